@@ -0,0 +1,307 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// appBundleOf returns the macOS .app bundle the executable at exe is in, or the empty string if it isn't in one
+func appBundleOf(exe string) string {
+	macOS := filepath.Dir(exe)
+	contents := filepath.Dir(macOS)
+	app := filepath.Dir(contents)
+	if filepath.Base(macOS) != "MacOS" || filepath.Base(contents) != "Contents" || filepath.Ext(app) != ".app" {
+		return ""
+	}
+	return app
+}
+
+// applyAppBundle install an update carrying a whole macOS .app bundle, in a zip, tar or dmg archive. As for
+// applyBundle, the archive is staged and verified as a whole, then the new bundle is extracted next to the one it
+// replaces, checked and swapped in by renaming the directories. The replaced bundle is kept as the hidden
+// directory .<name>.app.bak.
+func (o *Options) applyAppBundle(update io.Reader, verify bool) error {
+	if o.Patcher != nil || o.Device != "" || o.relocation() != "" || len(o.Files) > 0 {
+		return errors.New("an application bundle can't be applied as a patch, a device image, relocated or with other files")
+	}
+	app := filepath.Clean(o.AppBundle)
+	parent, name := filepath.Dir(app), filepath.Base(app)
+
+	archivePath := filepath.Join(parent, fmt.Sprintf(".%s.archive", name))
+	_ = os.Remove(archivePath)
+	fp, err := openFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	archive := &removeOnClose{File: fp}
+	defer archive.Close()
+
+	var checksum hash.Hash
+	var w io.Writer = fp
+	if o.Checksum != nil {
+		checksum = o.Hash.New()
+		w = io.MultiWriter(fp, checksum)
+	}
+	size, err := io.Copy(w, update)
+	if err != nil {
+		return err
+	}
+	if err = fp.Sync(); err != nil {
+		return err
+	}
+	if err = o.verifyStaged(archivePath, verify, checksum); err != nil {
+		return err
+	}
+
+	newApp := filepath.Join(parent, fmt.Sprintf(".%s.new", name))
+	_ = os.RemoveAll(newApp)
+	defer os.RemoveAll(newApp)
+	if o.Archive == "dmg" {
+		err = extractDMG(archivePath, newApp)
+	} else {
+		err = extractAppBundle(fp, size, o.Archive, newApp)
+	}
+	if err == nil {
+		err = checkAppBundleLinks(newApp)
+	}
+	if err != nil {
+		return err
+	}
+
+	exe := filepath.Join(newApp, "Contents", "MacOS", filepath.Base(o.TargetPath))
+	if fi, err := os.Stat(exe); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: Contents/MacOS/%s", ErrMemberNotFound, filepath.Base(o.TargetPath))
+	}
+	if o.CodesignVerifier != nil && runtime.GOOS == "darwin" {
+		if err = o.CodesignVerifier.Verify(newApp); err != nil {
+			return err
+		}
+	}
+	if o.BurnIn != nil {
+		if err = o.BurnIn(exe); err != nil {
+			return err
+		}
+	}
+	// once verified, Gatekeeper must not ask the user to confirm the first launch of the new version
+	clearQuarantine(newApp)
+
+	if err = swapAppBundle(newApp, app); err != nil {
+		return err
+	}
+	syncDir(parent)
+	return nil
+}
+
+// swapAppBundle replace the bundle directory app by newApp, keeping the replaced one as .<name>.app.bak, and put
+// it back if newApp can't be moved in
+func swapAppBundle(newApp string, app string) error {
+	backup := filepath.Join(filepath.Dir(app), fmt.Sprintf(".%s.bak", filepath.Base(app)))
+	_ = os.RemoveAll(backup)
+	if err := os.Rename(app, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(newApp, app); err != nil {
+		if rerr := os.Rename(backup, app); rerr != nil && !os.IsNotExist(rerr) {
+			return &rollbackErr{err, rerr}
+		}
+		return err
+	}
+	return nil
+}
+
+// extractAppBundle extract the first .app directory of the zip or tar archive f to dest, with its permissions and
+// symbolic links. Other entries, like the __MACOSX directory added by the Finder, are ignored.
+func extractAppBundle(f *os.File, size int64, format string, dest string) error {
+	root := ""
+	extract := func(name string, mode os.FileMode, link string, open func() (io.ReadCloser, error)) error {
+		// once clean, an entry can only be in the bundle if its path starts with it
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		parts := strings.SplitN(name, "/", 2)
+		if root == "" && strings.HasSuffix(parts[0], ".app") {
+			root = parts[0]
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+		}
+		if parts[0] != root || len(parts) == 1 {
+			return nil
+		}
+		return writeAppBundleEntry(dest, parts[1], mode, link, open)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	switch format {
+	case "tar":
+		tr := tar.NewReader(f)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error reading tar archive: %s", err)
+			}
+			mode := header.FileInfo().Mode()
+			if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeSymlink {
+				continue
+			}
+			err = extract(header.Name, mode, header.Linkname, func() (io.ReadCloser, error) { return io.NopCloser(tr), nil })
+			if err != nil {
+				return err
+			}
+		}
+	case "zip":
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return fmt.Errorf("error reading zip archive: %s", err)
+		}
+		for _, entry := range zr.File {
+			link := ""
+			if entry.Mode()&os.ModeSymlink != 0 {
+				r, err := entry.Open()
+				if err != nil {
+					return err
+				}
+				b, err := io.ReadAll(io.LimitReader(r, 4096))
+				r.Close()
+				if err != nil {
+					return err
+				}
+				link = string(b)
+			}
+			if err = extract(entry.Name, entry.Mode(), link, entry.Open); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	if root == "" {
+		return fmt.Errorf("%w: *.app", ErrMemberNotFound)
+	}
+	return nil
+}
+
+// writeAppBundleEntry create the file, directory or symbolic link at name, a clean path relative to the bundle
+// extracted to dest, refusing links pointing outside of it and entries inside a link extracted earlier
+func writeAppBundleEntry(dest string, name string, mode os.FileMode, link string, open func() (io.ReadCloser, error)) error {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if dir := path.Dir(name); dir != "." {
+		if resolved, err := resolveInBundle(dest, dir); err != nil || resolved != dir {
+			return fmt.Errorf("invalid bundle entry %q inside a symbolic link", name)
+		}
+	}
+
+	switch {
+	case mode.IsDir():
+		return os.MkdirAll(target, mode.Perm()|0700)
+	case mode&os.ModeSymlink != 0:
+		resolved := path.Join(path.Dir(name), link)
+		if path.IsAbs(link) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return fmt.Errorf("invalid link %q in bundle entry %q", link, name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case mode.IsRegular():
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		// never written through a link extracted earlier
+		fp, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(fp, r); err != nil {
+			fp.Close()
+			return err
+		}
+		if err = os.Chmod(target, mode.Perm()); err != nil {
+			fp.Close()
+			return err
+		}
+		return fp.Close()
+	}
+	return nil
+}
+
+// checkAppBundleLinks fails if a symbolic link of the bundle extracted to dest leads outside of it. Links are only
+// checked once all of them are extracted, as a link can go through others extracted after it.
+func checkAppBundleLinks(dest string) error {
+	return filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		name, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		if _, err = resolveInBundle(dest, filepath.ToSlash(name)); err != nil {
+			return fmt.Errorf("invalid link in bundle entry %q: %w", filepath.ToSlash(name), err)
+		}
+		return nil
+	})
+}
+
+// resolveInBundle returns the path name, relative to the bundle extracted to dest, leads to once the symbolic links
+// extracted there are followed, failing if it leads outside of the bundle. Missing entries are taken as they are.
+func resolveInBundle(dest string, name string) (string, error) {
+	resolved := ""
+	pending := strings.Split(name, "/")
+	for links := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "" {
+				return "", errors.New("leads outside of the bundle")
+			}
+			if resolved = path.Dir(resolved); resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(next)))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > 255 {
+			return "", errors.New("too many levels of symbolic links")
+		}
+		link, err := os.Readlink(filepath.Join(dest, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		link = filepath.ToSlash(link)
+		if path.IsAbs(link) || filepath.IsAbs(link) {
+			return "", fmt.Errorf("absolute link %q", link)
+		}
+		// the link is relative to the directory it is in, which is what was resolved so far
+		pending = append(strings.Split(link, "/"), pending...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,51 @@
+package selfupdate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// extractDMG copy the first .app bundle of the disk image at image to dest, mounting it without showing it in the
+// Finder
+func extractDMG(image string, dest string) error {
+	mount, err := os.MkdirTemp("", "selfupdate-dmg-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(mount)
+
+	out, err := exec.Command("hdiutil", "attach", "-nobrowse", "-readonly", "-noautoopen", "-mountpoint", mount, image).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error mounting disk image: %s", strings.TrimSpace(string(out)))
+	}
+	defer func() {
+		if out, err := exec.Command("hdiutil", "detach", mount, "-force").CombinedOutput(); err != nil {
+			logError("Unable to unmount disk image: %s\n", strings.TrimSpace(string(out)))
+		}
+	}()
+
+	entries, err := os.ReadDir(mount)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && filepath.Ext(e.Name()) == ".app" {
+			// ditto keeps the symbolic links, extended attributes and code signatures of the bundle
+			if out, err = exec.Command("ditto", filepath.Join(mount, e.Name()), dest).CombinedOutput(); err != nil {
+				return fmt.Errorf("error copying %s: %s", e.Name(), strings.TrimSpace(string(out)))
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: *.app", ErrMemberNotFound)
+}
+
+// clearQuarantine remove the quarantine attribute from every file of the bundle at app
+func clearQuarantine(app string) {
+	if out, err := exec.Command("xattr", "-dr", "com.apple.quarantine", app).CombinedOutput(); err != nil {
+		logDebug("Unable to clear the quarantine of %s: %s\n", app, strings.TrimSpace(string(out)))
+	}
+}
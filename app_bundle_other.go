@@ -0,0 +1,14 @@
+//go:build !darwin
+// +build !darwin
+
+package selfupdate
+
+import "fmt"
+
+// extractDMG is only supported on macOS, disk images can't be mounted elsewhere
+func extractDMG(_ string, _ string) error {
+	return fmt.Errorf("%w: disk images can only be installed on macOS", ErrNotSupported)
+}
+
+// clearQuarantine does nothing, there is no quarantine outside of macOS
+func clearQuarantine(_ string) {}
@@ -0,0 +1,112 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appTarball returns a tar archive of a .app bundle with a framework linked the way Xcode does
+func appTarball(t *testing.T, extra ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{Name: "MyApp.app/", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "MyApp.app/Contents/MacOS/myapp", Mode: 0755, Size: int64(len(newFile)), Typeflag: tar.TypeReg},
+		{Name: "MyApp.app/Contents/Info.plist", Mode: 0644, Size: 4, Typeflag: tar.TypeReg},
+		{Name: "MyApp.app/Contents/Frameworks/Lib.framework/Versions/A/", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "MyApp.app/Contents/Frameworks/Lib.framework/Versions/Current", Linkname: "A", Typeflag: tar.TypeSymlink},
+		{Name: "MyApp.app/Contents/Frameworks/Lib.framework/Resources", Linkname: "Versions/Current/Resources", Typeflag: tar.TypeSymlink},
+	}
+	for _, header := range append(headers, extra...) {
+		assert.Nil(t, w.WriteHeader(header))
+		switch header.Name {
+		case "MyApp.app/Contents/MacOS/myapp":
+			_, _ = w.Write(newFile)
+		case "MyApp.app/Contents/Info.plist":
+			_, _ = w.Write([]byte("plst"))
+		}
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestAppBundleOf(t *testing.T) {
+	assert.Equal(t, "/Applications/MyApp.app", appBundleOf("/Applications/MyApp.app/Contents/MacOS/myapp"))
+	assert.Equal(t, "", appBundleOf("/usr/local/bin/myapp"))
+	assert.Equal(t, "", appBundleOf("/Applications/MyApp/Contents/MacOS/myapp"))
+}
+
+func TestApplyAppBundle(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	archive := appTarball(t)
+
+	app := filepath.Join(t.TempDir(), "MyApp.app")
+	target := filepath.Join(app, "Contents", "MacOS", "myapp")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(target), 0755))
+	writeOldFile(target, t)
+	assert.Nil(t, os.WriteFile(filepath.Join(app, "Contents", "Resources"), []byte("old"), 0644))
+
+	opts := Options{TargetPath: target, AppBundle: app, Archive: "tar", PublicKey: pub, Signature: ed25519.Sign(priv, newFile)}
+	assert.NotNil(t, Apply(bytes.NewReader(archive), opts))
+	opts.Signature = ed25519.Sign(priv, archive)
+	validateUpdate(target, Apply(bytes.NewReader(archive), opts), t)
+
+	fi, err := os.Stat(target)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+	link, err := os.Readlink(filepath.Join(app, "Contents", "Frameworks", "Lib.framework", "Versions", "Current"))
+	assert.Nil(t, err)
+	assert.Equal(t, "A", link)
+	// files of the previous version are gone with its bundle, which is kept aside
+	_, err = os.Stat(filepath.Join(app, "Contents", "Resources"))
+	assert.True(t, os.IsNotExist(err))
+	old, err := os.ReadFile(filepath.Join(filepath.Dir(app), ".MyApp.app.bak", "Contents", "MacOS", "myapp"))
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, old)
+
+	entries, err := os.ReadDir(filepath.Dir(app))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestApplyAppBundleRejected(t *testing.T) {
+	app := filepath.Join(t.TempDir(), "MyApp.app")
+	target := filepath.Join(app, "Contents", "MacOS", "myapp")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(target), 0755))
+	writeOldFile(target, t)
+
+	for _, archive := range [][]byte{
+		appTarball(t, &tar.Header{Name: "MyApp.app/Contents/escape", Linkname: "../../..", Typeflag: tar.TypeSymlink}),
+		appTarball(t, &tar.Header{Name: "MyApp.app/Contents/passwd", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}),
+		// each link stays in the bundle on its own, chained they lead out of it
+		appTarball(t, &tar.Header{Name: "MyApp.app/Contents/up", Linkname: "b/../..", Typeflag: tar.TypeSymlink},
+			&tar.Header{Name: "MyApp.app/Contents/b", Linkname: ".", Typeflag: tar.TypeSymlink}),
+		appTarball(t, &tar.Header{Name: "MyApp.app/Contents/b", Linkname: ".", Typeflag: tar.TypeSymlink},
+			&tar.Header{Name: "MyApp.app/Contents/up", Linkname: "b/../..", Typeflag: tar.TypeSymlink}),
+		// nothing is written through a link
+		appTarball(t, &tar.Header{Name: "MyApp.app/Contents/lib", Linkname: "Frameworks", Typeflag: tar.TypeSymlink},
+			&tar.Header{Name: "MyApp.app/Contents/lib/planted", Mode: 0644, Typeflag: tar.TypeReg}),
+	} {
+		err := Apply(bytes.NewReader(archive), Options{TargetPath: target, AppBundle: app, Archive: "tar"})
+		assert.NotNil(t, err)
+		b, err := os.ReadFile(target)
+		assert.Nil(t, err)
+		assert.Equal(t, oldFile, b)
+	}
+
+	archive := zipped(t, map[string][]byte{"myapp": newFile})
+	err := Apply(bytes.NewReader(archive), Options{TargetPath: target, AppBundle: app, Archive: "zip"})
+	assert.True(t, errors.Is(err, ErrMemberNotFound))
+
+	entries, err := os.ReadDir(filepath.Dir(app))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+}
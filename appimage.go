@@ -0,0 +1,351 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/md4"
+)
+
+// appImagePath returns the AppImage the executable exe runs from, or the empty string if it doesn't run from one.
+// The AppImage runtime mounts the image read-only at APPDIR, and sets APPIMAGE to the path of the image, which is
+// what must be updated.
+func appImagePath(exe string) string {
+	image, dir := os.Getenv("APPIMAGE"), os.Getenv("APPDIR")
+	if runtime.GOOS != "linux" || image == "" || dir == "" || !filepath.IsAbs(image) {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(dir, exe)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	image, err = filepath.EvalSymlinks(image)
+	if err != nil {
+		return ""
+	}
+	if fi, err := os.Stat(image); err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+	return image
+}
+
+// AppImageUpdateInfo returns the update information embedded in the .upd_info section of the AppImage at path,
+// like "zsync|https://example.com/MyApp-x86_64.AppImage.zsync", or the empty string if there is none
+func AppImageUpdateInfo(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	section := f.Section(".upd_info")
+	if section == nil || section.Type == elf.SHT_NOBITS {
+		return "", nil
+	}
+	data, err := section.Data()
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// zsyncURL returns the URL of the zsync file named by the update information of an AppImage
+func zsyncURL(info string) (string, error) {
+	fields := strings.Split(info, "|")
+	switch {
+	case fields[0] == "zsync" && len(fields) == 2:
+		return fields[1], nil
+	case fields[0] == "gh-releases-zsync" && len(fields) == 5 && !strings.Contains(fields[4], "*"):
+		owner, repo, tag, file := url.PathEscape(fields[1]), url.PathEscape(fields[2]), fields[3], url.PathEscape(fields[4])
+		if tag == "latest" {
+			return fmt.Sprintf("https://github.com/%s/%s/releases/latest/download/%s", owner, repo, file), nil
+		}
+		return fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s", owner, repo, url.PathEscape(tag), file), nil
+	}
+	return "", fmt.Errorf("%w: unsupported AppImage update information %q", errNoBlockIndex, info)
+}
+
+// zsyncIndex is the content of a zsync file: the checksums of the blocks of the file it describes
+type zsyncIndex struct {
+	url         string // of the file described, resolved against the URL of the zsync file
+	blockSize   int64
+	length      int64
+	rsumBytes   int    // bytes of the weak checksum of each block kept in the file
+	strongBytes int    // bytes of the MD4 of each block kept in the file
+	sha1        string // hex encoded SHA-1 of the whole file
+	weak        []uint32
+	strong      []string
+}
+
+// maxZsyncBlockSize bounds the memory used to compare blocks
+const maxZsyncBlockSize = 1024 * 1024
+
+// parseZsync decode the zsync file data downloaded from base
+func parseZsync(data []byte, base string) (*zsyncIndex, error) {
+	idx := &zsyncIndex{}
+	r := bufio.NewReader(bytes.NewReader(data))
+	target := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("truncated zsync header")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid zsync header %q", line)
+		}
+		switch key {
+		case "Blocksize":
+			idx.blockSize, err = strconv.ParseInt(value, 10, 64)
+		case "Length":
+			idx.length, err = strconv.ParseInt(value, 10, 64)
+		case "Hash-Lengths":
+			var seq int
+			_, err = fmt.Sscanf(value, "%d,%d,%d", &seq, &idx.rsumBytes, &idx.strongBytes)
+		case "URL":
+			if target == "" {
+				target = value
+			}
+		case "SHA-1":
+			idx.sha1 = strings.ToLower(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid zsync header %q: %s", line, err)
+		}
+	}
+	if idx.blockSize <= 0 || idx.blockSize > maxZsyncBlockSize || idx.length < 0 || idx.rsumBytes < 1 || idx.rsumBytes > 4 || idx.strongBytes < 3 || idx.strongBytes > md4.Size {
+		return nil, errors.New("invalid zsync geometry")
+	}
+	if len(idx.sha1) != 2*sha1.Size || target == "" {
+		return nil, errors.New("zsync file without SHA-1 or URL")
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	idx.url = u.ResolveReference(ref).String()
+
+	n := (idx.length + idx.blockSize - 1) / idx.blockSize
+	sums, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entry := idx.rsumBytes + idx.strongBytes
+	if int64(len(sums)) != n*int64(entry) {
+		return nil, fmt.Errorf("zsync file of %d bytes must have %d blocks", idx.length, n)
+	}
+	for i := 0; i < len(sums); i += entry {
+		// the weak checksum is the last bytes of its two 16 bits halves, big-endian
+		var weak [4]byte
+		copy(weak[4-idx.rsumBytes:], sums[i:i+idx.rsumBytes])
+		idx.weak = append(idx.weak, binary.BigEndian.Uint32(weak[:]))
+		idx.strong = append(idx.strong, string(sums[i+idx.rsumBytes:i+entry]))
+	}
+	return idx, nil
+}
+
+// locate returns the offset in local, of length size, of every full block of the zsync file it contains
+func (idx *zsyncIndex) locate(local io.ReaderAt, size int64) (map[int]int64, error) {
+	candidates := map[uint32][]int{}
+	for i, w := range idx.weak {
+		if int64(i+1)*idx.blockSize <= idx.length {
+			candidates[w] = append(candidates[w], i)
+		}
+	}
+	mask := uint32(uint64(1)<<(8*idx.rsumBytes) - 1)
+	weak := func(r *rollingChecksum) uint32 {
+		return ((r.a&0xffff)<<16 | r.b&0xffff) & mask
+	}
+	h := md4.New()
+	strong := func(window []byte) string {
+		h.Reset()
+		h.Write(window)
+		return string(h.Sum(nil)[:idx.strongBytes])
+	}
+	want := func(i int) string { return idx.strong[i] }
+	return locateBlocks(local, size, idx.blockSize, candidates, weak, strong, want)
+}
+
+// fetchZsync rebuild the AppImage of newVer from the blocks of the AppImage at target it shares with it, and the
+// other blocks downloaded with conf.ZsyncClient from the file described by the zsync file named in the update
+// information embedded in target. The result is checked against the zsync file, it is verified like a download
+// by the caller.
+func (u *Updater) fetchZsync(ctx context.Context, conf *Config, newVer *Version, target string) (io.ReadCloser, int64, *Options, error) {
+	client := conf.ZsyncClient
+	if client == nil || conf.Device != "" || len(newVer.Files) > 0 {
+		return nil, 0, nil, errNoBlockIndex
+	}
+	if codec, archive, _ := payloadFormat(conf, newVer); codec != "" || archive != "" {
+		// the signatures and checksum of a compressed payload don't cover the AppImage rebuilt
+		return nil, 0, nil, errNoBlockIndex
+	}
+	var err error
+	if target == "" {
+		if target, err = ExecutableRealPath(); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+	info, err := AppImageUpdateInfo(target)
+	if err != nil || info == "" {
+		return nil, 0, nil, errNoBlockIndex
+	}
+	zsync, err := zsyncURL(info)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	dctx, cancel := withTimeout(ctx, conf.DownloadTimeout)
+	defer cancel()
+	data, err := getURL(dctx, client, zsync, 64*1024*1024)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	idx, err := parseZsync(data, zsync)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	local, err := os.Open(target)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer local.Close()
+	fi, err := local.Stat()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	found, err := idx.locate(local, fi.Size())
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(target), ".zsync-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	spool := &removeOnClose{File: f}
+	fail := func(err error) (io.ReadCloser, int64, *Options, error) {
+		spool.Close()
+		return nil, 0, nil, err
+	}
+
+	whole := sha1.New()
+	w := io.MultiWriter(spool, whole)
+	blocks := len(idx.weak)
+	downloaded := int64(0)
+	for i := 0; i < blocks; {
+		if offset, ok := found[i]; ok {
+			if _, err = io.Copy(w, io.NewSectionReader(local, offset, idx.blockSize)); err != nil {
+				return fail(err)
+			}
+			i++
+			continue
+		}
+
+		// download the following missing blocks at once
+		j := i
+		for ; j < blocks; j++ {
+			if _, ok := found[j]; ok {
+				break
+			}
+		}
+		start := int64(i) * idx.blockSize
+		length := int64(j) * idx.blockSize
+		if length > idx.length {
+			length = idx.length
+		}
+		length -= start
+		body, err := getRange(dctx, client, idx.url, start, length)
+		if err != nil {
+			return fail(err)
+		}
+		n, err := io.Copy(w, io.LimitReader(newContextReader(dctx, body), length))
+		body.Close()
+		if err == nil && n != length {
+			err = fmt.Errorf("received %d bytes of the %d requested at offset %d", n, length, start)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		downloaded += length
+		i = j
+	}
+	if hex.EncodeToString(whole.Sum(nil)) != idx.sha1 {
+		return fail(errors.New("AppImage rebuilt with zsync doesn't match the zsync file"))
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	opts, err := u.options(ctx, conf, newVer)
+	if err != nil {
+		return fail(err)
+	}
+	logInfo("Reused %d of %d blocks of the installed AppImage, downloaded %d of %d bytes.\n", len(found), blocks, downloaded, idx.length)
+	return spool, idx.length, opts, nil
+}
+
+// installZsync install newVer over the AppImage at target, or the running one if empty, rebuilt by fetchZsync.
+// The zsync file describes the release its URL points to, which might not be newVer: the update is then refused
+// by the verification and the caller downloads newVer.
+func (u *Updater) installZsync(ctx context.Context, conf *Config, newVer *Version, target string) error {
+	r, contentLength, opts, err := u.fetchZsync(ctx, conf, newVer, target)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var update io.Reader = r
+	if conf.ProgressCallback != nil {
+		update = &progressReader{Reader: r, progressCallback: conf.ProgressCallback, contentLength: contentLength}
+	}
+	opts.TargetPath = target
+	opts.staged = u.staged
+	u.executable, err = applyUpdate(update, opts)
+	return err
+}
+
+// getURL returns at most limit bytes of the content at url
+func getURL(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	if err = checkStatus(url, response, http.StatusOK); err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return io.ReadAll(io.LimitReader(response.Body, limit))
+}
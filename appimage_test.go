@@ -0,0 +1,198 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/md4"
+)
+
+// appImage returns a minimal ELF file embedding info in its .upd_info section, followed by payload
+func appImage(t *testing.T, info string, payload []byte) []byte {
+	names := []byte("\x00.upd_info\x00.shstrtab\x00")
+	updInfo := make([]byte, 1024)
+	copy(updInfo, info)
+
+	headerSize := int64(binary.Size(elf.Header64{}))
+	updOffset := headerSize
+	namesOffset := updOffset + int64(len(updInfo))
+	payloadOffset := namesOffset + int64(len(names))
+	sectionsOffset := (payloadOffset + int64(len(payload)) + 7) &^ 7
+
+	var buf bytes.Buffer
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(sectionsOffset),
+		Ehsize:    uint16(headerSize),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	assert.Nil(t, binary.Write(&buf, binary.LittleEndian, header))
+	buf.Write(updInfo)
+	buf.Write(names)
+	buf.Write(payload)
+	buf.Write(make([]byte, sectionsOffset-int64(buf.Len())))
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Off: uint64(updOffset), Size: uint64(len(updInfo)), Addralign: 1},
+		{Name: 11, Type: uint32(elf.SHT_STRTAB), Off: uint64(namesOffset), Size: uint64(len(names)), Addralign: 1},
+	}
+	assert.Nil(t, binary.Write(&buf, binary.LittleEndian, sections))
+	return buf.Bytes()
+}
+
+// zsyncFile returns the zsync file of data as zsyncmake writes it
+func zsyncFile(data []byte, blockSize int, rsumBytes int, strongBytes int, url string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "zsync: 0.6.2\nFilename: app.AppImage\nBlocksize: %d\nLength: %d\nHash-Lengths: 2,%d,%d\nURL: %s\nSHA-1: %x\n\n", blockSize, len(data), rsumBytes, strongBytes, url, sha1.Sum(data))
+	for i := 0; i < len(data); i += blockSize {
+		// the last block is padded with zeros
+		block := make([]byte, blockSize)
+		copy(block, data[i:])
+		r := newRollingChecksum(block)
+		var rsum [4]byte
+		binary.BigEndian.PutUint16(rsum[:], uint16(r.a))
+		binary.BigEndian.PutUint16(rsum[2:], uint16(r.b))
+		buf.Write(rsum[4-rsumBytes:])
+		h := md4.New()
+		h.Write(block)
+		buf.Write(h.Sum(nil)[:strongBytes])
+	}
+	return buf.Bytes()
+}
+
+// appImageSource is a Source signing image, it must not be downloaded
+type appImageSource struct {
+	image []byte
+	key   ed25519.PrivateKey
+}
+
+func (s *appImageSource) Get(*Version) (io.ReadCloser, int64, error) {
+	return nil, 0, errors.New("the AppImage must be rebuilt with zsync")
+}
+
+func (s *appImageSource) GetSignature() ([]byte, error) {
+	return ed25519.Sign(s.key, s.image), nil
+}
+
+func (s *appImageSource) LatestVersion() (*Version, error) {
+	return &Version{Number: "1.1.0"}, nil
+}
+
+func TestAppImagePath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("AppImages only run on Linux")
+	}
+	dir := t.TempDir()
+	image := filepath.Join(dir, "MyApp-x86_64.AppImage")
+	assert.Nil(t, os.WriteFile(image, []byte("image"), 0755))
+	mount := filepath.Join(dir, ".mount_MyApp")
+	assert.Nil(t, os.MkdirAll(filepath.Join(mount, "usr", "bin"), 0755))
+
+	t.Setenv("APPIMAGE", image)
+	t.Setenv("APPDIR", mount)
+	assert.Equal(t, image, appImagePath(filepath.Join(mount, "usr", "bin", "myapp")))
+	assert.Equal(t, "", appImagePath(filepath.Join(dir, "myapp")))
+
+	t.Setenv("APPIMAGE", "")
+	assert.Equal(t, "", appImagePath(filepath.Join(mount, "usr", "bin", "myapp")))
+}
+
+func TestZsyncURL(t *testing.T) {
+	u, err := zsyncURL("zsync|https://example.com/MyApp-x86_64.AppImage.zsync")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/MyApp-x86_64.AppImage.zsync", u)
+
+	u, err = zsyncURL("gh-releases-zsync|owner|repo|latest|MyApp-x86_64.AppImage.zsync")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://github.com/owner/repo/releases/latest/download/MyApp-x86_64.AppImage.zsync", u)
+
+	_, err = zsyncURL("gh-releases-zsync|owner|repo|latest|MyApp-*-x86_64.AppImage.zsync")
+	assert.True(t, errors.Is(err, errNoBlockIndex))
+	_, err = zsyncURL("bintray-zsync|owner|repo|app|file")
+	assert.True(t, errors.Is(err, errNoBlockIndex))
+}
+
+func TestAppImageUpdateInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MyApp.AppImage")
+	assert.Nil(t, os.WriteFile(path, appImage(t, "zsync|https://example.com/app.zsync", []byte("payload")), 0755))
+	info, err := AppImageUpdateInfo(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "zsync|https://example.com/app.zsync", info)
+
+	assert.Nil(t, os.WriteFile(path, []byte("not an ELF file"), 0755))
+	_, err = AppImageUpdateInfo(path)
+	assert.NotNil(t, err)
+}
+
+func TestInstallZsync(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	payload := make([]byte, 64*1024)
+	_, err = rand.Read(payload)
+	assert.Nil(t, err)
+	changed := append([]byte(nil), payload...)
+	copy(changed[30000:], "a few bytes changed in the middle of the new version")
+
+	var newImage []byte
+	var served int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app.AppImage.zsync", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zsyncFile(newImage, 2048, 3, 5, "app.AppImage"))
+	})
+	mux.HandleFunc("/app.AppImage", func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{ResponseWriter: w, n: &served}
+		http.ServeContent(cw, r, "app.AppImage", time.Time{}, bytes.NewReader(newImage))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	info := "zsync|" + server.URL + "/app.AppImage.zsync"
+	oldImage := appImage(t, info, payload)
+	newImage = appImage(t, info, changed)
+	target := filepath.Join(t.TempDir(), "MyApp-x86_64.AppImage")
+	assert.Nil(t, os.WriteFile(target, oldImage, 0755))
+
+	conf := &Config{Source: &appImageSource{image: newImage, key: priv}, PublicKey: pub, ZsyncClient: server.Client()}
+	u := &Updater{conf: conf}
+	assert.Nil(t, u.installZsync(context.Background(), conf, &Version{Number: "1.1.0"}, target))
+	b, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newImage, b)
+	assert.True(t, served < int64(len(newImage))/4, "downloaded %d bytes of %d", served, len(newImage))
+
+	// the zsync file describing another release than the one signed, the update is refused
+	assert.Nil(t, os.WriteFile(target, oldImage, 0755))
+	conf.Source = &appImageSource{image: oldImage, key: priv}
+	assert.NotNil(t, u.installZsync(context.Background(), conf, &Version{Number: "1.1.0"}, target))
+	b, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldImage, b)
+
+	conf.ZsyncClient = nil
+	assert.True(t, errors.Is(u.installZsync(context.Background(), conf, &Version{Number: "1.1.0"}, target), errNoBlockIndex))
+}
@@ -2,40 +2,54 @@ package selfupdate
 
 import (
 	"bytes"
+	"context"
 	"crypto"
-	"crypto/ed25519"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 )
 
 var openFile = os.OpenFile
 
+// ErrPendingReboot is returned by Apply on Windows when the executable is locked by another process and its
+// replacement was scheduled for the next reboot instead
+var ErrPendingReboot = errors.New("update pending until reboot")
+
 // Apply performs an update of the current executable (or opts.TargetFile, if set) with the contents of the given io.Reader.
 //
 // Apply performs the following actions to ensure a safe cross-platform update:
 //
-// 1. If configured, applies the contents of the update io.Reader as a binary patch.
+// 1. Creates a new file, /path/to/.target.new with the TargetMode and streams the contents of the update io.Reader
+// to it, applying it as a binary patch if configured.
+//
+// 2. If configured, verifies the checksum computed while writing the new executable matches.
 //
-// 2. If configured, computes the checksum of the new executable and verifies it matches.
+// 3. If configured, verifies the signature with a public key, reading the new executable back from disk. The file
+// is removed if any verification fails.
 //
-// 3. If configured, verifies the signature with a public key.
+// 4. Hard links /path/to/target to /path/to/.target.bak and renames /path/to/.target.new over /path/to/target, so
+// there is always an executable at /path/to/target.
 //
-// 4. Creates a new file, /path/to/.target.new with the TargetMode with the contents of the updated file
+// On Windows, the running executable can't be replaced but can be renamed, so:
 //
-// 5. Renames /path/to/target to /path/to/.target.old
+// 5. Renames /path/to/target to /path/to/.target.bak, a previous backup still in use by a running process is renamed
+// aside and deleted at the next reboot.
 //
-// 6. Renames /path/to/.target.new to /path/to/target
+// 6. Renames /path/to/.target.new to /path/to/target, and hides the backup.
 //
-// 7. If the final rename is successful, deletes /path/to/.target.old, returns no error. On Windows,
-// the removal of /path/to/target.old always fails, so instead Apply hides the old file instead.
+// 7. If the final rename fails, attempts to roll back by renaming /path/to/.target.bak back to /path/to/target.
 //
-// 8. If the final rename fails, attempts to roll back by renaming /path/to/.target.old
-// back to /path/to/target.
+// 8. If /path/to/target can't be renamed because another process opened it without sharing, the replacement is
+// scheduled for the next reboot and ErrPendingReboot is returned. This requires the rights to write
+// PendingFileRenameOperations, usually administrator.
 //
 // If the roll back operation fails, the file system is left in an inconsistent state (betweet steps 5 and 6) where
 // there is no new executable file and the old executable file could not be be moved to its original location. In this
@@ -47,28 +61,74 @@ func Apply(update io.Reader, opts Options) error {
 	return apply(update, &opts)
 }
 
+// ApplyContext is Apply, giving up with ctx.Err() if ctx is done before update is fully read. The target is then
+// left untouched.
+func ApplyContext(ctx context.Context, update io.Reader, opts Options) error {
+	r := newContextReader(ctx, io.NopCloser(update))
+	defer r.Close()
+	return apply(r, &opts)
+}
+
 func apply(update io.Reader, opts *Options) error {
 	// validate
 	verify := false
 	switch {
-	case opts.Signature != nil && opts.PublicKey != nil:
+	case opts.Signature != nil && (opts.PublicKey != nil || opts.Verifier != nil):
 		// okay
 		verify = true
 	case opts.Signature != nil:
 		return errors.New("no public key to verify signature with")
-	case opts.PublicKey != nil:
+	case opts.PublicKey != nil || opts.Verifier != nil:
 		return errors.New("no signature to verify with")
 	}
+	switch {
+	case opts.GPGVerifier != nil && opts.GPGSignature == nil:
+		return errors.New("no OpenPGP signature to verify with")
+	case opts.GPGVerifier == nil && opts.GPGSignature != nil:
+		return errors.New("no OpenPGP key ring to verify signature with")
+	}
+	switch {
+	case opts.MinisignVerifier != nil && opts.MinisignSignature == nil:
+		return errors.New("no minisign signature to verify with")
+	case opts.MinisignVerifier == nil && opts.MinisignSignature != nil:
+		return errors.New("no minisign public key to verify signature with")
+	}
+	switch {
+	case opts.CosignVerifier != nil && opts.CosignBundle == nil:
+		return errors.New("no cosign bundle to verify with")
+	case opts.CosignVerifier == nil && opts.CosignBundle != nil:
+		return errors.New("no cosign identity to verify bundle with")
+	}
+	switch {
+	case opts.AttestationVerifier != nil && opts.Attestation == nil:
+		return errors.New("no attestation to verify with")
+	case opts.AttestationVerifier == nil && opts.Attestation != nil:
+		return errors.New("no provenance policy to verify attestation with")
+	}
 
 	// set defaults
 	if opts.Hash == 0 {
 		opts.Hash = crypto.SHA256
 	}
-	if opts.Verifier == nil {
-		opts.Verifier = NewECDSAVerifier()
+	if verify && opts.Verifier == nil {
+		verifier, err := NewVerifier(opts.PublicKey, opts.Hash)
+		if err != nil {
+			return err
+		}
+		opts.Verifier = verifier
 	}
-	if opts.TargetMode == 0 {
-		opts.TargetMode = 0755
+	if v, ok := opts.Verifier.(*keyVerifier); ok && verify && opts.PublicKey != nil {
+		verifier, err := v.bind(opts.PublicKey, opts.Hash)
+		if err != nil {
+			return err
+		}
+		opts.Verifier = verifier
+	}
+	if opts.RenameTo != "" && filepath.Base(opts.RenameTo) != opts.RenameTo {
+		return fmt.Errorf("invalid executable name %q", opts.RenameTo)
+	}
+	if err := opts.checkRelocation(); err != nil {
+		return err
 	}
 
 	// get target path
@@ -77,105 +137,260 @@ func apply(update io.Reader, opts *Options) error {
 	if err != nil {
 		return err
 	}
+	if opts.TargetMode == 0 {
+		opts.TargetMode = targetMode(opts.TargetPath)
+	}
 
-	var newBytes []byte
-	if opts.Patcher != nil {
-		if newBytes, err = opts.applyPatch(update); err != nil {
+	if opts.Checksum != nil && !opts.Hash.Available() {
+		return errors.New("requested hash function not available")
+	}
+
+	// get the directory the executable exists in
+	updateDir := filepath.Dir(opts.TargetPath)
+	filename := filepath.Base(opts.TargetPath)
+
+	// get the directory where the new executable will be staged
+	stagingDir := updateDir
+	if opts.Staging != nil {
+		if stagingDir, err = opts.Staging.StagingDir(opts.TargetPath); err != nil {
 			return err
 		}
-	} else {
-		// no patch to apply, go on through
-		if newBytes, err = io.ReadAll(update); err != nil {
+	}
+
+	if opts.Codec != "" && runsCommand(opts.Codec) {
+		// the signature covers the compressed download, so that the command never reads unverified data
+		spool, err := opts.verifyCompressed(update, verify, stagingDir)
+		if err != nil {
 			return err
 		}
+		defer spool.Close()
+		update = spool
+		verify = false
 	}
-
-	// verify checksum if requested
-	if opts.Checksum != nil {
-		if err = opts.verifyChecksum(newBytes); err != nil {
+	if opts.Codec != "" {
+		rc, err := decompress(update, opts.Codec)
+		if err != nil {
 			return err
 		}
+		defer rc.Close()
+		update = rc
 	}
-
-	if verify {
-		if err = opts.verifySignature(newBytes); err != nil {
+	if opts.AppBundle != "" {
+		return opts.applyAppBundle(update, verify)
+	}
+	if len(opts.Files) > 0 {
+		return opts.applyBundle(update, verify, stagingDir)
+	}
+	var member io.ReadCloser
+	if opts.Archive != "" {
+		if member, err = extractMember(update, opts.Archive, opts.archiveMember(), stagingDir); err != nil {
 			return err
 		}
+		defer member.Close()
+		update = member
 	}
 
-	// get the directory the executable exists in
-	updateDir := filepath.Dir(opts.TargetPath)
-	filename := filepath.Base(opts.TargetPath)
-
-	// Copy the contents of newbinary to a new executable file
-	newPath := filepath.Join(updateDir, fmt.Sprintf(".%s.new", filename))
-	fp, err := openFile(newPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, opts.TargetMode)
+	// Stream the contents of newbinary to a new executable file, it is verified once complete so that it never
+	// has to be held in memory. It is in the directory of the executable by default, so that it can be renamed
+	// over it without crossing file systems.
+	newPath := filepath.Join(stagingDir, fmt.Sprintf(".%s.new", filename))
+	// a leftover of an interrupted update, or a link planted in a shared directory, is never written through
+	_ = os.Remove(newPath)
+	fp, err := openFile(newPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, opts.TargetMode)
+	if os.IsPermission(err) {
+		return fmt.Errorf("%w: %v", ErrNeedsElevation, err)
+	}
 	if err != nil {
 		return err
 	}
 	os.Chmod(newPath, opts.TargetMode)
 	defer fp.Close()
 
-	_, err = io.Copy(fp, bytes.NewReader(newBytes))
+	var checksum hash.Hash
+	var w io.Writer = fp
+	if opts.Checksum != nil {
+		checksum = opts.Hash.New()
+		w = io.MultiWriter(fp, checksum)
+	}
+	if opts.staged != nil {
+		opts.staged.Reset()
+		w = io.MultiWriter(w, opts.staged)
+	}
+	if opts.Patcher != nil {
+		err = opts.applyPatch(update, w)
+	} else {
+		// no patch to apply, go on through
+		_, err = io.Copy(w, update)
+	}
+	if member != nil && err == nil {
+		// the rest of a tar archive is read on close, failing if the download it comes from doesn't check out
+		err = member.Close()
+	}
 	if err != nil {
+		fp.Close()
+		_ = os.Remove(newPath)
+		return err
+	}
+	// the content must be on disk before the rename makes it the executable, or a power loss could leave an
+	// empty file in its place
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		_ = os.Remove(newPath)
 		return err
 	}
-	//don't call fp.Sync().system power off ,file will lost
-	fp.Sync()
 	// if we don't call fp.Close(), windows won't let us move the new executable
 	// because the file will still be "in use"
 	fp.Close()
 
-	// this is where we'll move the executable to so that we can swap in the updated replacement
-	oldPath := opts.OldSavePath
-	removeOld := opts.OldSavePath == ""
-	if removeOld {
-		oldPath = filepath.Join(updateDir, fmt.Sprintf(".%s.old", filename))
+	if err = opts.verifyStaged(newPath, verify, checksum); err != nil {
+		_ = os.Remove(newPath)
+		return err
 	}
 
-	// delete any existing old exec file - this is necessary on Windows for two reasons:
-	// 1. after a successful update, Windows can't remove the .old file because the process is still running
-	// 2. windows rename operations fail if the destination file already exists
-	_ = os.Remove(oldPath)
+	if opts.AuthenticodeVerifier != nil && runtime.GOOS == "windows" {
+		if err = opts.AuthenticodeVerifier.Verify(newPath); err != nil {
+			_ = os.Remove(newPath)
+			return err
+		}
+	}
+
+	if opts.CodesignVerifier != nil && runtime.GOOS == "darwin" {
+		if err = opts.CodesignVerifier.Verify(newPath); err != nil {
+			_ = os.Remove(newPath)
+			return err
+		}
+	}
 
-	// move the existing executable to a new file in the same directory
-	err = os.Rename(opts.TargetPath, oldPath)
+	if opts.BurnIn != nil {
+		if err = opts.BurnIn(newPath); err != nil {
+			_ = os.Remove(newPath)
+			return err
+		}
+	}
+
+	if opts.Device != "" {
+		err = writeDeviceImage(newPath, opts.Device)
+		_ = os.Remove(newPath)
+		return err
+	}
+
+	preserveAttributes(opts.TargetPath, newPath, opts.TargetMode)
+
+	if runtime.GOOS == "windows" {
+		if err = markOfTheWeb(newPath, opts.MarkOfTheWeb); err != nil {
+			_ = os.Remove(newPath)
+			return err
+		}
+	}
+
+	// this is where the executable being replaced is kept, so that it can be restored
+	backup := opts.OldSavePath
+	if backup == "" {
+		backup = backupPath(opts.TargetPath)
+	}
+	if _, serr := os.Stat(opts.TargetPath); opts.createTarget && os.IsNotExist(serr) {
+		err = moveFile(newPath, opts.TargetPath, opts.TargetMode)
+	} else {
+		err = swapExecutable(newPath, opts.TargetPath, backup, opts.TargetMode)
+	}
 	if err != nil {
+		if !errors.Is(err, ErrPendingReboot) {
+			_ = os.Remove(newPath)
+		}
 		return err
 	}
 
-	// move the new exectuable in to become the new program
-	err = os.Rename(newPath, opts.TargetPath)
+	// make the rename durable
+	syncDir(updateDir)
+	if opts.OldSavePath == "" {
+		_ = hideFile(backup)
+	}
+
+	if dest := opts.relocation(); dest != "" && dest != opts.TargetPath {
+		relocateInstalled(opts, dest)
+	}
+
+	return nil
+}
+
+// backupPath returns where the executable replaced at target is kept by default
+func backupPath(target string) string {
+	return filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.bak", filepath.Base(target)))
+}
+
+// swapExecutable replace target with the staged executable newPath, keeping the executable replaced at backup.
+// Where a file can be renamed over another, target is hard linked to backup and newPath renamed over it, so
+// there is always a working executable at target: if any step fails target is untouched. On Windows, the running
+// executable can't be replaced but can be renamed, it is moved to backup first and moved back if newPath can't
+// take its place. If target is locked, its replacement is scheduled for the next reboot and ErrPendingReboot returned.
+func swapExecutable(newPath, target, backup string, mode os.FileMode) error {
+	if runtime.GOOS != "windows" {
+		if err := linkBackup(target, backup); err != nil {
+			return err
+		}
+		return moveFile(newPath, target, mode)
+	}
 
+	// a leftover backup must go first, windows rename operations fail if the destination file already exists
+	if err := retryLocked(func() error { return os.Remove(backup) }); err != nil && !os.IsNotExist(err) {
+		// the previous backup is still running, it can be renamed but not deleted until it exits
+		stale := fmt.Sprintf("%s.%d", backup, time.Now().UnixNano())
+		if os.Rename(backup, stale) == nil {
+			_ = hideFile(stale)
+			_ = moveFileAtReboot(stale, "")
+		}
+	}
+	if err := retryLocked(func() error { return os.Rename(target, backup) }); err != nil {
+		if !isFileLocked(err) {
+			return err
+		}
+		// another process opened target without sharing it, it can only be replaced while nothing runs
+		if rerr := moveFileAtReboot(newPath, target); rerr != nil {
+			return err
+		}
+		logInfo("%s is in use, it will be updated at the next reboot.\n", target)
+		return fmt.Errorf("%w: %s", ErrPendingReboot, target)
+	}
+	err := retryLocked(func() error { return moveFile(newPath, target, mode) })
 	if err != nil {
-		// move unsuccessful
-		//
-		// The filesystem is now in a bad state. We have successfully
-		// moved the existing binary to a new location, but we couldn't move the new
-		// binary to take its place. That means there is no file where the current executable binary
-		// used to be!
-		// Try to rollback by restoring the old binary to its original path.
-		rerr := os.Rename(oldPath, opts.TargetPath)
+		// there is no executable at target anymore, restore the one replaced
+		rerr := retryLocked(func() error { return os.Rename(backup, target) })
 		if rerr != nil {
 			return &rollbackErr{err, rerr}
 		}
-
 		return err
 	}
+	return nil
+}
 
-	// move successful, remove the old binary if needed
-	if removeOld {
-		errRemove := os.Remove(oldPath)
-
-		// windows has trouble with removing old binaries, so hide it instead
-		if errRemove != nil {
-			_ = hideFile(oldPath)
+// linkBackup keep the file at target at backup too, hard linked or copied, without moving target away
+func linkBackup(target, backup string) error {
+	_ = os.Remove(backup)
+	if err := os.Link(target, backup); err != nil {
+		// file systems without hard links get a copy
+		fi, serr := os.Stat(target)
+		if serr != nil {
+			return serr
+		}
+		if err = copyFile(target, backup, fi.Mode().Perm()); err != nil {
+			_ = os.Remove(backup)
+			return fmt.Errorf("error backing up %s: %w", target, err)
 		}
 	}
-
 	return nil
 }
 
+// syncDir flush the entries of dir to disk, so that a rename in it survives a power loss. Not all systems allow
+// it, Windows doesn't need it, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
+
 // RollbackError takes an error value returned by Apply and returns the error, if any,
 // that occurred when attempting to roll back from a failed update. Applications should
 // always call this function on any non-nil errors returned by Apply.
@@ -203,19 +418,22 @@ type Options struct {
 	// The empty string means 'the executable file of the running program'.
 	TargetPath string
 
-	// Create TargetPath replacement with this file mode. If zero, defaults to 0755.
+	// Create TargetPath replacement with this file mode. If zero, defaults to the mode of TargetPath, setuid and
+	// setgid bits included, or 0755 if it doesn't exist. The owner, when running as root, and the extended
+	// attributes of TargetPath, like its SELinux context, are carried over as well.
 	TargetMode os.FileMode
 
 	// Checksum of the new binary to verify against. If nil, no checksum or signature verification is done.
 	Checksum []byte
 
-	// Public key to use for signature verification. If nil, no signature verification is done.
+	// Public key to use for signature verification when Verifier is nil. It can be an ed25519.PublicKey,
+	// a *rsa.PublicKey or a *ecdsa.PublicKey. If nil and Verifier is nil, no signature verification is done.
 	PublicKey crypto.PublicKey
 
 	// Signature to verify the updated file. If nil, no signature verification is done.
 	Signature []byte
 
-	// Pluggable signature verification algorithm. If nil, ECDSA is used.
+	// Pluggable signature verification. If nil, it is chosen from the type of PublicKey.
 	Verifier Verifier
 
 	// Use this hash function to generate the checksum. If not set, SHA256 is used.
@@ -225,9 +443,119 @@ type Options struct {
 	// If non-nil, treat the update contents as a patch and use this object to apply the patch.
 	Patcher Patcher
 
+	// Name of the registered Codec the update, or the patch if Patcher is set, is compressed with.
+	// The empty string means it isn't compressed. The zstd, xz and brotli codecs run an external command, so the
+	// Signature of updates compressed with them must cover the compressed bytes, it is checked before decompressing.
+	Codec string
+
+	// Format of the archive, "zip", "tar" or, with AppBundle, "dmg", the update is extracted from once decompressed with Codec.
+	// The empty string means the update isn't an archive.
+	Archive string
+
+	// path.Match pattern selecting the file of the archive to install, compared to the whole path of each entry
+	// and to its base name. The empty string means the base name of RenameTo, or of TargetPath.
+	ArchiveMember string
+
+	// Other files of the archive to install with the executable. If not empty, the update is a bundle: signatures
+	// and Checksum cover the whole archive once decompressed, and every file is replaced, or none is.
+	Files []BundleFile
+
+	// If not empty, the macOS .app bundle TargetPath is in. The update is then an archive, including "dmg" disk
+	// images, holding a whole new bundle that replaces this directory once verified.
+	AppBundle string
+
 	// Store the old executable file at this path after a successful update.
-	// The empty string means the old executable file will be removed after the update.
+	// The empty string means it is kept as the hidden file .<name>.bak next to TargetPath.
 	OldSavePath string
+
+	// Detached OpenPGP signature to verify the updated file with GPGVerifier. If nil, no OpenPGP verification is done.
+	GPGSignature []byte
+
+	// Key ring used to verify GPGSignature.
+	GPGVerifier *GPGVerifier
+
+	// minisign or signify signature to verify the updated file with MinisignVerifier. If nil, no minisign verification is done.
+	MinisignSignature []byte
+
+	// Public keys used to verify MinisignSignature.
+	MinisignVerifier *MinisignVerifier
+
+	// cosign bundle to verify the updated file with CosignVerifier. If nil, no cosign verification is done.
+	CosignBundle []byte
+
+	// Trusted roots and identity used to verify CosignBundle.
+	CosignVerifier *CosignVerifier
+
+	// in-toto attestation carrying the SLSA provenance of the updated file. If nil, no provenance verification is done.
+	Attestation []byte
+
+	// Trusted keys and provenance policy used to verify Attestation.
+	AttestationVerifier *AttestationVerifier
+
+	// If not empty, the updated file is renamed to this name in the TargetPath directory once the update
+	// is done, and a symlink is left at TargetPath. TargetPath is then set to the new path.
+	RenameTo string
+
+	// If not empty, the updated file is moved to this path once the update is done, for example to switch
+	// to a versioned directory layout. It must be a relative path, resolved against InstallRoot, which it
+	// can't leave. A symlink to the new location is left at LinkPath and TargetPath is then set to the new
+	// path. Takes precedence over RenameTo.
+	RelocateTo string
+
+	// Directory RelocateTo is relative to. The empty string means the directory of TargetPath.
+	InstallRoot string
+
+	// Path of the symlink pointing to the relocated file, an existing symlink is replaced.
+	// The empty string means TargetPath.
+	LinkPath string
+
+	// Define where the new executable is written before replacing TargetPath.
+	// If nil, it is staged in the same directory as TargetPath.
+	Staging StagingStrategy
+
+	// If not nil, called with the path of the complete staged executable before it replaces TargetPath.
+	// A non nil error abort the update and the staged executable is removed.
+	BurnIn func(staged string) error
+
+	// If not nil, the staged executable must carry a valid Authenticode signature accepted by this verifier
+	// before it replaces TargetPath. Only checked on Windows.
+	AuthenticodeVerifier *AuthenticodeVerifier
+
+	// If not nil, the staged executable must be code signed, and possibly notarized, as required by this
+	// verifier before it replaces TargetPath. Only checked on macOS.
+	CodesignVerifier *CodesignVerifier
+
+	// Content of the Zone.Identifier alternate data stream, the Mark-of-the-Web, set on the updated file on Windows,
+	// like "[ZoneTransfer]\r\nZoneId=3\r\n". The empty string means it is removed so that the updated
+	// executable, whose integrity is already verified, isn't blocked by SmartScreen on first launch.
+	MarkOfTheWeb string
+
+	// If not empty, the verified update is an image written to this raw device, like the MTD partition
+	// /dev/mtd3 or a block device, instead of replacing TargetPath. Bad blocks of NAND flash are skipped and
+	// everything written is read back to be verified. A patch is still applied to the content of TargetPath.
+	// Only supported on Linux when built with the selfupdate_mtd tag, ErrNotSupported is returned otherwise.
+	Device string
+
+	// if not nil, a SHA-256 reset then fed with everything written to the staged executable, whose signature must be
+	// verified over the same content, so that the digest can be trusted after the staged file is verified
+	staged hash.Hash
+
+	// if true, TargetPath doesn't have to exist: the update is then moved there, with nothing to back up
+	createTarget bool
+}
+
+// errStagedChanged is returned when the staged executable doesn't have the content written to it anymore
+var errStagedChanged = errors.New("staged update changed since it was written")
+
+// archiveMember returns the pattern selecting the file to install in an archive
+func (o *Options) archiveMember() string {
+	if o.ArchiveMember != "" {
+		return o.ArchiveMember
+	}
+	if o.RenameTo != "" {
+		return o.RenameTo
+	}
+	return filepath.Base(o.TargetPath)
 }
 
 // CheckPermissions determines whether the process has the correct permissions to
@@ -279,55 +607,106 @@ func (o *Options) getPath() (string, error) {
 	return o.TargetPath, nil
 }
 
-func (o *Options) applyPatch(patch io.Reader) ([]byte, error) {
+func (o *Options) applyPatch(patch io.Reader, w io.Writer) error {
 	// open the file to patch
 	old, err := os.Open(o.TargetPath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer old.Close()
 
 	// apply the patch
-	var applied bytes.Buffer
-	if err = o.Patcher.Patch(old, &applied, patch); err != nil {
-		return nil, err
+	return o.Patcher.Patch(old, w, patch)
+}
+
+// verifyStaged check the complete staged update at path against the checksum computed while it was written and
+// every configured signature. Verifiers read it back from disk, so only those needing the whole message at once,
+// like ed25519 signatures of the whole update, hold it in memory.
+// verifyCompressed spool update in dir and check its signature, before it is decompressed by a codec running an
+// external command
+func (o *Options) verifyCompressed(update io.Reader, verify bool, dir string) (io.ReadCloser, error) {
+	switch {
+	case !verify:
+		return nil, fmt.Errorf("the %s codec runs an external command, it only decompresses signed updates", o.Codec)
+	case o.Patcher != nil:
+		return nil, fmt.Errorf("the %s codec runs an external command, it can't decompress patches", o.Codec)
 	}
 
-	return applied.Bytes(), nil
+	f, err := os.CreateTemp(dir, ".compressed-*")
+	if err != nil {
+		return nil, err
+	}
+	spool := &removeOnClose{File: f}
+	if _, err = io.Copy(spool, update); err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = o.Verifier.VerifySignature(spool, o.Signature)
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+	return spool, nil
 }
 
-func (o *Options) verifyChecksum(updated []byte) error {
-	checksum, err := checksumFor(o.Hash, updated)
-	if err != nil {
-		return err
+func (o *Options) verifyStaged(path string, verify bool, checksum hash.Hash) error {
+	if checksum != nil {
+		if sum := checksum.Sum(nil); !bytes.Equal(o.Checksum, sum) {
+			return fmt.Errorf("updated file has wrong checksum. Expected: %x, got: %x", o.Checksum, sum)
+		}
 	}
 
-	if !bytes.Equal(o.Checksum, checksum) {
-		return fmt.Errorf("updated file has wrong checksum. Expected: %x, got: %x", o.Checksum, checksum)
+	if verify {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var payload io.Reader = f
+		var read hash.Hash
+		if o.staged != nil {
+			read = sha256.New()
+			payload = io.TeeReader(f, read)
+		}
+		err = o.Verifier.VerifySignature(payload, o.Signature)
+		if err == nil && o.staged != nil {
+			// what the verifier didn't read is still part of the staged file
+			_, err = io.Copy(read, f)
+			if err == nil && !bytes.Equal(read.Sum(nil), o.staged.Sum(nil)) {
+				err = errStagedChanged
+			}
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
 	}
-	return nil
-}
 
-func (o *Options) verifySignature(updated []byte) error {
-	if publicKey, ok := o.PublicKey.(ed25519.PublicKey); ok {
-		valid := ed25519.Verify(publicKey, updated, o.Signature)
-		if !valid {
-			return errors.New("invalid ed25519 signature")
+	if o.GPGVerifier != nil {
+		if err := o.GPGVerifier.verifyFile(path, o.GPGSignature); err != nil {
+			return err
 		}
-		return nil
 	}
-	checksum, err := checksumFor(o.Hash, updated)
-	if err != nil {
-		return err
+
+	if o.MinisignVerifier != nil {
+		if err := o.MinisignVerifier.verifyFile(path, o.MinisignSignature); err != nil {
+			return err
+		}
 	}
-	return o.Verifier.VerifySignature(checksum, o.Signature, o.Hash, o.PublicKey)
-}
 
-func checksumFor(h crypto.Hash, payload []byte) ([]byte, error) {
-	if !h.Available() {
-		return nil, errors.New("requested hash function not available")
+	if o.CosignVerifier != nil {
+		if err := o.CosignVerifier.verifyFile(path, o.CosignBundle); err != nil {
+			return err
+		}
 	}
-	hash := h.New()
-	hash.Write(payload) // guaranteed not to error
-	return hash.Sum([]byte{}), nil
+
+	if o.AttestationVerifier != nil {
+		if err := o.AttestationVerifier.verifyFile(path, o.Attestation); err != nil {
+			return err
+		}
+	}
+	return nil
 }
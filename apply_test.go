@@ -5,11 +5,16 @@ import (
 	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/Lamdt03/selfupdate/internal/binarydist"
@@ -24,6 +29,7 @@ var (
 func cleanup(path string) {
 	os.Remove(path)
 	os.Remove(fmt.Sprintf(".%s.new", path))
+	os.Remove(fmt.Sprintf(".%s.bak", path))
 }
 
 // we write with a separate name for each test so that we can run them in parallel
@@ -79,6 +85,28 @@ func TestApplyOldSavePath(t *testing.T) {
 	cleanup(oldfName)
 }
 
+func TestApplyKeepsBackup(t *testing.T) {
+	fName := "TestApplyKeepsBackup"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	err := Apply(bytes.NewReader(newFile), Options{
+		TargetPath: fName,
+	})
+	validateUpdate(fName, err, t)
+
+	buf, err := os.ReadFile(fmt.Sprintf(".%s.bak", fName))
+	if err != nil {
+		t.Fatalf("Failed to read the backup: %v", err)
+	}
+	if !bytes.Equal(buf, oldFile) {
+		t.Fatalf("Backup is not the old file! Bytes read: %v, Bytes expected: %v", buf, oldFile)
+	}
+	if _, err := os.Stat(fmt.Sprintf(".%s.new", fName)); !os.IsNotExist(err) {
+		t.Fatalf("Staged file was left behind: %v", err)
+	}
+}
+
 func TestVerifyChecksum(t *testing.T) {
 	fName := "TestVerifyChecksum"
 	defer cleanup(fName)
@@ -300,6 +328,24 @@ func TestVerifyRSASignature(t *testing.T) {
 	defer cleanup(fName)
 	writeOldFile(fName, t)
 
+	opts := Options{TargetPath: fName}
+	err := opts.SetPublicKeyPEM([]byte(rsaPublicKey))
+	if err != nil {
+		t.Fatalf("Could not parse public key: %v", err)
+	}
+	opts.Verifier = NewRSAKeyVerifier(opts.PublicKey.(*rsa.PublicKey), crypto.SHA256)
+
+	opts.Signature = signrsa(rsaPrivateKey, newFile, t)
+	err = Apply(bytes.NewReader(newFile), opts)
+	validateUpdate(fName, err, t)
+}
+
+func TestVerifyKeylessVerifier(t *testing.T) {
+	fName := "TestVerifyKeylessVerifier"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	// the Verifiers which don't hold the key verify with the public key of Options
 	opts := Options{
 		TargetPath: fName,
 		Verifier:   NewRSAVerifier(),
@@ -308,10 +354,24 @@ func TestVerifyRSASignature(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Could not parse public key: %v", err)
 	}
-
 	opts.Signature = signrsa(rsaPrivateKey, newFile, t)
 	err = Apply(bytes.NewReader(newFile), opts)
 	validateUpdate(fName, err, t)
+
+	writeOldFile(fName, t)
+	opts.Verifier = NewECDSAVerifier()
+	err = Apply(bytes.NewReader(newFile), opts)
+	if err == nil {
+		t.Fatalf("ECDSA verifier accepted an RSA public key")
+	}
+
+	err = opts.SetPublicKeyPEM([]byte(ecdsaPublicKey))
+	if err != nil {
+		t.Fatalf("Could not parse public key: %v", err)
+	}
+	opts.Signature = signec(ecdsaPrivateKey, newFile, t)
+	err = Apply(bytes.NewReader(newFile), opts)
+	validateUpdate(fName, err, t)
 }
 
 func TestVerifyEd25519Signature(t *testing.T) {
@@ -330,6 +390,29 @@ func TestVerifyEd25519Signature(t *testing.T) {
 	validateUpdate(fName, err, t)
 }
 
+func TestVerifyCustomVerifier(t *testing.T) {
+	fName := "TestVerifyCustomVerifier"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	var verified []byte
+	opts := Options{
+		TargetPath: fName,
+		Signature:  []byte("signed by the HSM"),
+		Verifier: verifyFn(func(payload io.Reader, signature []byte) error {
+			var err error
+			verified, err = io.ReadAll(payload)
+			return err
+		}),
+	}
+
+	err := Apply(bytes.NewReader(newFile), opts)
+	validateUpdate(fName, err, t)
+	if !bytes.Equal(verified, newFile) {
+		t.Fatalf("Verifier was not given the update")
+	}
+}
+
 func TestVerifyFailBadSignature(t *testing.T) {
 	fName := "TestVerifyFailBadSignature"
 	defer cleanup(fName)
@@ -489,3 +572,134 @@ func TestWriteError(t *testing.T) {
 		t.Fatalf("Allowed an update to an empty file")
 	}
 }
+
+func TestApplyRenameTo(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "myapp")
+	writeOldFile(fName, t)
+
+	opts := Options{TargetPath: fName, RenameTo: "MyApp"}
+	err := apply(bytes.NewReader(newFile), &opts)
+	validateUpdate(filepath.Join(dir, "MyApp"), err, t)
+
+	if opts.TargetPath != filepath.Join(dir, "MyApp") {
+		t.Fatalf("TargetPath was not updated: %s", opts.TargetPath)
+	}
+	if runtime.GOOS != "windows" {
+		validateUpdate(fName, nil, t)
+	}
+}
+
+func TestApplyRenameToInvalid(t *testing.T) {
+	fName := "TestApplyRenameToInvalid"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	err := Apply(bytes.NewReader(newFile), Options{TargetPath: fName, RenameTo: "../escape"})
+	if err == nil {
+		t.Fatalf("Allowed renaming the executable outside of its directory")
+	}
+}
+
+func TestApplyVerifiesStagedFile(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "myapp")
+	writeOldFile(fName, t)
+	staged := filepath.Join(dir, ".myapp.new")
+
+	// the verifier is given the staged file, not a copy of the update in memory
+	opts := Options{
+		TargetPath: fName,
+		Signature:  []byte("signed by the HSM"),
+		Verifier: verifyFn(func(payload io.Reader, signature []byte) error {
+			f, ok := payload.(*os.File)
+			if !ok || f.Name() != staged {
+				return fmt.Errorf("verifier was given %T instead of the staged file", payload)
+			}
+			return nil
+		}),
+	}
+	err := Apply(bytes.NewReader(newFile), opts)
+	validateUpdate(fName, err, t)
+
+	// a rejected update doesn't leave the staged file behind
+	writeOldFile(fName, t)
+	opts.Verifier = verifyFn(func(io.Reader, []byte) error { return fmt.Errorf("rejected") })
+	if err = Apply(bytes.NewReader(newFile), opts); err == nil {
+		t.Fatalf("Allowed an update rejected by the verifier")
+	}
+	if _, err = os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("Staged file was not removed: %v", err)
+	}
+
+	err = Apply(bytes.NewReader(newFile), Options{TargetPath: fName, Checksum: []byte{0x0A}})
+	if err == nil {
+		t.Fatalf("Failed to detect bad checksum!")
+	}
+	if _, err = os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("Staged file was not removed: %v", err)
+	}
+}
+
+func TestApplyStagedDigest(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "myapp")
+	writeOldFile(fName, t)
+	staged := filepath.Join(dir, ".myapp.new")
+
+	digest := sha256.New()
+	opts := &Options{
+		TargetPath: fName,
+		Signature:  []byte("signed"),
+		Verifier:   verifyFn(func(payload io.Reader, signature []byte) error { return nil }),
+		staged:     digest,
+	}
+	err := apply(bytes.NewReader(newFile), opts)
+	validateUpdate(fName, err, t)
+	if sum := sha256.Sum256(newFile); !bytes.Equal(sum[:], digest.Sum(nil)) {
+		t.Fatalf("Digest of the staged file is %x instead of %x", digest.Sum(nil), sum)
+	}
+
+	// the staged file is replaced by other signed content before it is verified
+	writeOldFile(fName, t)
+	opts.Verifier = verifyFn(func(payload io.Reader, signature []byte) error {
+		if err := os.WriteFile(staged, oldFile, 0755); err != nil {
+			return err
+		}
+		_, err := io.ReadAll(payload)
+		return err
+	})
+	if err = apply(bytes.NewReader(newFile), opts); !errors.Is(err, errStagedChanged) {
+		t.Fatalf("Allowed a staged file changed before verification: %v", err)
+	}
+	if _, err = os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("Staged file was not removed: %v", err)
+	}
+}
+
+func TestApplyStagedLeftover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "myapp")
+	victim := filepath.Join(dir, "victim")
+	writeOldFile(target, t)
+	writeOldFile(victim, t)
+
+	// a link left where the update is staged must not be written through
+	if err := os.Symlink(victim, filepath.Join(dir, ".myapp.new")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := apply(bytes.NewReader(newFile), &Options{TargetPath: target})
+	validateUpdate(target, err, t)
+
+	buf, err := os.ReadFile(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, oldFile) {
+		t.Fatalf("staged link was written through")
+	}
+}
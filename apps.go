@@ -0,0 +1,24 @@
+package selfupdate
+
+// forApp returns the entries of a manifest shared by several applications that describe app, keyed by their
+// "name". Entries without a name are for every application, and every entry is kept if app is empty.
+func forApp(appVersions []appVersion, app string) []appVersion {
+	if app == "" {
+		return appVersions
+	}
+	selected := make([]appVersion, 0, len(appVersions))
+	for _, a := range appVersions {
+		if a.Name == "" || a.Name == app {
+			selected = append(selected, a)
+		}
+	}
+	return selected
+}
+
+// SetApp make the source only consider the entries of the manifest whose "name" is app, so that a single feed can
+// describe all the applications of an organization. The empty string consider every entry.
+func (h *HTTPSource) SetApp(app string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.selector.app = app
+}
@@ -0,0 +1,44 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceApp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"name":"cli","os":%[1]q,"version":"3.0.0"},
+			{"name":"agent","os":%[1]q,"version":"1.5.0","yanked":true},
+			{"name":"agent","os":%[1]q,"version":"1.4.0"},
+			{"name":"cli","os":%[1]q,"version":"1.5.0"}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.0.0", v.Number)
+
+	source.SetApp("agent")
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.4.0", v.Number)
+	assert.True(t, source.IsYanked("1.5.0"))
+
+	source.SetApp("cli")
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.0.0", v.Number)
+	assert.False(t, source.IsYanked("1.5.0"))
+
+	source.SetApp("other")
+	_, err = source.LatestVersion()
+	assert.NotNil(t, err)
+}
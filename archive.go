@@ -0,0 +1,172 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrMemberNotFound is returned when an archive doesn't contain the executable to install
+var ErrMemberNotFound = errors.New("executable not found in archive")
+
+// archiveFromURL returns the format of the archive a download is, "zip" or "tar", guessed from the extension of its
+// URL once the extension of a compression codec is removed, or the empty string if it doesn't look like an archive
+func archiveFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := strings.ToLower(u.Path)
+	if strings.HasSuffix(name, ".tgz") {
+		return "tar"
+	}
+	if _, ok := codecExtensions[path.Ext(name)]; ok {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	switch path.Ext(name) {
+	case ".zip":
+		return "zip"
+	case ".tar":
+		return "tar"
+	case ".dmg":
+		return "dmg"
+	}
+	return ""
+}
+
+// matchMember report if the archive entry name is selected by pattern, a path.Match pattern compared to the
+// whole path of the entry and to its base name
+func matchMember(pattern string, name string) bool {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(name))
+	return ok
+}
+
+// extractMember returns the content of the first regular file of the archive read from r matching pattern. A
+// tar archive is read as a stream, a zip archive is first written to a temporary file in dir as its index is at
+// the end.
+func extractMember(r io.Reader, format string, pattern string, dir string) (io.ReadCloser, error) {
+	switch format {
+	case "tar":
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil, fmt.Errorf("%w: %s", ErrMemberNotFound, pattern)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error reading tar archive: %s", err)
+			}
+			if header.Typeflag == tar.TypeReg && matchMember(pattern, header.Name) {
+				logDebug("Extracting %s from the archive.\n", header.Name)
+				return &tarMember{member: tr, archive: r}, nil
+			}
+		}
+	case "zip":
+		return extractZipMember(r, pattern, dir)
+	}
+	return nil, fmt.Errorf("unsupported archive format %q", format)
+}
+
+// tarMember reads a member of a tar archive, then the rest of the archive once the member is done, so that the
+// checks wrapping the download, which only happen at its end, cover the whole archive
+type tarMember struct {
+	member  io.Reader
+	archive io.Reader
+	drained bool
+}
+
+func (m *tarMember) Read(p []byte) (int, error) {
+	n, err := m.member.Read(p)
+	if err == io.EOF {
+		if derr := m.drain(); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+// Close reads what is left of the archive, so that a member not read to its end still checks the download
+func (m *tarMember) Close() error {
+	return m.drain()
+}
+
+func (m *tarMember) drain() error {
+	if m.drained {
+		return nil
+	}
+	m.drained = true
+	if _, err := io.Copy(io.Discard, m.archive); err != nil {
+		return fmt.Errorf("error reading tar archive: %w", err)
+	}
+	return nil
+}
+
+func extractZipMember(r io.Reader, pattern string, dir string) (io.ReadCloser, error) {
+	f, err := os.CreateTemp(dir, ".archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	spool := &removeOnClose{File: f}
+	size, err := io.Copy(f, r)
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		spool.Close()
+		return nil, fmt.Errorf("error reading zip archive: %s", err)
+	}
+	for _, entry := range zr.File {
+		if !entry.Mode().IsRegular() || !matchMember(pattern, entry.Name) {
+			continue
+		}
+		logDebug("Extracting %s from the archive.\n", entry.Name)
+		member, err := entry.Open()
+		if err != nil {
+			spool.Close()
+			return nil, fmt.Errorf("error reading zip archive: %s", err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{member, multiCloser{member, spool}}, nil
+	}
+	spool.Close()
+	return nil, fmt.Errorf("%w: %s", ErrMemberNotFound, pattern)
+}
+
+// removeOnClose is a temporary file removed once closed
+type removeOnClose struct {
+	*os.File
+}
+
+func (f *removeOnClose) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// multiCloser close all its closers, returning the first error
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
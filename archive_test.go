@@ -0,0 +1,156 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tarball(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, name := range []string{"README.md", "myapp_linux/myapp", "myapp_linux/LICENSE"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		assert.Nil(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := w.Write(content)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		assert.Nil(t, err)
+		_, err = f.Write(content)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestArchiveFromURL(t *testing.T) {
+	assert.Equal(t, "tar", archiveFromURL("https://localhost/myapp_linux_amd64.tar.gz"))
+	assert.Equal(t, "tar", archiveFromURL("https://localhost/myapp_linux_amd64.tgz"))
+	assert.Equal(t, "tar", archiveFromURL("https://localhost/myapp_linux_amd64.tar.zst"))
+	assert.Equal(t, "zip", archiveFromURL("https://localhost/myapp_windows_amd64.ZIP"))
+	assert.Equal(t, "dmg", archiveFromURL("https://localhost/MyApp.dmg"))
+	assert.Equal(t, "", archiveFromURL("https://localhost/myapp.gz"))
+	assert.Equal(t, "", archiveFromURL("https://localhost/myapp"))
+}
+
+func TestMatchMember(t *testing.T) {
+	assert.True(t, matchMember("myapp", "./myapp_linux/myapp"))
+	assert.True(t, matchMember("myapp_*/myapp", "myapp_linux/myapp"))
+	assert.False(t, matchMember("myapp", "myapp_linux/myapp.sig"))
+}
+
+func TestApplyArchive(t *testing.T) {
+	files := map[string][]byte{"README.md": []byte("read me"), "myapp_linux/myapp": newFile, "myapp_linux/LICENSE": []byte("MIT")}
+
+	for name, c := range map[string]struct {
+		archive string
+		codec   string
+		content []byte
+	}{
+		"tar.gz": {"tar", "gzip", gzipped(t, tarball(t, files))},
+		"zip":    {"zip", "", zipped(t, files)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "myapp")
+			writeOldFile(target, t)
+
+			err := Apply(bytes.NewReader(c.content), Options{TargetPath: target, Codec: c.codec, Archive: c.archive})
+			validateUpdate(target, err, t)
+
+			err = Apply(bytes.NewReader(c.content), Options{TargetPath: target, Codec: c.codec, Archive: c.archive, ArchiveMember: "otherapp"})
+			assert.ErrorIs(t, err, ErrMemberNotFound)
+
+			// the spooled archive is removed, only the executable and its backup remain
+			entries, err := os.ReadDir(dir)
+			assert.Nil(t, err)
+			assert.Len(t, entries, 2)
+			_, err = os.Stat(filepath.Join(dir, ".myapp.bak"))
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestFetchArchive(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	archive := gzipped(t, tarball(t, map[string][]byte{"README.md": []byte("read me"), "myapp_linux/myapp": newFile}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/myapp_1.1.0.tar.gz":
+			w.Write(archive)
+		case "/myapp_1.1.0.tar.gz.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u := &Updater{}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/myapp_{{.Version}}.tar.gz"), PublicKey: pub, ArchiveMember: "myapp_*/myapp"}
+	r, _, opts, err := u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, "gzip", opts.Codec)
+	assert.Equal(t, "tar", opts.Archive)
+
+	target := filepath.Join(t.TempDir(), "installed")
+	writeOldFile(target, t)
+	opts.TargetPath = target
+	err = apply(r, opts)
+	validateUpdate(target, err, t)
+}
+
+func TestApplyArchiveChecksWholeDownload(t *testing.T) {
+	archive := gzipped(t, tarball(t, map[string][]byte{"myapp_linux/myapp": newFile, "myapp_linux/LICENSE": []byte("MIT")}))
+	target := filepath.Join(t.TempDir(), "myapp")
+
+	// the member is complete, but the digest of the download is only known once the archive is read to its end
+	writeOldFile(target, t)
+	r, err := newHashReader(io.NopCloser(bytes.NewReader(archive)), crypto.SHA256, make([]byte, sha256.Size))
+	assert.Nil(t, err)
+	err = Apply(r, Options{TargetPath: target, Codec: "gzip", Archive: "tar"})
+	assert.ErrorContains(t, err, "wrong checksum")
+	assertOldFile(t, target)
+
+	err = Apply(bytes.NewReader(archive), Options{TargetPath: target, Codec: "gzip", Archive: "tar", Checksum: make([]byte, sha256.Size)})
+	assert.ErrorContains(t, err, "wrong checksum")
+	assertOldFile(t, target)
+
+	// without the gzip trailer the member can still be read whole
+	err = Apply(bytes.NewReader(archive[:len(archive)-8]), Options{TargetPath: target, Codec: "gzip", Archive: "tar"})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assertOldFile(t, target)
+}
+
+func assertOldFile(t *testing.T, path string) {
+	buf, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, buf)
+}
@@ -0,0 +1,297 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	dssePayloadType   = "application/vnd.in-toto+json"
+	slsaProvenanceV02 = "https://slsa.dev/provenance/v0.2"
+	slsaProvenanceV1  = "https://slsa.dev/provenance/v1"
+)
+
+// AttestationSource define a Source that is able to provide the provenance attestation of the executable
+type AttestationSource interface {
+	Source
+	GetAttestation() ([]byte, error) // Get the DSSE envelope, or the .intoto.jsonl file of envelopes, attesting the executable
+}
+
+// ProvenancePolicy define what a SLSA provenance must state for an update to be accepted. Empty fields are not checked.
+type ProvenancePolicy struct {
+	BuilderID  string // Exact id of the trusted builder, like https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0
+	SourceRepo string // Repository the executable must be built from, like github.com/org/repo
+	BuildType  string // Exact build type, like https://github.com/slsa-framework/slsa-github-generator/generic@v1
+}
+
+// Provenance is what was extracted from a verified SLSA provenance
+type Provenance struct {
+	BuilderID  string
+	SourceRepo string
+	BuildType  string
+}
+
+// dsseEnvelope is a Dead Simple Signing Envelope as used by in-toto attestations
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// inTotoStatement is an in-toto statement with a SLSA v0.2 or v1 provenance predicate
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+	Predicate     struct {
+		// SLSA v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		BuildType  string `json:"buildType"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+
+		// SLSA v1
+		BuildDefinition struct {
+			BuildType            string `json:"buildType"`
+			ResolvedDependencies []struct {
+				URI string `json:"uri"`
+			} `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// AttestationVerifier verify in-toto attestations carrying a SLSA provenance, so that only executables produced
+// by a trusted builder from the expected source repository are applied. The attestation is a DSSE envelope, or
+// an .intoto.jsonl file with one envelope per line as produced by the SLSA GitHub generator, signed by a trusted key.
+type AttestationVerifier struct {
+	keys   []crypto.PublicKey
+	policy ProvenancePolicy
+}
+
+// NewAttestationVerifier returns an AttestationVerifier enforcing policy on attestations signed by one of the
+// PEM encoded ECDSA, Ed25519 or RSA public keys.
+func NewAttestationVerifier(policy ProvenancePolicy, publicKeys ...[]byte) (*AttestationVerifier, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no attestation public key")
+	}
+
+	a := &AttestationVerifier{policy: policy}
+	for _, pk := range publicKeys {
+		block, _ := pem.Decode(pk)
+		if block == nil {
+			return nil, errors.New("couldn't parse attestation public key PEM data")
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = append(a.keys, key)
+	}
+	return a, nil
+}
+
+// Verify check that attestation contains a signed provenance for payload that satisfy the policy
+func (a *AttestationVerifier) Verify(payload []byte, attestation []byte) error {
+	_, err := a.VerifyProvenance(payload, attestation)
+	return err
+}
+
+// VerifyProvenance check attestation like Verify and returns the verified provenance
+func (a *AttestationVerifier) VerifyProvenance(payload []byte, attestation []byte) (*Provenance, error) {
+	sha256Digest := sha256.Sum256(payload)
+	sha512Digest := sha512.Sum512(payload)
+	return a.verifyDigests(sha256Digest[:], sha512Digest[:], attestation)
+}
+
+// verifyFile check attestation like Verify, computing the digests of the payload while streaming the file at path
+func (a *AttestationVerifier) verifyFile(path string, attestation []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sha256Hash, sha512Hash := sha256.New(), sha512.New()
+	if _, err = io.Copy(io.MultiWriter(sha256Hash, sha512Hash), f); err != nil {
+		return err
+	}
+	_, err = a.verifyDigests(sha256Hash.Sum(nil), sha512Hash.Sum(nil), attestation)
+	return err
+}
+
+func (a *AttestationVerifier) verifyDigests(sha256Digest, sha512Digest []byte, attestation []byte) (*Provenance, error) {
+	digests := map[string]string{
+		"sha256": hex.EncodeToString(sha256Digest),
+		"sha512": hex.EncodeToString(sha512Digest),
+	}
+
+	lastErr := errors.New("no attestation found")
+	for _, envelope := range attestationEnvelopes(attestation) {
+		statement, err := a.openEnvelope(envelope)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !statement.covers(digests) {
+			lastErr = errors.New("attestation doesn't cover the update digest")
+			continue
+		}
+
+		provenance, err := statement.provenance()
+		if err != nil {
+			return nil, err
+		}
+		if err = a.policy.check(provenance); err != nil {
+			return nil, err
+		}
+
+		logDebug("Valid provenance from builder %s for %s.\n", provenance.BuilderID, provenance.SourceRepo)
+		return provenance, nil
+	}
+	return nil, lastErr
+}
+
+func (a *AttestationVerifier) String() string {
+	return fmt.Sprintf("AttestationVerifier(%d keys)", len(a.keys))
+}
+
+// attestationEnvelopes split a .intoto.jsonl file in its envelopes, a single envelope may be pretty printed
+func attestationEnvelopes(data []byte) [][]byte {
+	data = bytes.TrimSpace(data)
+	if json.Valid(data) {
+		return [][]byte{data}
+	}
+
+	var envelopes [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			envelopes = append(envelopes, line)
+		}
+	}
+	return envelopes
+}
+
+// openEnvelope verify the DSSE envelope signature and returns the statement it carries
+func (a *AttestationVerifier) openEnvelope(data []byte) (*inTotoStatement, error) {
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid attestation envelope: %s", err)
+	}
+	if envelope.PayloadType != dssePayloadType {
+		return nil, fmt.Errorf("unsupported attestation payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation payload: %s", err)
+	}
+
+	pae := dssePAE(envelope.PayloadType, payload)
+	digest := sha256.Sum256(pae)
+	verified := false
+	for _, s := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		for _, key := range a.keys {
+			if verifyKeySignature(key, digest[:], pae, sig) == nil {
+				verified = true
+			}
+		}
+	}
+	if !verified {
+		return nil, errors.New("attestation isn't signed by a trusted key")
+	}
+
+	var statement inTotoStatement
+	if err = json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("invalid in-toto statement: %s", err)
+	}
+	return &statement, nil
+}
+
+// dssePAE is the DSSE pre-authentication encoding, which is what is actually signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func (s *inTotoStatement) covers(digests map[string]string) bool {
+	for _, subject := range s.Subject {
+		for alg, value := range subject.Digest {
+			if expected, ok := digests[alg]; ok && strings.EqualFold(expected, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *inTotoStatement) provenance() (*Provenance, error) {
+	p := s.Predicate
+	switch s.PredicateType {
+	case slsaProvenanceV02:
+		return &Provenance{BuilderID: p.Builder.ID, BuildType: p.BuildType, SourceRepo: p.Invocation.ConfigSource.URI}, nil
+	case slsaProvenanceV1:
+		provenance := &Provenance{BuilderID: p.RunDetails.Builder.ID, BuildType: p.BuildDefinition.BuildType}
+		if len(p.BuildDefinition.ResolvedDependencies) > 0 {
+			provenance.SourceRepo = p.BuildDefinition.ResolvedDependencies[0].URI
+		}
+		return provenance, nil
+	}
+	return nil, fmt.Errorf("unsupported attestation predicate type %q", s.PredicateType)
+}
+
+func (p ProvenancePolicy) check(provenance *Provenance) error {
+	if p.BuilderID != "" && provenance.BuilderID != p.BuilderID {
+		return fmt.Errorf("update built by untrusted builder %q", provenance.BuilderID)
+	}
+	if p.BuildType != "" && provenance.BuildType != p.BuildType {
+		return fmt.Errorf("update built with unexpected build type %q", provenance.BuildType)
+	}
+	if p.SourceRepo != "" && normalizeRepo(provenance.SourceRepo) != normalizeRepo(p.SourceRepo) {
+		return fmt.Errorf("update built from unexpected source %q", provenance.SourceRepo)
+	}
+	return nil
+}
+
+// normalizeRepo reduce a source URI like git+https://github.com/org/repo.git@refs/tags/v1.0.0 to github.com/org/repo
+func normalizeRepo(uri string) string {
+	uri = strings.TrimPrefix(uri, "git+")
+	if i := strings.Index(uri, "://"); i >= 0 {
+		uri = uri[i+3:]
+	}
+	if i := strings.Index(uri, "@"); i >= 0 {
+		uri = uri[:i]
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(uri, "/"), ".git"))
+}
@@ -0,0 +1,90 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBuilderID = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"
+	testBuildType = "https://github.com/slsa-framework/slsa-github-generator/generic@v1"
+)
+
+func newAttestationKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signAttestation(t *testing.T, key *ecdsa.PrivateKey, statement string) []byte {
+	pae := dssePAE(dssePayloadType, []byte(statement))
+	digest := sha256.Sum256(pae)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.Nil(t, err)
+
+	envelope, err := json.Marshal(map[string]interface{}{
+		"payloadType": dssePayloadType,
+		"payload":     base64.StdEncoding.EncodeToString([]byte(statement)),
+		"signatures":  []map[string]string{{"keyid": "", "sig": base64.StdEncoding.EncodeToString(sig)}},
+	})
+	assert.Nil(t, err)
+	return envelope
+}
+
+func provenanceV02(payload []byte, repo string) string {
+	return fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"myapp","digest":{"sha256":"%x"}}],`+
+		`"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":%q},"buildType":%q,`+
+		`"invocation":{"configSource":{"uri":%q}}}}`, sha256.Sum256(payload), testBuilderID, testBuildType, repo)
+}
+
+func provenanceV1(payload []byte, builder string) string {
+	return fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"myapp","digest":{"sha256":"%x"}}],`+
+		`"predicateType":"https://slsa.dev/provenance/v1","predicate":{"buildDefinition":{"buildType":%q,`+
+		`"resolvedDependencies":[{"uri":"git+https://github.com/org/app@refs/tags/v1.1.0"}]},"runDetails":{"builder":{"id":%q}}}}`,
+		sha256.Sum256(payload), testBuildType, builder)
+}
+
+func TestAttestationVerifier(t *testing.T) {
+	key, pub := newAttestationKey(t)
+	other, _ := newAttestationKey(t)
+
+	a, err := NewAttestationVerifier(ProvenancePolicy{BuilderID: testBuilderID, SourceRepo: "github.com/org/app", BuildType: testBuildType}, pub)
+	assert.Nil(t, err)
+
+	provenance, err := a.VerifyProvenance(newFile, signAttestation(t, key, provenanceV02(newFile, "git+https://github.com/org/app@refs/tags/v1.1.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, testBuilderID, provenance.BuilderID)
+
+	assert.Nil(t, a.Verify(newFile, signAttestation(t, key, provenanceV1(newFile, testBuilderID))))
+
+	// the attestation must be about the update, signed by a trusted key, and satisfy the policy
+	assert.NotNil(t, a.Verify(oldFile, signAttestation(t, key, provenanceV1(newFile, testBuilderID))))
+	assert.NotNil(t, a.Verify(newFile, signAttestation(t, other, provenanceV1(newFile, testBuilderID))))
+	assert.NotNil(t, a.Verify(newFile, signAttestation(t, key, provenanceV1(newFile, "https://evil.example.com/builder"))))
+	assert.NotNil(t, a.Verify(newFile, signAttestation(t, key, provenanceV02(newFile, "git+https://github.com/evil/app"))))
+
+	// an .intoto.jsonl file can carry the attestations of several artifacts
+	jsonl := bytes.Join([][]byte{
+		signAttestation(t, key, provenanceV1(oldFile, testBuilderID)),
+		signAttestation(t, key, provenanceV1(newFile, testBuilderID)),
+	}, []byte("\n"))
+	assert.Nil(t, a.Verify(newFile, jsonl))
+}
+
+func TestNormalizeRepo(t *testing.T) {
+	assert.Equal(t, "github.com/org/app", normalizeRepo("git+https://github.com/Org/app.git@refs/heads/main"))
+	assert.Equal(t, "github.com/org/app", normalizeRepo("github.com/org/app/"))
+}
@@ -0,0 +1,105 @@
+package selfupdate
+
+import "net/http"
+
+// RequestDecorator modify a request before it is sent to an update server, for example to add an Authorization
+// header with a token that is refreshed when it expires. An error fails the request.
+type RequestDecorator func(req *http.Request) error
+
+// BearerToken returns a RequestDecorator setting the Authorization header to a bearer token
+func BearerToken(token string) RequestDecorator {
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// BasicAuth returns a RequestDecorator authenticating requests with HTTP basic authentication
+func BasicAuth(username, password string) RequestDecorator {
+	return func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	}
+}
+
+// StaticHeaders returns a RequestDecorator setting headers, like an API key, on every request
+func StaticHeaders(headers map[string]string) RequestDecorator {
+	return func(req *http.Request) error {
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return nil
+	}
+}
+
+// NewAuthClient returns a copy of client, or of http.DefaultClient if nil, whose requests to update servers are
+// modified by decorators, in order. Pass it to NewHTTPSource, NewChecksumsFileSource or NewMessageSource. When a
+// server redirects to another host, like a CDN or a presigned S3 URL, the request to that host isn't decorated so
+// that credentials don't leak. It can be combined with the other clients and policies in any order, decorators
+// run again for each retry of a RetryPolicy.
+func NewAuthClient(client *http.Client, decorators ...RequestDecorator) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// decorate right above the network, below the policies
+	var wrappers []wrappingTransport
+	base := client.Transport
+	for {
+		w, ok := base.(wrappingTransport)
+		if !ok {
+			break
+		}
+		wrappers = append(wrappers, w)
+		base = w.unwrap()
+	}
+
+	c := *client
+	c.Transport = &authTransport{base: base, decorators: decorators}
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		c.Transport = wrappers[i].rewrap(c.Transport)
+	}
+	return &c
+}
+
+type authTransport struct {
+	base       http.RoundTripper
+	decorators []RequestDecorator
+}
+
+var _ wrappingTransport = (*authTransport)(nil)
+
+// RoundTrip will decorate a copy of req unless it follows a redirect to another host
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	origin := req
+	for origin.Response != nil && origin.Response.Request != nil {
+		origin = origin.Response.Request
+	}
+	if origin.URL.Host != req.URL.Host {
+		return base.RoundTrip(req)
+	}
+
+	decorated := req.Clone(req.Context())
+	for _, decorate := range t.decorators {
+		if err := decorate(decorated); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return base.RoundTrip(decorated)
+}
+
+func (t *authTransport) unwrap() http.RoundTripper {
+	return t.base
+}
+
+func (t *authTransport) rewrap(base http.RoundTripper) http.RoundTripper {
+	return &authTransport{base: base, decorators: t.decorators}
+}
@@ -0,0 +1,53 @@
+package selfupdate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuthClient(t *testing.T) {
+	var cdnAuthorization string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuthorization = r.Header.Get("Authorization")
+		w.Write(newFile)
+	}))
+	defer cdn.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/app" {
+			http.Redirect(w, r, cdn.URL+"/app", http.StatusFound)
+			return
+		}
+		w.Write(newFile)
+	}))
+	defer server.Close()
+
+	client := NewAuthClient(nil, BearerToken("secret"), StaticHeaders(map[string]string{"X-Api-Key": "key"}))
+	client = (&RetryPolicy{}).Client(client)
+
+	signature, err := NewHTTPSource(client, server.URL+"/app").GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, signature)
+
+	// credentials aren't sent to the host the download is redirected to
+	r, _, err := NewHTTPSource(client, server.URL+"/app").Get(&Version{})
+	assert.Nil(t, err)
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, body)
+	assert.Equal(t, "", cdnAuthorization)
+
+	failing := NewAuthClient(nil, func(*http.Request) error { return errors.New("no token") })
+	_, _, err = NewHTTPSource(failing, server.URL+"/app").Get(&Version{})
+	assert.NotNil(t, err)
+}
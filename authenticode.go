@@ -0,0 +1,184 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const (
+	peSecurityDirectory = 4      // IMAGE_DIRECTORY_ENTRY_SECURITY
+	winCertTypePKCS     = 0x0002 // WIN_CERT_TYPE_PKCS_SIGNED_DATA
+)
+
+// AuthenticodeVerifier check, on Windows, that the update carry a valid Authenticode signature from the expected
+// publisher before it replaces the running executable. This is in addition to the signature verification.
+// The signature and its certificate chain are validated by Windows, the publisher is then matched by the common
+// name or the thumbprint of the signing certificate.
+type AuthenticodeVerifier struct {
+	publisher   string
+	thumbprints []string
+}
+
+// NewAuthenticodeVerifier returns an AuthenticodeVerifier accepting executables signed by a certificate whose
+// subject common name is publisher, if not empty, and whose SHA-1 or SHA-256 thumbprint is one of thumbprints,
+// if any is given. Thumbprints are hex encoded as displayed by Windows, spaces and colons are ignored.
+func NewAuthenticodeVerifier(publisher string, thumbprints ...string) (*AuthenticodeVerifier, error) {
+	if publisher == "" && len(thumbprints) == 0 {
+		return nil, errors.New("a publisher or a thumbprint is required")
+	}
+
+	a := &AuthenticodeVerifier{publisher: publisher}
+	for _, t := range thumbprints {
+		t = strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(t))
+		if _, err := hex.DecodeString(t); err != nil || (len(t) != 2*sha1.Size && len(t) != 2*sha256.Size) {
+			return nil, fmt.Errorf("invalid certificate thumbprint %q", t)
+		}
+		a.thumbprints = append(a.thumbprints, t)
+	}
+	return a, nil
+}
+
+// Verify check that the executable at path has a trusted Authenticode signature from the expected publisher.
+// It returns ErrNotSupported on other operating systems than Windows.
+func (a *AuthenticodeVerifier) Verify(path string) error {
+	if err := verifyAuthenticodeTrust(path); err != nil {
+		return err
+	}
+
+	signer, err := authenticodeSigner(path)
+	if err != nil {
+		return err
+	}
+	return a.check(signer)
+}
+
+func (a *AuthenticodeVerifier) check(signer *x509.Certificate) error {
+	if a.publisher != "" && signer.Subject.CommonName != a.publisher {
+		return fmt.Errorf("executable signed by %q instead of %q", signer.Subject.CommonName, a.publisher)
+	}
+	if len(a.thumbprints) == 0 {
+		return nil
+	}
+
+	sha1Thumbprint := sha1.Sum(signer.Raw)
+	sha256Thumbprint := sha256.Sum256(signer.Raw)
+	for _, t := range a.thumbprints {
+		if t == hex.EncodeToString(sha1Thumbprint[:]) || t == hex.EncodeToString(sha256Thumbprint[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("executable signed by untrusted certificate %x", sha1Thumbprint)
+}
+
+func (a *AuthenticodeVerifier) String() string {
+	return fmt.Sprintf("AuthenticodeVerifier(%q, %d thumbprints)", a.publisher, len(a.thumbprints))
+}
+
+// pkcs7ContentInfo is the PKCS #7 structure stored in the certificate table of a signed executable
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0"` // explicitly tagged SignedData
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version         int
+	IssuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+}
+
+// authenticodeSigner returns the certificate of the signer of the PE executable at path. The signature itself
+// isn't verified.
+func authenticodeSigner(path string) (*x509.Certificate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	exe, err := pe.NewFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a Windows executable: %s", err)
+	}
+	var security pe.DataDirectory
+	switch h := exe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		security = h.DataDirectory[peSecurityDirectory]
+	case *pe.OptionalHeader64:
+		security = h.DataDirectory[peSecurityDirectory]
+	}
+	if security.Size == 0 {
+		return nil, errors.New("executable isn't Authenticode signed")
+	}
+
+	// the certificate table is referenced by file offset, not by virtual address
+	table := make([]byte, security.Size)
+	if _, err = f.ReadAt(table, int64(security.VirtualAddress)); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading certificate table: %s", err)
+	}
+	for len(table) >= 8 {
+		length := binary.LittleEndian.Uint32(table)
+		certType := binary.LittleEndian.Uint16(table[6:])
+		if length < 8 || int(length) > len(table) {
+			break
+		}
+		if certType == winCertTypePKCS {
+			return pkcs7Signer(table[8:length])
+		}
+		// entries are aligned on 8 bytes
+		next := (int(length) + 7) &^ 7
+		if next > len(table) {
+			break
+		}
+		table = table[next:]
+	}
+	return nil, errors.New("executable has no Authenticode signature")
+}
+
+func pkcs7Signer(der []byte) (*x509.Certificate, error) {
+	var content pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &content); err != nil {
+		return nil, fmt.Errorf("invalid Authenticode signature: %s", err)
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("invalid Authenticode signed data: %s", err)
+	}
+	if len(signed.SignerInfos) != 1 {
+		return nil, fmt.Errorf("Authenticode signature must have one signer, found %d", len(signed.SignerInfos))
+	}
+	certificates, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Authenticode certificate: %s", err)
+	}
+
+	signer := signed.SignerInfos[0].IssuerAndSerial
+	for _, cert := range certificates {
+		if cert.SerialNumber.Cmp(signer.Serial) == 0 && bytes.Equal(cert.RawIssuer, signer.Issuer.FullBytes) {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("Authenticode signer certificate not found")
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+func verifyAuthenticodeTrust(_ string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,138 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCodeSigningCertificate(t *testing.T, publisher string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: publisher},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+// writeSignedPE writes a minimal PE executable whose certificate table hold a PKCS #7 signed data for cert
+func writeSignedPE(t *testing.T, path string, cert *x509.Certificate) {
+	type issuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+	type signerInfo struct {
+		Version         int
+		IssuerAndSerial issuerAndSerial
+	}
+	type signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      []signerInfo `asn1:"set"`
+	}
+
+	signed, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			IssuerAndSerial: issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+		}},
+	})
+	assert.Nil(t, err)
+	pkcs7, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed},
+	})
+	assert.Nil(t, err)
+
+	var exe bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	exe.Write(dos)
+	exe.WriteString("PE\x00\x00")
+
+	header := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	binary.Write(&exe, binary.LittleEndian, pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, SizeOfOptionalHeader: uint16(binary.Size(header))})
+	offset := exe.Len() + binary.Size(header)
+	offset = (offset + 7) &^ 7
+	table := make([]byte, 8, 8+len(pkcs7))
+	binary.LittleEndian.PutUint32(table, uint32(8+len(pkcs7)))
+	binary.LittleEndian.PutUint16(table[4:], 0x0200)
+	binary.LittleEndian.PutUint16(table[6:], winCertTypePKCS)
+	table = append(table, pkcs7...)
+	header.DataDirectory[peSecurityDirectory] = pe.DataDirectory{VirtualAddress: uint32(offset), Size: uint32(len(table))}
+	binary.Write(&exe, binary.LittleEndian, header)
+	exe.Write(make([]byte, offset-exe.Len()))
+	exe.Write(table)
+
+	assert.Nil(t, os.WriteFile(path, exe.Bytes(), 0755))
+}
+
+func TestAuthenticodeSigner(t *testing.T) {
+	cert := newCodeSigningCertificate(t, "Fyne Labs")
+	path := filepath.Join(t.TempDir(), "app.exe")
+	writeSignedPE(t, path, cert)
+
+	signer, err := authenticodeSigner(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, cert.Raw, signer.Raw)
+
+	thumbprint := fmt.Sprintf("% X", sha1.Sum(cert.Raw))
+	for _, c := range []struct {
+		publisher   string
+		thumbprints []string
+		valid       bool
+	}{
+		{"Fyne Labs", nil, true},
+		{"", []string{thumbprint}, true},
+		{"Fyne Labs", []string{strings.Repeat("00", sha1.Size), thumbprint}, true},
+		{"Evil Corp", nil, false},
+		{"Fyne Labs", []string{strings.Repeat("00", sha1.Size)}, false},
+	} {
+		a, err := NewAuthenticodeVerifier(c.publisher, c.thumbprints...)
+		assert.Nil(t, err)
+		assert.Equal(t, c.valid, a.check(signer) == nil, c)
+	}
+
+	_, err = NewAuthenticodeVerifier("")
+	assert.NotNil(t, err)
+	_, err = NewAuthenticodeVerifier("", "1234")
+	assert.NotNil(t, err)
+
+	unsigned := filepath.Join(t.TempDir(), "unsigned")
+	assert.Nil(t, os.WriteFile(unsigned, newFile, 0755))
+	_, err = authenticodeSigner(unsigned)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+package selfupdate
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// WINTRUST_ACTION_GENERIC_VERIFY_V2
+var genericVerifyV2 = syscall.GUID{
+	Data1: 0xaac56b,
+	Data2: 0xcd44,
+	Data3: 0x11d0,
+	Data4: [8]byte{0x8c, 0xc2, 0x00, 0xc0, 0x4f, 0xc2, 0x95, 0xee},
+}
+
+type wintrustFileInfo struct {
+	cbStruct       uint32
+	pcwszFilePath  *uint16
+	hFile          uintptr
+	pgKnownSubject *syscall.GUID
+}
+
+type wintrustData struct {
+	cbStruct            uint32
+	pPolicyCallbackData uintptr
+	pSIPClientData      uintptr
+	dwUIChoice          uint32
+	fdwRevocationChecks uint32
+	dwUnionChoice       uint32
+	pFile               *wintrustFileInfo
+	dwStateAction       uint32
+	hWVTStateData       uintptr
+	pwszURLReference    *uint16
+	dwProvFlags         uint32
+	dwUIContext         uint32
+	pSignatureSettings  uintptr
+}
+
+const (
+	wtdUINone                = 2
+	wtdRevokeNone            = 0
+	wtdChoiceFile            = 1
+	wtdStateActionVerify     = 1
+	wtdStateActionClose      = 2
+	wtdCacheOnlyURLRetrieval = 0x1000
+)
+
+// verifyAuthenticodeTrust ask Windows to validate the Authenticode signature of path and its certificate chain
+func verifyAuthenticodeTrust(path string) error {
+	wintrust := syscall.NewLazyDLL("wintrust.dll")
+	winVerifyTrust := wintrust.NewProc("WinVerifyTrust")
+
+	ptr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	file := wintrustFileInfo{pcwszFilePath: ptr}
+	file.cbStruct = uint32(unsafe.Sizeof(file))
+	data := wintrustData{
+		dwUIChoice:          wtdUINone,
+		fdwRevocationChecks: wtdRevokeNone,
+		dwUnionChoice:       wtdChoiceFile,
+		pFile:               &file,
+		dwStateAction:       wtdStateActionVerify,
+		dwProvFlags:         wtdCacheOnlyURLRetrieval,
+	}
+	data.cbStruct = uint32(unsafe.Sizeof(data))
+
+	r, _, _ := winVerifyTrust.Call(^uintptr(0), uintptr(unsafe.Pointer(&genericVerifyV2)), uintptr(unsafe.Pointer(&data)))
+
+	// release the state allocated by the verification
+	data.dwStateAction = wtdStateActionClose
+	winVerifyTrust.Call(^uintptr(0), uintptr(unsafe.Pointer(&genericVerifyV2)), uintptr(unsafe.Pointer(&data)))
+
+	if r != 0 {
+		return fmt.Errorf("invalid Authenticode signature: WinVerifyTrust returned 0x%x", uint32(r))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/internal/binarydist"
+)
+
+const benchmarkSize = 8 << 20 // size of the executable used by the benchmarks
+
+// benchmarkGoals are the performance goals of the update hot path on our slowest target, an ARMv7 board at 1 GHz.
+// They haven't been measured on it yet, so they are only reported against, never enforced. Run them on the
+// target itself with:
+//
+//	SELFUPDATE_GOALS=1 go test -v -run TestPerformanceGoals
+//
+// and use `go test -run - -bench . -benchmem` to compare against a previous run with benchstat.
+var benchmarkGoals = []struct {
+	name  string
+	bench func(*testing.B)
+	size  int64         // goal is for processing size bytes, or for a single operation if 0
+	limit time.Duration // time aimed for
+}{
+	{"manifest", BenchmarkManifestParse, 0, time.Millisecond},
+	{"sha256", func(b *testing.B) { benchmarkHash(b, crypto.SHA256) }, 100 << 20, time.Second},
+	{"verify", BenchmarkVerifyED25519, 100 << 20, time.Second},
+	{"patch", BenchmarkPatch, 10 << 20, 2 * time.Second},
+	{"apply", BenchmarkApply, 100 << 20, 5 * time.Second},
+}
+
+func TestPerformanceGoals(t *testing.T) {
+	if os.Getenv("SELFUPDATE_GOALS") == "" {
+		t.Skip("set SELFUPDATE_GOALS to report against the performance goals")
+	}
+
+	for _, goal := range benchmarkGoals {
+		result := testing.Benchmark(goal.bench)
+		if result.N == 0 {
+			t.Fatalf("%s: benchmark failed", goal.name)
+		}
+
+		spent := time.Duration(result.NsPerOp())
+		if goal.size > 0 && result.Bytes > 0 {
+			spent = time.Duration(float64(result.NsPerOp()) * float64(goal.size) / float64(result.Bytes))
+		}
+		status := "within"
+		if spent > goal.limit {
+			status = "over"
+		}
+		t.Logf("%s: %s, %s its %s goal on %s/%s %s", goal.name, spent, status, goal.limit, runtime.GOOS, runtime.GOARCH, result.MemString())
+	}
+}
+
+// benchmarkPayload returns a deterministic executable like payload of size bytes
+func benchmarkPayload(size int) []byte {
+	payload := make([]byte, size)
+	rand.New(rand.NewSource(42)).Read(payload)
+	return payload
+}
+
+func BenchmarkManifestParse(b *testing.B) {
+	var appVersions []appVersion
+	for i := 0; i < 20; i++ {
+		for _, goos := range []string{"linux", "darwin", "windows", "freebsd"} {
+			appVersions = append(appVersions, appVersion{
+				Name:        "myapp",
+				OS:          goos,
+				Version:     fmt.Sprintf("1.%d.0", 20-i),
+				DownloadURL: fmt.Sprintf("https://example.com/myapp-%s-1.%d.0", goos, 20-i),
+				SHA256:      fmt.Sprintf("%x", sha256.Sum256([]byte(goos))),
+				Yanked:      i%5 == 0,
+			})
+		}
+	}
+	appVersions = append(appVersions, appVersion{OS: runtime.GOOS, Version: "1.0.0"})
+	manifest, err := json.Marshal(appVersions)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(manifest)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var parsed []appVersion
+		if err := json.Unmarshal(manifest, &parsed); err != nil {
+			b.Fatal(err)
+		}
+		a, _, err := latestAppVersion(parsed, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = entryVersion(a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	b.Run("sha256", func(b *testing.B) { benchmarkHash(b, crypto.SHA256) })
+	b.Run("sha512", func(b *testing.B) { benchmarkHash(b, crypto.SHA512) })
+}
+
+func benchmarkHash(b *testing.B, h crypto.Hash) {
+	payload := benchmarkPayload(benchmarkSize)
+	hash := h.New()
+	hash.Write(payload)
+	expected := hash.Sum(nil)
+
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := newHashReader(io.NopCloser(bytes.NewReader(payload)), h, expected)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = io.Copy(io.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyED25519(b *testing.B) {
+	payload := benchmarkPayload(benchmarkSize)
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	signature := ed25519.Sign(priv, payload)
+	verifier := NewED25519Verifier(pub)
+
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := verifier.VerifySignature(bytes.NewReader(payload), signature); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPatch(b *testing.B) {
+	// diffing is slow and done by the publisher, keep the patched executable small
+	old := benchmarkPayload(1 << 20)
+	updated := append([]byte(nil), old...)
+	for i := 0; i < len(updated); i += 4096 {
+		updated[i]++
+	}
+
+	var patch bytes.Buffer
+	if err := binarydist.Diff(bytes.NewReader(old), bytes.NewReader(updated), &patch); err != nil {
+		b.Fatal(err)
+	}
+	patcher := NewBSDiffPatcher()
+
+	b.SetBytes(int64(len(updated)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := patcher.Patch(bytes.NewReader(old), io.Discard, bytes.NewReader(patch.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	payload := benchmarkPayload(benchmarkSize)
+	checksum := sha256.Sum256(payload)
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	signature := ed25519.Sign(priv, payload)
+
+	target := filepath.Join(b.TempDir(), "app")
+	if err := os.WriteFile(target, oldFile, 0755); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := Apply(bytes.NewReader(payload), Options{
+			TargetPath: target,
+			Checksum:   checksum[:],
+			Signature:  signature,
+			PublicKey:  pub,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
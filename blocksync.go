@@ -0,0 +1,336 @@
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// BlockSource define a Source that publish a block index of its executables, so that only the blocks that
+// aren't already in the installed executable are downloaded
+type BlockSource interface {
+	Source
+	GetBlockIndex(v *Version) ([]byte, error)                          // Get the JSON BlockIndex of the executable of v, ErrNotPublished if there is none
+	GetBlocks(v *Version, offset, length int64) (io.ReadCloser, error) // Get length bytes of the executable of v starting at offset
+}
+
+// BlockIndex describe the blocks of an executable, published next to it for block level updates
+type BlockIndex struct {
+	BlockSize int64   `json:"block_size"` // Length of the blocks, the last one can be shorter
+	Length    int64   `json:"length"`     // Length of the executable
+	SHA256    string  `json:"sha256"`     // Hex encoded SHA-256 of the executable
+	Blocks    []Block `json:"blocks"`
+}
+
+// Block is the checksums of a block of an executable
+type Block struct {
+	Weak   uint32 `json:"weak"`   // rsync rolling checksum, to find candidate blocks at any offset of the installed executable
+	Strong string `json:"strong"` // Hex encoded SHA-256 of the block, to confirm a candidate
+}
+
+// defaultBlockSize is the block size of NewBlockIndex, small enough for blocks to survive the shifts of a rebuild
+const defaultBlockSize = 16 * 1024
+
+// errNoBlockIndex is returned by fetchBlocks when no block index is available, the executable is then downloaded
+var errNoBlockIndex = errors.New("no block index available")
+
+// NewBlockIndex returns the block index of the executable read from r, to be published as ${URL}.blocks by a
+// HTTPSource. A blockSize of 0 default to 16KiB.
+func NewBlockIndex(r io.Reader, blockSize int64) (*BlockIndex, error) {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+
+	idx := &BlockIndex{BlockSize: blockSize}
+	whole := sha256.New()
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			whole.Write(buf[:n])
+			idx.Length += int64(n)
+			strong := sha256.Sum256(buf[:n])
+			idx.Blocks = append(idx.Blocks, Block{Weak: newRollingChecksum(buf[:n]).sum(), Strong: hex.EncodeToString(strong[:])})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	idx.SHA256 = hex.EncodeToString(whole.Sum(nil))
+	return idx, nil
+}
+
+// check that the index is consistent, so that it can be used safely
+func (idx *BlockIndex) check() error {
+	if idx.BlockSize <= 0 || idx.Length < 0 {
+		return errors.New("invalid block index geometry")
+	}
+	if int64(len(idx.Blocks)) != (idx.Length+idx.BlockSize-1)/idx.BlockSize {
+		return fmt.Errorf("block index of %d bytes must have %d blocks, not %d", idx.Length, (idx.Length+idx.BlockSize-1)/idx.BlockSize, len(idx.Blocks))
+	}
+	return nil
+}
+
+// blockLength returns the length of block i
+func (idx *BlockIndex) blockLength(i int) int64 {
+	if end := int64(i+1) * idx.BlockSize; end > idx.Length {
+		return idx.Length - int64(i)*idx.BlockSize
+	}
+	return idx.BlockSize
+}
+
+// locate returns the offset in local, of length size, of every full block of the index it contains
+func (idx *BlockIndex) locate(local io.ReaderAt, size int64) (map[int]int64, error) {
+	candidates := map[uint32][]int{}
+	for i, b := range idx.Blocks {
+		if idx.blockLength(i) == idx.BlockSize {
+			candidates[b.Weak] = append(candidates[b.Weak], i)
+		}
+	}
+	strong := func(window []byte) string {
+		sum := sha256.Sum256(window)
+		return hex.EncodeToString(sum[:])
+	}
+	want := func(i int) string { return idx.Blocks[i].Strong }
+	return locateBlocks(local, size, idx.BlockSize, candidates, (*rollingChecksum).sum, strong, want)
+}
+
+// locateBlocks returns the offset in local, of length size, of the blocks of length bs listed in candidates by
+// their weak checksum, computed with weak from the rolling checksum. A candidate found at an offset is confirmed
+// when the strong checksum of the window there is the one wanted for it.
+func locateBlocks(local io.ReaderAt, size int64, bs int64, candidates map[uint32][]int, weak func(*rollingChecksum) uint32, strongSum func(window []byte) string, want func(i int) string) (map[int]int64, error) {
+	found := map[int]int64{}
+	if size < bs {
+		return found, nil
+	}
+
+	window := make([]byte, bs)
+	if _, err := local.ReadAt(window, 0); err != nil {
+		return nil, err
+	}
+	rolling := newRollingChecksum(window)
+	leaving := bufio.NewReader(io.NewSectionReader(local, 0, size))
+	entering := bufio.NewReader(io.NewSectionReader(local, bs, size-bs))
+
+	for offset := int64(0); ; offset++ {
+		var strong string
+		for _, i := range candidates[weak(rolling)] {
+			if _, ok := found[i]; ok {
+				continue
+			}
+			if strong == "" {
+				// the weak checksum matched, confirm with the strong one
+				if _, err := local.ReadAt(window, offset); err != nil {
+					return nil, err
+				}
+				strong = strongSum(window)
+			}
+			if want(i) == strong {
+				found[i] = offset
+			}
+		}
+
+		if offset+bs >= size {
+			return found, nil
+		}
+		out, err := leaving.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		in, err := entering.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		rolling.roll(out, in)
+	}
+}
+
+// rollingChecksum is the weak checksum of rsync, which can be moved forward a byte at a time
+type rollingChecksum struct {
+	a, b   uint32
+	length uint32
+}
+
+func newRollingChecksum(p []byte) *rollingChecksum {
+	r := &rollingChecksum{length: uint32(len(p))}
+	for i, x := range p {
+		r.a += uint32(x)
+		r.b += uint32(len(p)-i) * uint32(x)
+	}
+	return r
+}
+
+// roll remove out from the start of the window and add in at its end
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.length*uint32(out)
+}
+
+func (r *rollingChecksum) sum() uint32 {
+	return (r.b&0xffff)<<16 | r.a&0xffff
+}
+
+// fetchBlocks rebuild the executable of newVer from the blocks of the executable at target it shares with it
+// and the other blocks downloaded from the Source, if it publishes a block index. The result is checked against
+// the index, it is verified like a download by the caller.
+func (u *Updater) fetchBlocks(ctx context.Context, conf *Config, newVer *Version, target string) (io.ReadCloser, int64, *Options, error) {
+	bs, ok := conf.Source.(BlockSource)
+	if !ok || conf.Device != "" {
+		return nil, 0, nil, errNoBlockIndex
+	}
+	if codec, archive, _ := payloadFormat(conf, newVer); codec != "" || archive != "" {
+		// blocks of a compressed payload have nothing in common with the installed executable
+		return nil, 0, nil, errNoBlockIndex
+	}
+	data, err := getBlockIndex(ctx, bs, newVer)
+	if errors.Is(err, ErrNotPublished) {
+		return nil, 0, nil, errNoBlockIndex
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var idx BlockIndex
+	if err = json.Unmarshal(data, &idx); err != nil {
+		return nil, 0, nil, fmt.Errorf("error unmarshalling block index: %s", err)
+	}
+	if err = idx.check(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	if target == "" {
+		if target, err = ExecutableRealPath(); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+	local, err := os.Open(target)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	found, err := idx.locate(local, info.Size())
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(target), ".blocks-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	spool := &removeOnClose{File: f}
+	fail := func(err error) (io.ReadCloser, int64, *Options, error) {
+		spool.Close()
+		return nil, 0, nil, err
+	}
+
+	dctx, cancel := withTimeout(ctx, conf.DownloadTimeout)
+	defer cancel()
+	whole := sha256.New()
+	w := io.MultiWriter(spool, whole)
+	downloaded := int64(0)
+	for i := 0; i < len(idx.Blocks); {
+		if offset, ok := found[i]; ok {
+			if _, err = io.Copy(w, io.NewSectionReader(local, offset, idx.BlockSize)); err != nil {
+				return fail(err)
+			}
+			i++
+			continue
+		}
+
+		// download the following missing blocks at once
+		j := i
+		for ; j < len(idx.Blocks); j++ {
+			if _, ok := found[j]; ok {
+				break
+			}
+		}
+		start := int64(i) * idx.BlockSize
+		length := int64(j-i-1)*idx.BlockSize + idx.blockLength(j-1)
+		body, err := getBlocks(dctx, bs, newVer, start, length)
+		if err != nil {
+			return fail(err)
+		}
+		n, err := io.Copy(w, io.LimitReader(body, length))
+		body.Close()
+		if err == nil && n != length {
+			err = fmt.Errorf("received %d bytes of the %d requested at offset %d", n, length, start)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		downloaded += length
+		i = j
+	}
+	if hex.EncodeToString(whole.Sum(nil)) != idx.SHA256 {
+		return fail(errors.New("executable rebuilt from blocks doesn't match the block index"))
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	opts, err := u.options(ctx, conf, newVer)
+	if err != nil {
+		return fail(err)
+	}
+	logInfo("Reused %d of %d blocks of the installed executable, downloaded %d of %d bytes.\n", len(found), len(idx.Blocks), downloaded, idx.Length)
+	return spool, idx.Length, opts, nil
+}
+
+var _ BlockContextSource = (*HTTPSource)(nil)
+
+// GetBlockIndex will return the content of ${URL}.blocks
+func (h *HTTPSource) GetBlockIndex(v *Version) ([]byte, error) {
+	return h.GetBlockIndexContext(context.Background(), v)
+}
+
+// GetBlockIndexContext is GetBlockIndex, the request is interrupted once ctx is done
+func (h *HTTPSource) GetBlockIndexContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getLimited(ctx, h.resolve(v)+".blocks", 16*1024*1024)
+}
+
+// GetBlocks will return length bytes of the executable starting at offset with a Range request
+func (h *HTTPSource) GetBlocks(v *Version, offset, length int64) (io.ReadCloser, error) {
+	return h.GetBlocksContext(context.Background(), v, offset, length)
+}
+
+// GetBlocksContext is GetBlocks, the download is interrupted once ctx is done
+func (h *HTTPSource) GetBlocksContext(ctx context.Context, v *Version, offset, length int64) (io.ReadCloser, error) {
+	return getRange(ctx, h.client, h.resolve(v), offset, length)
+}
+
+// getRange returns length bytes of the file at url starting at offset with a Range request
+func getRange(ctx context.Context, client *http.Client, url string, offset, length int64) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+	// offsets must count the bytes of the file, not of a transparently decompressed response
+	request.Header.Set("Accept-Encoding", "identity")
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	if err = checkStatus(url, response, http.StatusPartialContent); err != nil {
+		return nil, err
+	}
+	if start, err := rangeStart(response.Header.Get("Content-Range")); err != nil || start != offset {
+		response.Body.Close()
+		return nil, fmt.Errorf("error downloading blocks of %s: unexpected Content-Range %q", url, response.Header.Get("Content-Range"))
+	}
+	return response.Body, nil
+}
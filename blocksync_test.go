@@ -0,0 +1,154 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockFiles returns an executable and its next version, which has some bytes inserted and changed
+func blockFiles() ([]byte, []byte) {
+	old := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(old)
+	next := append([]byte{}, old[:10000]...)
+	next = append(next, []byte("inserted bytes shifting the rest")...)
+	next = append(next, old[10000:]...)
+	copy(next[40000:], "changed")
+	return old, next
+}
+
+func TestBlockIndexLocate(t *testing.T) {
+	old, next := blockFiles()
+	idx, err := NewBlockIndex(bytes.NewReader(next), 1024)
+	assert.Nil(t, err)
+	assert.Nil(t, idx.check())
+	assert.Equal(t, int64(len(next)), idx.Length)
+	assert.Equal(t, 65, len(idx.Blocks))
+
+	found, err := idx.locate(bytes.NewReader(old), int64(len(old)))
+	assert.Nil(t, err)
+	// the blocks around the insertion and the change, and the short last block, can't be reused
+	assert.Equal(t, 62, len(found))
+	for i, offset := range found {
+		assert.Equal(t, next[int64(i)*1024:int64(i+1)*1024], old[offset:offset+1024])
+	}
+
+	found, err = idx.locate(bytes.NewReader(old[:100]), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(found))
+}
+
+func blockServer(t *testing.T, next []byte, priv ed25519.PrivateKey, index bool) (*httptest.Server, *int64) {
+	var served int64
+	idx, err := NewBlockIndex(bytes.NewReader(next), 1024)
+	assert.Nil(t, err)
+	data, err := json.Marshal(idx)
+	assert.Nil(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			w.Write([]byte(`[{"os":"` + runtime.GOOS + `","version":"1.1.0","download_url":"` + server.URL + `/app"}]`))
+		case "/app":
+			cw := &countingWriter{ResponseWriter: w, n: &served}
+			http.ServeContent(cw, r, "app", time.Time{}, bytes.NewReader(next))
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(priv, next))
+		case "/app.blocks":
+			if !index {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, &served
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(c.n, int64(len(p)))
+	return c.ResponseWriter.Write(p)
+}
+
+func testBlockSync(t *testing.T, index bool) int64 {
+	old, next := blockFiles()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	server, served := blockServer(t, next, priv, index)
+	defer server.Close()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "myapp")
+	assert.Nil(t, os.WriteFile(target, old, 0755))
+
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: pub}
+	v, err := conf.Source.LatestVersion()
+	assert.Nil(t, err)
+
+	u := &Updater{conf: conf}
+	assert.Nil(t, u.install(context.Background(), conf, "1.0.0", v, target))
+	data, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, next, data)
+
+	// the spool file doesn't survive the update
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasPrefix(e.Name(), ".blocks-"))
+	}
+	return atomic.LoadInt64(served)
+}
+
+func TestBlockSync(t *testing.T) {
+	_, next := blockFiles()
+	served := testBlockSync(t, true)
+	assert.True(t, served > 0)
+	assert.True(t, served <= 4*1024+int64(len(next))%1024, "downloaded %d bytes", served)
+
+	// without a block index, the whole executable is downloaded
+	assert.Equal(t, int64(len(next)), testBlockSync(t, false))
+}
+
+func TestBlockSyncCancelled(t *testing.T) {
+	old, next := blockFiles()
+	_, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	server, served := blockServer(t, next, priv, true)
+	defer server.Close()
+
+	target := filepath.Join(t.TempDir(), "myapp")
+	assert.Nil(t, os.WriteFile(target, old, 0755))
+
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/manifest")}
+	v, err := conf.Source.LatestVersion()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u := &Updater{conf: conf}
+	_, _, _, err = u.fetchBlocks(ctx, conf, v, target)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(0), atomic.LoadInt64(served))
+}
@@ -0,0 +1,285 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Lamdt03/selfupdate/manifest"
+)
+
+// BundleFile is a file installed with the executable from the archive of an update, like a helper binary, shell
+// completions or data files. Its Member is matched as Options.ArchiveMember.
+//
+// Deprecated: use manifest.BundleFile.
+type BundleFile = manifest.BundleFile
+
+// bundleEntry is a file of a bundle being installed
+type bundleEntry struct {
+	member string
+	target string
+	mode   os.FileMode
+	staged string // path of the extracted file
+	old    string // path the replaced file is kept at, empty if there was none
+}
+
+// checkBundlePath returns an error if the path of a bundle file isn't relative to the directory of the executable
+func checkBundlePath(p string) error {
+	clean := filepath.Clean(filepath.FromSlash(p))
+	if p == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid bundle file path %q", p)
+	}
+	return nil
+}
+
+// applyBundle install an update carrying more than one file. The whole archive is staged and verified, as its
+// signatures cover the archive, then every file is extracted next to the file it replaces and they are all swapped
+// in. If any of them can't be, the ones already swapped are restored so that the installation is never left with
+// files of different versions.
+func (o *Options) applyBundle(update io.Reader, verify bool, stagingDir string) error {
+	if o.Archive == "" {
+		return errors.New("a bundle must be a zip or tar archive")
+	}
+	if o.Patcher != nil || o.Device != "" || o.relocation() != "" {
+		return errors.New("a bundle can't be applied as a patch, a device image or relocated")
+	}
+
+	updateDir := filepath.Dir(o.TargetPath)
+	entries := []*bundleEntry{{member: o.archiveMember(), target: o.TargetPath, mode: o.TargetMode}}
+	for _, file := range o.Files {
+		if err := checkBundlePath(file.Path); err != nil {
+			return err
+		}
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		entries = append(entries, &bundleEntry{member: file.Member, target: filepath.Join(updateDir, filepath.FromSlash(file.Path)), mode: mode})
+	}
+
+	bundlePath := filepath.Join(stagingDir, fmt.Sprintf(".%s.bundle", filepath.Base(o.TargetPath)))
+	_ = os.Remove(bundlePath)
+	fp, err := openFile(bundlePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	bundle := &removeOnClose{File: fp}
+	defer bundle.Close()
+
+	var checksum hash.Hash
+	var w io.Writer = fp
+	if o.Checksum != nil {
+		checksum = o.Hash.New()
+		w = io.MultiWriter(fp, checksum)
+	}
+	size, err := io.Copy(w, update)
+	if err != nil {
+		return err
+	}
+	if err = o.verifyStaged(bundlePath, verify, checksum); err != nil {
+		return err
+	}
+
+	defer func() {
+		for _, e := range entries {
+			if e.staged != "" {
+				_ = os.Remove(e.staged)
+			}
+		}
+	}()
+	if err = extractBundle(fp, size, o.Archive, entries); err != nil {
+		return err
+	}
+
+	newPath := entries[0].staged
+	if o.AuthenticodeVerifier != nil && runtime.GOOS == "windows" {
+		if err = o.AuthenticodeVerifier.Verify(newPath); err != nil {
+			return err
+		}
+	}
+	if o.CodesignVerifier != nil && runtime.GOOS == "darwin" {
+		if err = o.CodesignVerifier.Verify(newPath); err != nil {
+			return err
+		}
+	}
+	if o.BurnIn != nil {
+		if err = o.BurnIn(newPath); err != nil {
+			return err
+		}
+	}
+	if runtime.GOOS == "windows" {
+		if err = markOfTheWeb(newPath, o.MarkOfTheWeb); err != nil {
+			return err
+		}
+	}
+
+	if err = swapBundle(entries, o.OldSavePath); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		syncDir(filepath.Dir(e.target))
+		e.staged = ""
+		if e.old == "" || e == entries[0] {
+			continue
+		}
+		if os.Remove(e.old) != nil {
+			_ = hideFile(e.old)
+		}
+	}
+	// as for a single executable, the replaced one is kept to be restored
+	if entries[0].old != "" && o.OldSavePath == "" {
+		_ = hideFile(entries[0].old)
+	}
+	return nil
+}
+
+// extractBundle extract the first regular file of the archive matching each entry next to its target
+func extractBundle(f *os.File, size int64, format string, entries []*bundleEntry) error {
+	extract := func(name string, open func() (io.ReadCloser, error)) error {
+		for _, e := range entries {
+			if e.staged != "" || !matchMember(e.member, name) {
+				continue
+			}
+			logDebug("Extracting %s from the bundle.\n", name)
+			r, err := open()
+			if err != nil {
+				return err
+			}
+			err = e.stage(r)
+			r.Close()
+			return err
+		}
+		return nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	switch format {
+	case "tar":
+		tr := tar.NewReader(f)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error reading tar archive: %s", err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err = extract(header.Name, func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }); err != nil {
+				return err
+			}
+		}
+	case "zip":
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return fmt.Errorf("error reading zip archive: %s", err)
+		}
+		for _, entry := range zr.File {
+			if !entry.Mode().IsRegular() {
+				continue
+			}
+			if err = extract(entry.Name, entry.Open); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	for _, e := range entries {
+		if e.staged == "" {
+			return fmt.Errorf("%w: %s", ErrMemberNotFound, e.member)
+		}
+	}
+	return nil
+}
+
+// stage write the content of the file next to its target
+func (e *bundleEntry) stage(r io.Reader) error {
+	dir := filepath.Dir(e.target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	staged := filepath.Join(dir, fmt.Sprintf(".%s.new", filepath.Base(e.target)))
+	_ = os.Remove(staged)
+	fp, err := openFile(staged, os.O_CREATE|os.O_EXCL|os.O_WRONLY, e.mode)
+	if err != nil {
+		return err
+	}
+	e.staged = staged
+	os.Chmod(staged, e.mode)
+	if _, err = io.Copy(fp, r); err != nil {
+		fp.Close()
+		return err
+	}
+	fp.Sync()
+	return fp.Close()
+}
+
+// swapBundle move every staged file over its target, the executable first, restoring the replaced files if one
+// of them fails. As swapExecutable does, each replaced file is kept at backupPath, or oldSavePath for the
+// executable: hard linked where the file can be renamed over, so a target is never missing, moved on Windows.
+func swapBundle(entries []*bundleEntry, oldSavePath string) error {
+	for i, e := range entries {
+		backup := backupPath(e.target)
+		if i == 0 && oldSavePath != "" {
+			backup = oldSavePath
+		}
+		_ = retryLocked(func() error { return os.Remove(backup) })
+
+		var err error
+		if _, err = os.Lstat(e.target); err == nil {
+			if runtime.GOOS == "windows" {
+				err = retryLocked(func() error { return os.Rename(e.target, backup) })
+			} else {
+				err = linkBackup(e.target, backup)
+			}
+		}
+		switch {
+		case err == nil:
+			e.old = backup
+		case !errors.Is(err, os.ErrNotExist):
+			return rollbackBundle(entries[:i], err)
+		}
+
+		if err = retryLocked(func() error { return moveFile(e.staged, e.target, e.mode) }); err != nil {
+			return rollbackBundle(entries[:i+1], err)
+		}
+	}
+	return nil
+}
+
+// rollbackBundle restore the files replaced by the swapped entries after err
+func rollbackBundle(swapped []*bundleEntry, err error) error {
+	var rerr error
+	for i := len(swapped) - 1; i >= 0; i-- {
+		e := swapped[i]
+		var r error
+		if e.old != "" {
+			r = retryLocked(func() error { return os.Rename(e.old, e.target) })
+		} else if _, serr := os.Stat(e.staged); os.IsNotExist(serr) {
+			// the file is new in this version
+			r = os.Remove(e.target)
+		}
+		if r == nil {
+			e.old = ""
+		} else if rerr == nil {
+			rerr = r
+		}
+	}
+	if rerr != nil {
+		return &rollbackErr{err, rerr}
+	}
+	return err
+}
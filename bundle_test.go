@@ -0,0 +1,81 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyBundle(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	bundle := zipped(t, map[string][]byte{
+		"myapp/myapp":        newFile,
+		"myapp/myapp-helper": []byte("helper"),
+		"myapp/share/db":     []byte("data"),
+	})
+	files := []BundleFile{{Member: "myapp-helper", Path: "myapp-helper", Mode: 0755}, {Member: "myapp/share/db", Path: "share/db"}}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "myapp")
+	writeOldFile(target, t)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "myapp-helper"), []byte("old helper"), 0755))
+
+	// the signature covers the archive, not the executable
+	err = Apply(bytes.NewReader(bundle), Options{TargetPath: target, Archive: "zip", Files: files, PublicKey: pub, Signature: ed25519.Sign(priv, newFile)})
+	assert.NotNil(t, err)
+	err = Apply(bytes.NewReader(bundle), Options{TargetPath: target, Archive: "zip", Files: files, PublicKey: pub, Signature: ed25519.Sign(priv, bundle)})
+	validateUpdate(target, err, t)
+
+	helper, err := os.ReadFile(filepath.Join(dir, "myapp-helper"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("helper"), helper)
+	data, err := os.ReadFile(filepath.Join(dir, "share", "db"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	// only the replaced executable is kept, the other replaced files are removed
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+	backup, err := os.ReadFile(filepath.Join(dir, ".myapp.bak"))
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, backup)
+
+	err = Apply(bytes.NewReader(bundle), Options{TargetPath: target, Archive: "zip", Files: []BundleFile{{Member: "missing", Path: "missing"}}})
+	assert.True(t, errors.Is(err, ErrMemberNotFound))
+	err = Apply(bytes.NewReader(bundle), Options{TargetPath: target, Archive: "zip", Files: []BundleFile{{Member: "myapp-helper", Path: "../escape"}}})
+	assert.NotNil(t, err)
+}
+
+func TestApplyBundleRollback(t *testing.T) {
+	bundle := zipped(t, map[string][]byte{"myapp": newFile, "new-file": []byte("new"), "helper": []byte("helper")})
+	files := []BundleFile{{Member: "new-file", Path: "new-file"}, {Member: "helper", Path: "helper"}}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "myapp")
+	writeOldFile(target, t)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "helper"), []byte("old helper"), 0644))
+	// the helper can't be moved out of the way, so the update must be undone
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, ".helper.bak", "busy"), 0755))
+
+	err := Apply(bytes.NewReader(bundle), Options{TargetPath: target, Archive: "zip", Files: files})
+	assert.NotNil(t, err)
+	assert.Nil(t, RollbackError(err))
+
+	data, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, data)
+	helper, err := os.ReadFile(filepath.Join(dir, "helper"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old helper"), helper)
+	_, err = os.Stat(filepath.Join(dir, "new-file"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, ".helper.new"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,134 @@
+package selfupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ErrBurnInFailed is returned when at least one self test failed against the new executable
+var ErrBurnInFailed = errors.New("burn-in self test failed")
+
+// SelfTest define a test run against the new executable before it replace the running one
+type SelfTest struct {
+	Name string                        // Name used to report the result of the test
+	Run  func(executable string) error // Test the executable at the given path, usually by starting it with some test flags
+}
+
+// SelfTestResult is the outcome of a SelfTest
+type SelfTestResult struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Error    string   `json:"error,omitempty"`
+	Duration Duration `json:"duration"`
+}
+
+// BurnInReport is sent to the BurnInReporter once all the self tests have run
+type BurnInReport struct {
+	Version string           `json:"version"`
+	OS      string           `json:"os"`
+	Arch    string           `json:"arch"`
+	Passed  bool             `json:"passed"`
+	Results []SelfTestResult `json:"results"`
+}
+
+// BurnInReporter define a way to report burn-in results to the server. A non nil error means the server
+// refused the report and the update will not be applied.
+type BurnInReporter interface {
+	ReportBurnIn(report *BurnInReport) error
+}
+
+// BurnIn define a self test suite run against the new executable, staged in its secondary slot as defined by
+// Config.Staging, before it is allowed to replace the running executable. This is meant for safety-critical
+// fleets where an update that doesn't pass the tests on the device itself must never reach the primary slot.
+type BurnIn struct {
+	Tests    []SelfTest     // Self tests to run, in order
+	Reporter BurnInReporter // Where to report the results, default to the Source if it is a BurnInReporter
+}
+
+// Register add a self test to the suite
+func (b *BurnIn) Register(name string, run func(executable string) error) {
+	b.Tests = append(b.Tests, SelfTest{Name: name, Run: run})
+}
+
+// run execute all the self tests against executable and report the result. The update can only proceed if
+// all the tests passed and the report was accepted.
+func (b *BurnIn) run(executable string, v *Version, reporter BurnInReporter) error {
+	report := &BurnInReport{OS: runtime.GOOS, Arch: runtime.GOARCH, Passed: true}
+	if v != nil {
+		report.Version = v.Number
+	}
+
+	var failed []string
+	for _, test := range b.Tests {
+		logInfo("Running burn-in self test %s.\n", test.Name)
+		start := time.Now()
+		err := runSelfTest(test, executable)
+		result := SelfTestResult{Name: test.Name, Passed: err == nil, Duration: Duration(time.Since(start))}
+		if err != nil {
+			logError("Burn-in self test %s failed: %s\n", test.Name, err)
+			result.Error = err.Error()
+			report.Passed = false
+			failed = append(failed, test.Name)
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if reporter != nil {
+		if err := reporter.ReportBurnIn(report); err != nil {
+			return fmt.Errorf("error reporting burn-in results: %s", err)
+		}
+	}
+
+	if !report.Passed {
+		return fmt.Errorf("%w: %s", ErrBurnInFailed, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runSelfTest run a single test, a panic being reported as a failure so that a buggy test can't take the updater down
+func runSelfTest(test SelfTest, executable string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return test.Run(executable)
+}
+
+type httpBurnInReporter struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPBurnInReporter returns a BurnInReporter that POST the report as JSON to url. Any answer other
+// than a 2xx status refuse the update.
+func NewHTTPBurnInReporter(client *http.Client, url string) BurnInReporter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpBurnInReporter{client: client, url: url}
+}
+
+func (h *httpBurnInReporter) ReportBurnIn(report *BurnInReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("burn-in report refused by %s: %s", h.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package selfupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBurnIn(t *testing.T) {
+	var received *BurnInReport
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = &BurnInReport{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(received))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var tested []string
+	b := &BurnIn{Reporter: NewHTTPBurnInReporter(nil, server.URL)}
+	b.Register("starts", func(executable string) error {
+		tested = append(tested, executable)
+		return nil
+	})
+
+	assert.Nil(t, b.run("/slot/app", &Version{Number: "1.1.0"}, b.Reporter))
+	assert.Equal(t, []string{"/slot/app"}, tested)
+	assert.True(t, received.Passed)
+	assert.Equal(t, "1.1.0", received.Version)
+	assert.Len(t, received.Results, 1)
+
+	// the server can veto the update even if all the tests passed
+	status = http.StatusConflict
+	assert.NotNil(t, b.run("/slot/app", &Version{Number: "1.1.0"}, b.Reporter))
+
+	status = http.StatusOK
+	b.Register("panics", func(string) error { panic("boom") })
+	b.Register("fails", func(string) error { return errors.New("wrong answer") })
+	err := b.run("/slot/app", &Version{Number: "1.1.0"}, b.Reporter)
+	assert.ErrorIs(t, err, ErrBurnInFailed)
+	assert.False(t, received.Passed)
+	assert.Equal(t, "panic: boom", received.Results[1].Error)
+	assert.Equal(t, "wrong answer", received.Results[2].Error)
+}
+
+func TestApplyBurnIn(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	assert.Nil(t, os.WriteFile(target, oldFile, 0755))
+
+	var staged string
+	err := apply(bytes.NewReader(newFile), &Options{TargetPath: target, BurnIn: func(path string) error {
+		staged = path
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, newFile, content)
+		return ErrBurnInFailed
+	}})
+	assert.ErrorIs(t, err, ErrBurnInFailed)
+
+	// the primary slot is untouched and the secondary one is cleaned up
+	content, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+	_, err = os.Stat(staged)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, apply(bytes.NewReader(newFile), &Options{TargetPath: target, BurnIn: func(string) error { return nil }}))
+	content, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
@@ -0,0 +1,183 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// downloadCacheDir returns the directory downloads are cached in, by default a directory named after the
+// executable in the user cache directory
+func downloadCacheDir(conf *Config) (string, error) {
+	if conf.CacheDir != "" {
+		return conf.CacheDir, nil
+	}
+	return cacheDir("downloads")
+}
+
+// cachePath returns where the download of v is cached, it is only cached when caching is enabled and v announces
+// the digest of the download, so that a rebuilt release is never confused with the cached one
+func cachePath(conf *Config, v *Version) (string, bool) {
+	if conf.CacheSize <= 0 || v.Digest == nil || !v.DigestHash.Available() {
+		return "", false
+	}
+	if v.Number == "" || v.Number == "." || v.Number == ".." || strings.ContainsAny(v.Number, `/\`) {
+		return "", false
+	}
+	dir, err := downloadCacheDir(conf)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, v.Number+"-"+hex.EncodeToString(v.Digest)), true
+}
+
+// getCached returns the cached download of v if there is one
+func getCached(ctx context.Context, conf *Config, v *Version) (io.ReadCloser, int64, bool) {
+	path, ok := cachePath(conf, v)
+	if !ok {
+		return nil, 0, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	// a damaged download would otherwise fail every update
+	h := v.DigestHash.New()
+	size, err := io.Copy(h, f)
+	if err == nil && !bytes.Equal(h.Sum(nil), v.Digest) {
+		logError("Removing the corrupted cached download of version %s.\n", v.Number)
+		f.Close()
+		os.Remove(path)
+		return nil, 0, false
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, false
+	}
+	// keep the most recently used downloads when evicting
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	logInfo("Using the cached download of version %s.\n", v.Number)
+	return newContextReader(ctx, f), size, true
+}
+
+// cacheDownload returns r, writing what is read from it to the cache. The download is only kept once it was
+// entirely read and matches the digest of v.
+func cacheDownload(conf *Config, v *Version, r io.ReadCloser) io.ReadCloser {
+	path, ok := cachePath(conf, v)
+	if !ok {
+		return r
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logDebug("Unable to create the download cache: %v\n", err)
+		return r
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		logDebug("Unable to create the download cache: %v\n", err)
+		return r
+	}
+	return &cachingReader{ReadCloser: r, file: f, hash: v.DigestHash.New(), conf: conf, v: v, path: path}
+}
+
+// cachingReader copy a download to a temporary file of the cache, moved in place once the download is complete
+type cachingReader struct {
+	io.ReadCloser
+	file *os.File
+	hash hash.Hash
+	conf *Config
+	v    *Version
+	path string
+	size int64
+}
+
+func (c *cachingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 && c.file != nil {
+		c.hash.Write(p[:n])
+		c.size += int64(n)
+		if _, werr := c.file.Write(p[:n]); werr != nil || c.size > c.conf.CacheSize {
+			// don't fail the download because it can't be cached
+			c.discard()
+		}
+	}
+	if err == io.EOF && c.file != nil {
+		c.commit()
+	}
+	return n, err
+}
+
+func (c *cachingReader) Close() error {
+	c.discard()
+	return c.ReadCloser.Close()
+}
+
+func (c *cachingReader) discard() {
+	if c.file == nil {
+		return
+	}
+	c.file.Close()
+	os.Remove(c.file.Name())
+	c.file = nil
+}
+
+func (c *cachingReader) commit() {
+	if !bytes.Equal(c.hash.Sum(nil), c.v.Digest) {
+		c.discard()
+		return
+	}
+	tmp := c.file.Name()
+	err := c.file.Close()
+	c.file = nil
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		logDebug("Unable to cache the download of version %s: %v\n", c.v.Number, err)
+		os.Remove(tmp)
+		return
+	}
+	evictCache(filepath.Dir(c.path), c.conf.CacheSize)
+}
+
+// evictCache remove the least recently used downloads of dir until they fit in size bytes
+func evictCache(dir string, size int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var files []os.FileInfo
+	total := int64(0)
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, info := range files {
+		if total <= size {
+			return
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err == nil {
+			logDebug("Evicted %s from the download cache.\n", info.Name())
+			total -= info.Size()
+		}
+	}
+}
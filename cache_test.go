@@ -0,0 +1,75 @@
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadCache(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(newFile)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	conf := &Config{
+		Source:    NewHTTPSource(nil, server.URL+"/app-{{.Version}}"),
+		CacheSize: int64(2 * len(newFile)),
+		CacheDir:  dir,
+	}
+	u := &Updater{conf: conf}
+	digest := sha256.Sum256(newFile)
+	download := func(number string, digest []byte) []byte {
+		r, _, err := u.Download(&Version{Number: number, DigestHash: crypto.SHA256, Digest: digest})
+		assert.Nil(t, err)
+		content, _ := io.ReadAll(r)
+		r.Close()
+		return content
+	}
+
+	assert.Equal(t, newFile, download("1.1.0", digest[:]))
+	assert.Equal(t, newFile, download("1.1.0", digest[:]))
+	assert.Equal(t, 1, downloads)
+	_, err := os.Stat(filepath.Join(dir, fmt.Sprintf("1.1.0-%x", digest)))
+	assert.Nil(t, err)
+
+	// a download that doesn't match its digest isn't kept
+	wrong := sha256.Sum256(oldFile)
+	download("1.1.0", wrong[:])
+	download("1.1.0", wrong[:])
+	assert.Equal(t, 3, downloads)
+
+	// a corrupted cached download is downloaded again
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("1.1.0-%x", digest)), oldFile, 0644))
+	assert.Equal(t, newFile, download("1.1.0", digest[:]))
+	assert.Equal(t, 4, downloads)
+
+	// the least recently used download is evicted
+	past := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, fmt.Sprintf("1.1.0-%x", digest)), past, past))
+	download("1.2.0", digest[:])
+	download("1.3.0", digest[:])
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	_, err = os.Stat(filepath.Join(dir, fmt.Sprintf("1.1.0-%x", digest)))
+	assert.True(t, os.IsNotExist(err))
+
+	// nothing is cached unless enabled
+	conf.CacheSize = 0
+	download("1.4.0", digest[:])
+	_, err = os.Stat(filepath.Join(dir, fmt.Sprintf("1.4.0-%x", digest)))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,84 @@
+package selfupdate
+
+import (
+	"runtime"
+)
+
+// capabilitiesSchema is increased every time a field is added to Capabilities
+const capabilitiesSchema = 2
+
+// Capabilities describe what the running build of the library supports and what the Updater is configured to
+// use. It is meant to be serialized to JSON and reported to the update server or support tooling, so they can
+// adapt to the variety of clients deployed in the field.
+type Capabilities struct {
+	Schema     int      `json:"schema"`     // Version of this description, to know which fields can be expected
+	OS         string   `json:"os"`         // runtime.GOOS
+	Arch       string   `json:"arch"`       // runtime.GOARCH
+	Current    string   `json:"current"`    // Version currently running, if known
+	Hashes     []string `json:"hashes"`     // Digests that can be checked
+	Signatures []string `json:"signatures"` // Signature formats that can be verified
+	Delta      []string `json:"delta"`      // Binary patch formats that can be applied
+	Codecs     []string `json:"codecs"`     // Compression formats updates and patches can be decoded from
+	Archives   []string `json:"archives"`   // Archive formats an executable can be extracted from
+	Appliers   []string `json:"appliers"`   // Ways an update can be installed
+	Manifest   []string `json:"manifest"`   // Optional manifest fields that are understood
+	Verifiers  []string `json:"verifiers"`  // Verifications required by the configuration, every update must pass them
+}
+
+// Capabilities returns what the running build supports and what the Updater is configured to require
+func (u *Updater) Capabilities() *Capabilities {
+	conf := u.config()
+
+	c := &Capabilities{
+		Schema:     capabilitiesSchema,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Hashes:     []string{"sha256", "sha512"},
+		Signatures: []string{"ed25519", "ed25519-threshold", "rsa", "ecdsa", "openpgp", "minisign", "signify", "cosign", "in-toto"},
+		Delta:      []string{"bsdiff"},
+		Codecs:     Codecs(),
+		Archives:   []string{},
+		Appliers:   []string{"replace", "rename", "relocate", "staging", "burn-in", "recovery"},
+		Manifest:   []string{"sha256", "sha512", "executable", "install_path", "yanked", "consent", "requires", "available_from", "end_of_support", "size", "signature", "codec", "archive", "member", "patches", "signed", "files", "channel", "arch", "goarm", "goamd64", "libc", "universal", "release_notes", "release_notes_url", "minimum_version", "mandatory", "rollout", "name", "published", "criticality"},
+		Verifiers:  []string{},
+	}
+	if deviceSupported {
+		c.Appliers = append(c.Appliers, "device")
+	}
+	switch runtime.GOOS {
+	case "windows":
+		c.Signatures = append(c.Signatures, "authenticode")
+		c.Appliers = append(c.Appliers, "installer")
+	case "darwin":
+		c.Signatures = append(c.Signatures, "codesign")
+	case "linux":
+		c.Appliers = append(c.Appliers, "appimage")
+	}
+	if conf.Current != nil {
+		c.Current = conf.Current.Number
+	}
+
+	if requireSignature(conf) {
+		c.Verifiers = append(c.Verifiers, "signature")
+	}
+	if conf.RequireChecksum {
+		c.Verifiers = append(c.Verifiers, "checksum")
+	}
+	for _, v := range []struct {
+		name       string
+		configured bool
+	}{
+		{"openpgp", conf.GPGVerifier != nil},
+		{"minisign", conf.MinisignVerifier != nil},
+		{"cosign", conf.CosignVerifier != nil},
+		{"in-toto", conf.AttestationVerifier != nil},
+		{"authenticode", conf.AuthenticodeVerifier != nil && runtime.GOOS == "windows"},
+		{"codesign", conf.CodesignVerifier != nil && runtime.GOOS == "darwin"},
+		{"burn-in", conf.BurnIn != nil},
+	} {
+		if v.configured {
+			c.Verifiers = append(c.Verifiers, v.name)
+		}
+	}
+	return c
+}
@@ -0,0 +1,30 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	u := &Updater{conf: &Config{Current: &Version{Number: "1.2.0"}, MinisignVerifier: &MinisignVerifier{}, RequireChecksum: true}}
+	c := u.Capabilities()
+	assert.Equal(t, runtime.GOOS, c.OS)
+	assert.Equal(t, runtime.GOARCH, c.Arch)
+	assert.Equal(t, "1.2.0", c.Current)
+	assert.Contains(t, c.Delta, "bsdiff")
+	assert.Contains(t, c.Signatures, "minisign")
+	assert.Equal(t, []string{"checksum", "minisign"}, c.Verifiers)
+
+	u = &Updater{conf: &Config{}}
+	assert.Equal(t, []string{"signature"}, u.Capabilities().Verifiers)
+
+	b, err := json.Marshal(u.Capabilities())
+	assert.Nil(t, err)
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, float64(capabilitiesSchema), decoded["schema"])
+	assert.Equal(t, []interface{}{}, decoded["archives"])
+}
@@ -0,0 +1,84 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"io"
+)
+
+// ChainedSource provide a Source that get the latest version information from one Source and download the
+// executable and its signature from another. This allow check traffic and download traffic to go to different
+// systems, for example a JSON manifest endpoint and a CDN or S3 bucket.
+type ChainedSource struct {
+	versions Source
+	payload  Source
+}
+
+var _ HashSource = (*ChainedSource)(nil)
+var _ ContextSource = (*ChainedSource)(nil)
+
+// NewChainedSource returns a Source that will use versions.LatestVersion to find the latest version and
+// payload.Get and payload.GetSignature to download it. When payload is a HTTPSource, its URL can use
+// the {{.Version}} template parameter to point to the version announced by versions.
+func NewChainedSource(versions Source, payload Source) Source {
+	return &ChainedSource{versions: versions, payload: payload}
+}
+
+// Get will return the executable from the payload source
+func (c *ChainedSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	return c.payload.Get(v)
+}
+
+// GetContext will return the executable from the payload source, the download is interrupted once ctx is done
+func (c *ChainedSource) GetContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) {
+	return getExecutable(ctx, c.payload, v)
+}
+
+// resolve returns the URL the payload source downloads the executable of v from
+func (c *ChainedSource) resolve(v *Version) string {
+	if r, ok := c.payload.(urlResolver); ok {
+		return r.resolve(v)
+	}
+	return ""
+}
+
+// GetSignature will return the signature from the payload source
+func (c *ChainedSource) GetSignature() ([]byte, error) {
+	return c.payload.GetSignature()
+}
+
+// GetSignatureContext will return the signature of the executable of v from the payload source, or ctx.Err() once
+// ctx is done
+func (c *ChainedSource) GetSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	return getSignature(ctx, c.payload, v)
+}
+
+// LatestVersion will return the latest version from the version source
+func (c *ChainedSource) LatestVersion() (*Version, error) {
+	return c.versions.LatestVersion()
+}
+
+// LatestVersionContext will return the latest version from the version source, or ctx.Err() once ctx is done
+func (c *ChainedSource) LatestVersionContext(ctx context.Context) (*Version, error) {
+	return latestVersion(ctx, c.versions)
+}
+
+// GetHash will return the digest from the payload source if it is a HashSource
+func (c *ChainedSource) GetHash() (crypto.Hash, []byte, error) {
+	hs, ok := c.payload.(HashSource)
+	if !ok {
+		return 0, nil, errors.New("payload source doesn't provide digest")
+	}
+	return hs.GetHash()
+}
+
+// GetHashContext will return the digest of the executable of v from the payload source if it is a HashSource, or
+// ctx.Err() once ctx is done
+func (c *ChainedSource) GetHashContext(ctx context.Context, v *Version) (crypto.Hash, []byte, error) {
+	hs, ok := c.payload.(HashSource)
+	if !ok {
+		return 0, nil, errors.New("payload source doesn't provide digest")
+	}
+	return getHash(ctx, hs, v)
+}
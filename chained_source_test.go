@@ -0,0 +1,50 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainedSource(t *testing.T) {
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"download_url":"https://unused/","version":"1.1.0"}]`, runtime.GOOS)
+	}))
+	defer manifest.Close()
+
+	signature := make([]byte, 64)
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app-1.1.0":
+			w.Write([]byte("executable"))
+		case "/app-1.1.0.ed25519":
+			w.Write(signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cdn.Close()
+
+	source := NewChainedSource(NewHTTPSource(nil, manifest.URL), NewHTTPSource(nil, cdn.URL+"/app-{{.Version}}"))
+
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+
+	r, _, err := source.Get(v)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "executable", string(body))
+
+	s, err := source.(ContextSource).GetSignatureContext(context.Background(), v)
+	assert.Nil(t, err)
+	assert.Equal(t, signature, s)
+}
@@ -0,0 +1,110 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-512 for crypto.Hash
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrNoChecksum is returned when Config.RequireChecksum is set and the digest of an update could not be found
+var ErrNoChecksum = errors.New("no checksum available for the update")
+
+// HashSource define a Source that is able to provide the digest of the executable independently of its content
+type HashSource interface {
+	Source
+	GetHash() (crypto.Hash, []byte, error) // Get the hash function and digest of the executable, SHA-256 or SHA-512
+}
+
+// newHashReader returns a reader that will fail at the end of r if its content doesn't match the expected digest
+func newHashReader(r io.ReadCloser, h crypto.Hash, expected []byte) (io.ReadCloser, error) {
+	if !h.Available() {
+		return nil, errors.New("requested hash function not available")
+	}
+	if len(expected) != h.Size() {
+		return nil, fmt.Errorf("checksum must be %v bytes long and was %v", h.Size(), len(expected))
+	}
+	return &hashReader{ReadCloser: r, hash: h.New(), expected: expected}, nil
+}
+
+// hashReader compute the digest of everything read and fail at the end of the stream if it doesn't match expected
+type hashReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+}
+
+var _ io.ReadCloser = (*hashReader)(nil)
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.ReadCloser.Read(p)
+	hr.hash.Write(p[:n])
+	if err == io.EOF {
+		if sum := hr.hash.Sum(nil); !bytes.Equal(sum, hr.expected) {
+			return n, fmt.Errorf("downloaded file has wrong checksum. Expected: %x, got: %x", hr.expected, sum)
+		}
+	}
+	return n, err
+}
+
+// ErrSizeMismatch is returned when the executable downloaded doesn't have the size announced by the manifest
+var ErrSizeMismatch = errors.New("downloaded file doesn't have the expected size")
+
+// sizeReader fail as soon as more than expected bytes are read, or at the end of the stream if fewer were
+type sizeReader struct {
+	io.ReadCloser
+	expected int64
+	read     int64
+}
+
+var _ io.ReadCloser = (*sizeReader)(nil)
+
+func (sr *sizeReader) Read(p []byte) (int, error) {
+	n, err := sr.ReadCloser.Read(p)
+	sr.read += int64(n)
+	if sr.read > sr.expected {
+		return n, fmt.Errorf("%w. Expected: %d bytes, got more", ErrSizeMismatch, sr.expected)
+	}
+	if err == io.EOF && sr.read != sr.expected {
+		return n, fmt.Errorf("%w. Expected: %d bytes, got: %d", ErrSizeMismatch, sr.expected, sr.read)
+	}
+	return n, err
+}
+
+// decodeDigest decode the hex digest from a manifest, only one of sha256 or sha512 is expected to be set
+func decodeDigest(sha256Hex, sha512Hex string) (crypto.Hash, []byte, error) {
+	h, digestHex := crypto.SHA256, sha256Hex
+	if digestHex == "" {
+		h, digestHex = crypto.SHA512, sha512Hex
+	}
+	if digestHex == "" {
+		return 0, nil, nil
+	}
+	digest, err := parseChecksum([]byte(digestHex), h.Size())
+	if err != nil {
+		return 0, nil, err
+	}
+	return h, digest, nil
+}
+
+// parseChecksum decode the first field of a sha256sum style line: "<hex digest>  <filename>"
+func parseChecksum(content []byte, size int) ([]byte, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty checksum file")
+	}
+	digest, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q: %s", fields[0], err)
+	}
+	if len(digest) != size {
+		return nil, fmt.Errorf("checksum must be %v bytes long and was %v", size, len(digest))
+	}
+	return digest, nil
+}
@@ -0,0 +1,146 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashReader(t *testing.T) {
+	data := []byte("this is some test data that should arrive on the other end of the pipe")
+	sum := sha512.Sum512(data)
+
+	r, err := newHashReader(io.NopCloser(bytes.NewReader(data)), crypto.SHA512, sum[:])
+	assert.Nil(t, err)
+	body, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, data, body)
+
+	r, err = newHashReader(io.NopCloser(bytes.NewReader(data[1:])), crypto.SHA512, sum[:])
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.NotNil(t, err)
+
+	_, err = newHashReader(io.NopCloser(bytes.NewReader(data)), crypto.SHA256, sum[:])
+	assert.NotNil(t, err)
+}
+
+func TestDecodeDigest(t *testing.T) {
+	sum := sha256.Sum256(newFile)
+
+	h, digest, err := decodeDigest(hex.EncodeToString(sum[:]), "")
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.SHA256, h)
+	assert.Equal(t, sum[:], digest)
+
+	_, digest, err = decodeDigest("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, digest)
+
+	_, _, err = decodeDigest("", hex.EncodeToString(sum[:]))
+	assert.NotNil(t, err)
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256.Sum256(newFile)
+
+	digest, err := parseChecksum([]byte(hex.EncodeToString(sum[:])+"  myapp-linux-amd64\n"), sha256.Size)
+	assert.Nil(t, err)
+	assert.Equal(t, sum[:], digest)
+
+	_, err = parseChecksum([]byte("not hex"), sha256.Size)
+	assert.NotNil(t, err)
+}
+
+func TestUpdaterRequireChecksum(t *testing.T) {
+	u := &Updater{conf: &Config{Source: &ChainedSource{}, RequireChecksum: true}}
+	_, err := u.checksumReader(context.Background(), &Version{}, io.NopCloser(bytes.NewReader(newFile)))
+	assert.ErrorIs(t, err, ErrNoChecksum)
+
+	sum := sha256.Sum256(newFile)
+	r, err := u.checksumReader(context.Background(), &Version{DigestHash: crypto.SHA256, Digest: sum[:]}, io.NopCloser(bytes.NewReader(newFile)))
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.Nil(t, err)
+}
+
+func TestSizeReader(t *testing.T) {
+	data := []byte("exactly this")
+	for _, c := range []struct {
+		expected int64
+		valid    bool
+	}{
+		{int64(len(data)), true},
+		{int64(len(data)) - 1, false},
+		{int64(len(data)) + 1, false},
+	} {
+		_, err := io.ReadAll(&sizeReader{ReadCloser: io.NopCloser(bytes.NewReader(data)), expected: c.expected})
+		if c.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.True(t, errors.Is(err, ErrSizeMismatch), c.expected)
+		}
+	}
+}
+
+func TestManifestPinnedVersion(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	var size int
+	var served []byte
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":"%s/app","size":%d,"signature":%q}]`,
+				runtime.GOOS, server.URL, size, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, newFile)))
+		case "/app":
+			w.Write(served)
+		default:
+			// the CDN doesn't serve signatures, the manifest does
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewHTTPSource(nil, server.URL+"/manifest").LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, ed25519.Sign(priv, newFile), v.Signature)
+
+	target := filepath.Join(t.TempDir(), "app")
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: pub, VersionStore: &memoryVersionStore{}}
+
+	size, served = len(newFile), newFile
+	assert.Nil(t, Recover(conf, target))
+	content, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+
+	// a truncated download is refused before being verified
+	served = newFile[:len(newFile)-1]
+	assert.True(t, errors.Is(Recover(conf, target), ErrSizeMismatch))
+
+	// an older executable signed with the same key is refused too
+	served = oldFile
+	assert.NotNil(t, Recover(conf, target))
+	content, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
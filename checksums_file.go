@@ -0,0 +1,129 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ChecksumsFileSource wrap a Source to provide the digest of the executable from a goreleaser style checksums.txt
+// file, one "<hex digest>  <asset name>" per line. The Updater will verify the download against it.
+type ChecksumsFileSource struct {
+	Source
+	client       *http.Client
+	checksumsURL string
+	asset        string
+	publicKey    ed25519.PublicKey
+
+	lock    sync.Mutex
+	version *Version
+}
+
+var _ HashSource = (*ChecksumsFileSource)(nil)
+
+// NewChecksumsFileSource returns a HashSource that download executable and signature from source and their digest
+// from checksumsURL. Both checksumsURL and asset are templates accepting the same parameters as NewHTTPSource.
+// asset is the name of the entry to look for, if empty the base name of the HTTPSource download URL is used.
+// If publicKey is not nil, the checksums file must be signed by it, with the signature served at ${checksumsURL}.ed25519.
+func NewChecksumsFileSource(source Source, client *http.Client, checksumsURL, asset string, publicKey ed25519.PublicKey) *ChecksumsFileSource {
+	return &ChecksumsFileSource{Source: source, client: secureClient(client), checksumsURL: checksumsURL, asset: asset, publicKey: publicKey}
+}
+
+// Get will return the executable from the wrapped source and remember the version for GetHash
+func (c *ChecksumsFileSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	c.lock.Lock()
+	c.version = v
+	c.lock.Unlock()
+
+	return c.Source.Get(v)
+}
+
+// GetHash will return the digest listed in the checksums file for the asset
+func (c *ChecksumsFileSource) GetHash() (crypto.Hash, []byte, error) {
+	c.lock.Lock()
+	v := c.version
+	c.lock.Unlock()
+	return c.GetHashContext(context.Background(), v)
+}
+
+// GetHashContext is GetHash for the asset of v, the requests are interrupted once ctx is done
+func (c *ChecksumsFileSource) GetHashContext(ctx context.Context, v *Version) (crypto.Hash, []byte, error) {
+	asset := expandURLTemplate(c.asset, v)
+	if asset == "" {
+		h, ok := c.Source.(*HTTPSource)
+		if !ok {
+			return 0, nil, errors.New("asset name is required when the source isn't a HTTPSource")
+		}
+		asset = path.Base(h.resolve(v))
+	}
+
+	url := expandURLTemplate(c.checksumsURL, v)
+	content, err := c.download(ctx, url, 1<<20)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if c.publicKey != nil {
+		signature, err := c.download(ctx, url+".ed25519", ed25519.SignatureSize+1)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ed25519.Verify(c.publicKey, content, signature) {
+			return 0, nil, errors.New("invalid ed25519 signature for checksums file")
+		}
+	}
+
+	return findChecksum(content, asset)
+}
+
+func (c *ChecksumsFileSource) download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatus(url, resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// findChecksum look for asset in a checksums file and guess the hash function from the digest length
+func findChecksum(content []byte, asset string) (crypto.Hash, []byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != asset {
+			continue
+		}
+
+		for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA512} {
+			if len(fields[0]) == hexLen(h) {
+				digest, err := parseChecksum([]byte(fields[0]), h.Size())
+				return h, digest, err
+			}
+		}
+		return 0, nil, fmt.Errorf("unsupported digest length for %s", asset)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, fmt.Errorf("no checksum found for %s", asset)
+}
+
+func hexLen(h crypto.Hash) int {
+	return h.Size() * 2
+}
@@ -0,0 +1,73 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumsFileSource(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	digest := sha256.Sum256(newFile)
+	checksums := []byte(fmt.Sprintf("%x  myapp_1.1.0_darwin_arm64.tar.gz\n%x  myapp_1.1.0_linux_amd64\n", sha256.Sum256(oldFile), digest))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1.0/checksums.txt":
+			w.Write(checksums)
+		case "/1.1.0/checksums.txt.ed25519":
+			w.Write(ed25519.Sign(priv, checksums))
+		case "/1.1.0/myapp_1.1.0_linux_amd64", "/1.2.0/myapp_1.2.0_linux_amd64":
+			w.Write(newFile)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := NewChecksumsFileSource(NewHTTPSource(nil, server.URL+"/{{.Version}}/myapp_{{.Version}}_linux_amd64"), nil, server.URL+"/{{.Version}}/checksums.txt", "", pub)
+	r, _, err := source.Get(&Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	r.Close()
+
+	h, sum, err := source.GetHash()
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.SHA256, h)
+	assert.Equal(t, digest[:], sum)
+
+	// the asset of the version asked for, not of the last download
+	r, _, err = source.Get(&Version{Number: "1.2.0"})
+	assert.Nil(t, err)
+	r.Close()
+	h, sum, err = source.GetHashContext(context.Background(), &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.SHA256, h)
+	assert.Equal(t, digest[:], sum)
+
+	wrongPub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	source.publicKey = wrongPub
+	_, _, err = source.GetHash()
+	assert.NotNil(t, err)
+}
+
+func TestFindChecksum(t *testing.T) {
+	digest := sha256.Sum256(newFile)
+	content := []byte(fmt.Sprintf("%x *myapp.exe\n", digest))
+
+	_, sum, err := findChecksum(content, "myapp.exe")
+	assert.Nil(t, err)
+	assert.Equal(t, digest[:], sum)
+
+	_, _, err = findChecksum(content, "other")
+	assert.NotNil(t, err)
+}
@@ -14,8 +14,10 @@ func main() {
 	// Used `selfupdatectl create-keys` followed by `selfupdatectl print-key`
 	publicKey := ed25519.PublicKey{178, 103, 83, 57, 61, 138, 18, 249, 244, 80, 163, 162, 24, 251, 190, 241, 11, 168, 179, 41, 245, 27, 166, 70, 220, 254, 118, 169, 101, 26, 199, 129}
 
-	// The public key above match the signature of the below file served by our CDN
-	httpSource := selfupdate.NewHTTPSource(nil, "http://geoffrey-test-artefacts.fynelabs.com/nomad.exe")
+	// The public key above match the signature of the below file served by our CDN, which is only reachable over
+	// plain HTTP, so this example has to opt into it
+	insecure := &selfupdate.SecurityPolicy{AllowInsecure: true}
+	httpSource := selfupdate.NewHTTPSource(insecure.Client(nil), "http://geoffrey-test-artefacts.fynelabs.com/nomad.exe")
 	config := &selfupdate.Config{
 		Source: httpSource,
 		Schedule: selfupdate.Schedule{
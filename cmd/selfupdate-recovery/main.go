@@ -0,0 +1,74 @@
+// selfupdate-recovery is a tiny recovery stub for unattended installations. It checks that the application can
+// still start and, if it can't, reinstall the latest verified release from the source of the application
+// configuration file. Run it from the service manager when the application fails, for example with systemd
+// OnFailure=, or embed it in the application and install it with selfupdate.InstallRecoveryStub.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Lamdt03/selfupdate"
+)
+
+func main() {
+	config := flag.String("config", "", "The JSON updater configuration of the application, see selfupdate.LoadConfigFile.")
+	target := flag.String("target", "", "The executable to repair.")
+	check := flag.String("check", "--version", "Arguments the executable is run with to check it works, empty to only check it exists.")
+	timeout := flag.Duration("timeout", 30*time.Second, "How long the check can take.")
+	force := flag.Bool("force", false, "Reinstall even if the executable works.")
+	flag.Parse()
+
+	if *config == "" || *target == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	selfupdate.LogError = log.Printf
+	selfupdate.LogInfo = log.Printf
+
+	if !*force {
+		err := healthy(*target, *check, *timeout)
+		if err == nil {
+			return
+		}
+		log.Printf("%s is broken: %v\n", *target, err)
+	}
+
+	if err := reinstall(*config, *target); err != nil {
+		log.Fatalf("Recovery failed: %v\n", err)
+	}
+	log.Printf("%s recovered\n", *target)
+}
+
+// healthy run the executable with the check arguments and report if it failed
+func healthy(target string, check string, timeout time.Duration) error {
+	if _, err := os.Stat(target); err != nil {
+		return err
+	}
+	if check == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, target, strings.Fields(check)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func reinstall(config string, target string) error {
+	fc, err := selfupdate.LoadConfigFile(config)
+	if err != nil {
+		return err
+	}
+	return selfupdate.Recover(fc.Config(nil), target)
+}
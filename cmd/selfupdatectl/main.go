@@ -16,6 +16,7 @@ func main() {
 			createKeys(),
 			sign(),
 			check(),
+			verifyRelease(),
 			keyPrint(),
 			s3upload(),
 		},
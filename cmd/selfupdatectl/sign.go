@@ -2,9 +2,12 @@ package main
 
 import (
 	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 
@@ -14,6 +17,8 @@ import (
 type application struct {
 	privateKey string
 	publicKey  string
+	append     bool
+	digest     string
 }
 
 func sign() *cli.Command {
@@ -31,6 +36,16 @@ func sign() *cli.Command {
 				Destination: &a.privateKey,
 				Value:       "ed25519.key",
 			},
+			&cli.StringFlag{
+				Name:        "digest",
+				Usage:       "Sign the sha256 or sha512 digest of the executable instead of its whole content, for clients verifying large updates in constant memory with Config.SignedDigest.",
+				Destination: &a.digest,
+			},
+			&cli.BoolFlag{
+				Name:        "append",
+				Usage:       "Add this signature to the existing .ed25519 file, for clients requiring several signers.",
+				Destination: &a.append,
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 			for _, exe := range ctx.Args().Slice() {
@@ -51,7 +66,12 @@ func (a *application) sign(executable string) error {
 		return err
 	}
 
-	content, err := executableContent(executable)
+	var content []byte
+	if a.digest != "" {
+		content, err = executableDigest(executable, a.digest)
+	} else {
+		content, err = executableContent(executable)
+	}
 	if err != nil {
 		return err
 	}
@@ -62,6 +82,17 @@ func (a *application) sign(executable string) error {
 		return fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", len(signature))
 	}
 
+	if a.append {
+		existing, err := os.ReadFile(executable + ".ed25519")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(existing)%ed25519.SignatureSize != 0 {
+			return fmt.Errorf("%s.ed25519 is not a list of ed25519 signatures", executable)
+		}
+		signature = append(existing, signature...)
+	}
+
 	return os.WriteFile(executable+".ed25519", signature, 0644)
 }
 
@@ -104,3 +135,26 @@ func executableContent(executable string) ([]byte, error) {
 
 	return io.ReadAll(executableFile)
 }
+
+func executableDigest(executable string, digest string) ([]byte, error) {
+	var h hash.Hash
+	switch digest {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported digest %q, sha256 or sha512 expected", digest)
+	}
+
+	executableFile, err := os.Open(executable)
+	if err != nil {
+		return nil, err
+	}
+	defer executableFile.Close()
+
+	if _, err = io.Copy(h, executableFile); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
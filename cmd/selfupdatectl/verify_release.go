@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Lamdt03/selfupdate"
+	"github.com/urfave/cli/v2"
+)
+
+type releaseCheck struct {
+	os              string
+	arch            string
+	requireChecksum bool
+}
+
+func verifyRelease() *cli.Command {
+	a := &application{}
+	c := &releaseCheck{}
+
+	return &cli.Command{
+		Name:  "verify-release",
+		Usage: "Verify a release the same way the selfupdate client would before announcing it",
+		Description: "You must specify the URL or the file of the executable and may specify a filename for the Public Key you want to use.\n" +
+			"The signature is expected at ${URL}.ed25519 and the digest, if any, at ${URL}.sha256 or ${URL}.sha512.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "public-key",
+				Aliases:     []string{"pub"},
+				Usage:       "The public key file to use to verify the signature for this executable.",
+				Destination: &a.publicKey,
+				Value:       "ed25519.pem",
+			},
+			&cli.StringFlag{
+				Name:        "os",
+				Usage:       "The operating system the executable must target (linux, darwin, windows).",
+				Destination: &c.os,
+			},
+			&cli.StringFlag{
+				Name:        "arch",
+				Usage:       "The architecture the executable must target (amd64, arm64, ...).",
+				Destination: &c.arch,
+			},
+			&cli.BoolFlag{
+				Name:        "require-checksum",
+				Usage:       "Fail if no .sha256 or .sha512 digest is published next to the executable.",
+				Destination: &c.requireChecksum,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			failed := 0
+			for _, location := range ctx.Args().Slice() {
+				if !a.verifyRelease(location, c) {
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%v release(s) would be rejected by the client", failed)
+			}
+			return nil
+		},
+	}
+}
+
+// releaseReport collect the result of each check to print them once done
+type releaseReport struct {
+	location string
+	lines    []string
+	failed   bool
+}
+
+func (r *releaseReport) ok(check string, format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf("  %-10s ok    %s", check, fmt.Sprintf(format, args...)))
+}
+
+func (r *releaseReport) warn(check string, format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf("  %-10s warn  %s", check, fmt.Sprintf(format, args...)))
+}
+
+func (r *releaseReport) fail(check string, format string, args ...interface{}) {
+	r.failed = true
+	r.lines = append(r.lines, fmt.Sprintf("  %-10s FAIL  %s", check, fmt.Sprintf(format, args...)))
+}
+
+func (r *releaseReport) print(w io.Writer) {
+	fmt.Fprintln(w, r.location)
+	for _, line := range r.lines {
+		fmt.Fprintln(w, line)
+	}
+	if r.failed {
+		fmt.Fprintln(w, "  result     REJECTED")
+	} else {
+		fmt.Fprintln(w, "  result     ACCEPTED")
+	}
+}
+
+func (a *application) verifyRelease(location string, c *releaseCheck) bool {
+	report := &releaseReport{location: location}
+	defer report.print(os.Stdout)
+
+	publicKey, err := publicKeyVerifier(a.publicKey)
+	if err != nil {
+		report.fail("key", "%s", err)
+		return false
+	}
+
+	address, done, err := releaseSource(location)
+	if err != nil {
+		report.fail("location", "%s", err)
+		return false
+	}
+	defer done()
+
+	// use the same source implementation as the client, so the exact same rules apply
+	source := selfupdate.NewHTTPSource(nil, address)
+	r, contentLength, err := source.Get(&selfupdate.Version{})
+	if err != nil {
+		report.fail("download", "%s", err)
+		return false
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		report.fail("download", "%s", err)
+		return false
+	}
+
+	switch {
+	case contentLength < 0:
+		report.warn("size", "%v bytes, no Content-Length announced so the client can't report progress", len(content))
+	case contentLength != int64(len(content)):
+		report.fail("size", "%v bytes received but Content-Length announced %v", len(content), contentLength)
+	default:
+		report.ok("size", "%v bytes", len(content))
+	}
+
+	c.checkHeader(report, content)
+
+	opts := selfupdate.Options{PublicKey: publicKey}
+	signature, err := source.GetSignature()
+	if err != nil {
+		report.fail("signature", "%s", err)
+		return false
+	}
+	opts.Signature = signature[:]
+
+	if hs, ok := source.(selfupdate.HashSource); ok {
+		h, digest, err := hs.GetHash()
+		switch {
+		case err == nil:
+			opts.Hash, opts.Checksum = h, digest
+			report.ok("digest", "%s %x published", h, digest)
+		case c.requireChecksum:
+			report.fail("digest", "%s", err)
+		default:
+			report.warn("digest", "not published: %s", err)
+		}
+	}
+
+	// run the client verification against a throw away target so nothing on the system is touched
+	err = applyToScratch(content, opts)
+	if err != nil {
+		report.fail("verify", "%s", err)
+		return false
+	}
+	if opts.Checksum != nil {
+		report.ok("verify", "ed25519 signature and digest valid")
+	} else {
+		report.ok("verify", "ed25519 signature valid")
+	}
+
+	return !report.failed
+}
+
+// checkHeader make sure the payload is an executable for the expected platform
+func (c *releaseCheck) checkHeader(report *releaseReport, content []byte) {
+	goos, goarch, err := executablePlatform(content)
+	if err != nil {
+		report.fail("header", "%s", err)
+		return
+	}
+
+	if (c.os != "" && c.os != goos) || (c.arch != "" && c.arch != goarch) {
+		report.fail("header", "executable for %s/%s", goos, goarch)
+		return
+	}
+	report.ok("header", "executable for %s/%s", goos, goarch)
+}
+
+func releaseSource(location string) (string, func(), error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location, func() {}, nil
+	}
+
+	path, err := filepath.Abs(location)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// serve local files over HTTP, so they go through the same code path as a download from a web server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: http.FileServer(http.Dir(filepath.Dir(path)))}
+	go server.Serve(listener)
+
+	return "http://" + listener.Addr().String() + "/" + url.PathEscape(filepath.Base(path)), func() { server.Close() }, nil
+}
+
+func applyToScratch(content []byte, opts selfupdate.Options) error {
+	dir, err := os.MkdirTemp("", "selfupdatectl")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	opts.TargetPath = filepath.Join(dir, "executable")
+	if err = os.WriteFile(opts.TargetPath, nil, 0755); err != nil {
+		return err
+	}
+	return selfupdate.Apply(bytes.NewReader(content), opts)
+}
+
+func executablePlatform(content []byte) (string, string, error) {
+	r := bytes.NewReader(content)
+
+	if f, err := elf.NewFile(r); err == nil {
+		arch, ok := map[elf.Machine]string{
+			elf.EM_386:     "386",
+			elf.EM_X86_64:  "amd64",
+			elf.EM_ARM:     "arm",
+			elf.EM_AARCH64: "arm64",
+			elf.EM_RISCV:   "riscv64",
+			elf.EM_PPC64:   "ppc64",
+			elf.EM_S390:    "s390x",
+			elf.EM_MIPS:    "mips",
+		}[f.Machine]
+		if !ok {
+			return "", "", fmt.Errorf("unsupported ELF machine %s", f.Machine)
+		}
+		goos := "linux"
+		if f.OSABI == elf.ELFOSABI_FREEBSD {
+			goos = "freebsd"
+		}
+		return goos, arch, nil
+	}
+
+	if f, err := macho.NewFile(r); err == nil {
+		return machoPlatform(f.Cpu)
+	}
+	if f, err := macho.NewFatFile(r); err == nil {
+		// universal binaries run on every architecture they carry, report the first one
+		return machoPlatform(f.Arches[0].Cpu)
+	}
+
+	if f, err := pe.NewFile(r); err == nil {
+		arch, ok := map[uint16]string{
+			pe.IMAGE_FILE_MACHINE_I386:  "386",
+			pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+			pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+			pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+		}[f.Machine]
+		if !ok {
+			return "", "", fmt.Errorf("unsupported PE machine %#x", f.Machine)
+		}
+		return "windows", arch, nil
+	}
+
+	return "", "", fmt.Errorf("not an ELF, Mach-O or PE executable")
+}
+
+func machoPlatform(cpu macho.Cpu) (string, string, error) {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "darwin", "amd64", nil
+	case macho.CpuArm64:
+		return "darwin", "arm64", nil
+	}
+	return "", "", fmt.Errorf("unsupported Mach-O cpu %s", cpu)
+}
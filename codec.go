@@ -0,0 +1,192 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownCodec is returned when an update or a patch is encoded with a codec that isn't registered
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// Codec define a compression format an update or a patch can be encoded with
+type Codec interface {
+	Name() string                                 // Name the codec is registered and referred to with, like "gzip"
+	NewReader(r io.Reader) (io.ReadCloser, error) // Decompress what is read from r
+}
+
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[string]Codec{}
+)
+
+// RegisterCodec make c available to decompress updates and patches, replacing any codec registered with the
+// same name. It can be used to add a format or to swap a built in codec for another implementation.
+func RegisterCodec(c Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+
+	codecs[strings.ToLower(c.Name())] = c
+}
+
+// LookupCodec returns the codec registered as name
+func LookupCodec(name string) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	c, ok := codecs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// Codecs returns the sorted names of the registered codecs
+func Codecs() []string {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// codecExtensions map the extension of a compressed download to the name of its codec
+var codecExtensions = map[string]string{
+	".gz":  "gzip",
+	".tgz": "gzip",
+	".bz2": "bzip2",
+	".xz":  "xz",
+	".zst": "zstd",
+	".br":  "brotli",
+}
+
+// codecFromURL returns the name of the codec a download is compressed with, guessed from the extension of its
+// URL, or the empty string if it doesn't look compressed
+func codecFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return codecExtensions[strings.ToLower(path.Ext(u.Path))]
+}
+
+// runsCommand report if the codec registered as name decompress by running an external command
+func runsCommand(name string) bool {
+	c, err := LookupCodec(name)
+	if err != nil {
+		return false
+	}
+	_, ok := c.(*commandCodec)
+	return ok
+}
+
+// decompress returns r decoded with the codec registered as name, r is returned as is if name is empty or
+// "identity"
+func decompress(r io.Reader, name string) (io.ReadCloser, error) {
+	if name == "" || strings.EqualFold(name, "identity") {
+		return io.NopCloser(r), nil
+	}
+	c, err := LookupCodec(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(r)
+}
+
+// commandDirs are the directories the commands of the codecs are looked up in. The PATH isn't used, it could lead
+// to a binary planted by another user.
+var commandDirs = []string{"/usr/bin", "/bin", "/usr/local/bin", "/opt/homebrew/bin"}
+
+// commandCodec decompress by running an external command, for formats without an implementation in the standard
+// library. The command is looked up in commandDirs when used, so it only has to be installed where it is needed.
+// apply only feeds it downloads whose signature was checked first.
+type commandCodec struct {
+	name    string
+	command string
+	args    []string
+}
+
+func (c *commandCodec) Name() string {
+	return c.name
+}
+
+// lookPath returns the command in the first of commandDirs holding it, if only its owner can modify it
+func (c *commandCodec) lookPath() (string, error) {
+	for _, dir := range commandDirs {
+		path := filepath.Join(dir, c.command)
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if info.Mode().Perm()&0022 != 0 {
+			return "", fmt.Errorf("%s codec not available: %s can be modified by other users", c.name, path)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("%s codec not available: %s not found in %s", c.name, c.command, strings.Join(commandDirs, ", "))
+}
+
+func (c *commandCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	path, err := c.lookPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, c.args...)
+	cmd.Env = []string{}
+	cmd.Stdin = r
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cr := &commandReader{name: c.name, cmd: cmd, out: out}
+	cmd.Stderr = &cr.stderr
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+type commandReader struct {
+	name   string
+	cmd    *exec.Cmd
+	out    io.Reader
+	stderr bytes.Buffer
+	done   bool
+}
+
+// Read will report the failure of the command once all its output is read
+func (c *commandReader) Read(p []byte) (int, error) {
+	n, err := c.out.Read(p)
+	if err == io.EOF && !c.done {
+		c.done = true
+		if werr := c.cmd.Wait(); werr != nil {
+			return n, fmt.Errorf("error decompressing %s: %s: %s", c.name, werr, strings.TrimSpace(c.stderr.String()))
+		}
+	}
+	return n, err
+}
+
+// Close will stop the command if its output wasn't read until the end
+func (c *commandReader) Close() error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	return nil
+}
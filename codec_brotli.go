@@ -0,0 +1,9 @@
+//go:build !selfupdate_nobrotli
+// +build !selfupdate_nobrotli
+
+package selfupdate
+
+// The brotli codec run the brotli command, build with the selfupdate_nobrotli tag to leave it out
+func init() {
+	RegisterCodec(&commandCodec{name: "brotli", command: "brotli", args: []string{"-d", "-c"}})
+}
@@ -0,0 +1,32 @@
+package selfupdate
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type bzip2Codec struct{}
+
+func (bzip2Codec) Name() string {
+	return "bzip2"
+}
+
+func (bzip2Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func init() {
+	RegisterCodec(gzipCodec{})
+	RegisterCodec(bzip2Codec{})
+}
@@ -0,0 +1,234 @@
+package selfupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lamdt03/selfupdate/internal/binarydist"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(b)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestApplyCodec(t *testing.T) {
+	fName := "TestApplyCodec"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	err := Apply(bytes.NewReader(gzipped(t, newFile)), Options{TargetPath: fName, Codec: "gzip"})
+	validateUpdate(fName, err, t)
+
+	// patches are decompressed before being applied
+	writeOldFile(fName, t)
+	patch := new(bytes.Buffer)
+	assert.Nil(t, binarydist.Diff(bytes.NewReader(oldFile), bytes.NewReader(newFile), patch))
+	err = Apply(bytes.NewReader(gzipped(t, patch.Bytes())), Options{TargetPath: fName, Codec: "GZIP", Patcher: NewBSDiffPatcher()})
+	validateUpdate(fName, err, t)
+
+	err = Apply(bytes.NewReader(newFile), Options{TargetPath: fName, Codec: "lzma"})
+	assert.True(t, errors.Is(err, ErrUnknownCodec))
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Name() string {
+	return "upper"
+}
+
+func (upperCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(strings.ToUpper(string(b)))), nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec(upperCodec{})
+	defer func() {
+		codecsLock.Lock()
+		delete(codecs, "upper")
+		codecsLock.Unlock()
+	}()
+
+	assert.Contains(t, Codecs(), "upper")
+	assert.Contains(t, Codecs(), "gzip")
+
+	r, err := decompress(strings.NewReader("update"), "upper")
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE", string(b))
+}
+
+// useCommandDirs make the codecs look their command up in the directory of the command name found in the PATH
+func useCommandDirs(t *testing.T, name string) (string, bool) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Logf("%s not installed", name)
+		return "", false
+	}
+	dirs := commandDirs
+	commandDirs = []string{filepath.Dir(path)}
+	t.Cleanup(func() { commandDirs = dirs })
+	return path, true
+}
+
+func TestCommandCodec(t *testing.T) {
+	for _, name := range []string{"zstd", "xz"} {
+		path, ok := useCommandDirs(t, name)
+		if !ok {
+			continue
+		}
+		codec, err := LookupCodec(name)
+		if err != nil {
+			t.Logf("%s codec left out of the build", name)
+			continue
+		}
+
+		cmd := exec.Command(path, "-c")
+		cmd.Stdin = bytes.NewReader(newFile)
+		compressed, err := cmd.Output()
+		assert.Nil(t, err)
+
+		r, err := codec.NewReader(bytes.NewReader(compressed))
+		assert.Nil(t, err)
+		b, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+		assert.Equal(t, newFile, b)
+
+		// corrupt input is reported once everything is read
+		r, err = codec.NewReader(bytes.NewReader(newFile))
+		assert.Nil(t, err)
+		_, err = io.ReadAll(r)
+		assert.NotNil(t, err)
+		r.Close()
+	}
+}
+
+func TestCommandCodecLookup(t *testing.T) {
+	dir := t.TempDir()
+	dirs := commandDirs
+	commandDirs = []string{dir}
+	defer func() { commandDirs = dirs }()
+
+	codec := &commandCodec{name: "fake", command: "fake"}
+	_, err := codec.NewReader(strings.NewReader(""))
+	assert.NotNil(t, err)
+
+	// a command other users can replace isn't run
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "fake"), []byte("#!/bin/sh\n"), 0755))
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "fake"), 0777))
+	_, err = codec.lookPath()
+	assert.NotNil(t, err)
+
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "fake"), 0755))
+	path, err := codec.lookPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "fake"), path)
+}
+
+func TestApplyCommandCodec(t *testing.T) {
+	path, ok := useCommandDirs(t, "zstd")
+	if !ok {
+		t.Skip("zstd not installed")
+	}
+	if _, err := LookupCodec("zstd"); err != nil {
+		t.Skip("zstd codec left out of the build")
+	}
+	cmd := exec.Command(path, "-c")
+	cmd.Stdin = bytes.NewReader(newFile)
+	compressed, err := cmd.Output()
+	assert.Nil(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	target := filepath.Join(t.TempDir(), "myapp")
+	apply := func(opts Options) error {
+		assert.Nil(t, os.WriteFile(target, oldFile, 0755))
+		opts.TargetPath, opts.Codec = target, "zstd"
+		return Apply(bytes.NewReader(compressed), opts)
+	}
+
+	// nothing unsigned reaches the command
+	assert.NotNil(t, apply(Options{}))
+	assert.NotNil(t, apply(Options{PublicKey: pub, Signature: ed25519.Sign(priv, newFile)}))
+	b, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+
+	assert.Nil(t, apply(Options{PublicKey: pub, Signature: ed25519.Sign(priv, compressed)}))
+	b, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b)
+	entries, err := os.ReadDir(filepath.Dir(target))
+	assert.Nil(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasPrefix(e.Name(), ".compressed-"))
+	}
+}
+
+func TestCodecFromURL(t *testing.T) {
+	assert.Equal(t, "gzip", codecFromURL("https://localhost/myapp-linux-amd64.gz"))
+	assert.Equal(t, "zstd", codecFromURL("https://localhost/myapp.ZST?token=1"))
+	assert.Equal(t, "xz", codecFromURL("https://localhost/myapp.xz"))
+	assert.Equal(t, "", codecFromURL("https://localhost/myapp.exe"))
+	assert.Equal(t, "", codecFromURL("https://localhost/myapp"))
+}
+
+func TestFetchCompressed(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	compressed := gzipped(t, newFile)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.gz":
+			w.Write(compressed)
+		case "/app.gz.ed25519":
+			// the signature is over the executable, not over the download
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u := &Updater{}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/app.gz"), PublicKey: pub}
+	r, _, opts, err := u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, "gzip", opts.Codec)
+
+	target := filepath.Join(t.TempDir(), "myapp")
+	assert.Nil(t, os.WriteFile(target, oldFile, 0755))
+	opts.TargetPath = target
+	assert.Nil(t, apply(r, opts))
+	b, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b)
+
+	// a codec announced by the manifest wins over the extension
+	codec, _, _ := payloadFormat(conf, &Version{Codec: "xz"})
+	assert.Equal(t, "xz", codec)
+}
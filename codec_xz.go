@@ -0,0 +1,9 @@
+//go:build !selfupdate_noxz
+// +build !selfupdate_noxz
+
+package selfupdate
+
+// The xz codec run the xz command, build with the selfupdate_noxz tag to leave it out
+func init() {
+	RegisterCodec(&commandCodec{name: "xz", command: "xz", args: []string{"-d", "-c"}})
+}
@@ -0,0 +1,9 @@
+//go:build !selfupdate_nozstd
+// +build !selfupdate_nozstd
+
+package selfupdate
+
+// The zstd codec run the zstd command, build with the selfupdate_nozstd tag to leave it out
+func init() {
+	RegisterCodec(&commandCodec{name: "zstd", command: "zstd", args: []string{"-d", "-c"}})
+}
@@ -0,0 +1,66 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var teamIDPattern = regexp.MustCompile(`^[A-Z0-9]{10}$`)
+
+// runCodesign run the macOS codesign tool, it is a variable to be replaced in tests
+var runCodesign = func(args ...string) ([]byte, error) {
+	return exec.Command("codesign", args...).CombinedOutput()
+}
+
+// CodesignVerifier check, on macOS, that the update is signed with a Developer ID certificate of the expected
+// team and optionally notarized by Apple before it replaces the running executable, so that Gatekeeper doesn't
+// refuse to run it. This is in addition to the signature verification.
+type CodesignVerifier struct {
+	teamID    string
+	notarized bool
+}
+
+// NewCodesignVerifier returns a CodesignVerifier accepting executables and bundles signed by teamID, the 10
+// characters Team ID of the Apple developer account. If notarized is true, they must also be notarized, which
+// is checked with the stapled ticket or, if there is none, with Apple servers.
+func NewCodesignVerifier(teamID string, notarized bool) (*CodesignVerifier, error) {
+	if !teamIDPattern.MatchString(teamID) {
+		return nil, fmt.Errorf("invalid Team ID %q", teamID)
+	}
+	return &CodesignVerifier{teamID: teamID, notarized: notarized}, nil
+}
+
+// Verify check the code signature of the executable or bundle at path with the macOS codesign tool
+func (c *CodesignVerifier) Verify(path string) error {
+	args := []string{"--verify", "--strict", "--deep"}
+	if c.notarized {
+		args = append(args, "--check-notarization")
+	}
+	args = append(args, "-R="+c.requirement(), path)
+
+	out, err := runCodesign(args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("invalid code signature: %s", strings.TrimSpace(string(out)))
+		}
+		return fmt.Errorf("error running codesign: %s", err)
+	}
+	return nil
+}
+
+// requirement is the code requirement the update must satisfy: signed by a Developer ID of the team
+func (c *CodesignVerifier) requirement() string {
+	r := `anchor apple generic and certificate 1[field.1.2.840.113635.100.6.2.6] exists and certificate leaf[field.1.2.840.113635.100.6.1.13] exists and certificate leaf[subject.OU] = "` + c.teamID + `"`
+	if c.notarized {
+		r += " and notarized"
+	}
+	return r
+}
+
+func (c *CodesignVerifier) String() string {
+	return fmt.Sprintf("CodesignVerifier(%s)", c.teamID)
+}
@@ -0,0 +1,46 @@
+package selfupdate
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodesignVerifier(t *testing.T) {
+	defer func(run func(...string) ([]byte, error)) { runCodesign = run }(runCodesign)
+
+	_, err := NewCodesignVerifier("team", false)
+	assert.NotNil(t, err)
+	_, err = NewCodesignVerifier(`ABCDE12345" or anchor apple`, false)
+	assert.NotNil(t, err)
+
+	c, err := NewCodesignVerifier("ABCDE12345", true)
+	assert.Nil(t, err)
+
+	var args []string
+	runCodesign = func(a ...string) ([]byte, error) {
+		args = a
+		return nil, nil
+	}
+	assert.Nil(t, c.Verify("/tmp/.myapp.new"))
+	assert.Contains(t, args, "--check-notarization")
+	assert.Equal(t, "/tmp/.myapp.new", args[len(args)-1])
+	requirement := args[len(args)-2]
+	assert.True(t, strings.HasPrefix(requirement, "-R=anchor apple generic"))
+	assert.True(t, strings.HasSuffix(requirement, `certificate leaf[subject.OU] = "ABCDE12345" and notarized`))
+
+	exitErr := exec.Command("false").Run()
+	runCodesign = func(a ...string) ([]byte, error) {
+		return []byte("/tmp/.myapp.new: code object is not signed at all\n"), exitErr
+	}
+	err = c.Verify("/tmp/.myapp.new")
+	assert.EqualError(t, err, "invalid code signature: /tmp/.myapp.new: code object is not signed at all")
+
+	runCodesign = func(a ...string) ([]byte, error) {
+		return nil, errors.New("executable file not found in $PATH")
+	}
+	assert.NotNil(t, c.Verify("/tmp/.myapp.new"))
+}
@@ -0,0 +1,142 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// VersionComparator define how the versions of an application are ordered, so that schemes other than semver can
+// be used to decide what an update is
+type VersionComparator interface {
+	Compare(a, b string) (int, error) // Returns -1 if a is older than b, 0 if they are the same version and +1 if a is newer
+}
+
+var (
+	// SemVerComparator order semantic versions like 1.2.3 or v2.0.0-rc.1, it is the default
+	SemVerComparator VersionComparator = semverComparator{}
+	// CalVerComparator order calendar versions like 2024.06.1 or 24.6, segment by segment, missing segments being 0
+	CalVerComparator VersionComparator = calverComparator{}
+	// NumericComparator order plain numbers like build numbers or timestamps, 1718000000 or 20240601120000
+	NumericComparator VersionComparator = numericComparator{}
+)
+
+type semverComparator struct{}
+
+func (semverComparator) Compare(a, b string) (int, error) {
+	va, err := semver.NewVersion(strings.TrimSpace(a))
+	if err != nil {
+		return 0, fmt.Errorf("Error parsing version %s: %s", a, err)
+	}
+	vb, err := semver.NewVersion(strings.TrimSpace(b))
+	if err != nil {
+		return 0, fmt.Errorf("Error parsing version %s: %s", b, err)
+	}
+	return va.Compare(vb), nil
+}
+
+type calverComparator struct{}
+
+func (calverComparator) Compare(a, b string) (int, error) {
+	sa, err := calverSegments(a)
+	if err != nil {
+		return 0, err
+	}
+	sb, err := calverSegments(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		x, y := "0", "0"
+		if i < len(sa) {
+			x = sa[i]
+		}
+		if i < len(sb) {
+			y = sb[i]
+		}
+		if c := compareDigits(x, y); c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// calverSegments returns the numeric segments of a calendar version
+func calverSegments(version string) ([]string, error) {
+	segments := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	for _, s := range segments {
+		if !isDigits(s) {
+			return nil, fmt.Errorf("Error parsing calendar version %s", version)
+		}
+	}
+	return segments, nil
+}
+
+type numericComparator struct{}
+
+func (numericComparator) Compare(a, b string) (int, error) {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if !isDigits(a) {
+		return 0, fmt.Errorf("Error parsing numeric version %s", a)
+	}
+	if !isDigits(b) {
+		return 0, fmt.Errorf("Error parsing numeric version %s", b)
+	}
+	return compareDigits(a, b), nil
+}
+
+// isDigits report if s is a non empty string of decimal digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareDigits compare the numbers written with the decimal digits a and b, whatever their size
+func compareDigits(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	switch {
+	case len(a) != len(b):
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparator returns the VersionComparator of the configuration, SemVerComparator by default
+func (c *Config) comparator() VersionComparator {
+	if c.VersionComparator == nil {
+		return SemVerComparator
+	}
+	return c.VersionComparator
+}
+
+// newer report if version b is newer than version a according to c, semver if c is nil
+func newer(c VersionComparator, a, b string) (bool, error) {
+	if c == nil {
+		c = SemVerComparator
+	}
+	order, err := c.Compare(a, b)
+	return err == nil && order < 0, err
+}
+
+// SetVersionComparator define how the versions of the manifest are ordered when the newest one is selected,
+// semver if c is nil. Checks made by an Updater use Config.VersionComparator instead.
+func (h *HTTPSource) SetVersionComparator(c VersionComparator) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.selector.comparator = c
+}
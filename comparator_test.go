@@ -0,0 +1,69 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionComparators(t *testing.T) {
+	for _, c := range []struct {
+		comparator VersionComparator
+		a, b       string
+		expected   int
+	}{
+		{SemVerComparator, "1.2.0", "1.10.0", -1},
+		{SemVerComparator, "v2.0.0", "2.0.0", 0},
+		{SemVerComparator, "2.0.0", "2.0.0-rc.1", 1},
+		{CalVerComparator, "2024.06.1", "2024.6.2", -1},
+		{CalVerComparator, "2024.10", "2024.9.3", 1},
+		{CalVerComparator, "2024.06", "2024.6.0", 0},
+		{CalVerComparator, "24.1", "23.12.5", 1},
+		{NumericComparator, "20240601120000", "20240601115959", 1},
+		{NumericComparator, "999", "1000", -1},
+		{NumericComparator, "0042", "42", 0},
+	} {
+		order, err := c.comparator.Compare(c.a, c.b)
+		assert.Nil(t, err, c.a, c.b)
+		assert.Equal(t, c.expected, order, c.a, c.b)
+	}
+
+	for _, c := range []struct {
+		comparator VersionComparator
+		a, b       string
+	}{
+		{SemVerComparator, "2024.06.01.1", "1.0.0"},
+		{CalVerComparator, "2024.06-rc1", "2024.06"},
+		{NumericComparator, "1.2", "3"},
+		{NumericComparator, "", "3"},
+	} {
+		_, err := c.comparator.Compare(c.a, c.b)
+		assert.NotNil(t, err, c.a, c.b)
+	}
+}
+
+func TestCheckNowCalVer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"2024.06.01.2"}]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	asked := false
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "2024.06.01.1"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           &memoryVersionStore{},
+		VersionComparator:      CalVerComparator,
+		UpgradeConfirmCallback: func(string) bool { asked = true; return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.True(t, asked)
+
+	// not a semantic version
+	u.conf.VersionComparator = nil
+	assert.NotNil(t, u.CheckNow())
+}
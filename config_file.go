@@ -0,0 +1,352 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables that override values loaded by LoadConfigFile
+const EnvPrefix = "SELFUPDATE_"
+
+// trustedEnv are the settings deciding what is trusted, which the environment only overrides when the configuration
+// file sets trust_env: any process starting the application could otherwise redirect it to another server, swap the
+// signing key or turn off TLS checks
+var trustedEnv = []string{"URL", "PUBLIC_KEY", "ALLOW_INSECURE", "PROXY", "STAGING_DIR"}
+
+// Duration is a time.Duration that is read from JSON as a string like "1h30m"
+type Duration time.Duration
+
+// MarshalJSON encode the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decode a duration from a string like "1h30m"
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// FileConfig define the updater configuration that can be shipped with a packaged application and edited by
+// an administrator without recompiling. It is loaded from a JSON or YAML file by LoadConfigFile.
+type FileConfig struct {
+	URL              string            `json:"url"`                // URL template of the HTTPSource, see NewHTTPSource
+	PublicKey        []byte            `json:"public_key"`         // base64 encoded ed25519 public key
+	FetchOnStart     bool              `json:"fetch_on_start"`     // Check for an update when the updater is created
+	Interval         Duration          `json:"interval"`           // Check for an update at regular interval, "0s" to disable
+	StallTimeout     Duration          `json:"stall_timeout"`      // See Config.StallTimeout
+	StallRetries     int               `json:"stall_retries"`      // See Config.StallRetries
+	CheckTimeout     Duration          `json:"check_timeout"`      // See Config.CheckTimeout
+	SignatureTimeout Duration          `json:"signature_timeout"`  // See Config.SignatureTimeout
+	DownloadTimeout  Duration          `json:"download_timeout"`   // See Config.DownloadTimeout
+	UpdateTimeout    Duration          `json:"update_timeout"`     // See Config.UpdateTimeout
+	MinCheckInterval Duration          `json:"min_check_interval"` // See Config.MinCheckInterval
+	RateLimit        int64             `json:"rate_limit"`         // See Config.RateLimit
+	RetryAttempts    int               `json:"retry_attempts"`     // If not zero, requests failing with a transient error are retried, see RetryPolicy.MaxAttempts
+	StagingDir       string            `json:"staging_dir"`        // If not empty, stage updates in this directory instead of next to the executable
+	Disabled         bool              `json:"disabled"`           // Skip update checks
+	AllowInsecure    bool              `json:"allow_insecure"`     // Accept plain HTTP URLs for any host, see SecurityPolicy
+	Proxy            string            `json:"proxy"`              // If not empty, URL of the proxy to use or "direct", see NewProxyClient
+	Headers          map[string]string `json:"headers"`            // Headers, like an API key, sent with every request to the update server, see NewAuthClient
+	Constraint       string            `json:"constraint"`         // If not empty, only versions satisfying this semver constraint are installed, see HTTPSource.SetConstraint
+	Channel          string            `json:"channel"`            // If not empty, release channel like beta or nightly subscribed to on top of stable, see HTTPSource.SetChannel
+	AllowPrerelease  bool              `json:"allow_prerelease"`   // Install prerelease versions like 1.2.0-rc.1 of the stable channel, see Config.AllowPrerelease
+	App              string            `json:"app"`                // If not empty, name of the application in a manifest describing several, see HTTPSource.SetApp
+	KeepVersions     int               `json:"keep_versions"`      // See Config.KeepVersions
+	TrustEnv         bool              `json:"trust_env"`          // Let the environment override url, public_key, allow_insecure, proxy and staging_dir
+}
+
+// LoadConfigFile read the configuration at path, YAML if its extension is .yaml or .yml and JSON otherwise, then
+// apply the overrides of the SELFUPDATE_ environment variables named after the settings, like SELFUPDATE_INTERVAL
+// or SELFUPDATE_CHANNEL. The settings deciding what is trusted, SELFUPDATE_URL, SELFUPDATE_PUBLIC_KEY,
+// SELFUPDATE_ALLOW_INSECURE, SELFUPDATE_PROXY and SELFUPDATE_STAGING_DIR, are only overridden when the file sets
+// trust_env. The result is validated before being returned.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %s: %s", path, err)
+		}
+	}
+
+	fc := &FileConfig{}
+	if err = json.Unmarshal(b, fc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %s", path, err)
+	}
+	if err = fc.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err = fc.Validate(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// yamlToJSON convert a YAML document to JSON, so that it is decoded with the same names and formats
+func yamlToJSON(b []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(b, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func (fc *FileConfig) applyEnv(lookup func(string) (string, bool)) error {
+	if !fc.TrustEnv {
+		trusted := lookup
+		lookup = func(name string) (string, bool) {
+			for _, t := range trustedEnv {
+				if name == EnvPrefix+t {
+					if _, ok := trusted(name); ok {
+						logError("Ignoring %s, trust_env is not set in the configuration file.\n", name)
+					}
+					return "", false
+				}
+			}
+			return trusted(name)
+		}
+	}
+	if v, ok := lookup(EnvPrefix + "URL"); ok {
+		fc.URL = v
+	}
+	if v, ok := lookup(EnvPrefix + "PUBLIC_KEY"); ok {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("%sPUBLIC_KEY: %w", EnvPrefix, err)
+		}
+		fc.PublicKey = key
+	}
+	for name, b := range map[string]*bool{"FETCH_ON_START": &fc.FetchOnStart, "DISABLED": &fc.Disabled, "ALLOW_INSECURE": &fc.AllowInsecure, "ALLOW_PRERELEASE": &fc.AllowPrerelease} {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, name, err)
+			}
+			*b = parsed
+		}
+	}
+	for name, d := range map[string]*Duration{
+		"INTERVAL": &fc.Interval, "STALL_TIMEOUT": &fc.StallTimeout, "CHECK_TIMEOUT": &fc.CheckTimeout,
+		"SIGNATURE_TIMEOUT": &fc.SignatureTimeout, "DOWNLOAD_TIMEOUT": &fc.DownloadTimeout, "UPDATE_TIMEOUT": &fc.UpdateTimeout,
+		"MIN_CHECK_INTERVAL": &fc.MinCheckInterval,
+	} {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, name, err)
+			}
+			*d = Duration(parsed)
+		}
+	}
+	for name, i := range map[string]*int{"STALL_RETRIES": &fc.StallRetries, "RETRY_ATTEMPTS": &fc.RetryAttempts, "KEEP_VERSIONS": &fc.KeepVersions} {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, name, err)
+			}
+			*i = parsed
+		}
+	}
+	if v, ok := lookup(EnvPrefix + "RATE_LIMIT"); ok {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%sRATE_LIMIT: %w", EnvPrefix, err)
+		}
+		fc.RateLimit = i
+	}
+	if v, ok := lookup(EnvPrefix + "STAGING_DIR"); ok {
+		fc.StagingDir = v
+	}
+	if v, ok := lookup(EnvPrefix + "PROXY"); ok {
+		fc.Proxy = v
+	}
+	if v, ok := lookup(EnvPrefix + "CONSTRAINT"); ok {
+		fc.Constraint = v
+	}
+	if v, ok := lookup(EnvPrefix + "CHANNEL"); ok {
+		fc.Channel = v
+	}
+	if v, ok := lookup(EnvPrefix + "APP"); ok {
+		fc.App = v
+	}
+	return nil
+}
+
+// Validate check that the configuration is complete and consistent
+func (fc *FileConfig) Validate() error {
+	if fc.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(fc.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	if err = fc.securityPolicy().CheckURL(fc.URL); err != nil {
+		return err
+	}
+	if len(fc.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("ed25519 public key must be %v bytes long and was %v", ed25519.PublicKeySize, len(fc.PublicKey))
+	}
+	if fc.Interval < 0 {
+		return errors.New("interval can not be negative")
+	}
+	if fc.StallTimeout < 0 {
+		return errors.New("stall_timeout can not be negative")
+	}
+	for name, d := range map[string]Duration{"check_timeout": fc.CheckTimeout, "signature_timeout": fc.SignatureTimeout, "download_timeout": fc.DownloadTimeout, "update_timeout": fc.UpdateTimeout, "min_check_interval": fc.MinCheckInterval} {
+		if d < 0 {
+			return fmt.Errorf("%s can not be negative", name)
+		}
+	}
+	if fc.StallRetries < 0 {
+		return errors.New("stall_retries can not be negative")
+	}
+	if fc.RateLimit < 0 {
+		return errors.New("rate_limit can not be negative")
+	}
+	if fc.RetryAttempts < 0 {
+		return errors.New("retry_attempts can not be negative")
+	}
+	if fc.KeepVersions < 0 {
+		return errors.New("keep_versions can not be negative")
+	}
+	if fc.Proxy != "" {
+		if _, err = proxyFunc(fc.Proxy); err != nil {
+			return err
+		}
+	}
+	if fc.Constraint != "" {
+		if _, err = semver.NewConstraint(fc.Constraint); err != nil {
+			return fmt.Errorf("invalid version constraint %q: %w", fc.Constraint, err)
+		}
+	}
+	return nil
+}
+
+// Config returns a Config using a HTTPSource built with client for this configuration.
+// Callbacks and the current version are left for the application to fill.
+func (fc *FileConfig) Config(client *http.Client) *Config {
+	return fc.applyTo(&Config{}, client)
+}
+
+// applyTo returns a copy of conf with the values managed by the configuration file replaced
+func (fc *FileConfig) applyTo(conf *Config, client *http.Client) *Config {
+	c := *conf
+	client = fc.securityPolicy().Client(client)
+	if fc.RetryAttempts > 0 {
+		client = (&RetryPolicy{MaxAttempts: fc.RetryAttempts}).Client(client)
+	}
+	if len(fc.Headers) > 0 {
+		client = NewAuthClient(client, StaticHeaders(fc.Headers))
+	}
+	if fc.Proxy != "" {
+		if proxied, err := NewProxyClient(client, fc.Proxy); err == nil {
+			client = proxied
+		} else {
+			logError("Ignoring proxy: %v\n", err)
+		}
+	}
+	source := NewHTTPSource(client, fc.URL).(*HTTPSource)
+	if err := source.SetConstraint(fc.Constraint); err != nil {
+		logError("Ignoring version constraint: %v\n", err)
+	}
+	source.SetChannel(fc.Channel)
+	source.SetApp(fc.App)
+	c.Source = source
+	c.PublicKey = ed25519.PublicKey(fc.PublicKey)
+	c.Schedule.FetchOnStart = fc.FetchOnStart
+	c.Schedule.Interval = time.Duration(fc.Interval)
+	c.StallTimeout = time.Duration(fc.StallTimeout)
+	c.StallRetries = fc.StallRetries
+	c.CheckTimeout = time.Duration(fc.CheckTimeout)
+	c.SignatureTimeout = time.Duration(fc.SignatureTimeout)
+	c.DownloadTimeout = time.Duration(fc.DownloadTimeout)
+	c.UpdateTimeout = time.Duration(fc.UpdateTimeout)
+	c.MinCheckInterval = time.Duration(fc.MinCheckInterval)
+	c.RateLimit = fc.RateLimit
+	c.Staging = nil
+	if fc.StagingDir != "" {
+		c.Staging = CustomDirStaging(fc.StagingDir)
+	}
+	c.Disabled = fc.Disabled
+	c.AllowPrerelease = fc.AllowPrerelease
+	c.KeepVersions = fc.KeepVersions
+	return &c
+}
+
+func (fc *FileConfig) securityPolicy() *SecurityPolicy {
+	return &SecurityPolicy{AllowInsecure: fc.AllowInsecure}
+}
+
+// WatchConfigFile check every poll interval if the configuration file at path changed and, if so, reload it
+// and apply it with Reconfigure. Values not managed by the file, like callbacks, are kept. An invalid file is
+// logged and ignored. The returned function stop watching.
+func (u *Updater) WatchConfigFile(path string, client *http.Client, poll time.Duration) func() {
+	done := make(chan struct{})
+
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+
+	go func() {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = fi.ModTime()
+
+			fc, err := LoadConfigFile(path)
+			if err != nil {
+				logError("Ignoring configuration change: %v\n", err)
+				continue
+			}
+			if err = u.Reconfigure(fc.applyTo(u.config(), client)); err != nil {
+				logError("Ignoring configuration change: %v\n", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,145 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "selfupdate.json")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	key := base64.StdEncoding.EncodeToString(pub)
+
+	path := writeConfigFile(t, fmt.Sprintf(`{"url":"https://localhost/{{.OS}}","public_key":%q,"interval":"2h","fetch_on_start":true,"trust_env":true}`, key))
+	t.Setenv("SELFUPDATE_INTERVAL", "30m")
+	t.Setenv("SELFUPDATE_STAGING_DIR", t.TempDir())
+	t.Setenv("SELFUPDATE_RATE_LIMIT", "65536")
+	t.Setenv("SELFUPDATE_RETRY_ATTEMPTS", "5")
+
+	fc, err := LoadConfigFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://localhost/{{.OS}}", fc.URL)
+	assert.Equal(t, Duration(30*time.Minute), fc.Interval)
+
+	conf := fc.Config(nil)
+	assert.Equal(t, ed25519.PublicKey(pub), conf.PublicKey)
+	assert.True(t, conf.Schedule.FetchOnStart)
+	assert.Equal(t, 30*time.Minute, conf.Schedule.Interval)
+	assert.NotNil(t, conf.Staging)
+	assert.Equal(t, int64(65536), conf.RateLimit)
+	assert.Equal(t, 5, fc.RetryAttempts)
+	_, ok := conf.Source.(*HTTPSource).client.Transport.(*policyTransport).base.(*retryTransport)
+	assert.True(t, ok)
+}
+
+func TestLoadConfigFileTrustedEnv(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	path := writeConfigFile(t, fmt.Sprintf(`{"url":"https://localhost/app","public_key":%q}`, base64.StdEncoding.EncodeToString(pub)))
+	t.Setenv("SELFUPDATE_URL", "http://attacker.example.com/app")
+	t.Setenv("SELFUPDATE_PUBLIC_KEY", base64.StdEncoding.EncodeToString(other))
+	t.Setenv("SELFUPDATE_ALLOW_INSECURE", "true")
+	t.Setenv("SELFUPDATE_CHANNEL", "beta")
+
+	fc, err := LoadConfigFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://localhost/app", fc.URL)
+	assert.Equal(t, ed25519.PublicKey(pub), ed25519.PublicKey(fc.PublicKey))
+	assert.False(t, fc.AllowInsecure)
+	assert.Equal(t, "beta", fc.Channel)
+}
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "selfupdate.yaml")
+	content := fmt.Sprintf("url: https://localhost/app\npublic_key: %s\ninterval: 2h\nheaders:\n  X-Tenant: acme\n", base64.StdEncoding.EncodeToString(pub))
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+	fc, err := LoadConfigFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://localhost/app", fc.URL)
+	assert.Equal(t, ed25519.PublicKey(pub), ed25519.PublicKey(fc.PublicKey))
+	assert.Equal(t, Duration(2*time.Hour), fc.Interval)
+	assert.Equal(t, "acme", fc.Headers["X-Tenant"])
+
+	assert.Nil(t, os.WriteFile(path, []byte("url: [unterminated\n"), 0644))
+	_, err = LoadConfigFile(path)
+	assert.NotNil(t, err)
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	_, err := LoadConfigFile(writeConfigFile(t, `{"url":"ftp://localhost/app","public_key":"AAAA"}`))
+	assert.NotNil(t, err)
+
+	_, err = LoadConfigFile(writeConfigFile(t, `{"url":"https://localhost/app","interval":"soon"}`))
+	assert.NotNil(t, err)
+}
+
+func TestFileConfigValidate(t *testing.T) {
+	fc := &FileConfig{URL: "https://localhost/app", PublicKey: make([]byte, ed25519.PublicKeySize)}
+	assert.Nil(t, fc.Validate())
+
+	fc.Interval = -1
+	assert.NotNil(t, fc.Validate())
+
+	fc.Interval = 0
+	fc.RateLimit = -1
+	assert.NotNil(t, fc.Validate())
+
+	fc.RateLimit = 0
+	fc.Proxy = "ftp://proxy.corp"
+	assert.NotNil(t, fc.Validate())
+
+	fc.Proxy = ""
+	fc.PublicKey = nil
+	assert.NotNil(t, fc.Validate())
+
+	fc = &FileConfig{URL: "http://updates.example.com/app", PublicKey: make([]byte, ed25519.PublicKeySize)}
+	assert.ErrorIs(t, fc.Validate(), ErrInsecureURL)
+	fc.AllowInsecure = true
+	assert.Nil(t, fc.Validate())
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	key := base64.StdEncoding.EncodeToString(pub)
+
+	path := writeConfigFile(t, fmt.Sprintf(`{"url":"https://localhost/app","public_key":%q,"interval":"1h"}`, key))
+
+	reloaded := make(chan *Config, 1)
+	u := &Updater{conf: &Config{ConfigReloadedCallback: func(c *Config) { reloaded <- c }}}
+	stop := u.WatchConfigFile(path, nil, 10*time.Millisecond)
+	defer stop()
+
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf(`{"url":"https://localhost/app","public_key":%q,"interval":"2h","disabled":true}`, key)), 0644))
+	future := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(path, future, future))
+
+	select {
+	case conf := <-reloaded:
+		assert.Equal(t, 2*time.Hour, conf.Schedule.Interval)
+		assert.True(t, conf.Disabled)
+		assert.NotNil(t, conf.ConfigReloadedCallback)
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+}
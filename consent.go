@@ -0,0 +1,114 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/manifest"
+)
+
+// ErrConsentRequired is returned by CheckNow when the latest version carries a Consent but no ConsentCallback is
+// configured to present it
+var ErrConsentRequired = errors.New("update requires the user consent")
+
+// Consent is a text, like an EULA change or a privacy policy update, the user must accept before a version is
+// installed
+//
+// Deprecated: use manifest.Consent.
+type Consent = manifest.Consent
+
+// ConsentRecord is the proof that the user accepted a Consent before installing a version
+type ConsentRecord struct {
+	Version  string    `json:"version"`         // Version the consent was attached to
+	Title    string    `json:"title,omitempty"` // Title of the consent
+	SHA256   string    `json:"sha256"`          // Digest of the consent text accepted
+	Accepted time.Time `json:"accepted"`        // When the user accepted it
+}
+
+// ReceiptStore define where accepted consents are recorded
+type ReceiptStore interface {
+	RecordConsent(record *ConsentRecord) error
+}
+
+type fileReceiptStore string
+
+// NewFileReceiptStore returns a ReceiptStore appending each ConsentRecord as a line of JSON to the file at path
+func NewFileReceiptStore(path string) ReceiptStore {
+	return fileReceiptStore(path)
+}
+
+// RecordConsent will append record to the file and sync it to disk
+func (f fileReceiptStore) RecordConsent(record *ConsentRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	path := string(f)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// receiptStore returns the configured ReceiptStore, by default a file named after the executable in the user
+// configuration directory
+func receiptStore(conf *Config) (ReceiptStore, error) {
+	if conf.ReceiptStore != nil {
+		return conf.ReceiptStore, nil
+	}
+
+	path, err := stateFile(".receipt")
+	if err != nil {
+		return nil, fmt.Errorf("no place to record the consent receipt: %w", err)
+	}
+	return NewFileReceiptStore(path), nil
+}
+
+// obtainConsent present the consent attached to newVer, if any, and record its acceptance in the receipt. It
+// returns false if the update must not be applied.
+func obtainConsent(conf *Config, newVer *Version) (bool, error) {
+	consent := newVer.Consent
+	if consent == nil {
+		return true, nil
+	}
+	if conf.ConsentCallback == nil {
+		return false, fmt.Errorf("%w: version %s", ErrConsentRequired, newVer.Number)
+	}
+
+	if !conf.ConsentCallback(newVer.Number, consent) {
+		logInfo("The user didn't accept the consent attached to version %s.\n", newVer.Number)
+		return false, nil
+	}
+
+	store, err := receiptStore(conf)
+	if err != nil {
+		return false, err
+	}
+	record := &ConsentRecord{
+		Version:  newVer.Number,
+		Title:    consent.Title,
+		SHA256:   consent.Digest(),
+		Accepted: time.Now().UTC(),
+	}
+	if err = store.RecordConsent(record); err != nil {
+		return false, fmt.Errorf("error recording consent: %s", err)
+	}
+	return true, nil
+}
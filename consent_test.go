@@ -0,0 +1,114 @@
+package selfupdate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryReceiptStore struct {
+	records []*ConsentRecord
+	err     error
+}
+
+func (m *memoryReceiptStore) RecordConsent(record *ConsentRecord) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.records = append(m.records, record)
+	return nil
+}
+
+func consentServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":"http://localhost/1.1.0",`+
+			`"consent":{"title":"EULA","text":"You agree."}}]`, runtime.GOOS)
+	}))
+}
+
+func TestHTTPSourceConsent(t *testing.T) {
+	server := consentServer()
+	defer server.Close()
+
+	v, err := NewHTTPSource(nil, server.URL).LatestVersion()
+	assert.Nil(t, err)
+	if assert.NotNil(t, v.Consent) {
+		assert.Equal(t, "EULA", v.Consent.Title)
+		assert.Equal(t, "You agree.", v.Consent.Text)
+	}
+}
+
+func TestCheckNowConsent(t *testing.T) {
+	server := consentServer()
+	defer server.Close()
+
+	newUpdater := func(receipts ReceiptStore, consent func(string, *Consent) bool) *Updater {
+		return &Updater{conf: &Config{
+			Current:                &Version{Number: "1.0.0"},
+			Source:                 NewHTTPSource(nil, server.URL),
+			VersionStore:           &memoryVersionStore{},
+			ReceiptStore:           receipts,
+			ConsentCallback:        consent,
+			UpgradeConfirmCallback: func(string) bool { return true },
+		}}
+	}
+
+	receipts := &memoryReceiptStore{}
+	err := newUpdater(receipts, nil).CheckNow()
+	assert.True(t, errors.Is(err, ErrConsentRequired))
+	assert.Empty(t, receipts.records)
+
+	var shown *Consent
+	err = newUpdater(receipts, func(version string, c *Consent) bool {
+		assert.Equal(t, "1.1.0", version)
+		shown = c
+		return false
+	}).CheckNow()
+	assert.Nil(t, err)
+	assert.Equal(t, "You agree.", shown.Text)
+	assert.Empty(t, receipts.records)
+
+	failing := &memoryReceiptStore{err: errors.New("disk full")}
+	err = newUpdater(failing, func(string, *Consent) bool { return true }).CheckNow()
+	assert.NotNil(t, err)
+
+	// the download fails, but only after the consent was recorded
+	err = newUpdater(receipts, func(string, *Consent) bool { return true }).CheckNow()
+	assert.NotNil(t, err)
+	if assert.Len(t, receipts.records, 1) {
+		record := receipts.records[0]
+		assert.Equal(t, "1.1.0", record.Version)
+		assert.Equal(t, "EULA", record.Title)
+		assert.Equal(t, (&Consent{Text: "You agree."}).Digest(), record.SHA256)
+		assert.False(t, record.Accepted.IsZero())
+	}
+}
+
+func TestFileReceiptStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "selfupdate", "app.receipt")
+	store := NewFileReceiptStore(path)
+	assert.Nil(t, store.RecordConsent(&ConsentRecord{Version: "1.0.0", SHA256: "a"}))
+	assert.Nil(t, store.RecordConsent(&ConsentRecord{Version: "1.1.0", SHA256: "b"}))
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	var versions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record ConsentRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		versions = append(versions, record.Version)
+	}
+	assert.Equal(t, []string{"1.0.0", "1.1.0"}, versions)
+}
@@ -0,0 +1,103 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// selector define which entries of a manifest can be installed, beyond being for the running OS and not yanked
+type selector struct {
+	constraint *semver.Constraints // if present, only versions satisfying it are selected and the newest is preferred
+	channel    string              // if present and not stable, versions of this channel are selected along stable ones and the newest is preferred
+	prerelease bool                // if true, prerelease versions like 1.2.0-rc.1 of the stable channel are selected too
+	comparator VersionComparator   // if present, how versions are ordered when the newest is preferred, semver otherwise
+	app        string              // if present, only entries with this name, or without a name, are considered
+}
+
+// StableChannel is the channel of the manifest entries that don't declare one
+const StableChannel = "stable"
+
+// entryChannel returns the channel of the manifest entry a
+func entryChannel(a *appVersion) string {
+	if a.Channel == "" {
+		return StableChannel
+	}
+	return a.Channel
+}
+
+// ordered report if the newest selected version is preferred to the first one of the manifest
+func (s *selector) ordered() bool {
+	return s != nil && (s.constraint != nil || (s.channel != "" && s.channel != StableChannel))
+}
+
+// match report if the entry a can be selected
+func (s *selector) match(a *appVersion) bool {
+	channel := entryChannel(a)
+	if s == nil {
+		return channel == StableChannel && !isPrerelease(a.Version)
+	}
+	if channel != StableChannel && channel != s.channel {
+		return false
+	}
+	if channel == StableChannel && !s.prerelease && isPrerelease(a.Version) {
+		return false
+	}
+	if s.constraint == nil {
+		return true
+	}
+	v, err := semver.NewVersion(strings.TrimSpace(a.Version))
+	return err == nil && s.constraint.Check(v)
+}
+
+// prefer report if a should be selected over the entry selected so far. Without constraint or channel the first
+// entry of the manifest is the latest, otherwise the newest version is, whatever the order of the manifest.
+func (s *selector) prefer(a *appVersion, selected *appVersion) bool {
+	if selected == nil {
+		return true
+	}
+	if !s.ordered() {
+		return false
+	}
+	isNewer, err := newer(s.comparator, selected.Version, a.Version)
+	return err == nil && isNewer
+}
+
+// SetConstraint make LatestVersion return the newest version satisfying constraint, like "^1.2", "~1.4" or
+// "<2.0.0", so that an application can stay on a major version until it is ready to migrate. The empty string
+// remove the constraint, the first entry of the manifest is then the latest version.
+func (h *HTTPSource) SetConstraint(constraint string) error {
+	var c *semver.Constraints
+	if constraint != "" {
+		var err error
+		if c, err = semver.NewConstraint(constraint); err != nil {
+			return fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.selector.constraint = c
+	return nil
+}
+
+// SetChannel subscribe to the releases of channel, like "beta" or "nightly", on top of the stable ones which
+// are the only ones selected by default. Entries of the manifest declare their channel with "channel", those
+// that don't are stable. The newest version of the channel or stable is then the latest, whatever the order of
+// the manifest. The channel can be switched at any time, it is used by the next call to LatestVersion.
+func (h *HTTPSource) SetChannel(channel string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.selector.channel = channel
+}
+
+// Channel returns the channel subscribed to
+func (h *HTTPSource) Channel() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.selector.channel == "" {
+		return StableChannel
+	}
+	return h.selector.channel
+}
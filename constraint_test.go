@@ -0,0 +1,87 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceConstraint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"version":"2.1.0"},
+			{"os":%[1]q,"version":"1.4.0","yanked":true},
+			{"os":%[1]q,"version":"1.2.0"},
+			{"os":%[1]q,"version":"1.3.1"},
+			{"os":%[1]q,"version":"2.0.0"},
+			{"os":"other","version":"1.9.0"},
+			{"os":%[1]q,"version":"not a version"}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	for _, c := range []struct {
+		constraint string
+		expected   string
+	}{
+		{"", "2.1.0"},
+		{"^1.2", "1.3.1"},
+		{"<2.0.0", "1.3.1"},
+		{"~1.2.0", "1.2.0"},
+		{">=2", "2.1.0"},
+		{"2.0.x", "2.0.0"},
+	} {
+		assert.Nil(t, source.SetConstraint(c.constraint))
+		v, err := source.LatestVersion()
+		assert.Nil(t, err, c.constraint)
+		assert.Equal(t, c.expected, v.Number, c.constraint)
+	}
+
+	assert.Nil(t, source.SetConstraint("^3"))
+	_, err := source.LatestVersion()
+	assert.NotNil(t, err)
+	assert.NotNil(t, source.SetConstraint("not a constraint"))
+}
+
+func TestHTTPSourceChannel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"version":"1.3.0-nightly.2","channel":"nightly"},
+			{"os":%[1]q,"version":"1.2.0"},
+			{"os":%[1]q,"version":"1.3.0-beta.1","channel":"beta"},
+			{"os":%[1]q,"version":"1.1.0","channel":"stable"}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	assert.Equal(t, StableChannel, source.Channel())
+	for _, c := range []struct {
+		channel  string
+		expected string
+		release  string
+	}{
+		{"", "1.2.0", StableChannel},
+		{"beta", "1.3.0-beta.1", "beta"},
+		{"nightly", "1.3.0-nightly.2", "nightly"},
+		{"canary", "1.2.0", StableChannel},
+		{StableChannel, "1.2.0", StableChannel},
+	} {
+		source.SetChannel(c.channel)
+		v, err := source.LatestVersion()
+		assert.Nil(t, err, c.channel)
+		assert.Equal(t, c.expected, v.Number, c.channel)
+		assert.Equal(t, c.release, v.Channel, c.channel)
+	}
+
+	source.SetChannel("beta")
+	assert.Nil(t, source.SetConstraint("<1.3.0-0"))
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+}
@@ -0,0 +1,355 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto"
+	"io"
+	"sync"
+	"time"
+)
+
+// ContextSource define a Source whose requests can be cancelled, or given a deadline, with a context. Sources
+// that don't implement it are still abandoned once the context is done, but their request keeps running.
+type ContextSource interface {
+	Source
+	GetContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) // Get the executable, the download is interrupted once ctx is done
+	GetSignatureContext(ctx context.Context, v *Version) ([]byte, error)      // Get the signature that match the executable of v
+	LatestVersionContext(ctx context.Context) (*Version, error)               // Get the latest version information
+}
+
+// RangeContextSource define a RangeSource whose resumed downloads can be cancelled with a context
+type RangeContextSource interface {
+	RangeSource
+	GetRangeContext(ctx context.Context, v *Version, offset int64) (io.ReadCloser, int64, error) // Get the executable starting at offset, the download is interrupted once ctx is done
+}
+
+// HashContextSource define a HashSource whose digest request can be cancelled with a context
+type HashContextSource interface {
+	HashSource
+	GetHashContext(ctx context.Context, v *Version) (crypto.Hash, []byte, error) // Get the hash function and digest of the executable of v
+}
+
+// GPGContextSource define a GPGSource whose signature request can be cancelled with a context
+type GPGContextSource interface {
+	GPGSource
+	GetGPGSignatureContext(ctx context.Context, v *Version) ([]byte, error) // Get the OpenPGP signature of the executable of v
+}
+
+// MinisignContextSource define a MinisignSource whose signature request can be cancelled with a context
+type MinisignContextSource interface {
+	MinisignSource
+	GetMinisignSignatureContext(ctx context.Context, v *Version) ([]byte, error) // Get the minisign signature of the executable of v
+}
+
+// CosignContextSource define a CosignSource whose bundle request can be cancelled with a context
+type CosignContextSource interface {
+	CosignSource
+	GetCosignBundleContext(ctx context.Context, v *Version) ([]byte, error) // Get the cosign bundle of the executable of v
+}
+
+// AttestationContextSource define an AttestationSource whose attestation request can be cancelled with a context
+type AttestationContextSource interface {
+	AttestationSource
+	GetAttestationContext(ctx context.Context, v *Version) ([]byte, error) // Get the attestation of the executable of v
+}
+
+// BlockContextSource define a BlockSource whose block index and block requests can be cancelled with a context
+type BlockContextSource interface {
+	BlockSource
+	GetBlockIndexContext(ctx context.Context, v *Version) ([]byte, error)                          // Get the JSON BlockIndex of the executable of v
+	GetBlocksContext(ctx context.Context, v *Version, offset, length int64) (io.ReadCloser, error) // Get length bytes of the executable of v starting at offset
+}
+
+// KeyManifestContextSource define a KeyManifestSource publishing the key manifest next to each executable, whose
+// request can be cancelled with a context
+type KeyManifestContextSource interface {
+	KeyManifestSource
+	GetKeyManifestContext(ctx context.Context, v *Version) ([]byte, error) // Get the signed key manifest published with the executable of v
+}
+
+// KeyBundleContextSource define a KeyBundleSource publishing the key bundle next to each executable, whose
+// request can be cancelled with a context
+type KeyBundleContextSource interface {
+	KeyBundleSource
+	GetKeyBundleContext(ctx context.Context, v *Version) ([]byte, error) // Get the signed key bundle published with the executable of v
+}
+
+// latestVersion returns the latest version announced by s, or ctx.Err() once ctx is done
+func latestVersion(ctx context.Context, s Source) (*Version, error) {
+	if cs, ok := s.(ContextSource); ok {
+		return cs.LatestVersionContext(ctx)
+	}
+	if ctx.Done() == nil {
+		return s.LatestVersion()
+	}
+
+	type result struct {
+		v   *Version
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := s.LatestVersion()
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getExecutable start the download of v from s, the returned reader fails with ctx.Err() once ctx is done
+func getExecutable(ctx context.Context, s Source, v *Version) (io.ReadCloser, int64, error) {
+	if cs, ok := s.(ContextSource); ok {
+		r, length, err := cs.GetContext(ctx, v)
+		if err != nil {
+			return nil, 0, err
+		}
+		return newContextReader(ctx, r), length, nil
+	}
+	if ctx.Done() == nil {
+		return s.Get(v)
+	}
+
+	type result struct {
+		r      io.ReadCloser
+		length int64
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		r, length, err := s.Get(v)
+		done <- result{r, length, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, 0, r.err
+		}
+		return newContextReader(ctx, r.r), r.length, nil
+	case <-ctx.Done():
+		go func() {
+			// don't leak the download once it finally starts
+			if r := <-done; r.err == nil {
+				r.r.Close()
+			}
+		}()
+		return nil, 0, ctx.Err()
+	}
+}
+
+// getSignature returns the signature of the executable of v provided by s, or ctx.Err() once ctx is done
+func getSignature(ctx context.Context, s Source, v *Version) ([]byte, error) {
+	if cs, ok := s.(ContextSource); ok {
+		return cs.GetSignatureContext(ctx, v)
+	}
+	return getBytes(ctx, s.GetSignature)
+}
+
+// getBlockIndex returns the block index of the executable of v provided by s, or ctx.Err() once ctx is done
+func getBlockIndex(ctx context.Context, s BlockSource, v *Version) ([]byte, error) {
+	if cs, ok := s.(BlockContextSource); ok {
+		return cs.GetBlockIndexContext(ctx, v)
+	}
+	return getBytes(ctx, func() ([]byte, error) { return s.GetBlockIndex(v) })
+}
+
+// getBlocks returns length bytes of the executable of v provided by s starting at offset, the returned reader
+// fails with ctx.Err() once ctx is done
+func getBlocks(ctx context.Context, s BlockSource, v *Version, offset, length int64) (io.ReadCloser, error) {
+	if cs, ok := s.(BlockContextSource); ok {
+		r, err := cs.GetBlocksContext(ctx, v, offset, length)
+		if err != nil {
+			return nil, err
+		}
+		return newContextReader(ctx, r), nil
+	}
+	r, err := s.GetBlocks(v, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return newContextReader(ctx, r), nil
+}
+
+// resumeDownload resume the download of v from s at offset, the returned reader fails with ctx.Err() once ctx is done
+func resumeDownload(ctx context.Context, s RangeSource, v *Version, offset int64) (io.ReadCloser, int64, error) {
+	if cs, ok := s.(RangeContextSource); ok {
+		r, length, err := cs.GetRangeContext(ctx, v, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		return newContextReader(ctx, r), length, nil
+	}
+	r, length, err := s.GetRange(v, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newContextReader(ctx, r), length, nil
+}
+
+// getHash returns the digest of the executable of v provided by s, or ctx.Err() once ctx is done
+func getHash(ctx context.Context, s HashSource, v *Version) (crypto.Hash, []byte, error) {
+	if cs, ok := s.(HashContextSource); ok {
+		return cs.GetHashContext(ctx, v)
+	}
+	if ctx.Done() == nil {
+		return s.GetHash()
+	}
+
+	type result struct {
+		h      crypto.Hash
+		digest []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		h, digest, err := s.GetHash()
+		done <- result{h, digest, err}
+	}()
+	select {
+	case r := <-done:
+		return r.h, r.digest, r.err
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+// getBytes returns the result of get, or ctx.Err() if ctx is done first. get can't be interrupted, it keeps
+// running in the background until it returns: Sources provide context variants of their requests for this reason.
+func getBytes(ctx context.Context, get func() ([]byte, error)) ([]byte, error) {
+	if ctx.Done() == nil {
+		return get()
+	}
+
+	type result struct {
+		b   []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		b, err := get()
+		done <- result{b, err}
+	}()
+	select {
+	case r := <-done:
+		return r.b, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// contextReader fail with the error of its context once it is done, closing the reader it wraps so that a Read
+// blocked on the network returns
+type contextReader struct {
+	r    io.ReadCloser
+	ctx  context.Context
+	stop chan struct{}
+
+	stopOnce sync.Once
+	once     sync.Once
+	closeErr error
+}
+
+func newContextReader(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	if ctx.Done() == nil {
+		return r
+	}
+
+	c := &contextReader{r: r, ctx: ctx, stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-c.stop:
+		}
+	}()
+	return c
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	if err != nil && c.ctx.Err() != nil {
+		return n, c.ctx.Err()
+	}
+	return n, err
+}
+
+// FinalURL returns where the wrapped download came from once redirects were followed, if it reports it
+func (c *contextReader) FinalURL() string {
+	if f, ok := c.r.(finalURLReader); ok {
+		return f.FinalURL()
+	}
+	return ""
+}
+
+func (c *contextReader) close() error {
+	c.once.Do(func() {
+		c.closeErr = c.r.Close()
+	})
+	return c.closeErr
+}
+
+// Close will close the wrapped reader, once even if the context was done meanwhile
+func (c *contextReader) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	return c.close()
+}
+
+// cancelCloser close a download then cancel the context it was started with
+type cancelCloser struct {
+	io.Closer
+	cancel context.CancelFunc
+}
+
+func (c cancelCloser) Close() error {
+	err := c.Closer.Close()
+	c.cancel()
+	return err
+}
+
+// withTimeout returns ctx limited to timeout if it is positive
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// checkLatestVersion returns the latest version announced by the Source of conf within conf.CheckTimeout
+func checkLatestVersion(ctx context.Context, conf *Config) (*Version, error) {
+	ctx, cancel := withTimeout(ctx, conf.CheckTimeout)
+	defer cancel()
+	return latestVersion(withCheckSettings(ctx, conf), conf.Source)
+}
+
+// checkSettings are the selection settings of a Config. They are passed with each check rather than set on the
+// Source, which can be shared by concurrent checks.
+type checkSettings struct {
+	prerelease bool
+	comparator VersionComparator
+}
+
+type checkSettingsKey struct{}
+
+// withCheckSettings returns ctx carrying the selection settings of conf
+func withCheckSettings(ctx context.Context, conf *Config) context.Context {
+	return context.WithValue(ctx, checkSettingsKey{}, checkSettings{prerelease: conf.AllowPrerelease, comparator: conf.VersionComparator})
+}
+
+// selectorFor returns the selector of h, with the settings of the check ctx belongs to taking precedence
+func (h *HTTPSource) selectorFor(ctx context.Context) selector {
+	h.lock.Lock()
+	sel := h.selector
+	h.lock.Unlock()
+	if s, ok := ctx.Value(checkSettingsKey{}).(checkSettings); ok {
+		sel.prerelease, sel.comparator = s.prerelease, s.comparator
+	}
+	return sel
+}
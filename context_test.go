@@ -0,0 +1,244 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hungSource is a Source whose requests never complete
+type hungSource struct {
+	release chan struct{}
+}
+
+func (h *hungSource) Get(*Version) (io.ReadCloser, int64, error) {
+	<-h.release
+	return io.NopCloser(bytes.NewReader(newFile)), int64(len(newFile)), nil
+}
+
+func (h *hungSource) GetSignature() ([]byte, error) {
+	<-h.release
+	return nil, nil
+}
+
+func (h *hungSource) LatestVersion() (*Version, error) {
+	<-h.release
+	return &Version{Number: "1.1.0"}, nil
+}
+
+func TestCheckNowContextHungSource(t *testing.T) {
+	source := &hungSource{release: make(chan struct{})}
+	defer close(source.release)
+	u := &Updater{conf: &Config{Source: source, Current: &Version{Number: "1.0.0"}, VersionStore: &memoryVersionStore{}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, u.CheckNowContext(ctx), context.DeadlineExceeded)
+
+	_, _, err := getExecutable(ctx, source, &Version{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = getSignature(ctx, source, &Version{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestHTTPSourceGetContext(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// send the beginning of the executable then hang
+		w.Header().Set("Content-Length", "1000")
+		w.Write(newFile)
+		w.(http.Flusher).Flush()
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, length, err := getExecutable(ctx, NewHTTPSource(nil, server.URL+"/app"), &Version{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), length)
+	defer r.Close()
+
+	buf := make([]byte, len(newFile))
+	_, err = io.ReadFull(r, buf)
+	assert.Nil(t, err)
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestApplyContext(t *testing.T) {
+	fName := "TestApplyContext"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ApplyContext(ctx, bytes.NewReader(newFile), Options{TargetPath: fName})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	buf, err := os.ReadFile(fName)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, buf)
+
+	err = ApplyContext(context.Background(), bytes.NewReader(newFile), Options{TargetPath: fName})
+	validateUpdate(fName, err, t)
+}
+
+// phaseSource is a Source that hang in one phase of the update
+type phaseSource struct {
+	hang    string
+	release chan struct{}
+}
+
+func (p *phaseSource) wait(phase string) {
+	if p.hang == phase {
+		<-p.release
+	}
+}
+
+func (p *phaseSource) Get(*Version) (io.ReadCloser, int64, error) {
+	// like a network connection, a hung read returns once the body is closed
+	closed := make(chan struct{})
+	body := io.MultiReader(bytes.NewReader(newFile[:2]), readerFunc(func([]byte) (int, error) {
+		if p.hang == "download" {
+			<-closed
+			return 0, os.ErrClosed
+		}
+		return 0, io.EOF
+	}))
+	return struct {
+		io.Reader
+		io.Closer
+	}{body, closerFunc(func() error { close(closed); return nil })}, int64(len(newFile)), nil
+}
+
+func (p *phaseSource) GetSignature() ([]byte, error) {
+	p.wait("signature")
+	return make([]byte, ed25519.SignatureSize), nil
+}
+
+func (p *phaseSource) LatestVersion() (*Version, error) {
+	p.wait("check")
+	return &Version{Number: "1.1.0"}, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestPhaseTimeouts(t *testing.T) {
+	for _, c := range []struct {
+		hang string
+		conf Config
+	}{
+		{"check", Config{CheckTimeout: 20 * time.Millisecond}},
+		{"signature", Config{SignatureTimeout: 20 * time.Millisecond, CheckTimeout: time.Hour}},
+		{"download", Config{DownloadTimeout: 20 * time.Millisecond, SignatureTimeout: time.Hour}},
+		{"download", Config{UpdateTimeout: 20 * time.Millisecond}},
+	} {
+		source := &phaseSource{hang: c.hang, release: make(chan struct{})}
+		conf := c.conf
+		conf.Source = source
+		conf.Current = &Version{Number: "1.0.0"}
+		conf.VersionStore = &memoryVersionStore{}
+		conf.PublicKey, _, _ = ed25519.GenerateKey(nil)
+		u := &Updater{conf: &conf}
+
+		start := time.Now()
+		assert.ErrorIs(t, u.CheckNowContext(context.Background()), context.DeadlineExceeded, c.hang)
+		assert.True(t, time.Since(start) < 5*time.Second)
+		close(source.release)
+	}
+}
+
+func TestCancelResumeAndChecksum(t *testing.T) {
+	requested := make(chan string, 4)
+	aborted := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app" && r.Header.Get("Range") == "" {
+			// send the beginning of the executable then stall
+			w.Header().Set("Content-Length", "1000")
+			w.Write(newFile[:2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		// the range resume and the digest never answer until the client gives up
+		requested <- r.URL.Path
+		<-r.Context().Done()
+		aborted <- r.URL.Path
+	}))
+	defer server.Close()
+
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/app"), StallTimeout: 50 * time.Millisecond}
+	u := &Updater{conf: conf}
+	v := &Version{Number: "1.1.0", Digest: make([]byte, 32), DigestHash: crypto.SHA256}
+
+	expectCanceled := func(path string, run func(ctx context.Context) error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- run(ctx) }()
+
+		select {
+		case p := <-requested:
+			assert.Equal(t, path, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was never requested", path)
+		}
+		cancel()
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request of %s not interrupted by the context", path)
+		}
+		select {
+		case p := <-aborted:
+			assert.Equal(t, path, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request of %s still running", path)
+		}
+	}
+
+	expectCanceled("/app", func(ctx context.Context) error {
+		r, length, err := getExecutable(ctx, conf.Source, v)
+		if err != nil {
+			return err
+		}
+		r, err = u.pipeline(ctx, conf, v, r, length)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.ReadAll(r)
+		return err
+	})
+
+	expectCanceled("/app.sha256", func(ctx context.Context) error {
+		_, err := u.checksumReader(ctx, &Version{Number: "1.1.0"}, io.NopCloser(bytes.NewReader(newFile)))
+		return err
+	})
+}
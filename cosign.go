@@ -0,0 +1,345 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/verify"
+)
+
+var (
+	oidFulcioIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1} // deprecated raw string form
+	oidFulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8} // DER encoded UTF8String form
+)
+
+// CosignSource define a Source that is able to provide a cosign bundle of the executable
+type CosignSource interface {
+	Source
+	GetCosignBundle() ([]byte, error) // Get the bundle produced by `cosign sign-blob --bundle`
+}
+
+// sigstoreBundle is the JSON document written by `cosign sign-blob --bundle`
+type sigstoreBundle struct {
+	Base64Signature string `json:"base64Signature"`
+	Cert            string `json:"cert"`
+	RekorBundle     *struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           string `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		} `json:"Payload"`
+	} `json:"rekorBundle"`
+}
+
+// hashedRekord is the body of a Rekor hashedrekord entry
+type hashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   string `json:"content"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// CosignVerifier verify Sigstore cosign keyless signatures, so that updates are trusted because they were signed
+// by a given OIDC identity, for example a CI release workflow, instead of a distributed static key. The short lived
+// Fulcio certificate must chain to the trusted roots and must have been valid when the signature was recorded in
+// the Rekor transparency log, which is proven offline with the log signed entry timestamp.
+type CosignVerifier struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	rekorKey      crypto.PublicKey
+	identity      *regexp.Regexp
+	issuer        string
+}
+
+// NewCosignVerifier returns a CosignVerifier trusting the PEM encoded Fulcio root and intermediate certificates and
+// the PEM encoded Rekor public key. identity is a regular expression the whole certificate subject, an email or a
+// URI like https://github.com/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0, must match. If issuer is not
+// empty, the certificate must have been issued for that OIDC issuer, like https://token.actions.githubusercontent.com.
+func NewCosignVerifier(fulcioCertificates []byte, rekorPublicKey []byte, identity string, issuer string) (*CosignVerifier, error) {
+	c := &CosignVerifier{roots: x509.NewCertPool(), intermediates: x509.NewCertPool(), issuer: issuer}
+
+	var err error
+	if c.identity, err = regexp.Compile("^(?:" + identity + ")$"); err != nil {
+		return nil, fmt.Errorf("invalid identity: %s", err)
+	}
+
+	certs, err := parseCertificates(fulcioCertificates)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			c.roots.AddCert(cert)
+		} else {
+			c.intermediates.AddCert(cert)
+		}
+	}
+
+	block, _ := pem.Decode(rekorPublicKey)
+	if block == nil {
+		return nil, errors.New("couldn't parse Rekor public key PEM data")
+	}
+	if c.rekorKey, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Verify check that bundle is a valid cosign bundle for payload, signed by the expected identity
+func (c *CosignVerifier) Verify(payload []byte, bundle []byte) error {
+	digest := sha256.Sum256(payload)
+	return c.verify(digest[:], func() ([]byte, error) { return payload, nil }, bundle)
+}
+
+// verifyFile is Verify for the file at path, which is only read in memory when signed with an ed25519 key, as
+// those sign the whole payload rather than its digest
+func (c *CosignVerifier) verifyFile(path string, bundle []byte) error {
+	digest, err := sha256File(path)
+	if err != nil {
+		return err
+	}
+	return c.verify(digest, func() ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return verify.ReadMessage(f, 0)
+	}, bundle)
+}
+
+// verify check bundle for the payload with the SHA-256 digest, read by message only if its whole content is needed
+func (c *CosignVerifier) verify(digest []byte, message func() ([]byte, error), bundle []byte) error {
+	var b sigstoreBundle
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		return fmt.Errorf("invalid cosign bundle: %s", err)
+	}
+	if b.RekorBundle == nil {
+		return errors.New("cosign bundle doesn't contain a Rekor entry")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(b.Base64Signature)
+	if err != nil {
+		return fmt.Errorf("invalid cosign signature: %s", err)
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(b.Cert)
+	if err != nil {
+		return fmt.Errorf("invalid cosign certificate: %s", err)
+	}
+	certs, err := parseCertificates(certPEM)
+	if err != nil {
+		return err
+	}
+	cert := certs[0]
+
+	// the transparency log vouch for the time the signature was made
+	if err = c.verifySET(b); err != nil {
+		return err
+	}
+	signedAt := time.Unix(b.RekorBundle.Payload.IntegratedTime, 0)
+
+	intermediates := c.intermediates.Clone()
+	for _, ca := range certs[1:] {
+		intermediates.AddCert(ca)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         c.roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid cosign certificate: %s", err)
+	}
+
+	if err = c.verifyIdentity(cert); err != nil {
+		return err
+	}
+
+	var payload []byte
+	if _, ok := cert.PublicKey.(ed25519.PublicKey); ok {
+		if payload, err = message(); err != nil {
+			return err
+		}
+	}
+	if err = verifyKeySignature(cert.PublicKey, digest, payload, signature); err != nil {
+		return err
+	}
+
+	// the log entry must be about this very signature, otherwise any entry of the log would do
+	if err = verifyRekorEntry(b.RekorBundle.Payload.Body, digest, b.Base64Signature, certPEM); err != nil {
+		return err
+	}
+
+	logDebug("Valid cosign signature from %s recorded at %s.\n", certificateIdentities(cert), signedAt)
+	return nil
+}
+
+func (c *CosignVerifier) verifySET(b sigstoreBundle) error {
+	p := b.RekorBundle.Payload
+
+	// the signed entry timestamp is computed over the canonical JSON form of the payload, which is what
+	// encoding/json produce for a map as keys are sorted and there is nothing to escape in those values
+	canonical, err := json.Marshal(map[string]interface{}{
+		"body":           p.Body,
+		"integratedTime": p.IntegratedTime,
+		"logIndex":       p.LogIndex,
+		"logID":          p.LogID,
+	})
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(canonical)
+	if err = verifyKeySignature(c.rekorKey, digest[:], canonical, b.RekorBundle.SignedEntryTimestamp); err != nil {
+		return fmt.Errorf("invalid Rekor signed entry timestamp: %s", err)
+	}
+	return nil
+}
+
+func (c *CosignVerifier) verifyIdentity(cert *x509.Certificate) error {
+	if c.issuer != "" {
+		issuer, err := certificateIssuer(cert)
+		if err != nil {
+			return err
+		}
+		if issuer != c.issuer {
+			return fmt.Errorf("cosign certificate issued for %q instead of %q", issuer, c.issuer)
+		}
+	}
+
+	identities := certificateIdentities(cert)
+	for _, identity := range identities {
+		if c.identity.MatchString(identity) {
+			return nil
+		}
+	}
+	return fmt.Errorf("cosign certificate identities %q don't match %q", identities, c.identity)
+}
+
+func (c *CosignVerifier) String() string {
+	return fmt.Sprintf("CosignVerifier(%s)", c.identity)
+}
+
+func verifyRekorEntry(body string, digest []byte, signature string, certPEM []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return fmt.Errorf("invalid Rekor entry: %s", err)
+	}
+	var entry hashedRekord
+	if err = json.Unmarshal(raw, &entry); err != nil {
+		return fmt.Errorf("invalid Rekor entry: %s", err)
+	}
+	if entry.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported Rekor entry kind %q", entry.Kind)
+	}
+
+	spec := entry.Spec
+	if spec.Data.Hash.Algorithm != "sha256" || spec.Data.Hash.Value != hex.EncodeToString(digest) {
+		return errors.New("Rekor entry doesn't match the update digest")
+	}
+	if spec.Signature.Content != signature {
+		return errors.New("Rekor entry doesn't match the cosign signature")
+	}
+	key, err := base64.StdEncoding.DecodeString(spec.Signature.PublicKey.Content)
+	if err != nil || !bytes.Equal(bytes.TrimSpace(key), bytes.TrimSpace(certPEM)) {
+		return errors.New("Rekor entry doesn't match the cosign certificate")
+	}
+	return nil
+}
+
+// verifyKeySignature verify a signature of message, whose SHA-256 digest is given, for the usual sigstore key types
+func verifyKeySignature(key crypto.PublicKey, digest []byte, message []byte, signature []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) != nil && rsa.VerifyPSS(k, crypto.SHA256, digest, signature, nil) != nil {
+			return errors.New("invalid rsa signature")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, signature) {
+			return errors.New("invalid ecdsa signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, message, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+func certificateIssuer(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidFulcioIssuerV2):
+			var issuer string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err != nil {
+				return "", fmt.Errorf("invalid cosign certificate issuer: %s", err)
+			}
+			return issuer, nil
+		case ext.Id.Equal(oidFulcioIssuer):
+			return string(ext.Value), nil
+		}
+	}
+	return "", errors.New("cosign certificate doesn't carry an OIDC issuer")
+}
+
+func certificateIdentities(cert *x509.Certificate) []string {
+	identities := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("couldn't parse any PEM certificate")
+	}
+	return certs, nil
+}
@@ -0,0 +1,153 @@
+package selfupdate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sigstoreFixture struct {
+	rootPEM  []byte
+	rekorPEM []byte
+	rekorKey *ecdsa.PrivateKey
+	caKey    *ecdsa.PrivateKey
+	ca       *x509.Certificate
+}
+
+func newSigstoreFixture(t *testing.T) *sigstoreFixture {
+	f := &sigstoreFixture{}
+
+	var err error
+	f.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigstore"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &f.caKey.PublicKey, f.caKey)
+	assert.Nil(t, err)
+	f.ca, err = x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	f.rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	f.rekorKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&f.rekorKey.PublicKey)
+	assert.Nil(t, err)
+	f.rekorPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	return f
+}
+
+// sign produce a bundle like `cosign sign-blob --bundle` for a certificate valid around signedAt
+func (f *sigstoreFixture) sign(t *testing.T, payload []byte, identity string, issuer string, signedAt time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	issuerExt, err := asn1.MarshalWithParams(issuer, "utf8")
+	assert.Nil(t, err)
+	uri, err := url.Parse(identity)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       signedAt.Add(-time.Minute),
+		NotAfter:        signedAt.Add(9 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{uri},
+		ExtraExtensions: []pkix.Extension{{Id: oidFulcioIssuerV2, Value: issuerExt}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.ca, &key.PublicKey, f.caKey)
+	assert.Nil(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	digest := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.Nil(t, err)
+
+	entry := hashedRekord{Kind: "hashedrekord"}
+	entry.Spec.Data.Hash.Algorithm = "sha256"
+	entry.Spec.Data.Hash.Value = hex.EncodeToString(digest[:])
+	entry.Spec.Signature.Content = base64.StdEncoding.EncodeToString(signature)
+	entry.Spec.Signature.PublicKey.Content = base64.StdEncoding.EncodeToString(certPEM)
+	body, err := json.Marshal(entry)
+	assert.Nil(t, err)
+
+	var b sigstoreBundle
+	b.Base64Signature = entry.Spec.Signature.Content
+	b.Cert = entry.Spec.Signature.PublicKey.Content
+	b.RekorBundle = &struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           string `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		} `json:"Payload"`
+	}{}
+	p := &b.RekorBundle.Payload
+	p.Body = base64.StdEncoding.EncodeToString(body)
+	p.IntegratedTime = signedAt.Unix()
+	p.LogIndex = 42
+	p.LogID = "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"
+
+	canonical := []byte(`{"body":"` + p.Body + `","integratedTime":` + strconv.FormatInt(p.IntegratedTime, 10) + `,"logID":"` + p.LogID + `","logIndex":42}`)
+	setDigest := sha256.Sum256(canonical)
+	b.RekorBundle.SignedEntryTimestamp, err = ecdsa.SignASN1(rand.Reader, f.rekorKey, setDigest[:])
+	assert.Nil(t, err)
+
+	bundle, err := json.Marshal(b)
+	assert.Nil(t, err)
+	return bundle
+}
+
+func TestCosignVerifier(t *testing.T) {
+	f := newSigstoreFixture(t)
+	identity := "https://github.com/org/app/.github/workflows/release.yml@refs/tags/v1.1.0"
+	issuer := "https://token.actions.githubusercontent.com"
+
+	c, err := NewCosignVerifier(f.rootPEM, f.rekorPEM, `https://github\.com/org/app/\.github/workflows/release\.yml@refs/tags/v.*`, issuer)
+	assert.Nil(t, err)
+
+	// the certificate has long expired, but it was valid when the signature was logged
+	signedAt := time.Now().Add(-time.Hour)
+	assert.Nil(t, c.Verify(newFile, f.sign(t, newFile, identity, issuer, signedAt)))
+
+	assert.NotNil(t, c.Verify(oldFile, f.sign(t, newFile, identity, issuer, signedAt)))
+	assert.NotNil(t, c.Verify(newFile, f.sign(t, newFile, "https://github.com/evil/app/.github/workflows/release.yml@refs/tags/v1.1.0", issuer, signedAt)))
+	assert.NotNil(t, c.Verify(newFile, f.sign(t, newFile, identity, "https://accounts.google.com", signedAt)))
+
+	// moving the log time out of the certificate validity invalidate the signed entry timestamp
+	bundle := f.sign(t, newFile, identity, issuer, signedAt)
+	var b sigstoreBundle
+	assert.Nil(t, json.Unmarshal(bundle, &b))
+	b.RekorBundle.Payload.IntegratedTime += 3600
+	bundle, err = json.Marshal(b)
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Verify(newFile, bundle))
+
+	// a bundle recorded by another transparency log
+	other := newSigstoreFixture(t)
+	c, err = NewCosignVerifier(f.rootPEM, other.rekorPEM, ".*", "")
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Verify(newFile, f.sign(t, newFile, identity, issuer, signedAt)))
+}
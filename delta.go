@@ -0,0 +1,119 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Lamdt03/selfupdate/manifest"
+)
+
+// PatchSource define a Source that is able to provide binary patches from previous versions, so that only what
+// changed is downloaded
+type PatchSource interface {
+	Source
+	GetPatch(v *Version, from string) (io.ReadCloser, int64, string, error) // Get the patch turning version from into v, its length and its format, ErrNotPublished if there is none
+}
+
+// appPatch is a patch from a previous version listed in the manifest entry of a version
+type appPatch = manifest.Patch
+
+var _ PatchSource = (*HTTPSource)(nil)
+
+// GetPatch will return the patch from version from listed in the manifest entry of v. Signatures and digests
+// are still looked up for the executable of v, which is what is verified once the patch is applied.
+func (h *HTTPSource) GetPatch(v *Version, from string) (io.ReadCloser, int64, string, error) {
+	h.lock.Lock()
+	var patch *appPatch
+	if a := h.find(v); a != nil {
+		for i := range a.Patches {
+			if strings.TrimSpace(a.Patches[i].From) == strings.TrimSpace(from) {
+				patch = &a.Patches[i]
+				break
+			}
+		}
+	}
+	h.lock.Unlock()
+	if patch == nil {
+		return nil, 0, "", fmt.Errorf("no patch from %s to %s: %w", from, v.Number, ErrNotPublished)
+	}
+	url := expandURLTemplate(patch.URL, v)
+	response, err := h.client.Get(url)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	if err = checkStatus(url, response, http.StatusOK); err != nil {
+		return nil, 0, "", err
+	}
+	if patch.Size > 0 && response.ContentLength >= 0 && response.ContentLength != patch.Size {
+		response.Body.Close()
+		return nil, 0, "", fmt.Errorf("%w. Expected: %d bytes, announced: %d", ErrSizeMismatch, patch.Size, response.ContentLength)
+	}
+
+	body := response.Body
+	if patch.SHA256 != "" {
+		hash, digest, err := decodeDigest(patch.SHA256, "")
+		if err == nil {
+			body, err = newHashReader(body, hash, digest)
+		}
+		if err != nil {
+			response.Body.Close()
+			return nil, 0, "", fmt.Errorf("invalid digest for patch %s: %w", url, err)
+		}
+	}
+	return body, response.ContentLength, patch.Format, nil
+}
+
+// errNoDelta is returned by installDelta when there is no patch to apply, the full executable is then downloaded
+var errNoDelta = errors.New("no delta update available")
+
+// installDelta apply the patch from version from, installed at target, to newVer if the Source provides one. The
+// patched executable is verified like a full download, with the digest and signatures of newVer.
+func (u *Updater) installDelta(ctx context.Context, conf *Config, from string, newVer *Version, target string) error {
+	ps, ok := conf.Source.(PatchSource)
+	if !ok || from == "" || conf.Device != "" || len(newVer.Files) > 0 {
+		return errNoDelta
+	}
+	r, contentLength, format, err := ps.GetPatch(newVer, from)
+	if errors.Is(err, ErrNotPublished) {
+		logDebug("%v\n", err)
+		return errNoDelta
+	}
+	if err != nil {
+		return err
+	}
+	dctx, cancel := withTimeout(ctx, conf.DownloadTimeout)
+	defer cancel()
+	r = newContextReader(dctx, r)
+	defer r.Close()
+
+	patcher, err := patcherFor(format)
+	if err != nil {
+		return err
+	}
+	opts, err := u.options(ctx, conf, newVer)
+	if err != nil {
+		return err
+	}
+	opts.Patcher = patcher
+	opts.Codec, opts.Archive = "", ""
+	if newVer.Digest != nil {
+		opts.Hash, opts.Checksum = newVer.DigestHash, newVer.Digest
+	}
+	if conf.RateLimit > 0 {
+		r = newThrottledReader(r, conf.RateLimit, conf.RateBurst)
+	}
+
+	var update io.Reader = r
+	if conf.ProgressCallback != nil {
+		update = &progressReader{Reader: r, progressCallback: conf.ProgressCallback, contentLength: contentLength}
+	}
+	logInfo("Applying a %d bytes patch from version %s to %s.\n", contentLength, from, newVer.Number)
+	opts.TargetPath = target
+	opts.staged = u.staged
+	u.executable, err = applyUpdate(update, opts)
+	return err
+}
@@ -0,0 +1,86 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Lamdt03/selfupdate/internal/binarydist"
+	"github.com/stretchr/testify/assert"
+)
+
+func deltaServer(patch []byte, format string, priv ed25519.PrivateKey) (*httptest.Server, *int32) {
+	var full int32
+	digest := sha256.Sum256(newFile)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":"%s/app","sha256":"%x",`+
+				`"patches":[{"from":"1.0.0","url":"%s/app-1.0.0.patch","format":%q}]}]`, runtime.GOOS, server.URL, digest, server.URL, format)
+		case "/app":
+			atomic.AddInt32(&full, 1)
+			w.Write(newFile)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		case "/app-1.0.0.patch":
+			w.Write(patch)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, &full
+}
+
+func testDelta(t *testing.T, patch []byte, format string) int32 {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	server, full := deltaServer(patch, format, priv)
+	defer server.Close()
+
+	target := filepath.Join(t.TempDir(), "myapp")
+	writeOldFile(target, t)
+
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: pub}
+	v, err := conf.Source.LatestVersion()
+	assert.Nil(t, err)
+
+	u := &Updater{conf: conf}
+	err = u.install(context.Background(), conf, "1.0.0", v, target)
+	validateUpdate(target, err, t)
+	return atomic.LoadInt32(full)
+}
+
+func TestDeltaUpdate(t *testing.T) {
+	var patch bytes.Buffer
+	assert.Nil(t, binarydist.Diff(bytes.NewReader(oldFile), bytes.NewReader(newFile), &patch))
+
+	assert.Equal(t, int32(0), testDelta(t, patch.Bytes(), ""))
+
+	// a patch that doesn't apply, or produce something else, fall back to the full executable
+	assert.Equal(t, int32(1), testDelta(t, []byte("not a patch"), "bsdiff"))
+	assert.Equal(t, int32(1), testDelta(t, patch.Bytes(), "unknown"))
+}
+
+func TestDeltaUpdateXDelta(t *testing.T) {
+	if _, err := exec.LookPath("xdelta3"); err != nil {
+		t.Skip("xdelta3 isn't installed")
+	}
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "old"), oldFile, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "new"), newFile, 0644))
+	patch, err := exec.Command("xdelta3", "-e", "-c", "-s", filepath.Join(dir, "old"), filepath.Join(dir, "new")).Output()
+	assert.Nil(t, err)
+
+	assert.Equal(t, int32(0), testDelta(t, patch, "xdelta"))
+}
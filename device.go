@@ -0,0 +1,139 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// flashDevice is a raw device an image is written to block by block, like an MTD partition or a block device
+type flashDevice interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	geometry() (size int64, block int64, erasable bool) // Size of the device and of its blocks, erasable if blocks must be erased before being written
+	isBad(offset int64) (bool, error)                   // Report if the block at offset is marked bad
+	erase(offset int64) error                           // Erase the block at offset
+	markBad(offset int64) error                         // Mark the block at offset bad, so it is skipped from now on
+	sync() error
+}
+
+// writeDeviceImage write the verified image staged at path to the raw device
+func writeDeviceImage(path string, device string) error {
+	image, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	info, err := image.Stat()
+	if err != nil {
+		return err
+	}
+
+	dev, err := openDevice(device)
+	if err != nil {
+		return err
+	}
+	if err = writeImage(dev, image, info.Size()); err != nil {
+		dev.Close()
+		return fmt.Errorf("error writing image to %s: %w", device, err)
+	}
+	return dev.Close()
+}
+
+// writeImage stream length bytes of image to dev, skipping bad blocks and marking bad the blocks that fail to be
+// erased, written or read back identical. The image is read back once complete and compared with what was written.
+func writeImage(dev flashDevice, image io.Reader, length int64) error {
+	size, block, erasable := dev.geometry()
+	buf := make([]byte, block)
+	check := make([]byte, block)
+	written := sha256.New()
+
+	type extent struct{ offset, length int64 }
+	var extents []extent
+
+	pending := int64(0) // bytes of the image in buf that still have to be written
+	for offset, remaining := int64(0), length; remaining > 0; offset += block {
+		if pending == 0 {
+			pending = block
+			if remaining < block {
+				pending = remaining
+			}
+			if _, err := io.ReadFull(image, buf[:pending]); err != nil {
+				return err
+			}
+		}
+		// flash pages are written whole, what follows the end of the image is left erased
+		n := pending
+		if erasable {
+			for i := pending; i < block; i++ {
+				buf[i] = 0xff
+			}
+			n = block
+		}
+		if offset+n > size {
+			return fmt.Errorf("image of %d bytes doesn't fit in the %d bytes of good blocks", length, size)
+		}
+
+		bad, err := dev.isBad(offset)
+		if err != nil {
+			return err
+		}
+		if bad {
+			logInfo("Skipping bad block at offset %d.\n", offset)
+			continue
+		}
+
+		if err = writeBlock(dev, buf[:n], check[:n], offset, erasable); err != nil {
+			if !erasable {
+				return err
+			}
+			logError("Marking block at offset %d bad: %v\n", offset, err)
+			if err = dev.markBad(offset); err != nil {
+				return err
+			}
+			continue
+		}
+
+		written.Write(buf[:pending])
+		extents = append(extents, extent{offset, pending})
+		remaining -= pending
+		pending = 0
+	}
+	if err := dev.sync(); err != nil {
+		return err
+	}
+
+	readBack := sha256.New()
+	for _, e := range extents {
+		if _, err := dev.ReadAt(check[:e.length], e.offset); err != nil {
+			return err
+		}
+		readBack.Write(check[:e.length])
+	}
+	if !bytes.Equal(written.Sum(nil), readBack.Sum(nil)) {
+		return fmt.Errorf("image read back from the device doesn't match what was written")
+	}
+	return nil
+}
+
+// writeBlock erase if needed the block at offset, write data to it and check it reads back identical
+func writeBlock(dev flashDevice, data []byte, check []byte, offset int64, erasable bool) error {
+	if erasable {
+		if err := dev.erase(offset); err != nil {
+			return err
+		}
+	}
+	if _, err := dev.WriteAt(data, offset); err != nil {
+		return err
+	}
+	if _, err := dev.ReadAt(check, offset); err != nil {
+		return err
+	}
+	if !bytes.Equal(data, check) {
+		return fmt.Errorf("block at offset %d doesn't read back as written", offset)
+	}
+	return nil
+}
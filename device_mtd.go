@@ -0,0 +1,128 @@
+//go:build linux && selfupdate_mtd
+// +build linux,selfupdate_mtd
+
+package selfupdate
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// mtdInfo is struct mtd_info_user of <mtd/mtd-abi.h>
+type mtdInfo struct {
+	Type      uint8
+	Flags     uint32
+	Size      uint32
+	EraseSize uint32
+	WriteSize uint32
+	OOBSize   uint32
+	Padding   uint64
+}
+
+// eraseInfo is struct erase_info_user of <mtd/mtd-abi.h>
+type eraseInfo struct {
+	Start  uint32
+	Length uint32
+}
+
+// deviceSupported is true if images can be written to raw devices with Options.Device
+const deviceSupported = true
+
+// blockDeviceChunk is the size written at once to devices without erase blocks
+const blockDeviceChunk = 64 * 1024
+
+// ioc encode an ioctl request number like the _IOR and _IOW macros, whose layout depend on the architecture
+func ioc(write bool, nr uintptr, size uintptr) uintptr {
+	dir, shift := uintptr(2), uintptr(30) // _IOC_READ
+	if strings.HasPrefix(runtime.GOARCH, "mips") || strings.HasPrefix(runtime.GOARCH, "ppc") {
+		shift = 29
+		if write {
+			dir = 4
+		}
+	} else if write {
+		dir = 1
+	}
+	return dir<<shift | size<<16 | uintptr('M')<<8 | nr
+}
+
+var (
+	memGetInfo     = ioc(false, 1, unsafe.Sizeof(mtdInfo{}))
+	memErase       = ioc(true, 2, unsafe.Sizeof(eraseInfo{}))
+	memGetBadBlock = ioc(true, 11, unsafe.Sizeof(int64(0)))
+	memSetBadBlock = ioc(true, 12, unsafe.Sizeof(int64(0)))
+)
+
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) (uintptr, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+type rawDevice struct {
+	*os.File
+	size  int64
+	block int64
+	mtd   bool
+}
+
+// openDevice open an MTD partition, like /dev/mtd3, or a block device
+func openDevice(path string) (flashDevice, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var info mtdInfo
+	if _, err = ioctl(f, memGetInfo, unsafe.Pointer(&info)); err == nil {
+		return &rawDevice{File: f, size: int64(info.Size), block: int64(info.EraseSize), mtd: true}, nil
+	}
+	if !errors.Is(err, syscall.ENOTTY) && !errors.Is(err, syscall.EINVAL) {
+		f.Close()
+		return nil, err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rawDevice{File: f, size: size, block: blockDeviceChunk}, nil
+}
+
+func (d *rawDevice) geometry() (int64, int64, bool) {
+	return d.size, d.block, d.mtd
+}
+
+func (d *rawDevice) isBad(offset int64) (bool, error) {
+	if !d.mtd {
+		return false, nil
+	}
+	r, err := ioctl(d.File, memGetBadBlock, unsafe.Pointer(&offset))
+	if errors.Is(err, syscall.EOPNOTSUPP) {
+		// NOR flash has no bad blocks
+		return false, nil
+	}
+	return r > 0, err
+}
+
+func (d *rawDevice) erase(offset int64) error {
+	info := eraseInfo{Start: uint32(offset), Length: uint32(d.block)}
+	_, err := ioctl(d.File, memErase, unsafe.Pointer(&info))
+	return err
+}
+
+func (d *rawDevice) markBad(offset int64) error {
+	_, err := ioctl(d.File, memSetBadBlock, unsafe.Pointer(&offset))
+	return err
+}
+
+func (d *rawDevice) sync() error {
+	return d.File.Sync()
+}
@@ -0,0 +1,12 @@
+//go:build !linux || !selfupdate_mtd
+// +build !linux !selfupdate_mtd
+
+package selfupdate
+
+// deviceSupported is true if images can be written to raw devices with Options.Device
+const deviceSupported = false
+
+// openDevice is only available on Linux when built with the selfupdate_mtd tag
+func openDevice(_ string) (flashDevice, error) {
+	return nil, ErrNotSupported
+}
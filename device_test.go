@@ -0,0 +1,122 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFlash is a NAND flash of 16 blocks of 1kB with some bad blocks and some blocks that go bad when written
+type fakeFlash struct {
+	data    []byte
+	erased  map[int64]bool
+	bad     map[int64]bool
+	failing map[int64]bool
+}
+
+const fakeBlock = 1024
+
+func newFakeFlash() *fakeFlash {
+	return &fakeFlash{data: make([]byte, 16*fakeBlock), erased: map[int64]bool{}, bad: map[int64]bool{}, failing: map[int64]bool{}}
+}
+
+func (f *fakeFlash) geometry() (int64, int64, bool) {
+	return int64(len(f.data)), fakeBlock, true
+}
+
+func (f *fakeFlash) isBad(offset int64) (bool, error) {
+	return f.bad[offset], nil
+}
+
+func (f *fakeFlash) erase(offset int64) error {
+	for i := offset; i < offset+fakeBlock; i++ {
+		f.data[i] = 0xff
+	}
+	f.erased[offset] = true
+	return nil
+}
+
+func (f *fakeFlash) markBad(offset int64) error {
+	f.bad[offset] = true
+	return nil
+}
+
+func (f *fakeFlash) WriteAt(p []byte, offset int64) (int, error) {
+	if offset%fakeBlock != 0 || !f.erased[offset] || f.bad[offset] {
+		return 0, fmt.Errorf("invalid write at %d", offset)
+	}
+	copy(f.data[offset:], p)
+	if f.failing[offset] {
+		f.data[offset+10] ^= 1
+	}
+	delete(f.erased, offset)
+	return len(p), nil
+}
+
+func (f *fakeFlash) ReadAt(p []byte, offset int64) (int, error) {
+	return copy(p, f.data[offset:]), nil
+}
+
+func (f *fakeFlash) sync() error {
+	return nil
+}
+
+func (f *fakeFlash) Close() error {
+	return nil
+}
+
+func TestWriteImage(t *testing.T) {
+	image := make([]byte, 3*fakeBlock+100)
+	_, err := rand.Read(image)
+	assert.Nil(t, err)
+
+	flash := newFakeFlash()
+	flash.bad[fakeBlock] = true
+	flash.failing[2*fakeBlock] = true
+	assert.Nil(t, writeImage(flash, bytes.NewReader(image), int64(len(image))))
+
+	// the bad block is skipped, the failing one is marked bad and its data written to the next one
+	assert.True(t, flash.bad[2*fakeBlock])
+	assert.Equal(t, image[:fakeBlock], flash.data[:fakeBlock])
+	assert.Equal(t, image[fakeBlock:2*fakeBlock], flash.data[3*fakeBlock:4*fakeBlock])
+	assert.Equal(t, image[2*fakeBlock:3*fakeBlock], flash.data[4*fakeBlock:5*fakeBlock])
+	assert.Equal(t, image[3*fakeBlock:], flash.data[5*fakeBlock:5*fakeBlock+100])
+	assert.Equal(t, bytes.Repeat([]byte{0xff}, fakeBlock-100), flash.data[5*fakeBlock+100:6*fakeBlock])
+
+	// too many bad blocks
+	flash = newFakeFlash()
+	for i := int64(0); i < 14; i++ {
+		flash.bad[i*fakeBlock] = true
+	}
+	assert.NotNil(t, writeImage(flash, bytes.NewReader(image), int64(len(image))))
+}
+
+func TestApplyDevice(t *testing.T) {
+	dir := t.TempDir()
+	device := filepath.Join(dir, "mtd3")
+	assert.Nil(t, os.WriteFile(device, make([]byte, 256*1024), 0o644))
+	fName := filepath.Join(dir, "TestApplyDevice")
+	writeOldFile(fName, t)
+
+	err := Apply(bytes.NewReader(newFile), Options{TargetPath: fName, Device: device})
+	if !deviceSupported {
+		assert.True(t, errors.Is(err, ErrNotSupported))
+		return
+	}
+	assert.Nil(t, err)
+
+	b, err := os.ReadFile(device)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b[:len(newFile)])
+	old, err := os.ReadFile(fName)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, old)
+	_, err = os.Stat(filepath.Join(dir, ".TestApplyDevice.new"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -135,7 +135,6 @@ with the private key and distribute the signature along with the update.
 			Checksum: checksum,
 			Signature: signature,
 			Hash: crypto.SHA256, 	                 // this is the default, you don't need to specify it
-			Verifier: update.NewECDSAVerifier(),   // this is the default, you don't need to specify it
 		}
 		err = opts.SetPublicKeyPEM(publicKey)
 		if err != nil {
@@ -148,6 +147,10 @@ with the private key and distribute the signature along with the update.
 		return err
 	}
 
+The public key type select the signature algorithm: ed25519, RSA or ECDSA. If the private key isn't available
+as a plain public key, for example when it lives in an HSM, a custom Verifier can be set in Options.Verifier
+or Config.Verifier instead.
+
 # Building Single-File Go Binaries
 
 In order to update a Go application with self-update, you must distributed it as a single executable.
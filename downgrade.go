@@ -0,0 +1,189 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrDowngrade is returned by CheckNow when the latest version is older than the highest version ever installed
+var ErrDowngrade = errors.New("refusing to downgrade")
+
+// VersionStore define where the highest version ever installed is persisted, to refuse applying an older version
+// served by a compromised or stale mirror
+type VersionStore interface {
+	HighestVersion() (string, error)        // Get the highest version recorded, or an empty string if none
+	SetHighestVersion(version string) error // Record version as the highest version installed
+}
+
+// YankedVersionStore define a VersionStore also keeping the versions moved off because they were yanked by a signed
+// manifest, which are never installed again even if a stale mirror still offers them
+type YankedVersionStore interface {
+	VersionStore
+	YankedVersions() ([]string, error)     // Get the versions recorded as yanked
+	AddYankedVersion(version string) error // Record version as yanked
+}
+
+type fileVersionStore string
+
+var _ YankedVersionStore = fileVersionStore("")
+
+// NewFileVersionStore returns a VersionStore keeping the highest version installed in the file at path
+func NewFileVersionStore(path string) VersionStore {
+	return fileVersionStore(path)
+}
+
+// HighestVersion will return the content of the file
+func (f fileVersionStore) HighestVersion() (string, error) {
+	b, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SetHighestVersion will atomically replace the content of the file with version
+func (f fileVersionStore) SetHighestVersion(version string) error {
+	path := string(f)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, []byte(version+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// YankedVersions will return the lines of the file next to the highest version with the .yanked extension
+func (f fileVersionStore) YankedVersions() ([]string, error) {
+	b, err := os.ReadFile(string(f) + ".yanked")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// AddYankedVersion will append version to the file next to the highest version with the .yanked extension
+func (f fileVersionStore) AddYankedVersion(version string) error {
+	if err := os.MkdirAll(filepath.Dir(string(f)), 0755); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(string(f)+".yanked", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(fp, version); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// versionStore returns the configured VersionStore, by default a file named after the executable in the user
+// configuration directory. It returns nil if there is no place to persist versions.
+func versionStore(conf *Config) VersionStore {
+	if conf.VersionStore != nil {
+		return conf.VersionStore
+	}
+
+	path, err := stateFile(".version")
+	if err != nil {
+		logDebug("No place to record installed versions: %v\n", err)
+		return nil
+	}
+	return NewFileVersionStore(path)
+}
+
+// stateFile returns the path of a file named after the executable with ext in the user configuration directory
+func stateFile(ext string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	exe, err := ExecutableRealPath()
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(exe), filepath.Ext(exe))
+	return filepath.Join(dir, "selfupdate", name+ext), nil
+}
+
+// checkDowngrade returns ErrDowngrade if version is older than the highest version recorded in store according to c,
+// or was recorded as yanked. The update is refused too if store can't be read, so that corrupting or locking it
+// doesn't turn the check off.
+func checkDowngrade(store VersionStore, c VersionComparator, version string) error {
+	if store == nil {
+		return nil
+	}
+	if ys, ok := store.(YankedVersionStore); ok {
+		yanked, err := ys.YankedVersions()
+		if err != nil {
+			return fmt.Errorf("%w: unable to read the yanked versions: %v", ErrDowngrade, err)
+		}
+		for _, y := range yanked {
+			if y == version {
+				return fmt.Errorf("%w: version %s was yanked", ErrDowngrade, version)
+			}
+		}
+	}
+	highest, err := store.HighestVersion()
+	if err != nil {
+		return fmt.Errorf("%w: unable to read the highest version installed: %v", ErrDowngrade, err)
+	}
+	if highest == "" {
+		return nil
+	}
+
+	older, err := newer(c, version, highest)
+	if err != nil {
+		return fmt.Errorf("compare version: %w", err)
+	}
+	if older {
+		return fmt.Errorf("%w: version %s is older than version %s already installed", ErrDowngrade, version, highest)
+	}
+	return nil
+}
+
+// recordYanked persist that version was moved off because it was yanked, if store can keep it
+func recordYanked(store VersionStore, version string) {
+	ys, ok := store.(YankedVersionStore)
+	if !ok {
+		return
+	}
+	if err := ys.AddYankedVersion(version); err != nil {
+		logError("Unable to record the yanked version %s: %v\n", version, err)
+	}
+}
+
+// recordVersion persist version in store if it is higher than the one recorded according to c, or unconditionally
+// if force is true, which is used when moving off a yanked version
+func recordVersion(store VersionStore, c VersionComparator, version string, force bool) {
+	if store == nil || version == "" {
+		return
+	}
+	if !force {
+		highest, err := store.HighestVersion()
+		if err != nil {
+			logError("Unable to read the highest version installed: %v\n", err)
+			return
+		}
+		if highest != "" {
+			higher, err := newer(c, highest, version)
+			if err != nil || !higher {
+				return
+			}
+		}
+	}
+	if err := store.SetHighestVersion(version); err != nil {
+		logError("Unable to record the highest version installed: %v\n", err)
+	}
+}
@@ -0,0 +1,101 @@
+package selfupdate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryVersionStore struct {
+	version string
+}
+
+func (m *memoryVersionStore) HighestVersion() (string, error) { return m.version, nil }
+
+func (m *memoryVersionStore) SetHighestVersion(version string) error {
+	m.version = version
+	return nil
+}
+
+// brokenVersionStore is a VersionStore that can't be read
+type brokenVersionStore struct{}
+
+func (brokenVersionStore) HighestVersion() (string, error) { return "", errors.New("store locked") }
+
+func (brokenVersionStore) SetHighestVersion(string) error { return errors.New("store locked") }
+
+func TestFileVersionStore(t *testing.T) {
+	store := NewFileVersionStore(filepath.Join(t.TempDir(), "selfupdate", "myapp.version"))
+
+	v, err := store.HighestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "", v)
+
+	recordVersion(store, nil, "1.2.0", false)
+	recordVersion(store, nil, "1.1.0", false)
+	v, err = store.HighestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v)
+
+	assert.Nil(t, checkDowngrade(store, nil, "1.2.0"))
+	assert.Nil(t, checkDowngrade(store, nil, "1.3.0"))
+	assert.ErrorIs(t, checkDowngrade(store, nil, "1.1.9"), ErrDowngrade)
+
+	recordVersion(store, nil, "1.1.0", true)
+	v, err = store.HighestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v)
+}
+
+func TestCheckNowDowngrade(t *testing.T) {
+	server := yankServer()
+	defer server.Close()
+
+	// the executable was rolled back to 1.0.0 after 1.5.0 was installed, the mirror serves 1.1.0
+	store := &memoryVersionStore{version: "1.5.0"}
+	asked := false
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           store,
+		UpgradeConfirmCallback: func(string) bool { asked = true; return false },
+	}}
+	assert.ErrorIs(t, u.CheckNow(), ErrDowngrade)
+	assert.False(t, asked)
+
+	u.conf.AllowDowngrade = true
+	assert.Nil(t, u.CheckNow())
+	assert.True(t, asked)
+
+	// the running version is recorded
+	store.version = "0.9.0"
+	u.conf.AllowDowngrade = false
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, "1.0.0", store.version)
+}
+
+func TestCheckDowngradeUnreadableStore(t *testing.T) {
+	err := checkDowngrade(brokenVersionStore{}, SemVerComparator, "1.1.0")
+	assert.ErrorIs(t, err, ErrDowngrade)
+	assert.Contains(t, err.Error(), "store locked")
+
+	// a corrupted file can't be read as a version either
+	path := filepath.Join(t.TempDir(), "myapp.version")
+	assert.Nil(t, os.Mkdir(path, 0755))
+	assert.ErrorIs(t, checkDowngrade(NewFileVersionStore(path), SemVerComparator, "1.1.0"), ErrDowngrade)
+
+	server := yankServer()
+	defer server.Close()
+	asked := false
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           brokenVersionStore{},
+		UpgradeConfirmCallback: func(string) bool { asked = true; return true },
+	}}
+	assert.ErrorIs(t, u.CheckNow(), ErrDowngrade)
+	assert.False(t, asked)
+}
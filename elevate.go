@@ -0,0 +1,119 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ErrNeedsElevation is returned when the executable can't be replaced without administrator rights, and
+// Config.Elevate is not set or elevation is not possible
+var ErrNeedsElevation = errors.New("elevated privileges required")
+
+// replaceScript is the shell script replacing $3 by $1 through $2 in the same directory, keeping $3 at $4 and
+// setting the mode $5, run with elevated privileges on Unix. $1 stays writable by the user, so the copy $2, which
+// only root can change, must have the SHA-256 $6 of the verified update before it is installed.
+const replaceScript = `rm -f -- "$2" && cp -- "$1" "$2" || exit 1; ` +
+	`if command -v sha256sum >/dev/null; then sum=$(sha256sum < "$2"); else sum=$(shasum -a 256 < "$2"); fi; ` +
+	`[ "${sum%% *}" = "$6" ] || { rm -f -- "$2"; echo "$1 changed since it was verified" >&2; exit 1; }; ` +
+	`chmod "$5" "$2" && { ln -f -- "$3" "$4" 2>/dev/null || true; } && mv -f -- "$2" "$3"`
+
+// replaceCommand returns the command line running replaceScript to replace target by staged, whose SHA-256 is sum
+func replaceCommand(staged, target string, mode os.FileMode, sum []byte) []string {
+	tmp := filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.new", filepath.Base(target)))
+	return []string{"/bin/sh", "-c", replaceScript, "sh", staged, tmp, target, backupPath(target), fmt.Sprintf("%o", unixMode(mode)), hex.EncodeToString(sum)}
+}
+
+// unixMode returns mode as the octal permissions of chmod, the setuid, setgid and sticky bits included
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// sha256File returns the SHA-256 of the file at path
+func sha256File(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// writableDir report if files can be created in dir, other errors than a denied permission are left to the install
+// to report
+func writableDir(dir string) bool {
+	f, err := os.CreateTemp(dir, ".selfupdate-*")
+	if err != nil {
+		return !os.IsPermission(err)
+	}
+	f.Close()
+	_ = os.Remove(f.Name())
+	return true
+}
+
+// installElevated install newVer over exe, in a directory that is not writable: the update is applied and verified
+// on a copy of exe in a temporary directory, which then replaces exe with elevated privileges. The elevated command
+// checks the copy it installs still has the SHA-256 of the update as it was written and verified. Only the
+// executable is replaced this way, updates carrying other files or a whole .app bundle are refused before they are
+// downloaded.
+func (u *Updater) installElevated(ctx context.Context, conf *Config, from string, newVer *Version, exe string) error {
+	if len(newVer.Files) > 0 {
+		return fmt.Errorf("%w: bundles can't be installed with elevated privileges", ErrNeedsElevation)
+	}
+	if runtime.GOOS == "darwin" && (conf.AppBundle || newVer.Archive == "dmg") && appBundleOf(exe) != "" {
+		return fmt.Errorf("%w: application bundles can't be installed with elevated privileges", ErrNeedsElevation)
+	}
+
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	mode := targetMode(exe)
+	dir, err := os.MkdirTemp("", "selfupdate")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	staged := filepath.Join(dir, filepath.Base(exe))
+	if err = copyFile(exe, staged, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	// the digest is computed while the update is written and checked against what its signature was verified on,
+	// the staged file itself can be changed by any process of the user
+	u.staged = sha256.New()
+	err = u.install(ctx, conf, from, newVer, staged)
+	sum := u.staged.Sum(nil)
+	u.staged = nil
+	if err != nil {
+		return err
+	}
+
+	logInfo("Installing %s with elevated privileges.\n", exe)
+	if err = elevatedReplace(ctx, u.executable, exe, mode, sum); err != nil {
+		// including when the user declined, the executable still needs elevated privileges to be replaced
+		return fmt.Errorf("%w: elevated install: %v", ErrNeedsElevation, err)
+	}
+	u.executable = exe
+	return nil
+}
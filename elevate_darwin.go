@@ -0,0 +1,24 @@
+package selfupdate
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// elevatedReplace replace target by staged as root once its copy is checked against sum, after the administrator
+// authentication prompt of macOS
+func elevatedReplace(ctx context.Context, staged, target string, mode os.FileMode, sum []byte) error {
+	quoted := []string{}
+	for _, arg := range replaceCommand(staged, target, mode, sum) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	script := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(strings.Join(quoted, " "))
+	return exec.CommandContext(ctx, "/usr/bin/osascript", "-e", `do shell script "`+script+`" with administrator privileges`).Run()
+}
+
+// shellQuote quote s so that the shell reads it as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
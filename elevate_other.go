@@ -0,0 +1,33 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// elevatedReplace replace target by staged as root once its copy is checked against sum, with pkexec in a
+// graphical session or sudo otherwise
+func elevatedReplace(ctx context.Context, staged, target string, mode os.FileMode, sum []byte) error {
+	args := replaceCommand(staged, target, mode, sum)
+
+	var cmd *exec.Cmd
+	pkexec, perr := exec.LookPath("pkexec")
+	sudo, serr := exec.LookPath("sudo")
+	switch {
+	case perr == nil && (os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""):
+		cmd = exec.CommandContext(ctx, pkexec, args...)
+	case serr == nil:
+		cmd = exec.CommandContext(ctx, sudo, append([]string{"--"}, args...)...)
+	case perr == nil:
+		cmd = exec.CommandContext(ctx, pkexec, args...)
+	default:
+		return fmt.Errorf("%w: neither pkexec nor sudo is available", ErrNeedsElevation)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,79 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritableDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.True(t, writableDir(dir))
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestReplaceCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the replacement is run by cmd.exe on Windows")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "my app")
+	staged := filepath.Join(t.TempDir(), "my app")
+	assert.Nil(t, os.WriteFile(target, oldFile, 0755))
+	assert.Nil(t, os.WriteFile(staged, newFile, 0600))
+
+	// run without elevation, as it would be once elevated
+	sum := sha256.Sum256(newFile)
+	args := replaceCommand(staged, target, 0751|os.ModeSetgid, sum[:])
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	assert.Nil(t, err, string(out))
+
+	b, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b)
+	b, err = os.ReadFile(backupPath(target))
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+	fi, err := os.Stat(target)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0751), fi.Mode().Perm())
+	assert.True(t, fi.Mode()&os.ModeSetgid != 0)
+	_, err = os.Stat(filepath.Join(dir, ".my app.new"))
+	assert.True(t, os.IsNotExist(err))
+
+	// a file changed after it was verified is not installed
+	assert.Nil(t, os.WriteFile(staged, []byte("tampered"), 0600))
+	args = replaceCommand(staged, target, 0755, sum[:])
+	_, err = exec.Command(args[0], args[1:]...).CombinedOutput()
+	assert.NotNil(t, err)
+	b, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b)
+	_, err = os.Stat(filepath.Join(dir, ".my app.new"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInstallElevatedBundle(t *testing.T) {
+	source := &staticSource{}
+	u := &Updater{conf: &Config{Source: source, Elevate: true}}
+	exe := filepath.Join(t.TempDir(), "app")
+	assert.Nil(t, os.WriteFile(exe, oldFile, 0755))
+
+	v := &Version{Number: "1.1.0", Files: []BundleFile{{Member: "lib.so", Path: "lib.so"}}}
+	err := u.installElevated(context.Background(), u.conf, "1.0.0", v, exe)
+	assert.ErrorIs(t, err, ErrNeedsElevation)
+	assert.Contains(t, err.Error(), "bundles")
+	assert.Equal(t, 0, source.gets)
+
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+}
@@ -0,0 +1,110 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	seeMaskNoCloseProcess = 0x40
+	swHide                = 0
+)
+
+// shellExecuteInfo is SHELLEXECUTEINFOW
+type shellExecuteInfo struct {
+	cbSize       uint32
+	fMask        uint32
+	hwnd         uintptr
+	lpVerb       *uint16
+	lpFile       *uint16
+	lpParameters *uint16
+	lpDirectory  *uint16
+	nShow        int32
+	hInstApp     uintptr
+	lpIDList     uintptr
+	lpClass      *uint16
+	hkeyClass    uintptr
+	dwHotKey     uint32
+	hIcon        uintptr
+	hProcess     syscall.Handle
+}
+
+// elevatedReplace replace target by staged from a PowerShell script started after the UAC consent. staged stays
+// writable by the user, so it is copied next to target first, where only administrators can change it, and the
+// copy must have the SHA-256 sum of the verified update. The running target is renamed to its backup before the
+// copy takes its place, as it can't be overwritten.
+func elevatedReplace(ctx context.Context, staged, target string, _ os.FileMode, sum []byte) error {
+	tmp := filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.new", filepath.Base(target)))
+	script := fmt.Sprintf(`$ErrorActionPreference = 'Stop'
+try {
+	Copy-Item -LiteralPath %[1]s -Destination %[2]s -Force
+	if ((Get-FileHash -LiteralPath %[2]s -Algorithm SHA256).Hash -ne '%[5]s') {
+		Remove-Item -LiteralPath %[2]s -Force
+		exit 2
+	}
+	Remove-Item -LiteralPath %[4]s -Force -ErrorAction SilentlyContinue
+	Move-Item -LiteralPath %[3]s -Destination %[4]s -Force
+	try { Move-Item -LiteralPath %[2]s -Destination %[3]s -Force } catch { Move-Item -LiteralPath %[4]s -Destination %[3]s -Force; throw }
+} catch {
+	Remove-Item -LiteralPath %[2]s -Force -ErrorAction SilentlyContinue
+	exit 1
+}
+`, psQuote(staged), psQuote(tmp), psQuote(target), psQuote(backupPath(target)), hex.EncodeToString(sum))
+	params := "-NoProfile -NonInteractive -WindowStyle Hidden -EncodedCommand " + encodePowerShell(script)
+
+	verb, err := syscall.UTF16PtrFromString("runas")
+	if err != nil {
+		return err
+	}
+	file, err := syscall.UTF16PtrFromString("powershell.exe")
+	if err != nil {
+		return err
+	}
+	parameters, err := syscall.UTF16PtrFromString(params)
+	if err != nil {
+		return err
+	}
+	info := &shellExecuteInfo{fMask: seeMaskNoCloseProcess, lpVerb: verb, lpFile: file, lpParameters: parameters, nShow: swHide}
+	info.cbSize = uint32(unsafe.Sizeof(*info))
+
+	shellExecuteEx := syscall.NewLazyDLL("shell32.dll").NewProc("ShellExecuteExW")
+	if r1, _, err := shellExecuteEx.Call(uintptr(unsafe.Pointer(info))); r1 == 0 {
+		// also when the user declined the UAC prompt
+		return fmt.Errorf("%w: %v", ErrNeedsElevation, err)
+	}
+	defer syscall.CloseHandle(info.hProcess)
+
+	done := make(chan error, 1)
+	go func() {
+		if _, err := syscall.WaitForSingleObject(info.hProcess, syscall.INFINITE); err != nil {
+			done <- err
+			return
+		}
+		var code uint32
+		if err := syscall.GetExitCodeProcess(info.hProcess, &code); err != nil {
+			done <- err
+			return
+		}
+		switch code {
+		case 0:
+		case 2:
+			done <- fmt.Errorf("%s changed since it was verified", staged)
+			return
+		default:
+			done <- fmt.Errorf("elevated command exited with code %d", code)
+			return
+		}
+		done <- nil
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
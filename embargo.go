@@ -0,0 +1,35 @@
+package selfupdate
+
+import (
+	"net/http"
+	"time"
+)
+
+// withoutEmbargoed returns the entries of the manifest that are available at now, entries with an available_from
+// time in the future are uploaded ahead of a coordinated launch and must not be picked up yet
+func withoutEmbargoed(appVersions []appVersion, now time.Time) []appVersion {
+	available := make([]appVersion, 0, len(appVersions))
+	for _, a := range appVersions {
+		if !a.AvailableFrom.IsZero() && now.Before(a.AvailableFrom) {
+			logDebug("Version %s is embargoed until %s.\n", a.Version, a.AvailableFrom)
+			continue
+		}
+		available = append(available, a)
+	}
+	return available
+}
+
+// authenticatedTime returns the time of the Date header of response when it was received over TLS, so it is
+// vouched for by the update server instead of a local clock that could be wrong or set forward on purpose. The
+// local time is returned otherwise.
+func authenticatedTime(response *http.Response) time.Time {
+	if response.TLS == nil {
+		return time.Now()
+	}
+	date, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		logDebug("No usable Date header from the update server, using the local clock: %v\n", err)
+		return time.Now()
+	}
+	return date
+}
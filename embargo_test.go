@@ -0,0 +1,51 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func embargoHandler(availableFrom time.Time, date time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !date.IsZero() {
+			w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+		}
+		fmt.Fprintf(w, `[{"os":%[1]q,"version":"2.0.0","available_from":%[2]q},{"os":%[1]q,"version":"1.1.0"}]`,
+			runtime.GOOS, availableFrom.Format(time.RFC3339))
+	}
+}
+
+func TestHTTPSourceEmbargo(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		availableFrom time.Time
+		date          time.Time
+		tls           bool
+		latest        string
+	}{
+		{now.Add(time.Hour), time.Time{}, false, "1.1.0"},
+		{now.Add(-time.Hour), time.Time{}, false, "2.0.0"},
+		// the date of the server is trusted over TLS only
+		{now.Add(time.Hour), now.Add(2 * time.Hour), true, "2.0.0"},
+		{now.Add(time.Hour), now.Add(2 * time.Hour), false, "1.1.0"},
+		{now.Add(-time.Hour), now.Add(-2 * time.Hour), true, "1.1.0"},
+	} {
+		var server *httptest.Server
+		if c.tls {
+			server = httptest.NewTLSServer(embargoHandler(c.availableFrom, c.date))
+		} else {
+			server = httptest.NewServer(embargoHandler(c.availableFrom, c.date))
+		}
+
+		v, err := NewHTTPSource(server.Client(), server.URL).LatestVersion()
+		assert.Nil(t, err)
+		assert.Equal(t, c.latest, v.Number, c)
+		server.Close()
+	}
+}
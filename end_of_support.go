@@ -0,0 +1,84 @@
+package selfupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SupportSource define a Source whose manifest can declare when versions reach their end of support
+type SupportSource interface {
+	Source
+	EndOfSupport(version string) time.Time // When version stops being supported according to the last manifest fetched, zero if unknown
+}
+
+// EndOfSupportReport is what the beacon send when the running version is past its end of support. It doesn't
+// identify the device, only what is needed to count the clients still running old versions.
+type EndOfSupportReport struct {
+	Version      string    `json:"version"`        // Version running
+	EndOfSupport time.Time `json:"end_of_support"` // When it stopped being supported
+	Latest       string    `json:"latest"`         // Latest version announced by the Source
+	OS           string    `json:"os"`
+	Arch         string    `json:"arch"`
+}
+
+// EndOfSupportReporter define where the end of support beacon is sent
+type EndOfSupportReporter interface {
+	ReportEndOfSupport(*EndOfSupportReport) error
+}
+
+type httpEndOfSupportReporter struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPEndOfSupportReporter returns an EndOfSupportReporter that POST the report as JSON to url
+func NewHTTPEndOfSupportReporter(client *http.Client, url string) EndOfSupportReporter {
+	return &httpEndOfSupportReporter{client: secureClient(client), url: url}
+}
+
+func (h *httpEndOfSupportReporter) ReportEndOfSupport(report *EndOfSupportReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("end of support report refused by %s: %s", h.url, resp.Status)
+	}
+	return nil
+}
+
+// reportEndOfSupport send the beacon once per version if current is past its end of support according to the
+// Source. Failures are only logged, the beacon must never get in the way of updating.
+func (u *Updater) reportEndOfSupport(conf *Config, current string, latest string) {
+	if conf.EndOfSupportReporter == nil || current == "" || u.endOfSupportReported == current {
+		return
+	}
+	ss, ok := conf.Source.(SupportSource)
+	if !ok {
+		return
+	}
+	eos := ss.EndOfSupport(strings.TrimSpace(current))
+	if eos.IsZero() || time.Now().Before(eos) {
+		return
+	}
+
+	logInfo("Version %s reached its end of support on %s.\n", current, eos.Format("2006-01-02"))
+	report := &EndOfSupportReport{Version: current, EndOfSupport: eos, Latest: latest, OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if err := conf.EndOfSupportReporter.ReportEndOfSupport(report); err != nil {
+		logError("Unable to report the end of support of version %s: %v\n", current, err)
+		return
+	}
+	u.endOfSupportReported = current
+}
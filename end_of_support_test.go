@@ -0,0 +1,66 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNowEndOfSupport(t *testing.T) {
+	eos := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%[1]q,"version":"2.0.0"},`+
+			`{"os":%[1]q,"version":"1.0.0","end_of_support":%[2]q},`+
+			`{"os":%[1]q,"version":"1.5.0","end_of_support":%[3]q}]`,
+			runtime.GOOS, eos.Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	var reports []EndOfSupportReport
+	beacon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report EndOfSupportReport
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&report))
+		reports = append(reports, report)
+	}))
+	defer beacon.Close()
+
+	for _, c := range []struct {
+		current string
+		reports int
+	}{
+		{"1.0.0", 1},
+		{"1.5.0", 0},
+		{"1.2.0", 0},
+	} {
+		reports = nil
+		u := &Updater{conf: &Config{
+			Current:                &Version{Number: c.current},
+			Source:                 NewHTTPSource(nil, server.URL),
+			VersionStore:           &memoryVersionStore{},
+			EndOfSupportReporter:   NewHTTPEndOfSupportReporter(nil, beacon.URL),
+			UpgradeConfirmCallback: func(string) bool { return false },
+		}}
+
+		// the beacon is only sent once per version
+		assert.Nil(t, u.CheckNow())
+		assert.Nil(t, u.CheckNow())
+		assert.Equal(t, c.reports, len(reports), c.current)
+	}
+
+	reports = nil
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           &memoryVersionStore{},
+		EndOfSupportReporter:   NewHTTPEndOfSupportReporter(nil, beacon.URL),
+		UpgradeConfirmCallback: func(string) bool { return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EndOfSupportReport{{Version: "1.0.0", EndOfSupport: eos, Latest: "2.0.0", OS: runtime.GOOS, Arch: runtime.GOARCH}}, reports)
+}
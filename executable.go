@@ -25,7 +25,7 @@ func ExecutableRealPath() (string, error) {
 	return exePath, nil
 }
 
-// ExecutableDefaultOldPath returns the path to the old executable and an error if something went bad
+// ExecutableDefaultOldPath returns the path the executable replaced by the last update is kept at, and an error if something went bad
 func ExecutableDefaultOldPath() (string, error) {
 	if loadPath() != nil {
 		return "", exeErr
@@ -44,7 +44,7 @@ func loadPath() error {
 		filename := filepath.Base(exePath)
 
 		// get file path to the old executable
-		defaultOldExePath = filepath.Join(updateDir, fmt.Sprintf(".%s.old", filename))
+		defaultOldExePath = filepath.Join(updateDir, fmt.Sprintf(".%s.bak", filename))
 	})
 	return exeErr
 }
@@ -73,6 +73,10 @@ func getExecutableRealPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// the executable of an AppImage is on a read-only mount, the image is what gets updated and restarted
+	if image := appImagePath(exe); image != "" {
+		return image, nil
+	}
 
 	return exe, nil
 }
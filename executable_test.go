@@ -31,5 +31,5 @@ func TestAlwaysFindOldExecutable(t *testing.T) {
 	ext := filepath.Ext(exe)
 	assert.Nil(t, err)
 	assert.NotEmpty(t, exe)
-	assert.Equal(t, ".old", ext)
+	assert.Equal(t, ".bak", ext)
 }
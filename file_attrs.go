@@ -0,0 +1,76 @@
+package selfupdate
+
+import (
+	"os"
+	"strings"
+)
+
+// targetMode returns the mode the replacement of target is created with: the one of target, special bits included
+func targetMode(target string) os.FileMode {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return 0755
+	}
+	mode := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if mode == 0 {
+		return 0755
+	}
+	return mode
+}
+
+// preserveAttributes carry over the owner of src to dst when running privileged, then mode, which changing owner
+// may have cleared the setuid bit of, and the extended attributes of src. Failures are only logged, the update
+// itself is valid.
+func preserveAttributes(src, dst string, mode os.FileMode) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return
+	}
+	if err = preserveOwner(fi, dst); err != nil {
+		logDebug("Unable to preserve the owner of %s: %v\n", src, err)
+	}
+	if err = os.Chmod(dst, mode); err != nil {
+		logDebug("Unable to set the mode of %s: %v\n", dst, err)
+	}
+	if err = copyXattrs(src, dst); err != nil {
+		logDebug("Unable to preserve the extended attributes of %s: %v\n", src, err)
+	}
+}
+
+// xattrCopier give access to the extended attributes of files, as the system calls differ between systems
+type xattrCopier struct {
+	list func(path string, dest []byte) (int, error)
+	get  func(path, name string, dest []byte) (int, error)
+	set  func(path, name string, value []byte) error
+	skip func(name string) bool
+}
+
+// copy set the extended attributes of src on dst, the first failure is returned once all were tried
+func (x *xattrCopier) copy(src, dst string) error {
+	size, err := x.list(src, nil)
+	if err != nil || size <= 0 {
+		return err
+	}
+	names := make([]byte, size)
+	if size, err = x.list(src, names); err != nil {
+		return err
+	}
+
+	var first error
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if name == "" || (x.skip != nil && x.skip(name)) {
+			continue
+		}
+		n, err := x.get(src, name, nil)
+		if err == nil {
+			value := make([]byte, n)
+			if n, err = x.get(src, name, value); err == nil {
+				err = x.set(dst, name, value[:n])
+			}
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!illumos,!linux,!netbsd,!openbsd,!solaris
+
+package selfupdate
+
+import "os"
+
+// preserveOwner does nothing, the owner of new files is inherited on these systems
+func preserveOwner(_ os.FileInfo, _ string) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package selfupdate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPreservesMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on Windows")
+	}
+	target := filepath.Join(t.TempDir(), "myapp")
+	writeOldFile(target, t)
+	assert.Nil(t, os.Chmod(target, 0711|os.ModeSetuid))
+
+	err := Apply(bytes.NewReader(newFile), Options{TargetPath: target})
+	validateUpdate(target, err, t)
+	fi, err := os.Stat(target)
+	assert.Nil(t, err)
+	assert.Equal(t, 0711|os.ModeSetuid, fi.Mode()&(os.ModePerm|os.ModeSetuid))
+}
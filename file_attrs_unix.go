@@ -0,0 +1,18 @@
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd illumos linux netbsd openbsd solaris
+
+package selfupdate
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner give dst the owner and group described by fi, only root can do so
+func preserveOwner(fi os.FileInfo, dst string) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(dst, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,89 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// GPGSource define a Source that is able to provide a detached OpenPGP signature of the executable
+type GPGSource interface {
+	Source
+	GetGPGSignature() ([]byte, error) // Get the armored or binary detached signature of the executable
+}
+
+// GPGVerifier verify detached OpenPGP signatures, for projects whose release pipeline already sign with GPG.
+// Armored or binary signatures (gpg --detach-sign) over a SHA-2 digest are supported. A signature is only valid
+// if the key or subkey that made it is allowed to sign, is bound to its primary key, and neither the key nor the
+// signature are revoked or expired. Signatures with unknown critical subpackets or notations are refused.
+type GPGVerifier struct {
+	keys openpgp.EntityList
+}
+
+// gpgHashes are the digests a signature can be made over, SHA-1 and older are refused
+var gpgHashes = []crypto.Hash{crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA3_256, crypto.SHA3_512}
+
+// NewGPGVerifier returns a GPGVerifier trusting all the keys and subkeys of an armored or binary public key ring,
+// as exported by `gpg --armor --export`.
+func NewGPGVerifier(keyRing []byte) (*GPGVerifier, error) {
+	var keys openpgp.EntityList
+	var err error
+	if isArmored(keyRing) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(keyRing))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(keyRing))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP key ring: %w", err)
+	}
+	return &GPGVerifier{keys: keys}, nil
+}
+
+// Verify check that signature is a valid detached signature of payload by one of the trusted keys
+func (g *GPGVerifier) Verify(payload []byte, signature []byte) error {
+	return g.verify(bytes.NewReader(payload), signature)
+}
+
+// verifyFile check signature like Verify, streaming the payload from the file at path
+func (g *GPGVerifier) verifyFile(path string, signature []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.verify(f, signature)
+}
+
+func (g *GPGVerifier) verify(payload io.Reader, signature []byte) error {
+	var sig io.Reader = bytes.NewReader(signature)
+	if isArmored(signature) {
+		block, err := armor.Decode(sig)
+		if err != nil {
+			return fmt.Errorf("invalid OpenPGP signature: %w", err)
+		}
+		if block.Type != openpgp.SignatureType {
+			return fmt.Errorf("invalid OpenPGP signature: armored %s", block.Type)
+		}
+		sig = block.Body
+	}
+	signer, err := openpgp.CheckDetachedSignatureAndHash(g.keys, payload, sig, gpgHashes, nil)
+	if err != nil {
+		return fmt.Errorf("invalid OpenPGP signature: %w", err)
+	}
+	logDebug("Valid OpenPGP signature from key %X.\n", signer.PrimaryKey.Fingerprint)
+	return nil
+}
+
+// isArmored report if data is ASCII armored rather than binary OpenPGP
+func isArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP"))
+}
+
+func (g *GPGVerifier) String() string {
+	return fmt.Sprintf("GPGVerifier(%d keys)", len(g.keys))
+}
@@ -0,0 +1,203 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func readGPGTestData(t *testing.T, name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", "openpgp", name))
+	assert.Nil(t, err)
+	return b
+}
+
+func TestApplyGPGSignature(t *testing.T) {
+	fName := "TestApplyGPGSignature"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	verifier, err := NewGPGVerifier(readGPGTestData(t, "ed.asc"))
+	assert.Nil(t, err)
+
+	payload := readGPGTestData(t, "payload")
+	err = Apply(bytes.NewReader(payload), Options{
+		TargetPath:   fName,
+		GPGVerifier:  verifier,
+		GPGSignature: readGPGTestData(t, "payload.ed.asc"),
+	})
+	assert.Nil(t, err)
+
+	buf, err := os.ReadFile(fName)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, buf)
+}
+
+func TestApplyGPGSignatureNegative(t *testing.T) {
+	fName := "TestApplyGPGSignatureNegative"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	verifier, err := NewGPGVerifier(readGPGTestData(t, "rsa.asc"))
+	assert.Nil(t, err)
+
+	err = Apply(bytes.NewReader(readGPGTestData(t, "payload")), Options{
+		TargetPath:   fName,
+		GPGVerifier:  verifier,
+		GPGSignature: readGPGTestData(t, "payload.ed.asc"),
+	})
+	assert.NotNil(t, err)
+
+	err = Apply(bytes.NewReader(readGPGTestData(t, "payload")), Options{
+		TargetPath:  fName,
+		GPGVerifier: verifier,
+	})
+	assert.NotNil(t, err)
+
+	buf, err := os.ReadFile(fName)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, buf)
+}
+
+func TestGPGVerifier(t *testing.T) {
+	payload := readGPGTestData(t, "payload")
+	for _, name := range []string{"ed", "rsa", "ec"} {
+		verifier, err := NewGPGVerifier(readGPGTestData(t, name+".asc"))
+		assert.Nil(t, err, name)
+		signature := readGPGTestData(t, "payload."+name+".asc")
+		assert.Nil(t, verifier.Verify(payload, signature), name)
+		assert.NotNil(t, verifier.Verify(append(payload, '!'), signature), name)
+	}
+
+	verifier, err := NewGPGVerifier(readGPGTestData(t, "rsa.asc"))
+	assert.Nil(t, err)
+	assert.NotNil(t, verifier.Verify(payload, readGPGTestData(t, "payload.ed.asc")))
+}
+
+// gpgKey returns a new OpenPGP key made with config, with its public key ring
+func gpgKey(t *testing.T, config *packet.Config) (*openpgp.Entity, []byte) {
+	e, err := openpgp.NewEntity("selfupdate", "", "test@example.com", config)
+	assert.Nil(t, err)
+	return e, gpgPublic(t, e)
+}
+
+// gpgPublic returns the binary public key ring of e
+func gpgPublic(t *testing.T, e *openpgp.Entity) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, e.Serialize(&buf))
+	return buf.Bytes()
+}
+
+// gpgSign returns the binary detached signature of payload by e
+func gpgSign(t *testing.T, e *openpgp.Entity, payload []byte, config *packet.Config) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, openpgp.DetachSign(&buf, e, bytes.NewReader(payload), config))
+	return buf.Bytes()
+}
+
+// gpgVerify returns the error of the verification of signature of payload with the keys of keyRing
+func gpgVerify(keyRing []byte, payload []byte, signature []byte) error {
+	verifier, err := NewGPGVerifier(keyRing)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(payload, signature)
+}
+
+func TestGPGVerifierRevokedKey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, keyRing := gpgKey(t, config)
+	signature := gpgSign(t, e, newFile, config)
+	assert.Nil(t, gpgVerify(keyRing, newFile, signature))
+
+	assert.Nil(t, e.RevokeKey(packet.KeyCompromised, "leaked", config))
+	assert.NotNil(t, gpgVerify(gpgPublic(t, e), newFile, signature))
+}
+
+func TestGPGVerifierExpired(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	// the key expired a minute after its creation, an hour ago
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, KeyLifetimeSecs: 60, Time: func() time.Time { return past }}
+	e, keyRing := gpgKey(t, config)
+	assert.NotNil(t, gpgVerify(keyRing, newFile, gpgSign(t, e, newFile, config)))
+
+	// the key is valid, but the signature expired
+	config = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Time: func() time.Time { return past }}
+	e, keyRing = gpgKey(t, config)
+	assert.Nil(t, gpgVerify(keyRing, newFile, gpgSign(t, e, newFile, config)))
+	config.SigLifetimeSecs = 60
+	assert.NotNil(t, gpgVerify(keyRing, newFile, gpgSign(t, e, newFile, config)))
+}
+
+func TestGPGVerifierSubkeys(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, _ := gpgKey(t, config)
+	assert.Nil(t, e.AddSigningSubkey(config))
+	signer := e.Subkeys[len(e.Subkeys)-1]
+	signature := gpgSign(t, e, newFile, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, SigningKeyId: signer.PublicKey.KeyId})
+	assert.Nil(t, gpgVerify(gpgPublic(t, e), newFile, signature))
+
+	// without its binding signature, the subkey isn't one of the key
+	var unbound bytes.Buffer
+	assert.Nil(t, e.PrimaryKey.Serialize(&unbound))
+	for _, id := range e.Identities {
+		assert.Nil(t, id.UserId.Serialize(&unbound))
+		assert.Nil(t, id.SelfSignature.Serialize(&unbound))
+	}
+	assert.Nil(t, signer.PublicKey.Serialize(&unbound))
+	assert.NotNil(t, gpgVerify(unbound.Bytes(), newFile, signature))
+
+	// nor is a subkey bound for encryption only allowed to sign
+	rsaConfig := &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}
+	e, keyRing := gpgKey(t, rsaConfig)
+	encryption := e.Subkeys[0]
+	assert.False(t, encryption.Sig.FlagSign)
+	sig := &packet.Signature{
+		Version:      4,
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   encryption.PublicKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &encryption.PublicKey.KeyId,
+	}
+	h := crypto.SHA256.New()
+	h.Write(newFile)
+	assert.Nil(t, sig.Sign(h, encryption.PrivateKey, rsaConfig))
+	var buf bytes.Buffer
+	assert.Nil(t, sig.Serialize(&buf))
+	assert.NotNil(t, gpgVerify(keyRing, newFile, buf.Bytes()))
+}
+
+func TestGPGVerifierCriticalSubpacket(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, keyRing := gpgKey(t, config)
+	signature := gpgSign(t, e, newFile, config)
+	assert.Nil(t, gpgVerify(keyRing, newFile, signature))
+
+	// a signature with a subpacket it doesn't know marked critical is dropped as unsupported, before it is even
+	// checked: add one of the private subpacket types, 100, with the critical bit, to the hashed area
+	assert.Equal(t, byte(0xc2), signature[0]) // new format signature packet, one byte length
+	body := signature[2:]
+	hashedLen := int(body[4])<<8 | int(body[5]) + 3
+	patched := append([]byte{}, body[:6]...)
+	patched = append(patched, 2, 0x80|100, 0)
+	patched = append(patched, body[6:]...)
+	patched[4], patched[5] = byte(hashedLen>>8), byte(hashedLen)
+	err := gpgVerify(keyRing, newFile, append([]byte{0xc2, byte(len(patched))}, patched...))
+	assert.True(t, errors.Is(err, pgperrors.ErrUnknownIssuer), err)
+
+	// as are unknown critical notations
+	notation := &packet.Notation{Name: "unknown@example.com", Value: []byte("x"), IsCritical: true, IsHumanReadable: true}
+	config.SignatureNotations = []*packet.Notation{notation}
+	assert.NotNil(t, gpgVerify(keyRing, newFile, gpgSign(t, e, newFile, config)))
+}
@@ -0,0 +1,265 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UpdateState describe the last update installed while Config.HealthWindow is set, until the new version is marked
+// healthy or rolled back
+type UpdateState struct {
+	Version    string    `json:"version"`           // Version installed
+	Previous   string    `json:"previous"`          // Version it replaced
+	Backup     string    `json:"backup"`            // Path of the executable of the previous version
+	Started    time.Time `json:"started,omitempty"` // When the installed version first started, zero until then
+	Healthy    bool      `json:"healthy"`           // true once the installed version called Updater.MarkHealthy
+	RolledBack bool      `json:"rolled_back"`       // true once the previous version was restored because the installed one didn't become healthy
+}
+
+// HealthStore define where the state of the last update is persisted, so that the next start can tell if it is
+// running an update that never became healthy
+type HealthStore interface {
+	UpdateState() (*UpdateState, error)      // Get the state of the last update, or nil if none was recorded
+	SetUpdateState(state *UpdateState) error // Record the state of the last update
+}
+
+type fileHealthStore string
+
+// NewFileHealthStore returns a HealthStore keeping the state of the last update as JSON in the file at path
+func NewFileHealthStore(path string) HealthStore {
+	return fileHealthStore(path)
+}
+
+// UpdateState will return the state decoded from the file
+func (f fileHealthStore) UpdateState() (*UpdateState, error) {
+	b, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &UpdateState{}
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SetUpdateState will atomically replace the content of the file with state
+func (f fileHealthStore) SetUpdateState(state *UpdateState) error {
+	path := string(f)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".new"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// healthStore returns the configured HealthStore, by default a file named after the executable in the user
+// configuration directory. It returns nil if there is no place to persist the state.
+func healthStore(conf *Config) HealthStore {
+	if conf.HealthStore != nil {
+		return conf.HealthStore
+	}
+	path, err := stateFile(".health")
+	if err != nil {
+		logDebug("No place to record the state of updates: %v\n", err)
+		return nil
+	}
+	return NewFileHealthStore(path)
+}
+
+// recordPendingUpdate remember that version replaced previous, whose executable was at exe, until it is marked
+// healthy. It does nothing unless conf.HealthWindow is set.
+func recordPendingUpdate(conf *Config, previous string, exe string, version string, target string) {
+	if conf.HealthWindow <= 0 {
+		return
+	}
+	store := healthStore(conf)
+	if store == nil {
+		return
+	}
+	state := &UpdateState{Version: version, Previous: previous, Backup: previousExecutable(conf, previous, exe, target)}
+	if err := store.SetUpdateState(state); err != nil {
+		logError("Unable to record the update to %s: %v\n", version, err)
+	}
+}
+
+// previousExecutable returns where the executable of version, which was at exe before target was installed, can be
+// restored from: the copy kept by Config.KeepVersions if any, the backup left by Apply next to target otherwise
+func previousExecutable(conf *Config, version string, exe string, target string) string {
+	if conf.KeepVersions > 0 && validVersionDir(version) && exe != "" {
+		if dir, err := retentionDir(conf); err == nil {
+			kept := filepath.Join(dir, version, filepath.Base(exe))
+			if _, err = os.Stat(kept); err == nil {
+				return kept
+			}
+		}
+	}
+	return backupPath(target)
+}
+
+// failedUpdate report if version is an update that was rolled back because it didn't become healthy
+func failedUpdate(conf *Config, version string) bool {
+	if conf.HealthWindow <= 0 {
+		return false
+	}
+	store := healthStore(conf)
+	if store == nil {
+		return false
+	}
+	state, err := store.UpdateState()
+	return err == nil && state != nil && state.RolledBack && state.Version == version
+}
+
+// guardUpdate is called when the application starts. If it runs an update that already started without being
+// marked healthy, the previous version is restored right away, otherwise it has conf.HealthWindow to call MarkHealthy.
+func (u *Updater) guardUpdate() {
+	conf := u.config()
+	if conf.HealthWindow <= 0 {
+		return
+	}
+	store := healthStore(conf)
+	if store == nil {
+		return
+	}
+	state, err := store.UpdateState()
+	if err != nil {
+		logError("Unable to read the state of the last update: %v\n", err)
+		return
+	}
+	if state == nil || state.Healthy || state.RolledBack {
+		return
+	}
+	if conf.Current != nil && conf.Current.Number != state.Version {
+		// something else than the update is running, like a version installed by hand
+		return
+	}
+
+	if !state.Started.IsZero() {
+		logInfo("Version %s didn't become healthy after starting on %v.\n", state.Version, state.Started)
+		u.rollbackUnhealthy(store, state)
+		return
+	}
+	state.Started = time.Now()
+	if err = store.SetUpdateState(state); err != nil {
+		logError("Unable to record the start of version %s: %v\n", state.Version, err)
+		return
+	}
+
+	u.healthLock.Lock()
+	u.healthTimer = time.AfterFunc(conf.HealthWindow, func() {
+		logInfo("Version %s didn't become healthy within %v.\n", state.Version, conf.HealthWindow)
+		u.rollbackUnhealthy(store, state)
+	})
+	u.healthLock.Unlock()
+}
+
+// rollbackUnhealthy restore the version replaced by the update described by state, then restart
+func (u *Updater) rollbackUnhealthy(store HealthStore, state *UpdateState) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if current, err := store.UpdateState(); err == nil && current != nil && current.Healthy {
+		// MarkHealthy was called while waiting for the lock
+		return
+	}
+	conf := u.config()
+	exe := u.executable
+	if exe == "" {
+		var err error
+		if exe, err = ExecutableRealPath(); err != nil {
+			logError("Unable to roll back version %s: %v\n", state.Version, err)
+			return
+		}
+	}
+
+	f, err := os.Open(state.Backup)
+	if err != nil {
+		logError("Unable to roll back version %s: %v\n", state.Version, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		logError("Unable to roll back version %s: %v\n", state.Version, err)
+		return
+	}
+
+	logInfo("Rolling back to version %s.\n", state.Previous)
+	// the backup can't be replaced while it is read, keep the failed version aside instead
+	failed := filepath.Join(filepath.Dir(exe), fmt.Sprintf(".%s.failed", filepath.Base(exe)))
+	err = Apply(f, Options{TargetPath: exe, TargetMode: fi.Mode().Perm(), OldSavePath: failed})
+	if err != nil {
+		logError("Unable to roll back version %s: %v\n", state.Version, err)
+		return
+	}
+	f.Close()
+	u.executable = exe
+
+	state.RolledBack = true
+	if err = store.SetUpdateState(state); err != nil {
+		logError("Unable to record the rollback of version %s: %v\n", state.Version, err)
+	}
+	recordVersion(versionStore(conf), conf.VersionComparator, state.Previous, true)
+
+	if err = restart(conf, exe); err != nil {
+		logError("Unable to restart version %s: %v\n", state.Previous, err)
+	}
+}
+
+// MarkHealthy will confirm that the version running after an update works, so it is not rolled back when
+// Config.HealthWindow is set. It should be called once the application is known to work, for example after its
+// initialization succeeded.
+func (u *Updater) MarkHealthy() error {
+	u.healthLock.Lock()
+	if u.healthTimer != nil {
+		u.healthTimer.Stop()
+		u.healthTimer = nil
+	}
+	u.healthLock.Unlock()
+
+	conf := u.config()
+	if conf.HealthWindow <= 0 {
+		return nil
+	}
+	store := healthStore(conf)
+	if store == nil {
+		return nil
+	}
+	state, err := store.UpdateState()
+	if err != nil || state == nil || state.Healthy || state.RolledBack {
+		return err
+	}
+	if conf.Current != nil && conf.Current.Number != state.Version {
+		return nil
+	}
+	state.Healthy = true
+	return store.SetUpdateState(state)
+}
+
+// WasUpdateSuccessful will report if the last update installed while Config.HealthWindow is set worked. It returns
+// false once it was rolled back because the new version didn't call MarkHealthy in time.
+func (u *Updater) WasUpdateSuccessful() bool {
+	conf := u.config()
+	if conf.HealthWindow <= 0 {
+		return true
+	}
+	store := healthStore(conf)
+	if store == nil {
+		return true
+	}
+	state, err := store.UpdateState()
+	return err != nil || state == nil || !state.RolledBack
+}
@@ -0,0 +1,100 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHealthStore(t *testing.T) {
+	store := NewFileHealthStore(filepath.Join(t.TempDir(), "selfupdate", "myapp.health"))
+	state, err := store.UpdateState()
+	assert.Nil(t, err)
+	assert.Nil(t, state)
+
+	assert.Nil(t, store.SetUpdateState(&UpdateState{Version: "1.1.0", Previous: "1.0.0", Backup: "/opt/.myapp.bak"}))
+	state, err = store.UpdateState()
+	assert.Nil(t, err)
+	assert.Equal(t, &UpdateState{Version: "1.1.0", Previous: "1.0.0", Backup: "/opt/.myapp.bak"}, state)
+}
+
+// unhealthyUpdater returns an Updater running version 1.1.0 at exe, installed over version 1.0.0 kept as a backup
+func unhealthyUpdater(t *testing.T, window time.Duration, started time.Time) (*Updater, HealthStore, string, chan error) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "myapp")
+	backup := filepath.Join(dir, ".myapp.bak")
+	assert.Nil(t, os.WriteFile(exe, newFile, 0755))
+	assert.Nil(t, os.WriteFile(backup, oldFile, 0755))
+
+	store := NewFileHealthStore(filepath.Join(dir, "myapp.health"))
+	assert.Nil(t, store.SetUpdateState(&UpdateState{Version: "1.1.0", Previous: "1.0.0", Backup: backup, Started: started}))
+
+	exited := make(chan error, 1)
+	u := &Updater{conf: &Config{
+		Current:      &Version{Number: "1.1.0"},
+		HealthWindow: window,
+		HealthStore:  store,
+		VersionStore: &memoryVersionStore{version: "1.1.0"},
+		ExitCallback: func(err error) { exited <- err },
+	}, executable: exe}
+	return u, store, exe, exited
+}
+
+func TestGuardUpdateCrashed(t *testing.T) {
+	u, store, exe, exited := unhealthyUpdater(t, time.Hour, time.Now().Add(-time.Minute))
+	assert.True(t, u.WasUpdateSuccessful())
+
+	u.guardUpdate()
+	<-exited
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+
+	state, err := store.UpdateState()
+	assert.Nil(t, err)
+	assert.True(t, state.RolledBack)
+	assert.False(t, u.WasUpdateSuccessful())
+	assert.True(t, failedUpdate(u.conf, "1.1.0"))
+	assert.Equal(t, "1.0.0", u.conf.VersionStore.(*memoryVersionStore).version)
+}
+
+func TestGuardUpdateWindow(t *testing.T) {
+	u, _, exe, exited := unhealthyUpdater(t, 10*time.Millisecond, time.Time{})
+	u.guardUpdate()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the update wasn't rolled back")
+	}
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+}
+
+func TestMarkHealthy(t *testing.T) {
+	u, store, exe, exited := unhealthyUpdater(t, 50*time.Millisecond, time.Time{})
+	u.guardUpdate()
+	assert.Nil(t, u.MarkHealthy())
+
+	select {
+	case <-exited:
+		t.Fatal("a healthy update was rolled back")
+	case <-time.After(100 * time.Millisecond):
+	}
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, b)
+
+	state, err := store.UpdateState()
+	assert.Nil(t, err)
+	assert.True(t, state.Healthy)
+	assert.False(t, state.Started.IsZero())
+	assert.True(t, u.WasUpdateSuccessful())
+
+	// a healthy update is not guarded on the next start
+	u.guardUpdate()
+	assert.Nil(t, u.healthTimer)
+}
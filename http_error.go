@@ -0,0 +1,77 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrNotFound match the HTTPError of a 404 Not Found or 410 Gone response
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized match the HTTPError of a 401 Unauthorized or 403 Forbidden response
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrServerError match the HTTPError of a 5xx response
+	ErrServerError = errors.New("server error")
+)
+
+// HTTPError is returned by HTTPSource when the server answer with an unexpected status, instead of taking an
+// error page for the requested document. It match ErrNotFound, ErrUnauthorized or ErrServerError with errors.Is
+// depending on the status, and ErrNotPublished for a 404 as announced releases can still be propagating.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string // Beginning of the response body, to tell apart the error pages of a proxy, a CDN or the server
+}
+
+// maxErrorBody is how much of the body of an error response is kept in a HTTPError
+const maxErrorBody = 256
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("error downloading %s: %s", e.URL, e.Status)
+	}
+	return fmt.Sprintf("error downloading %s: %s: %s", e.URL, e.Status, e.Body)
+}
+
+// Is report if the status of the response is the kind of error target is
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case ErrNotPublished:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrServerError:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	}
+	return false
+}
+
+// checkStatus returns nil if the status of response is one of expected, otherwise the body of response is
+// closed and a HTTPError is returned
+func checkStatus(url string, response *http.Response, expected ...int) error {
+	for _, status := range expected {
+		if response.StatusCode == status {
+			return nil
+		}
+	}
+	defer response.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	body := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(string(b), ""))
+	return &HTTPError{URL: url, StatusCode: response.StatusCode, Status: response.Status, Body: strings.Join(strings.Fields(body), " ")}
+}
@@ -0,0 +1,67 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceStatusErrors(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/manifest" && status == http.StatusOK {
+			fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":"http://%s/app"}]`, runtime.GOOS, r.Host)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<html>\n  <body>%s\x00</body>\n</html>%s", http.StatusText(status), strings.Repeat("x", 1000))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL+"/manifest").(*HTTPSource)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		status int
+		is     error
+		isNot  error
+	}{
+		{http.StatusNotFound, ErrNotFound, ErrServerError},
+		{http.StatusGone, ErrNotFound, ErrNotPublished},
+		{http.StatusForbidden, ErrUnauthorized, ErrNotFound},
+		{http.StatusUnauthorized, ErrUnauthorized, ErrServerError},
+		{http.StatusBadGateway, ErrServerError, ErrNotPublished},
+	} {
+		status = c.status
+		_, _, err = source.Get(v)
+		assert.ErrorIs(t, err, c.is)
+		assert.False(t, errors.Is(err, c.isNot))
+
+		var httpErr *HTTPError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, c.status, httpErr.StatusCode)
+		assert.True(t, strings.HasPrefix(httpErr.Body, "<html> <body>"+http.StatusText(c.status)+"</body> </html>xxx"), httpErr.Body)
+		assert.True(t, len(httpErr.Body) <= maxErrorBody)
+
+		_, err = source.GetSignature()
+		assert.ErrorIs(t, err, c.is)
+		_, _, err = source.GetRange(v, 2)
+		assert.ErrorIs(t, err, c.is)
+		_, _, err = source.GetHash()
+		assert.ErrorIs(t, err, c.is)
+		_, err = source.LatestVersion()
+		assert.ErrorIs(t, err, c.is)
+	}
+
+	// a release announced but not uploaded yet can still be waited for
+	status = http.StatusNotFound
+	_, _, err = source.Get(v)
+	assert.ErrorIs(t, err, ErrNotPublished)
+}
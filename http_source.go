@@ -1,40 +1,97 @@
 package selfupdate
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto"
+	"encoding/base64"
 	"fmt"
-	"github.com/Masterminds/semver"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/manifest"
 )
 
 // HTTPSource provide a Source that will download the update from a HTTP url.
-// It is expecting the signature file to be served at ${URL}.ed25519
+// It is expecting the signature file to be served at ${URL}.ed25519, and optionally
+// an OpenPGP signature at ${URL}.asc and a digest at ${URL}.sha256 or ${URL}.sha512.
+// It is safe for concurrent use, the URL it was created with is never modified and the URLs of the executable
+// and of its signatures are derived from the Version given, never from a previous download.
 type HTTPSource struct {
-	client  *http.Client
-	baseURL string
+	client           *http.Client
+	baseURL          string
+	manifestVerifier Verifier // if present, the manifest must be signed, see NewSignedHTTPSource
+
+	lock          sync.Mutex
+	latestURL     string            // download_url of the latest version of the last manifest, for the getters not given a Version
+	yanked        *yankList         // versions yanked by the last manifest
+	versions      []appVersion      // entries of the last manifest, to plan upgrade paths and download intermediate versions
+	comparator    VersionComparator // how the entries of the last manifest were ordered, to plan upgrade paths
+	partialDir    string            // where downloads are persisted to be resumed, see ResumeDownloads
+	chunks        int               // number of concurrent ranged requests a download is split in, see ParallelDownloads
+	chunksMinSize int64             // size under which downloads aren't split
+	manifest      []byte            // last manifest received, once verified, reused when the server report it didn't change
+	etag          string            // ETag of the last manifest, sent as If-None-Match
+	lastModified  string            // Last-Modified of the last manifest, sent as If-Modified-Since
+	selector      selector          // which entries of the manifest can be selected as the latest version
 }
 
-var _ Source = (*HTTPSource)(nil)
+var _ RangeSource = (*HTTPSource)(nil)
+var _ HashSource = (*HTTPSource)(nil)
+var _ GPGSource = (*HTTPSource)(nil)
+var _ MinisignSource = (*HTTPSource)(nil)
+var _ CosignSource = (*HTTPSource)(nil)
+var _ AttestationSource = (*HTTPSource)(nil)
+var _ KeyManifestSource = (*HTTPSource)(nil)
+var _ KeyBundleSource = (*HTTPSource)(nil)
+var _ YankSource = (*HTTPSource)(nil)
+var _ UpgradePathSource = (*HTTPSource)(nil)
+var _ SupportSource = (*HTTPSource)(nil)
+var _ ContextSource = (*HTTPSource)(nil)
 
 type platform struct {
 	OS         string
 	Arch       string
+	ARMVersion string
+	AMD64Level string
+	Libc       string
 	Ext        string
 	Executable string
+	Version    string
 }
 
-type appVersion struct {
-	Name        string `json:"name"`
-	OS          string `json:"os"`
-	DownloadURL string `json:"download_url"`
-	Version     string `json:"version"`
+// appVersion is an entry of the manifest
+type appVersion = manifest.Entry
+
+// entryVersion returns the Version described by the manifest entry a
+func entryVersion(a *appVersion) (*Version, error) {
+	h, digest, err := decodeDigest(a.SHA256, a.SHA512)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest for version %s: %w", a.Version, err)
+	}
+	var signature []byte
+	if a.Signature != "" {
+		if signature, err = base64.StdEncoding.DecodeString(a.Signature); err != nil {
+			return nil, fmt.Errorf("invalid signature for version %s: %w", a.Version, err)
+		}
+	}
+	v := &Version{Number: a.Version, DigestHash: h, Digest: digest, Size: a.Size, Signature: signature, Executable: a.Executable, Consent: a.Consent, Codec: a.Codec, Archive: a.Archive, Member: a.Member, Files: a.Files, Channel: entryChannel(a), ReleaseNotes: a.ReleaseNotes, ReleaseNotesURL: a.ReleaseNotesURL, MinimumVersion: a.MinimumVersion, Mandatory: a.Mandatory, Rollout: a.Rollout, Date: a.Published, Criticality: a.Criticality}
+	if a.InstallPath != "" {
+		v.InstallPath = expandURLTemplate(a.InstallPath, v)
+		if err = checkInstallPath(v.InstallPath); err != nil {
+			return nil, fmt.Errorf("version %s: %w", a.Version, err)
+		}
+	}
+	if a.DownloadURL != "" {
+		v.URL = expandURLTemplate(a.DownloadURL, v)
+	}
+	return v, nil
 }
 
 // for update and signature using the http.Client provided. To help into providing
@@ -42,118 +99,432 @@ type appVersion struct {
 // following parameter are recognized:
 // {{.OS}} will be filled by the runtime OS name
 // {{.Arch}} will be filled by the runtime Arch name
+// {{.ARMVersion}} will be filled by the GOARM of the running executable on arm, like 6 or 7
+// {{.AMD64Level}} will be filled by the GOAMD64 of the running executable on amd64, like v1 or v3
+// {{.Libc}} will be filled on Linux by the C library expected by the running executable, musl or glibc
 // {{.Ext}} will be filled by the executable expected extension for the OS
+// {{.Executable}} will be filled by the name of the running executable without extension
+// {{.Version}} will be filled by the version being downloaded, if known
 // As an example the following string `http://localhost/myapp-{{.OS}}-{{.Arch}}{{.Ext}}`
 // would fetch on Windows AMD64 the following URL: `http://localhost/myapp-windows-amd64.exe`
 // and on Linux AMD64: `http://localhost/myapp-linux-amd64`.
 func NewHTTPSource(client *http.Client, base string) Source {
-	if client == nil {
-		client = http.DefaultClient
-	}
-
-	return &HTTPSource{client: client, baseURL: base}
+	return &HTTPSource{client: secureClient(client), baseURL: base}
 }
 
 // Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
 func (h *HTTPSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	return h.GetContext(context.Background(), v)
+}
+
+// GetContext is Get, the download is interrupted once ctx is done
+func (h *HTTPSource) GetContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) {
 	var request *http.Request
 	var err error
 	var response *http.Response
 
-	request, err = http.NewRequest("GET", h.baseURL, nil)
+	url := h.resolve(v)
+	h.lock.Lock()
+	partialDir, chunks, chunksMinSize := h.partialDir, h.chunks, h.chunksMinSize
+	h.lock.Unlock()
+	if partialDir != "" {
+		return h.getResumable(ctx, partialDir, url)
+	}
+	if chunks > 1 {
+		return h.getParallel(ctx, chunks, chunksMinSize, url)
+	}
+
+	request, err = http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error creating request: %s", err)
 	}
 	response, err = h.client.Do(request)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error downloading %s: %s", h.baseURL, err)
+		return nil, 0, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	if err = checkStatus(url, response, http.StatusOK); err != nil {
+		return nil, 0, err
+	}
+	return withFinalURL(response.Body, response), response.ContentLength, nil
+}
+
+// resolve returns the URL the executable of v is downloaded from, its download_url in the last manifest or the
+// URL the source was created with. If v is nil, it is the URL of the latest version of the last manifest. It
+// doesn't depend on what was downloaded before, so concurrent downloads of the same source don't mix up their URLs.
+func (h *HTTPSource) resolve(v *Version) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if a := h.find(v); a != nil && a.DownloadURL != "" {
+		return expandURLTemplate(a.DownloadURL, v)
 	}
-	return response.Body, response.ContentLength, nil
+	if v == nil && h.latestURL != "" {
+		return expandURLTemplate(h.latestURL, nil)
+	}
+	return expandURLTemplate(h.baseURL, v)
+}
+
+// GetRange will return if it succeed an io.ReaderCloser to the new executable starting at offset and the remaining length
+func (h *HTTPSource) GetRange(v *Version, offset int64) (io.ReadCloser, int64, error) {
+	return h.GetRangeContext(context.Background(), v, offset)
 }
 
-func compare(curVersion, newVersion string) (bool, error) {
-	curVersion = strings.TrimSpace(curVersion)
-	newVersion = strings.TrimSpace(newVersion)
-	curSemVer, err := semver.NewVersion(curVersion)
+// GetRangeContext is GetRange, the download is interrupted once ctx is done
+func (h *HTTPSource) GetRangeContext(ctx context.Context, v *Version, offset int64) (io.ReadCloser, int64, error) {
+	url := h.resolve(v)
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return false, fmt.Errorf("Error parsing current version %s: %s", curVersion, err)
+		return nil, 0, fmt.Errorf("error creating request: %s", err)
 	}
-	newSemVer, err := semver.NewVersion(newVersion)
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := h.client.Do(request)
 	if err != nil {
-		return false, fmt.Errorf("Error parsing new version %s: %s", newVersion, err)
+		return nil, 0, fmt.Errorf("error downloading %s: %w", url, err)
 	}
-	return curSemVer.LessThan(newSemVer), nil
+	if err = checkStatus(url, response, http.StatusOK, http.StatusPartialContent); err != nil {
+		return nil, 0, err
+	}
+
+	if offset > 0 && response.StatusCode != http.StatusPartialContent {
+		// the server ignored the range request, skip what we already have
+		_, err = io.CopyN(io.Discard, response.Body, offset)
+		if err != nil {
+			response.Body.Close()
+			return nil, 0, fmt.Errorf("error skipping to offset %d: %s", offset, err)
+		}
+		if response.ContentLength > 0 {
+			response.ContentLength -= offset
+		}
+	}
+	return withFinalURL(response.Body, response), response.ContentLength, nil
+}
+
+// GetSignature will return the content of ${URL}.ed25519 for the latest version of the last manifest, or for the
+// URL the source was created with. GetSignatureContext returns the signature of a given version.
+func (h *HTTPSource) GetSignature() ([]byte, error) {
+	return h.GetSignatureContext(context.Background(), nil)
+}
+
+// GetSignatureContext will return the content of ${URL}.ed25519 for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".ed25519")
+}
+
+// GetGPGSignature will return the content of ${URL}.asc
+func (h *HTTPSource) GetGPGSignature() ([]byte, error) {
+	return h.GetGPGSignatureContext(context.Background(), nil)
+}
+
+// GetGPGSignatureContext will return the content of ${URL}.asc for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetGPGSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".asc")
+}
+
+// GetMinisignSignature will return the content of ${URL}.minisig
+func (h *HTTPSource) GetMinisignSignature() ([]byte, error) {
+	return h.GetMinisignSignatureContext(context.Background(), nil)
+}
+
+// GetMinisignSignatureContext will return the content of ${URL}.minisig for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetMinisignSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".minisig")
+}
+
+// GetCosignBundle will return the content of ${URL}.bundle
+func (h *HTTPSource) GetCosignBundle() ([]byte, error) {
+	return h.GetCosignBundleContext(context.Background(), nil)
+}
+
+// GetCosignBundleContext will return the content of ${URL}.bundle for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetCosignBundleContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".bundle")
+}
+
+// GetAttestation will return the content of ${URL}.intoto.jsonl
+func (h *HTTPSource) GetAttestation() ([]byte, error) {
+	return h.GetAttestationContext(context.Background(), nil)
+}
+
+// GetAttestationContext will return the content of ${URL}.intoto.jsonl for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetAttestationContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".intoto.jsonl")
+}
+
+// GetKeyManifest will return the content of ${URL}.keys for the latest version of the last manifest, or for the
+// URL the source was created with
+func (h *HTTPSource) GetKeyManifest() ([]byte, error) {
+	return h.GetKeyManifestContext(context.Background(), nil)
+}
+
+// GetKeyManifestContext will return the content of ${URL}.keys for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetKeyManifestContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".keys")
+}
+
+// GetKeyBundle will return the content of ${URL}.roots for the latest version of the last manifest, or for the
+// URL the source was created with
+func (h *HTTPSource) GetKeyBundle() ([]byte, error) {
+	return h.GetKeyBundleContext(context.Background(), nil)
+}
+
+// GetKeyBundleContext will return the content of ${URL}.roots for the executable of v, the request is
+// interrupted once ctx is done
+func (h *HTTPSource) GetKeyBundleContext(ctx context.Context, v *Version) ([]byte, error) {
+	return h.getDetachedSignatureContext(ctx, h.resolve(v)+".roots")
+}
+
+func (h *HTTPSource) getDetachedSignature(url string) ([]byte, error) {
+	return h.getDetachedSignatureContext(context.Background(), url)
 }
 
-// GetSignature will return the content of  ${URL}.ed25519
-func (h *HTTPSource) GetSignature() ([64]byte, error) {
-	resp, err := h.client.Get(h.baseURL + ".ed25519")
+func (h *HTTPSource) getDetachedSignatureContext(ctx context.Context, url string) ([]byte, error) {
+	return h.getLimited(ctx, url, 64*1024)
+}
+
+// getLimited returns the first limit bytes of the document at url
+func (h *HTTPSource) getLimited(ctx context.Context, url string, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+	resp, err := h.client.Do(request)
 	if err != nil {
-		return [64]byte{}, err
+		return nil, err
+	}
+	if err = checkStatus(url, resp, http.StatusOK); err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// GetHash will return the digest stored in ${URL}.sha256 or, if missing, ${URL}.sha512
+func (h *HTTPSource) GetHash() (crypto.Hash, []byte, error) {
+	return h.GetHashContext(context.Background(), nil)
+}
+
+// GetHashContext is GetHash for the executable of v, the requests are interrupted once ctx is done
+func (h *HTTPSource) GetHashContext(ctx context.Context, v *Version) (crypto.Hash, []byte, error) {
+	base := h.resolve(v)
 
-	if resp.ContentLength != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", resp.ContentLength)
+	var lastErr error
+	for _, c := range []struct {
+		ext  string
+		hash crypto.Hash
+	}{{".sha256", crypto.SHA256}, {".sha512", crypto.SHA512}} {
+		digest, err := h.getChecksum(ctx, base+c.ext, c.hash.Size())
+		if err == nil {
+			return c.hash, digest, nil
+		}
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		lastErr = err
 	}
+	return 0, nil, lastErr
+}
 
-	writer := bytes.NewBuffer(make([]byte, 0, 64))
-	n, err := io.Copy(writer, resp.Body)
+func (h *HTTPSource) getChecksum(ctx context.Context, url string, size int) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return [64]byte{}, err
+		return nil, fmt.Errorf("error creating request: %s", err)
 	}
-
-	if n != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", n)
+	resp, err := h.client.Do(request)
+	if err != nil {
+		return nil, err
 	}
+	if err = checkStatus(url, resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	r := [64]byte{}
-	copy(r[:], writer.Bytes())
-
-	return r, nil
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, err
+	}
+	return parseChecksum(body, size)
 }
 
 // LatestVersion will return the URL Last-Modified time
 func (h *HTTPSource) LatestVersion() (*Version, error) {
-	request, err := http.NewRequest("GET", h.baseURL, nil)
+	return h.LatestVersionContext(context.Background())
+}
+
+// LatestVersionContext is LatestVersion, the request is interrupted once ctx is done
+func (h *HTTPSource) LatestVersionContext(ctx context.Context) (*Version, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", h.baseURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %s", err)
 	}
+	h.lock.Lock()
+	cached, etag, lastModified := h.manifest, h.etag, h.lastModified
+	h.lock.Unlock()
+	if cached != nil {
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			request.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
 
 	response, err := h.client.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("error send request %s: %s", h.baseURL, err)
+		return nil, fmt.Errorf("error send request %s: %w", h.baseURL, err)
 	}
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %s", err)
+	expected := []int{http.StatusOK}
+	if cached != nil {
+		expected = append(expected, http.StatusNotModified)
+	}
+	if err = checkStatus(h.baseURL, response, expected...); err != nil {
+		return nil, err
 	}
 	defer response.Body.Close()
-	var appVersions []appVersion
-	err = json.Unmarshal(body, &appVersions)
+
+	var body []byte
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		// embargoes are still evaluated again, with the time of this response
+		logDebug("Manifest %s not modified.\n", h.baseURL)
+		body = cached
+	} else {
+		if body, err = io.ReadAll(response.Body); err != nil {
+			return nil, fmt.Errorf("error reading response body: %s", err)
+		}
+		if h.manifestVerifier != nil {
+			if body, err = h.verifyManifest(body); err != nil {
+				return nil, err
+			}
+		}
+		h.lock.Lock()
+		h.manifest, h.etag, h.lastModified = nil, response.Header.Get("ETag"), response.Header.Get("Last-Modified")
+		if h.etag != "" || h.lastModified != "" {
+			h.manifest = body
+		}
+		h.lock.Unlock()
+	}
+	appVersions, err := manifest.Parse(body)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling response body: %s", err)
 	}
+	appVersions = withoutEmbargoed(appVersions, authenticatedTime(response))
+
+	sel := h.selectorFor(ctx)
+	appVersions = forApp(appVersions, sel.app)
+	a, yanked, err := latestAppVersion(appVersions, &sel)
+	if err == nil {
+		err = securePolicy(h.client).CheckURL(a.DownloadURL)
+	}
+	h.lock.Lock()
+	h.yanked = yanked
+	h.versions = appVersions
+	h.comparator = sel.comparator
+	if err == nil {
+		h.latestURL = a.DownloadURL
+	}
+	h.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	v, err := entryVersion(a)
+	if err == nil && v.URL == "" {
+		v.URL = expandURLTemplate(h.baseURL, v)
+	}
+	return v, err
+}
+
+// UpgradePath will return the versions to install in order to go from current to target, as required by the
+// "requires" field of the entries of the last manifest fetched by LatestVersion
+func (h *HTTPSource) UpgradePath(current string, target *Version) ([]*Version, error) {
+	h.lock.Lock()
+	a := h.find(target)
+	if a == nil {
+		h.lock.Unlock()
+		return []*Version{target}, nil
+	}
+	path, err := planUpgradePath(h.comparator, h.versions, current, a)
+	h.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, a := range appVersions {
-		if a.OS == runtime.GOOS {
-			h.baseURL = a.DownloadURL
-			return &Version{Number: a.Version}, nil
+	hops := make([]*Version, 0, len(path))
+	for _, a := range path[:len(path)-1] {
+		hop, err := entryVersion(a)
+		if err != nil {
+			return nil, err
 		}
+		hops = append(hops, hop)
 	}
-	return nil, fmt.Errorf("no version found")
+	return append(hops, target), nil
+}
+
+// find returns the entry of the last manifest for v on the running platform, h.lock must be held
+func (h *HTTPSource) find(v *Version) *appVersion {
+	if v == nil {
+		return nil
+	}
+	var found *appVersion
+	for i := range h.versions {
+		a := &h.versions[i]
+		if forPlatform(a) && strings.TrimSpace(a.Version) == strings.TrimSpace(v.Number) && (found == nil || betterBuild(a, found)) {
+			found = a
+		}
+	}
+	return found
+}
+
+// EndOfSupport will return the end_of_support time of version in the last manifest fetched by LatestVersion
+func (h *HTTPSource) EndOfSupport(version string) time.Time {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if a := h.find(&Version{Number: version}); a != nil {
+		return a.EndOfSupport
+	}
+	return time.Time{}
+}
+
+// yanksSigned report if the manifest is verified before the versions it yanks are trusted, see NewSignedHTTPSource
+func (h *HTTPSource) yanksSigned() bool {
+	return h.manifestVerifier != nil
+}
+
+// IsYanked will return true if version is marked as yanked in the last manifest fetched by LatestVersion
+func (h *HTTPSource) IsYanked(version string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.yanked.contains(version)
 }
 
 func replaceURLTemplate(base string) string {
+	return expandURLTemplate(base, nil)
+}
+
+func expandURLTemplate(base string, v *Version) string {
 	ext := ""
 	if runtime.GOOS == "windows" {
 		ext = ".exe"
 	}
 
 	p := platform{
-		OS:   runtime.GOOS,
-		Arch: runtime.GOARCH,
-		Ext:  ext,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		ARMVersion: runningVariant.ARMVersion,
+		AMD64Level: runningVariant.AMD64Level,
+		Libc:       runningLibc(),
+		Ext:        ext,
+	}
+	if v != nil {
+		p.Version = v.Number
 	}
 
 	exe, err := ExecutableRealPath()
@@ -1,11 +1,17 @@
 package selfupdate
 
 import (
+	"context"
 	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,20 +20,81 @@ import (
 
 func TestHTTPSourceLatestVersion(t *testing.T) {
 	client := http.Client{Timeout: time.Duration(60) * time.Second}
-	httpSource := NewHTTPSource(&client, "http://geoffrey-test-artefacts.fynelabs.com/self-update/Nomad.exe")
+	insecure := &SecurityPolicy{AllowInsecure: true}
+	httpSource := NewHTTPSource(insecure.Client(&client), "http://geoffrey-test-artefacts.fynelabs.com/self-update/Nomad.exe")
 
 	version, err := httpSource.LatestVersion()
 	assert.Nil(t, err)
 	assert.NotNil(t, version)
 }
 
+func TestHTTPSourceLatestVersionNotModified(t *testing.T) {
+	version := "1.1.0"
+	var full, conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `[{"os":%q,"version":%q,"download_url":"http://localhost/app"}]`, runtime.GOOS, version)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL)
+	for i := 0; i < 3; i++ {
+		v, err := source.LatestVersion()
+		assert.Nil(t, err)
+		assert.Equal(t, "1.1.0", v.Number)
+	}
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 2, conditional)
+
+	version = "1.2.0"
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+	assert.Equal(t, 2, full)
+}
+
+func TestHTTPSourceVersionMetadata(t *testing.T) {
+	manifest := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, manifest)
+	}))
+	defer server.Close()
+
+	manifest = fmt.Sprintf(`[{"os":%q,"version":"1.2.0","size":1234,"sha256":"%064x","channel":"beta",`+
+		`"published":"2024-06-01T16:00:00Z","criticality":"security","download_url":"http://localhost/app-{{.Version}}"}]`, runtime.GOOS, 1)
+	source := NewHTTPSource(nil, server.URL+"/{{.OS}}")
+	source.(*HTTPSource).SetChannel("beta")
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), v.Size)
+	assert.Equal(t, 32, len(v.Digest))
+	assert.Equal(t, "beta", v.Channel)
+	assert.Equal(t, time.Date(2024, 6, 1, 16, 0, 0, 0, time.UTC), v.Date)
+	assert.Equal(t, "security", v.Criticality)
+	assert.Equal(t, "http://localhost/app-1.2.0", v.URL)
+
+	manifest = fmt.Sprintf(`[{"os":%q,"version":"1.3.0"}]`, runtime.GOOS)
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/"+runtime.GOOS, v.URL)
+	assert.True(t, v.Date.IsZero())
+}
+
 func TestHTTPSourceCheckSignature(t *testing.T) {
 	client := http.Client{Timeout: time.Duration(60) * time.Second}
 
 	publicKey := ed25519.PublicKey{231, 120, 42, 245, 227, 182, 133, 19, 197, 251, 215, 216, 34, 35, 16, 183, 184, 174, 55, 30, 107, 18, 43, 136, 111, 68, 168, 138, 176, 212, 156, 124}
 	wrongPublicKey := ed25519.PublicKey{42, 103, 83, 57, 61, 138, 18, 249, 244, 80, 163, 162, 24, 251, 190, 241, 11, 168, 179, 41, 245, 27, 166, 70, 220, 254, 118, 169, 101, 26, 199, 129}
 
-	httpSource := NewHTTPSource(&client, "http://geoffrey-test-artefacts.fynelabs.com/self-update/Nomad.exe")
+	insecure := &SecurityPolicy{AllowInsecure: true}
+	httpSource := NewHTTPSource(insecure.Client(&client), "http://geoffrey-test-artefacts.fynelabs.com/self-update/Nomad.exe")
 	signature, err := httpSource.GetSignature()
 	assert.Nil(t, err)
 
@@ -49,6 +116,138 @@ func TestHTTPSourceCheckSignature(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestHTTPSourceChunked(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	signature := ed25519.Sign(priv, newFile)
+
+	// flushing before the end make the responses chunked, without Content-Length
+	chunked := func(w http.ResponseWriter, content []byte) {
+		w.Write(content[:2])
+		w.(http.Flusher).Flush()
+		w.Write(content[2:])
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":"%s/app","size":%d}]`, runtime.GOOS, server.URL, len(newFile))
+		case "/app":
+			chunked(w, newFile)
+		case "/app.ed25519":
+			chunked(w, signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL+"/manifest")
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	r, length, err := source.Get(v)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), length)
+	r.Close()
+	s, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, signature, s)
+
+	// the length announced by the manifest is used to report progress
+	var progress []float64
+	conf := &Config{Source: source, PublicKey: pub, ProgressCallback: func(p float64, err error) {
+		progress = append(progress, p)
+	}}
+	target := filepath.Join(t.TempDir(), "app")
+	writeOldFile(target, t)
+	u := &Updater{conf: conf}
+	validateUpdate(target, u.install(context.Background(), conf, "", v, target), t)
+	for _, p := range progress {
+		assert.True(t, p >= 0 && p <= 1, "progress %v", p)
+	}
+	assert.Equal(t, float64(1), progress[len(progress)-1])
+}
+
+func TestHTTPSourceConcurrent(t *testing.T) {
+	content := []byte("executable content")
+	digest := sha256.Sum256(content)
+	server := mirrorServer(t, content, digest)
+
+	source := NewHTTPSource(nil, server.URL+"/manifest").(*HTTPSource)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				// the manifest must still be used after a version was announced
+				v, err := source.LatestVersion()
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, "1.1.0", v.Number)
+
+				r, _, err := source.Get(v)
+				if !assert.Nil(t, err) {
+					return
+				}
+				body, err := io.ReadAll(r)
+				r.Close()
+				assert.Nil(t, err)
+				assert.Equal(t, content, body)
+
+				_, d, err := source.GetHash()
+				assert.Nil(t, err)
+				assert.Equal(t, digest[:], d)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, server.URL+"/manifest", source.baseURL)
+}
+
+func TestHTTPSourceInterleavedVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app-1.1.0", "/app-1.2.0":
+			w.Write([]byte(r.URL.Path))
+		case "/app-1.1.0.ed25519", "/app-1.2.0.ed25519", "/app-1.1.0.asc", "/app-1.2.0.asc":
+			w.Write([]byte(r.URL.Path))
+		case "/app-1.1.0.sha256", "/app-1.2.0.sha256":
+			fmt.Fprintf(w, "%x\n", sha256.Sum256([]byte(r.URL.Path)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL+"/app-{{.Version}}").(*HTTPSource)
+	older, newer := &Version{Number: "1.1.0"}, &Version{Number: "1.2.0"}
+	for _, v := range []*Version{older, newer} {
+		r, _, err := source.Get(v)
+		assert.Nil(t, err)
+		r.Close()
+	}
+
+	// the download of newer must not change what is fetched for older
+	ctx := context.Background()
+	signature, err := source.GetSignatureContext(ctx, older)
+	assert.Nil(t, err)
+	assert.Equal(t, "/app-1.1.0.ed25519", string(signature))
+	signature, err = source.GetGPGSignatureContext(ctx, older)
+	assert.Nil(t, err)
+	assert.Equal(t, "/app-1.1.0.asc", string(signature))
+	_, digest, err := source.GetHashContext(ctx, older)
+	assert.Nil(t, err)
+	expected := sha256.Sum256([]byte("/app-1.1.0.sha256"))
+	assert.Equal(t, expected[:], digest)
+
+	signature, err = source.GetSignatureContext(ctx, newer)
+	assert.Nil(t, err)
+	assert.Equal(t, "/app-1.2.0.ed25519", string(signature))
+}
+
 func TestReplaceURLTemplate(t *testing.T) {
 	nochange := "http://localhost/nomad-windows-amd64.exe"
 	change := "http://localhost/nomad-{{.OS}}-{{.Arch}}{{.Ext}}"
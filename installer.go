@@ -0,0 +1,272 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// Installer describe, on Windows, an update published as an installer rather than as the executable, for
+// applications installing more than one file. Once verified, it is run silently after the application exits.
+type Installer struct {
+	Format      string   // "msi", "nsis" or "inno", default to "msi" if the download URL ends with .msi, "nsis" otherwise
+	Args        []string // Arguments replacing the silent installation flags of Format, like /qn /norestart for msi
+	KeepStopped bool     // if true, the application isn't started again once the installer succeeded
+}
+
+// installerFormat returns the format of the installer newVer is published as
+func installerFormat(conf *Config, newVer *Version) string {
+	if conf.Installer.Format != "" {
+		return conf.Installer.Format
+	}
+	if r, ok := conf.Source.(urlResolver); ok && strings.EqualFold(path.Ext(r.resolve(newVer)), ".msi") {
+		return "msi"
+	}
+	return "nsis"
+}
+
+// command returns the program and the arguments running the installer at staged silently
+func (i *Installer) command(format string, staged string) (string, []string, error) {
+	var program string
+	var args, silent []string
+	switch format {
+	case "msi":
+		program, args, silent = "msiexec.exe", []string{"/i", staged}, []string{"/qn", "/norestart"}
+	case "nsis":
+		program, silent = staged, []string{"/S"}
+	case "inno":
+		program, silent = staged, []string{"/VERYSILENT", "/SUPPRESSMSGBOXES", "/NORESTART"}
+	default:
+		return "", nil, fmt.Errorf("unsupported installer format %q", format)
+	}
+	if len(i.Args) > 0 {
+		silent = i.Args
+	}
+	return program, append(args, silent...), nil
+}
+
+// stageInstaller download newVer to a new temporary directory and verify it as any update, returning its path
+// and the SHA-256 of the content written there and verified
+func (u *Updater) stageInstaller(ctx context.Context, conf *Config, newVer *Version) (string, []byte, error) {
+	r, contentLength, opts, err := u.fetch(ctx, conf, newVer)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err = u.pipeline(ctx, conf, newVer, r, contentLength)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	dir, err := os.MkdirTemp("", "selfupdate-installer-")
+	if err != nil {
+		return "", nil, err
+	}
+	ext := ".exe"
+	if installerFormat(conf, newVer) == "msi" {
+		ext = ".msi"
+	}
+	name := strings.TrimSuffix(filepath.Base(u.executable), filepath.Ext(u.executable))
+	if name == "" || name == "." {
+		name = "setup"
+	}
+	staged := filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, newVer.Number, ext))
+
+	// the installer is what gets verified and run, it is not installed as the executable. Apply replaces an
+	// existing file, an empty one stands for it.
+	if err = os.WriteFile(staged, nil, 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	opts.TargetPath = staged
+	opts.TargetMode = 0755
+	opts.OldSavePath = staged + ".old"
+	opts.RenameTo, opts.RelocateTo, opts.LinkPath, opts.Files, opts.BurnIn = "", "", "", nil, nil
+	// the temporary directory can be changed by any process of the user, the digest is taken while writing
+	opts.staged = sha256.New()
+	if err = apply(r, opts); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	discardPreloaded(conf, newVer)
+	return staged, opts.staged.Sum(nil), nil
+}
+
+// elevatedCopy is where an installer run elevated is copied to first, as the user can still change the verified
+// one in its temporary directory: a new directory under the Windows directory, where files created by an
+// administrator can't be changed by users
+type elevatedCopy struct {
+	from string // the verified installer
+	to   string // the copy, run by the elevated script
+	dir  string // the directory created for the copy, which must not exist yet
+	sum  []byte // SHA-256 of the verified installer, the copy must have it to be run
+}
+
+// handOff exit the application so that the installer at staged, verified by stageInstaller with the SHA-256 sum,
+// can replace it. A detached PowerShell script waits for the process to exit, runs the installer silently, with the
+// elevation prompt if conf.Elevate is set, starts the application again unless asked not to, then removes the
+// installer. Once elevated, the installer is run from a copy which is checked against sum.
+func (u *Updater) handOff(conf *Config, newVer *Version, staged string, sum []byte) error {
+	current, err := sha256File(staged)
+	if err == nil && !bytes.Equal(current, sum) {
+		err = errStagedChanged
+	}
+	if err != nil {
+		_ = os.RemoveAll(filepath.Dir(staged))
+		return err
+	}
+
+	run := staged
+	var elevated *elevatedCopy
+	if conf.Elevate {
+		id := make([]byte, 8)
+		if _, err = rand.Read(id); err != nil {
+			_ = os.RemoveAll(filepath.Dir(staged))
+			return err
+		}
+		root := os.Getenv("SystemRoot")
+		if root == "" {
+			root = `C:\Windows`
+		}
+		dir := filepath.Join(root, "Temp", "selfupdate-"+hex.EncodeToString(id))
+		run = filepath.Join(dir, filepath.Base(staged))
+		elevated = &elevatedCopy{from: staged, to: run, dir: dir, sum: sum}
+	}
+	program, args, err := conf.Installer.command(installerFormat(conf, newVer), run)
+	if err != nil {
+		_ = os.RemoveAll(filepath.Dir(staged))
+		return err
+	}
+	exe := u.executable
+	if exe == "" {
+		if exe, err = ExecutableRealPath(); err != nil {
+			_ = os.RemoveAll(filepath.Dir(staged))
+			return err
+		}
+	}
+	relaunch := ""
+	if !conf.Installer.KeepStopped {
+		relaunch = exe
+	}
+	script := installerScript(os.Getpid(), program, args, elevated, relaunch, filepath.Dir(staged))
+
+	if err = beforeExit(conf); err != nil {
+		_ = os.RemoveAll(filepath.Dir(staged))
+		return err
+	}
+	logInfo("Handing off to the installer of version %s.\n", newVer.Number)
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-EncodedCommand", encodePowerShell(script))
+	if err = cmd.Start(); err == nil {
+		_ = cmd.Process.Release()
+	}
+	return exit(conf, err)
+}
+
+// installerScript returns the PowerShell script waiting for the process pid to exit, then running program with
+// args, restarting relaunch as the application was launched if not empty once it succeeded, and removing dir. If
+// elevated is set, program runs from the copy of the installer made by an elevated script, see elevatedScript.
+func installerScript(pid int, program string, args []string, elevated *elevatedCopy, relaunch string, dir string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Wait-Process -Id %d -ErrorAction SilentlyContinue\n", pid)
+	if elevated != nil {
+		inner := "-NoProfile -NonInteractive -WindowStyle Hidden -EncodedCommand " + encodePowerShell(elevatedScript(program, args, elevated))
+		b.WriteString("$p = Start-Process -FilePath 'powershell.exe' -ArgumentList " + psQuote(inner) + " -Verb RunAs")
+	} else {
+		b.WriteString("$p = Start-Process -FilePath " + psQuote(program))
+		if len(args) > 0 {
+			b.WriteString(" -ArgumentList " + psQuote(commandLine(args)))
+		}
+	}
+	b.WriteString(" -Wait -PassThru\n")
+	if relaunch != "" {
+		// 3010 is the success of an msi requiring a reboot to complete
+		b.WriteString("if ($p -and @(0, 3010) -contains $p.ExitCode) { Start-Process -FilePath " + psQuote(relaunch))
+		if len(launch.args) > 1 {
+			b.WriteString(" -ArgumentList " + psQuote(commandLine(launch.args[1:])))
+		}
+		if launch.dir != "" {
+			b.WriteString(" -WorkingDirectory " + psQuote(launch.dir))
+		}
+		b.WriteString(" }\n")
+	}
+	b.WriteString("Remove-Item -LiteralPath " + psQuote(dir) + " -Recurse -Force -ErrorAction SilentlyContinue\n")
+	return b.String()
+}
+
+// elevatedScript returns the PowerShell script run elevated, copying the installer as described by elevated, then
+// running program with args only if the copy has the SHA-256 of the verified installer. It exits with the code of
+// the installer, or 1 if it couldn't be run.
+func elevatedScript(program string, args []string, elevated *elevatedCopy) string {
+	var b strings.Builder
+	b.WriteString("$ErrorActionPreference = 'Stop'\n$code = 1\n")
+	// the directory must be new, so that nothing the user placed there beforehand is run
+	b.WriteString("try {\n\tNew-Item -ItemType Directory -Path " + psQuote(elevated.dir) + " | Out-Null\n")
+	b.WriteString("} catch {\n\texit 1\n}\n")
+	b.WriteString("try {\n\tCopy-Item -LiteralPath " + psQuote(elevated.from) + " -Destination " + psQuote(elevated.to) + "\n")
+	b.WriteString("\tif ((Get-FileHash -LiteralPath " + psQuote(elevated.to) + " -Algorithm SHA256).Hash -eq '" + hex.EncodeToString(elevated.sum) + "') {\n")
+	b.WriteString("\t\t$p = Start-Process -FilePath " + psQuote(program))
+	if len(args) > 0 {
+		b.WriteString(" -ArgumentList " + psQuote(commandLine(args)))
+	}
+	b.WriteString(" -Wait -PassThru\n\t\t$code = $p.ExitCode\n\t}\n} catch {\n}\n")
+	b.WriteString("Remove-Item -LiteralPath " + psQuote(elevated.dir) + " -Recurse -Force -ErrorAction SilentlyContinue\n")
+	b.WriteString("exit $code\n")
+	return b.String()
+}
+
+// psQuote returns s as a PowerShell string literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// commandLine join args into a Windows command line, quoted the way CommandLineToArgvW splits them
+func commandLine(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+			quoted = append(quoted, arg)
+			continue
+		}
+		var b strings.Builder
+		b.WriteByte('"')
+		slashes := 0
+		for _, c := range arg {
+			switch c {
+			case '\\':
+				slashes++
+			case '"':
+				// the backslashes before a quote are doubled, and the quote escaped
+				b.WriteString(strings.Repeat(`\`, slashes+1))
+				slashes = 0
+			default:
+				slashes = 0
+			}
+			b.WriteRune(c)
+		}
+		// as are the backslashes before the closing quote
+		b.WriteString(strings.Repeat(`\`, slashes))
+		b.WriteByte('"')
+		quoted = append(quoted, b.String())
+	}
+	return strings.Join(quoted, " ")
+}
+
+// encodePowerShell encode script for the -EncodedCommand argument of PowerShell, base64 of its UTF-16LE text
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,91 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallerCommand(t *testing.T) {
+	program, args, err := (&Installer{}).command("msi", `C:\Temp\myapp-1.1.0.msi`)
+	assert.Nil(t, err)
+	assert.Equal(t, "msiexec.exe", program)
+	assert.Equal(t, []string{"/i", `C:\Temp\myapp-1.1.0.msi`, "/qn", "/norestart"}, args)
+
+	program, args, err = (&Installer{Args: []string{"/S", "/D=C:\\Apps"}}).command("nsis", `C:\Temp\setup.exe`)
+	assert.Nil(t, err)
+	assert.Equal(t, `C:\Temp\setup.exe`, program)
+	assert.Equal(t, []string{"/S", "/D=C:\\Apps"}, args)
+
+	_, _, err = (&Installer{}).command("wix", `C:\Temp\setup.exe`)
+	assert.NotNil(t, err)
+}
+
+func TestCommandLine(t *testing.T) {
+	assert.Equal(t, `/i "C:\Program Files\my app.msi" /qn`, commandLine([]string{"/i", `C:\Program Files\my app.msi`, "/qn"}))
+	assert.Equal(t, `"" "say \"hi\"" "C:\dir with space\\"`, commandLine([]string{"", `say "hi"`, `C:\dir with space\`}))
+	assert.Equal(t, `"a\\\"b"`, commandLine([]string{`a\"b`}))
+}
+
+func TestInstallerScript(t *testing.T) {
+	script := installerScript(42, "msiexec.exe", []string{"/i", `C:\It's here\app.msi`}, nil, `C:\App\myapp.exe`, `C:\Temp\installer`)
+	assert.True(t, strings.HasPrefix(script, "Wait-Process -Id 42 "))
+	assert.Contains(t, script, `Start-Process -FilePath 'msiexec.exe' -ArgumentList '/i "C:\It''s here\app.msi"' -Wait -PassThru`)
+	assert.Contains(t, script, `@(0, 3010) -contains $p.ExitCode) { Start-Process -FilePath 'C:\App\myapp.exe'`)
+	assert.Contains(t, script, `Remove-Item -LiteralPath 'C:\Temp\installer'`)
+	assert.NotContains(t, script, "RunAs")
+
+	script = installerScript(42, `C:\Temp\setup.exe`, nil, nil, "", `C:\Temp`)
+	assert.NotContains(t, script, "ExitCode")
+
+	// elevated, the installer runs from a copy only administrators can change, once checked
+	elevated := &elevatedCopy{from: `C:\Temp\installer\app.msi`, to: `C:\Windows\Temp\selfupdate-01\app.msi`, dir: `C:\Windows\Temp\selfupdate-01`, sum: []byte{0xab, 0xcd}}
+	script = installerScript(42, "msiexec.exe", []string{"/i", `C:\Windows\Temp\selfupdate-01\app.msi`}, elevated, "", `C:\Temp\installer`)
+	assert.Contains(t, script, "Start-Process -FilePath 'powershell.exe' -ArgumentList '-NoProfile -NonInteractive -WindowStyle Hidden -EncodedCommand ")
+	assert.Contains(t, script, " -Verb RunAs -Wait -PassThru")
+	assert.NotContains(t, script, "msiexec.exe")
+	inner := elevatedScript("msiexec.exe", []string{"/i", `C:\Windows\Temp\selfupdate-01\app.msi`}, elevated)
+	assert.Contains(t, script, encodePowerShell(inner))
+	assert.Contains(t, inner, `New-Item -ItemType Directory -Path 'C:\Windows\Temp\selfupdate-01'`)
+	assert.Contains(t, inner, `Copy-Item -LiteralPath 'C:\Temp\installer\app.msi' -Destination 'C:\Windows\Temp\selfupdate-01\app.msi'`)
+	assert.Contains(t, inner, `-Algorithm SHA256).Hash -eq 'abcd'`)
+	assert.Contains(t, inner, `Start-Process -FilePath 'msiexec.exe' -ArgumentList '/i C:\Windows\Temp\selfupdate-01\app.msi' -Wait -PassThru`)
+
+	b, err := base64.StdEncoding.DecodeString(encodePowerShell("é"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xe9, 0}, b)
+}
+
+func TestStageInstaller(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	conf := &Config{Source: &staticSource{key: priv}, PublicKey: pub, Installer: &Installer{Format: "msi"}}
+	u := &Updater{conf: conf, executable: filepath.Join(t.TempDir(), "myapp.exe")}
+
+	staged, sum, err := u.stageInstaller(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(filepath.Dir(staged))
+	assert.Equal(t, "myapp-1.1.0.msi", filepath.Base(staged))
+	validateUpdate(staged, nil, t)
+	expected := sha256.Sum256(newFile)
+	assert.Equal(t, expected[:], sum)
+
+	// an installer changed once verified is not handed off, and is removed
+	assert.Nil(t, os.WriteFile(staged, oldFile, 0755))
+	assert.ErrorIs(t, u.handOff(conf, &Version{Number: "1.1.0"}, staged, sum), errStagedChanged)
+	assert.NoFileExists(t, staged)
+
+	// nothing is left behind when the installer is not the one signed
+	_, other, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	conf.Source = &staticSource{key: other}
+	_, _, err = u.stageInstaller(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,313 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// KeyBundleSource define a Source that is able to provide a key bundle rotating the root keys of a KeyRing
+type KeyBundleSource interface {
+	Source
+	GetKeyBundle() ([]byte, error) // Get the signed key bundle, ErrNotPublished if there is none
+}
+
+// KeyBundle replace the root keys of a KeyRing and the keys trusted to sign updates. It must be signed by
+// Threshold of the root keys it replace and by Threshold of the root keys it introduces.
+type KeyBundle struct {
+	Version   int          `json:"version"`   // Must be higher than the version of the bundle currently applied, which is 0 for the compiled in keys
+	Threshold int          `json:"threshold"` // Number of root keys that must sign the next bundle
+	Roots     []TrustedKey `json:"roots"`     // Keys trusted to sign the next bundle
+	Keys      []TrustedKey `json:"keys"`      // Keys trusted to sign updates and key manifests
+}
+
+// keyBundleSignature is the signature of a key bundle by one root key
+type keyBundleSignature struct {
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// signedKeyBundle is the signed envelope of a key bundle
+type signedKeyBundle struct {
+	Bundle     []byte               `json:"bundle"` // JSON of a KeyBundle
+	Signatures []keyBundleSignature `json:"signatures"`
+}
+
+// KeyStore define where applied key bundles are persisted, so that rotated keys survive a restart
+type KeyStore interface {
+	KeyBundles() ([][]byte, error)    // Signed key bundles applied so far, oldest first
+	AddKeyBundle(bundle []byte) error // Record a signed key bundle once applied
+}
+
+type fileKeyStore string
+
+// NewFileKeyStore returns a KeyStore keeping each signed key bundle as a line of JSON in the file at path
+func NewFileKeyStore(path string) KeyStore {
+	return fileKeyStore(path)
+}
+
+// KeyBundles will return the bundles in the file, none if it doesn't exist
+func (f fileKeyStore) KeyBundles() ([][]byte, error) {
+	file, err := os.Open(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var bundles [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			bundles = append(bundles, append([]byte(nil), line...))
+		}
+	}
+	return bundles, scanner.Err()
+}
+
+// AddKeyBundle will append bundle to the file and sync it to disk
+func (f fileKeyStore) AddKeyBundle(bundle []byte) error {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, bundle); err != nil {
+		return err
+	}
+
+	path := string(f)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(compact.Bytes(), '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// keyStore returns the configured KeyStore, by default a file named after the executable in the user
+// configuration directory
+func keyStore(conf *Config) (KeyStore, error) {
+	if conf.KeyStore != nil {
+		return conf.KeyStore, nil
+	}
+
+	path, err := stateFile(".keys")
+	if err != nil {
+		return nil, fmt.Errorf("no place to persist key bundles: %w", err)
+	}
+	return NewFileKeyStore(path), nil
+}
+
+// NewRootKeyRing returns a KeyRing trusting keys to sign updates, whose keys, including the root keys
+// themselves, can be replaced by a KeyBundle signed by threshold of roots. This is how the keys compiled into
+// the first release can be rotated, or revoked if compromised.
+func NewRootKeyRing(threshold int, roots []TrustedKey, keys ...TrustedKey) (*KeyRing, error) {
+	k, err := NewKeyRing(keys...)
+	if err != nil {
+		return nil, err
+	}
+	if k.roots, err = rootKeys(threshold, roots); err != nil {
+		return nil, err
+	}
+	k.threshold = threshold
+	return k, nil
+}
+
+// rootKeys returns roots by ID once checked they can satisfy threshold
+func rootKeys(threshold int, roots []TrustedKey) (map[string]TrustedKey, error) {
+	byID := map[string]TrustedKey{}
+	for _, root := range roots {
+		if err := root.check(); err != nil {
+			return nil, err
+		}
+		if _, ok := byID[root.ID]; ok {
+			return nil, fmt.Errorf("duplicate root key id %q", root.ID)
+		}
+		byID[root.ID] = root
+	}
+	if threshold < 1 || threshold > len(byID) {
+		return nil, fmt.Errorf("threshold of %d root keys can't be met by %d root keys", threshold, len(byID))
+	}
+	return byID, nil
+}
+
+// signedBy returns how many distinct keys of roots produced a valid signature of message, only counting keys
+// valid at k.now() if expiry is true, k.lock must be held
+func (k *KeyRing) signedBy(roots map[string]TrustedKey, message []byte, signatures []keyBundleSignature, expiry bool) int {
+	now := k.now()
+	signers := map[string]bool{}
+	for _, s := range signatures {
+		root, ok := roots[s.KeyID]
+		if ok && (!expiry || root.validAt(now)) && ed25519.Verify(root.PublicKey, message, s.Signature) {
+			signers[s.KeyID] = true
+		}
+	}
+	return len(signers)
+}
+
+// ApplyKeyBundle verify that data is a key bundle signed by enough of the current root keys and of the root keys
+// it introduces, and replace the keys of the KeyRing with the ones of the bundle. A bundle with a version not
+// higher than the current one is refused, so an old bundle can't bring back revoked keys.
+func (k *KeyRing) ApplyKeyBundle(data []byte) error {
+	return k.applyKeyBundle(data, true)
+}
+
+// applyKeyBundle is ApplyKeyBundle, the expiry of the root keys is ignored if expiry is false to apply again a
+// bundle that was verified when root keys since expired were still valid
+func (k *KeyRing) applyKeyBundle(data []byte, expiry bool) error {
+	var envelope signedKeyBundle
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("error unmarshalling key bundle: %s", err)
+	}
+	var bundle KeyBundle
+	if err := json.Unmarshal(envelope.Bundle, &bundle); err != nil {
+		return fmt.Errorf("error unmarshalling key bundle: %s", err)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.roots == nil {
+		return errors.New("key ring without root keys can't apply a key bundle")
+	}
+	if bundle.Version <= k.bundleVersion {
+		return fmt.Errorf("key bundle version %d isn't newer than %d", bundle.Version, k.bundleVersion)
+	}
+	if n := k.signedBy(k.roots, envelope.Bundle, envelope.Signatures, expiry); n < k.threshold {
+		return fmt.Errorf("key bundle signed by %d trusted root keys, %d required", n, k.threshold)
+	}
+	roots, err := rootKeys(bundle.Threshold, bundle.Roots)
+	if err != nil {
+		return fmt.Errorf("invalid key bundle: %w", err)
+	}
+	if n := k.signedBy(roots, envelope.Bundle, envelope.Signatures, expiry); n < bundle.Threshold {
+		return fmt.Errorf("key bundle signed by %d of its root keys, %d required", n, bundle.Threshold)
+	}
+	keys := map[string]TrustedKey{}
+	for _, key := range bundle.Keys {
+		if err := key.check(); err != nil {
+			return fmt.Errorf("invalid key bundle: %w", err)
+		}
+		keys[key.ID] = key
+	}
+
+	k.roots, k.threshold, k.keys, k.bundleVersion = roots, bundle.Threshold, keys, bundle.Version
+	logInfo("Applied key bundle version %d, trusting %d root keys and %d signing keys.\n", bundle.Version, len(roots), len(keys))
+	return nil
+}
+
+// restore apply once the key bundles persisted in store, each of them being verified again against the keys the
+// previous ones left
+func (k *KeyRing) restore(store KeyStore) {
+	k.lock.Lock()
+	restored := k.restored
+	k.restored = true
+	k.lock.Unlock()
+	if restored {
+		return
+	}
+
+	bundles, err := store.KeyBundles()
+	if err != nil {
+		logError("Unable to read the key bundles applied: %v\n", err)
+		return
+	}
+	for _, bundle := range bundles {
+		if err = k.applyKeyBundle(bundle, false); err != nil {
+			logError("Ignoring persisted key bundle: %v\n", err)
+		}
+	}
+}
+
+// SignKeyBundle returns bundle signed by each of privateKeys, indexed by the ID clients know them as
+func SignKeyBundle(bundle *KeyBundle, privateKeys map[string]ed25519.PrivateKey) ([]byte, error) {
+	message, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(privateKeys))
+	for id := range privateKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	envelope := signedKeyBundle{Bundle: message}
+	for _, id := range ids {
+		envelope.Signatures = append(envelope.Signatures, keyBundleSignature{KeyID: id, Signature: ed25519.Sign(privateKeys[id], message)})
+	}
+	return json.Marshal(envelope)
+}
+
+// updateRootKeys apply the key bundle of the source, if it publishes one newer than what ring trusts, and persist
+// it. A missing or invalid bundle isn't fatal, the update will still be verified with the keys already trusted.
+func updateRootKeys(ctx context.Context, ring *KeyRing, conf *Config, v *Version) {
+	ring.lock.RLock()
+	rooted := ring.roots != nil
+	ring.lock.RUnlock()
+	if !rooted {
+		return
+	}
+
+	store, err := keyStore(conf)
+	if err != nil {
+		logError("Key bundles won't be persisted: %v\n", err)
+		return
+	}
+	ring.restore(store)
+
+	ks, ok := conf.Source.(KeyBundleSource)
+	if !ok {
+		return
+	}
+	var data []byte
+	if cks, ok := ks.(KeyBundleContextSource); ok {
+		data, err = cks.GetKeyBundleContext(ctx, v)
+	} else {
+		data, err = getBytes(ctx, ks.GetKeyBundle)
+	}
+	if errors.Is(err, ErrNotPublished) {
+		return
+	}
+	if err != nil {
+		logError("Ignoring key bundle: %s\n", err)
+		return
+	}
+
+	var envelope signedKeyBundle
+	var bundle KeyBundle
+	if json.Unmarshal(data, &envelope) == nil && json.Unmarshal(envelope.Bundle, &bundle) == nil {
+		ring.lock.RLock()
+		current := ring.bundleVersion
+		ring.lock.RUnlock()
+		if bundle.Version <= current {
+			logDebug("Key bundle version %d already applied.\n", bundle.Version)
+			return
+		}
+	}
+
+	if err = ring.ApplyKeyBundle(data); err != nil {
+		logError("Ignoring key bundle: %s\n", err)
+		return
+	}
+	if err = store.AddKeyBundle(data); err != nil {
+		logError("Unable to persist the key bundle, it will be applied again: %v\n", err)
+	}
+}
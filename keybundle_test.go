@@ -0,0 +1,153 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testKey struct {
+	TrustedKey
+	private ed25519.PrivateKey
+}
+
+func newTestKey(t *testing.T, id string) testKey {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	return testKey{TrustedKey{ID: id, PublicKey: pub}, priv}
+}
+
+func signBundle(t *testing.T, bundle *KeyBundle, signers ...testKey) []byte {
+	privateKeys := map[string]ed25519.PrivateKey{}
+	for _, s := range signers {
+		privateKeys[s.ID] = s.private
+	}
+	data, err := SignKeyBundle(bundle, privateKeys)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestKeyRingApplyKeyBundle(t *testing.T) {
+	root1, root2, root3 := newTestKey(t, "root1"), newTestKey(t, "root2"), newTestKey(t, "root3")
+	newRoot1, newRoot2 := newTestKey(t, "root4"), newTestKey(t, "root5")
+	release, newRelease := newTestKey(t, "release"), newTestKey(t, "release-2")
+
+	ring, err := NewRootKeyRing(2, []TrustedKey{root1.TrustedKey, root2.TrustedKey, root3.TrustedKey}, release.TrustedKey)
+	assert.Nil(t, err)
+
+	bundle := &KeyBundle{Version: 1, Threshold: 2, Roots: []TrustedKey{newRoot1.TrustedKey, newRoot2.TrustedKey}, Keys: []TrustedKey{newRelease.TrustedKey}}
+
+	// a quorum of the current roots and of the new roots must sign the bundle
+	assert.NotNil(t, ring.ApplyKeyBundle(signBundle(t, bundle, root1, newRoot1, newRoot2)))
+	assert.NotNil(t, ring.ApplyKeyBundle(signBundle(t, bundle, root1, root3, newRoot1)))
+	assert.Equal(t, []TrustedKey{release.TrustedKey}, ring.Keys())
+
+	signed := signBundle(t, bundle, root1, root3, newRoot1, newRoot2)
+	assert.Nil(t, ring.ApplyKeyBundle(signed))
+	assert.Equal(t, []TrustedKey{newRelease.TrustedKey}, ring.Keys())
+	assert.Nil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(newRelease.private, newFile)))
+	assert.NotNil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(release.private, newFile)))
+
+	// a bundle can't be applied twice, and the old roots are not trusted anymore
+	assert.NotNil(t, ring.ApplyKeyBundle(signed))
+	bundle = &KeyBundle{Version: 2, Threshold: 1, Roots: []TrustedKey{root1.TrustedKey}, Keys: []TrustedKey{release.TrustedKey}}
+	assert.NotNil(t, ring.ApplyKeyBundle(signBundle(t, bundle, root1, root2, root3)))
+
+	// the threshold must be reachable
+	bundle = &KeyBundle{Version: 2, Threshold: 3, Roots: []TrustedKey{newRoot1.TrustedKey, newRoot2.TrustedKey}}
+	assert.NotNil(t, ring.ApplyKeyBundle(signBundle(t, bundle, newRoot1, newRoot2)))
+	_, err = NewRootKeyRing(0, []TrustedKey{root1.TrustedKey})
+	assert.NotNil(t, err)
+
+	// a key ring without roots can't be rotated
+	plain, err := NewKeyRing(release.TrustedKey)
+	assert.Nil(t, err)
+	assert.NotNil(t, plain.ApplyKeyBundle(signed))
+}
+
+type memoryKeyStore struct {
+	bundles [][]byte
+}
+
+func (m *memoryKeyStore) KeyBundles() ([][]byte, error) {
+	return m.bundles, nil
+}
+
+func (m *memoryKeyStore) AddKeyBundle(bundle []byte) error {
+	m.bundles = append(m.bundles, bundle)
+	return nil
+}
+
+func TestFetchKeyBundle(t *testing.T) {
+	root, newRoot := newTestKey(t, "root"), newTestKey(t, "root-2")
+	release, newRelease := newTestKey(t, "release"), newTestKey(t, "release-2")
+
+	now := time.Now()
+	root.NotAfter = now.Add(time.Hour)
+	bundle := signBundle(t, &KeyBundle{Version: 1, Threshold: 1, Roots: []TrustedKey{newRoot.TrustedKey}, Keys: []TrustedKey{newRelease.TrustedKey}}, root, newRoot)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			w.Write(newFile)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(newRelease.private, newFile))
+		case "/app.roots":
+			w.Write(bundle)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := &memoryKeyStore{}
+	newRing := func() *KeyRing {
+		ring, err := NewRootKeyRing(1, []TrustedKey{root.TrustedKey}, release.TrustedKey)
+		assert.Nil(t, err)
+		ring.now = func() time.Time { return now }
+		return ring
+	}
+
+	ring := newRing()
+	u := &Updater{}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/app"), Verifier: ring, KeyStore: store}
+	r, _, opts, err := u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	r.Close()
+	assert.Nil(t, opts.Verifier.VerifySignature(bytes.NewReader(newFile), opts.Signature))
+	assert.Equal(t, 1, len(store.bundles))
+
+	// the same bundle isn't persisted again
+	r, _, _, err = u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	r.Close()
+	assert.Equal(t, 1, len(store.bundles))
+
+	// after a restart, the persisted bundle is applied even though the root that signed it expired since
+	now = now.Add(2 * time.Hour)
+	ring = newRing()
+	updateRootKeys(context.Background(), ring, &Config{Source: NewHTTPSource(nil, server.URL+"/missing"), KeyStore: store}, nil)
+	assert.Equal(t, []TrustedKey{newRelease.TrustedKey}, ring.Keys())
+}
+
+func TestFileKeyStore(t *testing.T) {
+	store := NewFileKeyStore(filepath.Join(t.TempDir(), "selfupdate", "app.keys"))
+	bundles, err := store.KeyBundles()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bundles))
+
+	for i := 1; i <= 2; i++ {
+		assert.Nil(t, store.AddKeyBundle([]byte(fmt.Sprintf("{\n  \"bundle\": %d\n}", i))))
+	}
+	bundles, err = store.KeyBundles()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"bundle":1}`), []byte(`{"bundle":2}`)}, bundles)
+}
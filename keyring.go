@@ -0,0 +1,200 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/verify"
+)
+
+// KeyManifestSource define a Source that is able to provide a signed key manifest introducing new signing keys
+type KeyManifestSource interface {
+	Source
+	GetKeyManifest() ([]byte, error) // Get the signed key manifest, ErrNotPublished if there is none
+}
+
+// TrustedKey is an ed25519 public key trusted to sign updates until NotAfter
+type TrustedKey struct {
+	ID        string            `json:"id"`                  // Unique name of the key, like 2024-release
+	PublicKey ed25519.PublicKey `json:"public_key"`          // Base64 encoded in a key manifest
+	NotAfter  time.Time         `json:"not_after,omitempty"` // The key isn't trusted anymore after that time, never expire if zero
+}
+
+// keyManifest is the signed envelope of a key manifest
+type keyManifest struct {
+	Manifest  []byte `json:"manifest"`  // JSON list of TrustedKey
+	KeyID     string `json:"key_id"`    // ID of the trusted key that signed Manifest
+	Signature []byte `json:"signature"` // ed25519 signature of Manifest
+}
+
+// KeyRing is a Verifier accepting updates signed by any of its trusted keys that hasn't expired. New keys are
+// introduced with a key manifest signed by a key already in the KeyRing, so signing keys can be rotated without
+// breaking clients shipped with an older key: publish a manifest adding the new key, then sign releases with it.
+// Keys learned from a manifest are only kept in memory, the next release is expected to embed them. A KeyRing
+// created with NewRootKeyRing can also have all its keys replaced by a KeyBundle, which is persisted.
+type KeyRing struct {
+	lock sync.RWMutex
+	keys map[string]TrustedKey
+	now  func() time.Time
+
+	roots         map[string]TrustedKey // keys trusted to sign key bundles, nil if they can't be applied
+	threshold     int                   // number of roots that must sign a key bundle
+	bundleVersion int                   // version of the last key bundle applied
+	restored      bool                  // true once the persisted key bundles were applied
+}
+
+var _ Verifier = (*KeyRing)(nil)
+
+// NewKeyRing returns a KeyRing trusting keys
+func NewKeyRing(keys ...TrustedKey) (*KeyRing, error) {
+	k := &KeyRing{keys: map[string]TrustedKey{}, now: time.Now}
+	for _, key := range keys {
+		if err := k.add(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Keys returns the keys currently trusted, sorted by ID
+func (k *KeyRing) Keys() []TrustedKey {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	now := k.now()
+	keys := make([]TrustedKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.validAt(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// VerifySignature check that signature is a valid ed25519 signature of payload by one of the trusted keys. The
+// payload is held in memory.
+func (k *KeyRing) VerifySignature(payload io.Reader, signature []byte) error {
+	message, err := verify.ReadMessage(payload, 0)
+	if err != nil {
+		return err
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("ed25519 signature must be %v bytes long and was %v", ed25519.SignatureSize, len(signature))
+	}
+
+	for _, key := range k.Keys() {
+		if ed25519.Verify(key.PublicKey, message, signature) {
+			logDebug("Update signed with key %s.\n", key.ID)
+			return nil
+		}
+	}
+	return errors.New("update isn't signed by a trusted key")
+}
+
+// AddKeyManifest verify that data is a key manifest signed by a trusted key and trust the keys it introduces.
+// A key already in the KeyRing can be listed again to change its expiry, which is how an old key is retired.
+func (k *KeyRing) AddKeyManifest(data []byte) error {
+	var envelope keyManifest
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("error unmarshalling key manifest: %s", err)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	signer, ok := k.keys[envelope.KeyID]
+	if !ok || !signer.validAt(k.now()) {
+		return fmt.Errorf("key manifest signed by untrusted key %q", envelope.KeyID)
+	}
+	if !ed25519.Verify(signer.PublicKey, envelope.Manifest, envelope.Signature) {
+		return errors.New("invalid ed25519 key manifest signature")
+	}
+
+	var keys []TrustedKey
+	if err := json.Unmarshal(envelope.Manifest, &keys); err != nil {
+		return fmt.Errorf("error unmarshalling key manifest: %s", err)
+	}
+	for _, key := range keys {
+		if err := key.check(); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if old, ok := k.keys[key.ID]; ok && !old.PublicKey.Equal(key.PublicKey) {
+			return fmt.Errorf("key manifest change the public key of %q", key.ID)
+		}
+	}
+	for _, key := range keys {
+		k.keys[key.ID] = key
+		logInfo("Trusting signing key %s from key manifest.\n", key.ID)
+	}
+	return nil
+}
+
+// SignKeyManifest returns a key manifest introducing keys, signed by privateKey which must be trusted by
+// clients as keyID
+func SignKeyManifest(keyID string, privateKey ed25519.PrivateKey, keys ...TrustedKey) ([]byte, error) {
+	manifest, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(keyManifest{Manifest: manifest, KeyID: keyID, Signature: ed25519.Sign(privateKey, manifest)})
+}
+
+func (k *KeyRing) add(key TrustedKey) error {
+	if err := key.check(); err != nil {
+		return err
+	}
+	if _, ok := k.keys[key.ID]; ok {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	k.keys[key.ID] = key
+	return nil
+}
+
+func (key TrustedKey) check() error {
+	if key.ID == "" {
+		return errors.New("trusted key without id")
+	}
+	if len(key.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("ed25519 public key %q must be %v bytes long and was %v", key.ID, ed25519.PublicKeySize, len(key.PublicKey))
+	}
+	return nil
+}
+
+func (key TrustedKey) validAt(t time.Time) bool {
+	return key.NotAfter.IsZero() || t.Before(key.NotAfter)
+}
+
+// updateKeyRing refresh ring from the key manifest of the source, if it publishes one. A missing or invalid
+// manifest isn't fatal, the update will still be verified with the keys already trusted.
+func updateKeyRing(ctx context.Context, ring *KeyRing, source Source, v *Version) {
+	ks, ok := source.(KeyManifestSource)
+	if !ok {
+		return
+	}
+	var manifest []byte
+	var err error
+	if cks, ok := ks.(KeyManifestContextSource); ok {
+		manifest, err = cks.GetKeyManifestContext(ctx, v)
+	} else {
+		manifest, err = getBytes(ctx, ks.GetKeyManifest)
+	}
+	if errors.Is(err, ErrNotPublished) {
+		return
+	}
+	if err == nil {
+		err = ring.AddKeyManifest(manifest)
+	}
+	if err != nil {
+		logError("Ignoring key manifest: %s\n", err)
+	}
+}
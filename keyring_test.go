@@ -0,0 +1,93 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRing(t *testing.T) {
+	oldPub, oldPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	newPub, newPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ring, err := NewKeyRing(TrustedKey{ID: "2023", PublicKey: oldPub})
+	assert.Nil(t, err)
+	ring.now = func() time.Time { return now }
+
+	assert.Nil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(oldPriv, newFile)))
+	assert.NotNil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(newPriv, newFile)))
+
+	// the old key introduce the new one and retire itself
+	manifest, err := SignKeyManifest("2023", oldPriv,
+		TrustedKey{ID: "2023", PublicKey: oldPub, NotAfter: now.Add(time.Hour)},
+		TrustedKey{ID: "2024", PublicKey: newPub})
+	assert.Nil(t, err)
+	assert.Nil(t, ring.AddKeyManifest(manifest))
+	assert.Len(t, ring.Keys(), 2)
+	assert.Nil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(newPriv, newFile)))
+
+	now = now.Add(2 * time.Hour)
+	assert.Len(t, ring.Keys(), 1)
+	assert.NotNil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(oldPriv, newFile)))
+	assert.Nil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(newPriv, newFile)))
+
+	// manifests must be signed by a key that is still trusted and can't replace a key
+	manifest, err = SignKeyManifest("2023", oldPriv, TrustedKey{ID: "2025", PublicKey: oldPub})
+	assert.Nil(t, err)
+	assert.NotNil(t, ring.AddKeyManifest(manifest))
+	manifest, err = SignKeyManifest("2024", newPriv, TrustedKey{ID: "2023", PublicKey: newPub})
+	assert.Nil(t, err)
+	assert.NotNil(t, ring.AddKeyManifest(manifest))
+	manifest, err = SignKeyManifest("2024", oldPriv, TrustedKey{ID: "2025", PublicKey: oldPub})
+	assert.Nil(t, err)
+	assert.NotNil(t, ring.AddKeyManifest(manifest))
+	assert.Len(t, ring.Keys(), 1)
+
+	_, err = NewKeyRing(TrustedKey{ID: "a", PublicKey: oldPub}, TrustedKey{ID: "a", PublicKey: newPub})
+	assert.NotNil(t, err)
+}
+
+func TestFetchKeyManifest(t *testing.T) {
+	oldPub, oldPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	newPub, newPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	manifest, err := SignKeyManifest("old", oldPriv, TrustedKey{ID: "new", PublicKey: newPub})
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			w.Write(newFile)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(newPriv, newFile))
+		case "/app.keys":
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ring, err := NewKeyRing(TrustedKey{ID: "old", PublicKey: oldPub})
+	assert.Nil(t, err)
+
+	u := &Updater{}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/app"), Verifier: ring}
+	r, _, opts, err := u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Len(t, ring.Keys(), 2)
+	assert.Nil(t, opts.Verifier.VerifySignature(bytes.NewReader(newFile), opts.Signature))
+}
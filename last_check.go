@@ -0,0 +1,74 @@
+package selfupdate
+
+import (
+	"time"
+
+	"github.com/Lamdt03/selfupdate/schedule"
+)
+
+// CheckState is what is remembered of the last update check
+//
+// Deprecated: use schedule.CheckState.
+type CheckState = schedule.CheckState
+
+// CheckStore define where the last update check is persisted, so that Config.MinCheckInterval holds across
+// launches of the application
+//
+// Deprecated: use schedule.CheckStore.
+type CheckStore = schedule.CheckStore
+
+// NewFileCheckStore returns a CheckStore keeping the last check as JSON in the file at path
+//
+// Deprecated: use schedule.NewFileCheckStore.
+func NewFileCheckStore(path string) CheckStore {
+	return schedule.NewFileCheckStore(path)
+}
+
+// checkStore returns the configured CheckStore, by default a file named after the executable in the user
+// configuration directory. It returns nil if there is no place to persist checks.
+func checkStore(conf *Config) CheckStore {
+	if conf.CheckStore != nil {
+		return conf.CheckStore
+	}
+	path, err := stateFile(".check")
+	if err != nil {
+		logDebug("No place to record update checks: %v\n", err)
+		return nil
+	}
+	return NewFileCheckStore(path)
+}
+
+// checkedRecently report if the last check recorded is more recent than conf.MinCheckInterval
+func checkedRecently(conf *Config, now time.Time) bool {
+	if conf.MinCheckInterval <= 0 {
+		return false
+	}
+	store := checkStore(conf)
+	if store == nil {
+		return false
+	}
+	last, err := store.LastCheck()
+	if err != nil {
+		logError("Unable to read the last update check: %v\n", err)
+		return false
+	}
+	if last == nil || last.Time.After(now) || now.Sub(last.Time) >= conf.MinCheckInterval {
+		return false
+	}
+	logInfo("Skipping update check, the last one was at %s.\n", last.Time.Format(time.RFC3339))
+	return true
+}
+
+// recordCheck persist that the Source announced version at now, when conf.MinCheckInterval is used
+func recordCheck(conf *Config, now time.Time, version string) {
+	if conf.MinCheckInterval <= 0 {
+		return
+	}
+	store := checkStore(conf)
+	if store == nil {
+		return
+	}
+	if err := store.RecordCheck(&CheckState{Time: now, Version: version}); err != nil {
+		logError("Unable to record the update check: %v\n", err)
+	}
+}
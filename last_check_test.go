@@ -0,0 +1,41 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNowMinCheckInterval(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.0.0"}]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	store := NewFileCheckStore(filepath.Join(t.TempDir(), "app.check"))
+	u := &Updater{conf: &Config{
+		Current:          &Version{Number: "1.0.0"},
+		Source:           NewHTTPSource(nil, server.URL),
+		VersionStore:     &memoryVersionStore{},
+		MinCheckInterval: time.Hour,
+		CheckStore:       store,
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, 1, requests)
+	last, err := store.LastCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0", last.Version)
+
+	assert.Nil(t, store.RecordCheck(&CheckState{Time: time.Now().Add(-2 * time.Hour)}))
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,79 @@
+package selfupdate
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ListSource define a Source that can list every published version rather than only the latest, for version
+// pickers and targeted downgrades
+type ListSource interface {
+	Source
+	ListVersions() ([]*Version, error) // Get the versions that can be installed, newest first
+}
+
+var _ ListSource = (*HTTPSource)(nil)
+
+// ListVersions will return the versions of the manifest that can be installed on the running platform, newest
+// first. Yanked versions are left out, as are the ones not selected by the channel, prerelease and constraint
+// settings of the source. Each version is only listed once, with the build LatestVersion would pick.
+func (h *HTTPSource) ListVersions() ([]*Version, error) {
+	return h.ListVersionsContext(context.Background())
+}
+
+// ListVersionsContext is ListVersions, the request is interrupted once ctx is done
+func (h *HTTPSource) ListVersionsContext(ctx context.Context) ([]*Version, error) {
+	if _, err := h.LatestVersionContext(ctx); err != nil {
+		return nil, err
+	}
+
+	sel := h.selectorFor(ctx)
+	h.lock.Lock()
+	var entries []*appVersion
+	builds := map[string]int{}
+	for i := range h.versions {
+		a := &h.versions[i]
+		if !forPlatform(a) || a.Yanked || !sel.match(a) {
+			continue
+		}
+		number := strings.TrimSpace(a.Version)
+		if j, ok := builds[number]; ok {
+			if betterBuild(a, entries[j]) {
+				entries[j] = a
+			}
+			continue
+		}
+		builds[number] = len(entries)
+		entries = append(entries, a)
+	}
+	h.lock.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		isNewer, err := newer(sel.comparator, entries[j].Version, entries[i].Version)
+		return err == nil && isNewer
+	})
+	versions := make([]*Version, 0, len(entries))
+	for _, a := range entries {
+		v, err := entryVersion(a)
+		if err != nil {
+			logDebug("Skipping version %s: %v\n", a.Version, err)
+			continue
+		}
+		if v.URL == "" {
+			v.URL = expandURLTemplate(h.baseURL, v)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// ListVersions will return the versions published by the Source, newest first, or ErrNotSupported if it can only
+// tell the latest one
+func (u *Updater) ListVersions() ([]*Version, error) {
+	ls, ok := u.config().Source.(ListSource)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return ls.ListVersions()
+}
@@ -0,0 +1,50 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceListVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"version":"1.2.0"},
+			{"os":%[1]q,"version":"1.10.0","download_url":"http://localhost/app-{{.Version}}"},
+			{"os":%[1]q,"version":"1.3.0","yanked":true},
+			{"os":%[1]q,"version":"1.11.0-beta.1","channel":"beta"},
+			{"os":%[1]q,"version":"1.1.0"},
+			{"os":"other","version":"2.0.0"}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	numbers := func() []string {
+		versions, err := source.ListVersions()
+		assert.Nil(t, err)
+		var n []string
+		for _, v := range versions {
+			n = append(n, v.Number)
+		}
+		return n
+	}
+	assert.Equal(t, []string{"1.10.0", "1.2.0", "1.1.0"}, numbers())
+
+	source.SetChannel("beta")
+	assert.Equal(t, []string{"1.11.0-beta.1", "1.10.0", "1.2.0", "1.1.0"}, numbers())
+
+	u := &Updater{conf: &Config{Source: source}}
+	versions, err := u.ListVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost/app-1.10.0", versions[1].URL)
+	assert.Equal(t, server.URL, versions[2].URL)
+
+	u.conf.Source = &hungSource{}
+	_, err = u.ListVersions()
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
@@ -0,0 +1,28 @@
+package selfupdate
+
+import "errors"
+
+// ErrUpdateRequired is returned by CheckNow when the user didn't confirm an update that is mandatory, or that
+// moves off a version below the minimum supported one, so the application can force it instead of carrying on
+var ErrUpdateRequired = errors.New("update is required")
+
+// UpdateRequired report if moving from the running version current to the newer latest is not optional: latest
+// is marked mandatory or current is older than the minimum version it declares is still supported
+func UpdateRequired(current string, latest *Version) bool {
+	return updateRequired(SemVerComparator, current, latest)
+}
+
+// updateRequired is UpdateRequired with versions ordered by c
+func updateRequired(c VersionComparator, current string, latest *Version) bool {
+	if latest == nil {
+		return false
+	}
+	if isNewer, err := newer(c, current, latest.Number); err != nil || !isNewer {
+		return false
+	}
+	if latest.Mandatory {
+		return true
+	}
+	below, err := newer(c, current, latest.MinimumVersion)
+	return latest.MinimumVersion != "" && err == nil && below
+}
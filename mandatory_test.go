@@ -0,0 +1,42 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRequired(t *testing.T) {
+	assert.False(t, UpdateRequired("1.0.0", &Version{Number: "1.1.0"}))
+	assert.True(t, UpdateRequired("1.0.0", &Version{Number: "1.1.0", Mandatory: true}))
+	assert.False(t, UpdateRequired("1.1.0", &Version{Number: "1.1.0", Mandatory: true}))
+	assert.False(t, UpdateRequired("1.2.0", &Version{Number: "1.1.0", Mandatory: true}))
+	assert.True(t, UpdateRequired("1.0.0", &Version{Number: "1.3.0", MinimumVersion: "1.1.0"}))
+	assert.False(t, UpdateRequired("1.1.0", &Version{Number: "1.3.0", MinimumVersion: "1.1.0"}))
+	assert.False(t, UpdateRequired("1.0.0", nil))
+}
+
+func TestCheckNowRequired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.3.0","minimum_version":"1.1.0"}]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	message := ""
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.2.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           &memoryVersionStore{},
+		UpgradeConfirmCallback: func(m string) bool { message = m; return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, "New version found", message)
+
+	u.conf.Current = &Version{Number: "1.0.0"}
+	assert.ErrorIs(t, u.CheckNow(), ErrUpdateRequired)
+	assert.Equal(t, "Required update found", message)
+}
@@ -0,0 +1,86 @@
+// Package manifest provides the format of the manifest listing the versions published on an update server.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Entry is a version listed in the manifest, for one platform
+type Entry struct {
+	Name            string       `json:"name"`
+	OS              string       `json:"os"`
+	Arch            string       `json:"arch,omitempty"`
+	GOARM           string       `json:"goarm,omitempty"`
+	GOAMD64         string       `json:"goamd64,omitempty"`
+	Libc            string       `json:"libc,omitempty"`
+	Universal       bool         `json:"universal,omitempty"`
+	ReleaseNotes    string       `json:"release_notes,omitempty"`
+	ReleaseNotesURL string       `json:"release_notes_url,omitempty"`
+	MinimumVersion  string       `json:"minimum_version,omitempty"`
+	Mandatory       bool         `json:"mandatory,omitempty"`
+	Rollout         *float64     `json:"rollout,omitempty"`
+	Published       time.Time    `json:"published,omitempty"`
+	Criticality     string       `json:"criticality,omitempty"`
+	DownloadURL     string       `json:"download_url"`
+	Version         string       `json:"version"`
+	SHA256          string       `json:"sha256,omitempty"`
+	SHA512          string       `json:"sha512,omitempty"`
+	Executable      string       `json:"executable,omitempty"`
+	InstallPath     string       `json:"install_path,omitempty"`
+	Yanked          bool         `json:"yanked,omitempty"`
+	Requires        string       `json:"requires,omitempty"`
+	AvailableFrom   time.Time    `json:"available_from,omitempty"`
+	Size            int64        `json:"size,omitempty"`
+	EndOfSupport    time.Time    `json:"end_of_support,omitempty"`
+	Signature       string       `json:"signature,omitempty"`
+	Codec           string       `json:"codec,omitempty"`
+	Archive         string       `json:"archive,omitempty"`
+	Member          string       `json:"member,omitempty"`
+	Channel         string       `json:"channel,omitempty"`
+	Files           []BundleFile `json:"files,omitempty"`
+	Consent         *Consent     `json:"consent,omitempty"`
+	Patches         []Patch      `json:"patches,omitempty"`
+}
+
+// Patch is a patch from a previous version listed in the manifest entry of a version
+type Patch struct {
+	From   string `json:"from"`             // Version the patch applies to
+	URL    string `json:"url"`              // URL template of the patch, accepting the same parameters as the download URL
+	Format string `json:"format,omitempty"` // "bsdiff" if empty, or "xdelta"
+	SHA256 string `json:"sha256,omitempty"` // Digest of the patch itself
+	Size   int64  `json:"size,omitempty"`   // Length of the patch
+}
+
+// BundleFile is a file installed with the executable from the archive of an update, like a helper binary, shell
+// completions or data files
+type BundleFile struct {
+	Member string      `json:"member"`         // path.Match pattern selecting the file in the archive
+	Path   string      `json:"path"`           // Path the file is installed at, relative to the directory of the executable
+	Mode   os.FileMode `json:"mode,omitempty"` // Permissions of the installed file, 0644 if zero
+}
+
+// Consent is a text, like an EULA change or a privacy policy update, the user must accept before a version is
+// installed
+type Consent struct {
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text"`
+}
+
+// Digest returns the hexadecimal SHA-256 of the consent text, identifying exactly what was accepted
+func (c *Consent) Digest() string {
+	digest := sha256.Sum256([]byte(c.Text))
+	return hex.EncodeToString(digest[:])
+}
+
+// Parse decode the entries of a manifest
+func Parse(body []byte) ([]Entry, error) {
+	var entries []Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,20 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := Parse([]byte(`[{"os":"linux","arch":"amd64","version":"1.2.0","download_url":"https://localhost/app","files":[{"member":"lib/*.so","path":"lib"}],"consent":{"text":"EULA"},"patches":[{"from":"1.1.0","url":"https://localhost/app.patch"}]}]`))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "1.2.0", entries[0].Version)
+	assert.Equal(t, "lib", entries[0].Files[0].Path)
+	assert.Equal(t, "1.1.0", entries[0].Patches[0].From)
+	assert.Len(t, entries[0].Consent.Digest(), 64)
+
+	_, err = Parse([]byte(`{"version":"1.2.0"}`))
+	assert.NotNil(t, err)
+}
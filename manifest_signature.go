@@ -0,0 +1,70 @@
+package selfupdate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NewSignedHTTPSource is like NewHTTPSource, but the JSON manifest at base must be signed and is verified with
+// verifier before any version or download URL it announces is trusted, so an attacker controlling only the
+// manifest endpoint can't redirect downloads. The manifest is either a JWS in compact serialization whose payload
+// is the JSON manifest and whose signing input is verified, or plain JSON with a detached signature served at
+// ${URL}.ed25519, as produced by `selfupdatectl sign`.
+func NewSignedHTTPSource(client *http.Client, base string, verifier Verifier) Source {
+	h := NewHTTPSource(client, base).(*HTTPSource)
+	h.manifestVerifier = verifier
+	return h
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+}
+
+// verifyManifest returns the manifest carried by body once its signature has been verified
+func (h *HTTPSource) verifyManifest(body []byte) ([]byte, error) {
+	if signingInput, payload, signature, ok := parseJWS(body); ok {
+		if err := h.manifestVerifier.VerifySignature(bytes.NewReader(signingInput), signature); err != nil {
+			return nil, fmt.Errorf("invalid manifest signature: %w", err)
+		}
+		return payload, nil
+	}
+
+	signature, err := h.getDetachedSignature(h.baseURL + ".ed25519")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching manifest signature: %w", err)
+	}
+	if err = h.manifestVerifier.VerifySignature(bytes.NewReader(body), signature); err != nil {
+		return nil, fmt.Errorf("invalid manifest signature: %w", err)
+	}
+	return body, nil
+}
+
+// parseJWS split a JWS in compact serialization, refusing unsigned ones
+func parseJWS(body []byte) ([]byte, []byte, []byte, bool) {
+	parts := strings.Split(string(bytes.TrimSpace(body)), ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, false
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	var header jwsHeader
+	if err = json.Unmarshal(rawHeader, &header); err != nil || header.Alg == "" || strings.EqualFold(header.Alg, "none") {
+		return nil, nil, nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	return []byte(parts[0] + "." + parts[1]), payload, signature, true
+}
@@ -0,0 +1,75 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jws(priv ed25519.PrivateKey, alg string, payload []byte) string {
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"`+alg+`"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(signingInput)))
+}
+
+func TestSignedHTTPSource(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	_, other, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	manifest := []byte(fmt.Sprintf(`[{"os":%q,"version":"1.1.0","download_url":"http://localhost/app"}]`, runtime.GOOS))
+	forged := []byte(fmt.Sprintf(`[{"os":%q,"version":"1.1.0","download_url":"http://attacker/app"}]`, runtime.GOOS))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/detached":
+			w.Write(manifest)
+		case "/detached.ed25519":
+			w.Write(ed25519.Sign(priv, manifest))
+		case "/forged":
+			w.Write(forged)
+		case "/forged.ed25519":
+			w.Write(ed25519.Sign(priv, manifest))
+		case "/unsigned":
+			w.Write(manifest)
+		case "/jws":
+			fmt.Fprintln(w, jws(priv, "EdDSA", manifest))
+		case "/jws-other":
+			fmt.Fprint(w, jws(other, "EdDSA", forged))
+		case "/jws-none":
+			fmt.Fprint(w, jws(other, "none", forged))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		path  string
+		valid bool
+	}{
+		{"/detached", true},
+		{"/jws", true},
+		{"/forged", false},
+		{"/unsigned", false},
+		{"/jws-other", false},
+		{"/jws-none", false},
+	} {
+		source := NewSignedHTTPSource(nil, server.URL+c.path, NewED25519Verifier(pub)).(*HTTPSource)
+		v, err := source.LatestVersion()
+		if c.valid {
+			assert.Nil(t, err, c.path)
+			assert.Equal(t, "1.1.0", v.Number)
+			assert.Equal(t, "http://localhost/app", source.resolve(v))
+		} else {
+			assert.NotNil(t, err, c.path)
+		}
+	}
+}
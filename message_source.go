@@ -0,0 +1,187 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Lamdt03/selfupdate/manifest"
+)
+
+// Subscriber define what a message bus client (NATS, MQTT, ...) need to provide to be used by a MessageSource.
+// The handler is called with the raw payload of every message published on topic and the returned
+// function is used to unsubscribe.
+type Subscriber interface {
+	Subscribe(topic string, handler func(payload []byte)) (func() error, error)
+}
+
+// MessageSource provide a Source that get notified of new version on a message bus topic. Every message
+// is expected to contain a signed manifest, the executable and its signature are then downloaded over HTTP
+// from the manifest download_url.
+type MessageSource struct {
+	client    *http.Client
+	publicKey ed25519.PublicKey
+
+	lock        sync.Mutex
+	latest      *appVersion
+	yanked      *yankList
+	trigger     chan struct{}
+	unsubscribe func() error
+}
+
+var _ YankSource = (*MessageSource)(nil)
+var _ ContextSource = (*MessageSource)(nil)
+
+// messageManifest is the payload expected on the message bus
+type messageManifest struct {
+	Manifest  []byte `json:"manifest"`  // JSON list of versions, in the same format HTTPSource understand
+	Signature []byte `json:"signature"` // ed25519 signature of Manifest
+}
+
+// NewMessageSource subscribe to topic and return a Source that will report the latest version announced on it.
+// Messages that are not signed by publicKey are ignored. Use Trigger with Schedule.Trigger to start an update
+// check as soon as a new version is announced.
+func NewMessageSource(sub Subscriber, topic string, client *http.Client, publicKey ed25519.PublicKey) (*MessageSource, error) {
+	m := &MessageSource{client: secureClient(client), publicKey: publicKey, trigger: make(chan struct{}, 1)}
+	unsubscribe, err := sub.Subscribe(topic, m.handle)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %w", topic, err)
+	}
+	m.unsubscribe = unsubscribe
+	return m, nil
+}
+
+// Trigger return a channel that receive a value every time a new manifest is accepted
+func (m *MessageSource) Trigger() <-chan struct{} {
+	return m.trigger
+}
+
+// Close unsubscribe from the message bus
+func (m *MessageSource) Close() error {
+	if m.unsubscribe == nil {
+		return nil
+	}
+	return m.unsubscribe()
+}
+
+func (m *MessageSource) handle(payload []byte) {
+	a, yanked, err := m.parse(payload)
+	if err != nil {
+		logError("Ignoring update notification: %v\n", err)
+		return
+	}
+
+	m.lock.Lock()
+	m.latest = a
+	m.yanked = yanked
+	m.lock.Unlock()
+
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MessageSource) parse(payload []byte) (*appVersion, *yankList, error) {
+	var msg messageManifest
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshalling message: %s", err)
+	}
+	if !ed25519.Verify(m.publicKey, msg.Manifest, msg.Signature) {
+		return nil, nil, errors.New("invalid ed25519 manifest signature")
+	}
+
+	appVersions, err := manifest.Parse(msg.Manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshalling manifest: %s", err)
+	}
+	latest, yanked, err := latestAppVersion(withoutEmbargoed(appVersions, time.Now()), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = securePolicy(m.client).CheckURL(latest.DownloadURL); err != nil {
+		return nil, nil, err
+	}
+	return latest, yanked, nil
+}
+
+func (m *MessageSource) download() (*HTTPSource, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.latest == nil {
+		return nil, errors.New("no update notification received yet")
+	}
+	return &HTTPSource{client: m.client, baseURL: m.latest.DownloadURL}, nil
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+func (m *MessageSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	h, err := m.download()
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.Get(v)
+}
+
+// GetSignature will return the content of ${download_url}.ed25519
+func (m *MessageSource) GetSignature() ([]byte, error) {
+	h, err := m.download()
+	if err != nil {
+		return nil, err
+	}
+	return h.GetSignature()
+}
+
+// GetContext is Get, the download is interrupted once ctx is done
+func (m *MessageSource) GetContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) {
+	h, err := m.download()
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.GetContext(ctx, v)
+}
+
+// GetSignatureContext is GetSignature, the request is interrupted once ctx is done
+func (m *MessageSource) GetSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	h, err := m.download()
+	if err != nil {
+		return nil, err
+	}
+	return h.GetSignatureContext(ctx, v)
+}
+
+// LatestVersionContext is LatestVersion, the manifest already received is returned without any request
+func (m *MessageSource) LatestVersionContext(_ context.Context) (*Version, error) {
+	return m.LatestVersion()
+}
+
+// LatestVersion will return the version of the last manifest received
+func (m *MessageSource) LatestVersion() (*Version, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.latest == nil {
+		return nil, errors.New("no update notification received yet")
+	}
+	return entryVersion(m.latest)
+}
+
+// yanksSigned report true, the manifests received are always verified
+func (m *MessageSource) yanksSigned() bool {
+	return true
+}
+
+// IsYanked will return true if version is marked as yanked in the last manifest received
+func (m *MessageSource) IsYanked(version string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.yanked.contains(version)
+}
@@ -0,0 +1,63 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSubscriber struct {
+	topic   string
+	handler func([]byte)
+}
+
+func (f *fakeSubscriber) Subscribe(topic string, handler func([]byte)) (func() error, error) {
+	f.topic = topic
+	f.handler = handler
+	return func() error { f.handler = nil; return nil }, nil
+}
+
+func signedMessage(t *testing.T, priv ed25519.PrivateKey, version string) []byte {
+	manifest := fmt.Sprintf(`[{"name":"app","os":%q,"download_url":"http://localhost/app","version":%q}]`, runtime.GOOS, version)
+	msg, err := json.Marshal(messageManifest{Manifest: []byte(manifest), Signature: ed25519.Sign(priv, []byte(manifest))})
+	assert.Nil(t, err)
+	return msg
+}
+
+func TestMessageSource(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	_, wrong, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	sub := &fakeSubscriber{}
+	source, err := NewMessageSource(sub, "updates.app", nil, pub)
+	assert.Nil(t, err)
+	assert.Equal(t, "updates.app", sub.topic)
+
+	_, err = source.LatestVersion()
+	assert.NotNil(t, err)
+
+	sub.handler(signedMessage(t, priv, "1.2.0"))
+	<-source.Trigger()
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+
+	sub.handler(signedMessage(t, wrong, "6.6.6"))
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+	select {
+	case <-source.Trigger():
+		t.Fatal("unsigned manifest should not trigger an update")
+	default:
+	}
+
+	assert.Nil(t, source.Close())
+	assert.Nil(t, sub.handler)
+}
@@ -0,0 +1,204 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	minisignUntrustedPrefix = "untrusted comment:"
+	minisignTrustedPrefix   = "trusted comment: "
+)
+
+// MinisignSource define a Source that is able to provide a minisign or signify signature of the executable
+type MinisignSource interface {
+	Source
+	GetMinisignSignature() ([]byte, error) // Get the content of the .minisig or signify .sig file of the executable
+}
+
+// MinisignSignature is a parsed minisign or signify signature file
+type MinisignSignature struct {
+	Algorithm      string   // "Ed" when the signature is over the file itself, "ED" when it is over its BLAKE2b-512 digest
+	KeyID          [8]byte  // Identifier of the key that made the signature
+	Signature      [64]byte // Ed25519 signature
+	TrustedComment string   // Signed comment, empty for signify signatures
+	GlobalSig      []byte   // Ed25519 signature of Signature and TrustedComment, nil for signify signatures
+}
+
+// ParseMinisignSignature parse the content of a minisign .minisig file or of an OpenBSD signify .sig file
+func ParseMinisignSignature(data []byte) (*MinisignSignature, error) {
+	lines := minisignLines(data)
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], minisignUntrustedPrefix) {
+		return nil, errors.New("invalid minisign signature: missing untrusted comment")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid minisign signature: %s", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature length %d", len(raw))
+	}
+
+	sig := &MinisignSignature{Algorithm: string(raw[:2])}
+	copy(sig.KeyID[:], raw[2:10])
+	copy(sig.Signature[:], raw[10:])
+	if sig.Algorithm != "Ed" && sig.Algorithm != "ED" {
+		return nil, fmt.Errorf("unsupported minisign signature algorithm %q", sig.Algorithm)
+	}
+
+	// signify signatures stop here
+	if len(lines) == 2 {
+		return sig, nil
+	}
+
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], minisignTrustedPrefix) {
+		return nil, errors.New("invalid minisign signature: missing trusted comment")
+	}
+	sig.TrustedComment = strings.TrimPrefix(lines[2], minisignTrustedPrefix)
+	if sig.GlobalSig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3])); err != nil {
+		return nil, fmt.Errorf("invalid minisign global signature: %s", err)
+	}
+	if len(sig.GlobalSig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign global signature length %d", len(sig.GlobalSig))
+	}
+	return sig, nil
+}
+
+// MinisignVerifier verify minisign and OpenBSD signify signatures, so that releases signed with those tools can
+// be consumed without converting keys. Both the legacy and the prehashed minisign formats are supported.
+type MinisignVerifier struct {
+	keys map[[8]byte]ed25519.PublicKey
+}
+
+// NewMinisignVerifier returns a MinisignVerifier trusting the given public keys. Each key can either be the content
+// of a minisign .pub or signify .pub file, or the bare base64 line as given to `minisign -P`.
+func NewMinisignVerifier(publicKeys ...[]byte) (*MinisignVerifier, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no minisign public key")
+	}
+
+	m := &MinisignVerifier{keys: make(map[[8]byte]ed25519.PublicKey, len(publicKeys))}
+	for _, pk := range publicKeys {
+		lines := minisignLines(pk)
+		if len(lines) > 0 && strings.HasPrefix(lines[0], minisignUntrustedPrefix) {
+			lines = lines[1:]
+		}
+		if len(lines) != 1 {
+			return nil, errors.New("invalid minisign public key")
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid minisign public key: %s", err)
+		}
+		if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+			return nil, errors.New("invalid minisign public key")
+		}
+
+		var id [8]byte
+		copy(id[:], raw[2:10])
+		m.keys[id] = ed25519.PublicKey(raw[10:])
+	}
+	return m, nil
+}
+
+// Verify check that signature is a valid minisign or signify signature of payload by one of the trusted keys
+func (m *MinisignVerifier) Verify(payload []byte, signature []byte) error {
+	_, err := m.VerifyComment(payload, signature)
+	return err
+}
+
+// VerifyComment check signature like Verify and returns its trusted comment once verified
+func (m *MinisignVerifier) VerifyComment(payload []byte, signature []byte) (string, error) {
+	return m.verify(signature, func(prehashed bool) ([]byte, error) {
+		if prehashed {
+			digest := blake2b.Sum512(payload)
+			return digest[:], nil
+		}
+		return payload, nil
+	})
+}
+
+// verifyFile check signature like Verify with the payload in the file at path. Prehashed signatures, the
+// default of minisign, are checked while streaming it, legacy ones require it in memory.
+func (m *MinisignVerifier) verifyFile(path string, signature []byte) error {
+	_, err := m.verify(signature, func(prehashed bool) ([]byte, error) {
+		if !prehashed {
+			return os.ReadFile(path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	})
+	return err
+}
+
+// verify check signature against the message returned by message, which is the BLAKE2b-512 digest of the payload
+// when prehashed is true
+func (m *MinisignVerifier) verify(signature []byte, message func(prehashed bool) ([]byte, error)) (string, error) {
+	sig, err := ParseMinisignSignature(signature)
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := m.keys[sig.KeyID]
+	if !ok {
+		return "", fmt.Errorf("minisign signature made with unknown key %X", sig.KeyID)
+	}
+
+	msg, err := message(sig.Algorithm == "ED")
+	if err != nil {
+		return "", err
+	}
+	if !ed25519.Verify(key, msg, sig.Signature[:]) {
+		return "", errors.New("invalid minisign signature")
+	}
+
+	if sig.GlobalSig != nil {
+		global := append(sig.Signature[:], sig.TrustedComment...)
+		if !ed25519.Verify(key, global, sig.GlobalSig) {
+			return "", errors.New("invalid minisign trusted comment signature")
+		}
+		logDebug("Valid minisign signature from key %X: %s\n", sig.KeyID, sig.TrustedComment)
+	} else {
+		logDebug("Valid signify signature from key %X.\n", sig.KeyID)
+	}
+	return sig.TrustedComment, nil
+}
+
+func (m *MinisignVerifier) String() string {
+	return fmt.Sprintf("MinisignVerifier(%d keys)", len(m.keys))
+}
+
+// minisignLines returns the non empty lines of data
+func minisignLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// only the line ending is stripped, the trusted comment is signed as is
+		if line := strings.TrimSuffix(scanner.Text(), "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
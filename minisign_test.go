@@ -0,0 +1,96 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+type minisignKey struct {
+	id   [8]byte
+	priv ed25519.PrivateKey
+	pub  []byte
+}
+
+func newMinisignKey(t *testing.T, id byte) *minisignKey {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	k := &minisignKey{id: [8]byte{id, 1, 2, 3, 4, 5, 6, 7}, priv: priv}
+	raw := append(append([]byte("Ed"), k.id[:]...), pub...)
+	k.pub = []byte("untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n")
+	return k
+}
+
+func (k *minisignKey) sign(algorithm string, payload []byte, trustedComment string) []byte {
+	message := payload
+	if algorithm == "ED" {
+		digest := blake2b.Sum512(payload)
+		message = digest[:]
+	}
+	sig := ed25519.Sign(k.priv, message)
+	raw := append(append([]byte(algorithm), k.id[:]...), sig...)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "untrusted comment: signature from secret key\n%s\n", base64.StdEncoding.EncodeToString(raw))
+	if trustedComment != "" {
+		global := ed25519.Sign(k.priv, append(sig, trustedComment...))
+		fmt.Fprintf(&b, "trusted comment: %s\n%s\n", trustedComment, base64.StdEncoding.EncodeToString(global))
+	}
+	return b.Bytes()
+}
+
+func TestMinisignVerifier(t *testing.T) {
+	key := newMinisignKey(t, 0)
+	other := newMinisignKey(t, 1)
+
+	m, err := NewMinisignVerifier(key.pub)
+	assert.Nil(t, err)
+
+	for _, algorithm := range []string{"Ed", "ED"} {
+		comment, err := m.VerifyComment(newFile, key.sign(algorithm, newFile, "timestamp:1700000000\tfile:myapp"))
+		assert.Nil(t, err)
+		assert.Equal(t, "timestamp:1700000000\tfile:myapp", comment)
+
+		assert.NotNil(t, m.Verify(oldFile, key.sign(algorithm, newFile, "timestamp:1700000000")))
+		assert.NotNil(t, m.Verify(newFile, other.sign(algorithm, newFile, "timestamp:1700000000")))
+	}
+
+	// signify signatures don't carry a trusted comment
+	assert.Nil(t, m.Verify(newFile, key.sign("Ed", newFile, "")))
+
+	// a tampered trusted comment must be rejected
+	tampered := bytes.Replace(key.sign("ED", newFile, "file:myapp"), []byte("file:myapp"), []byte("file:other"), 1)
+	assert.NotNil(t, m.Verify(newFile, tampered))
+
+	// keys can be given as the bare base64 line and several keys can be trusted
+	m, err = NewMinisignVerifier(key.pub, []byte(minisignLines(other.pub)[1]))
+	assert.Nil(t, err)
+	assert.Nil(t, m.Verify(newFile, other.sign("ED", newFile, "file:myapp")))
+
+	_, err = NewMinisignVerifier([]byte("untrusted comment: garbage\nAAAA\n"))
+	assert.NotNil(t, err)
+}
+
+func TestParseMinisignSignature(t *testing.T) {
+	key := newMinisignKey(t, 0)
+
+	sig, err := ParseMinisignSignature(key.sign("ED", newFile, "timestamp:1700000000"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ED", sig.Algorithm)
+	assert.Equal(t, key.id, sig.KeyID)
+	assert.Equal(t, "timestamp:1700000000", sig.TrustedComment)
+	assert.Len(t, sig.GlobalSig, ed25519.SignatureSize)
+
+	lines := bytes.SplitN(key.sign("ED", newFile, "timestamp:1700000000"), []byte("\n"), 4)
+	_, err = ParseMinisignSignature(bytes.Join(lines[:3], []byte("\n")))
+	assert.NotNil(t, err)
+
+	_, err = ParseMinisignSignature([]byte("not a signature"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,90 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// raceProbe is how much of the executable each racing mirror must deliver, the first one to do so is kept
+var raceProbe = 16 * 1024
+
+// RaceDownloads make Get start the download from up to racers mirrors at once and continue only with the one that
+// first delivers the beginning of the executable, the other downloads are cancelled. This lowers the latency of
+// updates for users far from some of the mirrors, for a few more KB downloaded. Mirrors that aren't raced are
+// still tried in order if all the racers fail.
+func (m *MirrorSource) RaceDownloads(racers int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.racers = racers
+}
+
+// raceResult is the beginning of a download from a racing mirror
+type raceResult struct {
+	index  int
+	mirror Source
+	r      io.ReadCloser
+	length int64
+	probe  []byte
+	err    error
+	cancel context.CancelFunc
+}
+
+// race returns the download of v from the candidate mirror that first delivered raceProbe bytes
+func race(ctx context.Context, candidates []Source, v *Version) (Source, io.ReadCloser, int64, error) {
+	results := make(chan *raceResult, len(candidates))
+	cancels := make([]context.CancelFunc, len(candidates))
+	for i := range candidates {
+		var rctx context.Context
+		rctx, cancels[i] = context.WithCancel(ctx)
+		go func(res *raceResult, rctx context.Context) {
+			res.r, res.length, res.err = getExecutable(rctx, res.mirror, v)
+			if res.err == nil {
+				res.probe = make([]byte, raceProbe)
+				var n int
+				n, res.err = io.ReadFull(res.r, res.probe)
+				if res.err == io.EOF || res.err == io.ErrUnexpectedEOF {
+					// the whole executable was received
+					res.err = nil
+				}
+				res.probe = res.probe[:n]
+				if res.err != nil {
+					res.r.Close()
+				}
+			}
+			results <- res
+		}(&raceResult{index: i, mirror: candidates[i], cancel: cancels[i]}, rctx)
+	}
+
+	var lastErr error
+	for i := range candidates {
+		res := <-results
+		if res.err != nil {
+			logDebug("Mirror download failed: %v\n", res.err)
+			lastErr = res.err
+			res.cancel()
+			continue
+		}
+
+		for j, cancel := range cancels {
+			if j != res.index {
+				cancel()
+			}
+		}
+		// the losers are closed once they notice they were cancelled
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				if lost := <-results; lost.err == nil {
+					lost.r.Close()
+				}
+			}
+		}(len(candidates) - i - 1)
+
+		logDebug("Mirror %d won the download race.\n", res.index)
+		return res.mirror, struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(res.probe), res.r), cancelCloser{res.r, res.cancel}}, res.length, nil
+	}
+	return nil, nil, 0, lastErr
+}
@@ -0,0 +1,85 @@
+package selfupdate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorSourceRace(t *testing.T) {
+	content := []byte("executable content")
+	cancelled := make(chan struct{}, 1)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"http://%s/app","version":"1.1.0"}]`, runtime.GOOS, r.Host)
+		case "/app":
+			select {
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+			case <-time.After(5 * time.Second):
+				w.Write([]byte("slow content"))
+			}
+		case "/app.ed25519":
+			w.Write([]byte("slow signature"))
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"http://%s/app","version":"1.1.0"}]`, runtime.GOOS, r.Host)
+		case "/broken":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"http://%s/missing","version":"1.1.0"}]`, runtime.GOOS, r.Host)
+		case "/app":
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		case "/app.ed25519":
+			w.Write([]byte("fast signature"))
+		}
+	}))
+	defer fast.Close()
+
+	source := NewMirrorSource(1, NewHTTPSource(nil, slow.URL+"/manifest"), NewHTTPSource(nil, fast.URL+"/manifest"))
+	source.RaceDownloads(2)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+
+	start := time.Now()
+	r, _, err := source.Get(v)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, content, body)
+	assert.True(t, time.Since(start) < 4*time.Second)
+
+	// the signature comes from the winner, and the loser is cancelled
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fast signature"), signature)
+	select {
+	case <-cancelled:
+	case <-time.After(4 * time.Second):
+		t.Error("the slow download wasn't cancelled")
+	}
+
+	// a failing racer leaves the race to the others
+	source = NewMirrorSource(1, NewHTTPSource(nil, fast.URL+"/broken"), NewHTTPSource(nil, fast.URL+"/manifest"))
+	source.RaceDownloads(2)
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	r, _, err = source.Get(v)
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, content, body)
+}
@@ -0,0 +1,187 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MirrorSource provide a Source that will use the first mirror that answer. Optionally it can require a quorum
+// of independent mirrors to agree on the digest of the executable before it is accepted, so that a single
+// compromised mirror can not serve a different executable. This is in addition to the signature verification.
+type MirrorSource struct {
+	mirrors []Source
+	quorum  int
+	racers  int
+
+	lock      sync.Mutex
+	available []Source
+	current   Source            // mirror of the last download, for GetSignature
+	from      map[string]Source // mirror each version was downloaded from
+}
+
+var _ ContextSource = (*MirrorSource)(nil)
+
+// NewMirrorSource returns a Source that will try each mirror in order. If quorum is greater than one, that many
+// mirrors must implement HashSource and report the same digest, which the download is then checked against.
+func NewMirrorSource(quorum int, mirrors ...Source) *MirrorSource {
+	return &MirrorSource{mirrors: mirrors, quorum: quorum}
+}
+
+// LatestVersion will query all mirrors and return the latest version reported by the first one that answer
+func (m *MirrorSource) LatestVersion() (*Version, error) {
+	return m.LatestVersionContext(context.Background())
+}
+
+// LatestVersionContext is LatestVersion, mirrors that didn't answer once ctx is done are skipped
+func (m *MirrorSource) LatestVersionContext(ctx context.Context) (*Version, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var latest *Version
+	var lastErr error
+	m.available = nil
+	for _, mirror := range m.mirrors {
+		v, err := latestVersion(ctx, mirror)
+		if err != nil {
+			logDebug("Mirror unavailable: %v\n", err)
+			lastErr = err
+			continue
+		}
+		if latest == nil {
+			latest = v
+		} else if v.Number != latest.Number {
+			logDebug("Mirror is announcing version %s instead of %s.\n", v.Number, latest.Number)
+			continue
+		}
+		m.available = append(m.available, mirror)
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no mirror available: %w", lastErr)
+	}
+	return latest, nil
+}
+
+// Get will return the executable from the first mirror that answer, checked against the digest the mirrors agreed on
+func (m *MirrorSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	return m.GetContext(context.Background(), v)
+}
+
+// GetContext is Get, the download is interrupted once ctx is done
+func (m *MirrorSource) GetContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	candidates := m.available
+	if candidates == nil {
+		candidates = m.mirrors
+	}
+
+	var h crypto.Hash
+	var expected []byte
+	if m.quorum > 1 {
+		var err error
+		if h, expected, err = m.vote(ctx, candidates, v); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	mirror, r, length, err := m.download(ctx, candidates, v)
+	if err != nil {
+		return nil, 0, err
+	}
+	m.current = mirror
+	if m.from == nil {
+		m.from = make(map[string]Source)
+	}
+	m.from[v.Number] = mirror
+	if expected != nil {
+		if r, err = newHashReader(r, h, expected); err != nil {
+			return nil, 0, err
+		}
+	}
+	return r, length, nil
+}
+
+// download returns the download of v from the racing mirrors, or the first candidate that answer
+func (m *MirrorSource) download(ctx context.Context, candidates []Source, v *Version) (Source, io.ReadCloser, int64, error) {
+	var lastErr error
+	if m.racers > 1 && len(candidates) > 1 {
+		racers := candidates
+		if len(racers) > m.racers {
+			racers = racers[:m.racers]
+		}
+		mirror, r, length, err := race(ctx, racers, v)
+		if err == nil {
+			return mirror, r, length, nil
+		}
+		lastErr = err
+		candidates = candidates[len(racers):]
+	}
+
+	for _, mirror := range candidates {
+		r, length, err := getExecutable(ctx, mirror, v)
+		if err != nil {
+			logDebug("Mirror download failed: %v\n", err)
+			lastErr = err
+			continue
+		}
+		return mirror, r, length, nil
+	}
+	return nil, nil, 0, fmt.Errorf("no mirror available: %w", lastErr)
+}
+
+// GetSignature will return the signature from the mirror the last executable was downloaded from
+func (m *MirrorSource) GetSignature() ([]byte, error) {
+	return m.GetSignatureContext(context.Background(), nil)
+}
+
+// GetSignatureContext will return the signature of the executable of v from the mirror it was downloaded from, the
+// request is interrupted once ctx is done
+func (m *MirrorSource) GetSignatureContext(ctx context.Context, v *Version) ([]byte, error) {
+	m.lock.Lock()
+	mirror := m.current
+	if v != nil {
+		mirror = m.from[v.Number]
+	}
+	m.lock.Unlock()
+
+	if mirror == nil {
+		return nil, errors.New("no executable downloaded yet")
+	}
+	return getSignature(ctx, mirror, v)
+}
+
+func (m *MirrorSource) vote(ctx context.Context, candidates []Source, v *Version) (crypto.Hash, []byte, error) {
+	var agreedHash crypto.Hash
+	var agreed []byte
+	votes := 0
+	for _, mirror := range candidates {
+		hs, ok := mirror.(HashSource)
+		if !ok {
+			continue
+		}
+		h, digest, err := getHash(ctx, hs, v)
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		if err != nil {
+			logDebug("Mirror digest unavailable: %v\n", err)
+			continue
+		}
+		if agreed == nil {
+			agreedHash, agreed = h, digest
+		} else if h != agreedHash || !bytes.Equal(agreed, digest) {
+			return 0, nil, fmt.Errorf("mirrors disagree on executable digest: %x and %x", agreed, digest)
+		}
+		votes++
+		if votes >= m.quorum {
+			return agreedHash, agreed, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("only %d mirrors reported a digest, %d required", votes, m.quorum)
+}
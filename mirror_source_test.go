@@ -0,0 +1,114 @@
+package selfupdate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mirrorServer(t *testing.T, content []byte, digest [32]byte) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"%s/app","version":"1.1.0"}]`, runtime.GOOS, server.URL)
+		case "/app":
+			w.Write(content)
+		case "/app.sha256":
+			fmt.Fprintf(w, "%x  app\n", digest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMirrorSourceQuorum(t *testing.T) {
+	content := []byte("executable content")
+	digest := sha256.Sum256(content)
+
+	a := mirrorServer(t, content, digest)
+	b := mirrorServer(t, content, digest)
+
+	source := NewMirrorSource(2, NewHTTPSource(nil, a.URL+"/manifest"), NewHTTPSource(nil, b.URL+"/manifest"))
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+
+	r, _, err := source.Get(v)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, content, body)
+}
+
+func TestMirrorSourceDisagree(t *testing.T) {
+	content := []byte("executable content")
+
+	a := mirrorServer(t, content, sha256.Sum256(content))
+	b := mirrorServer(t, content, sha256.Sum256([]byte("evil")))
+
+	source := NewMirrorSource(2, NewHTTPSource(nil, a.URL+"/manifest"), NewHTTPSource(nil, b.URL+"/manifest"))
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+
+	_, _, err = source.Get(v)
+	assert.NotNil(t, err)
+}
+
+func TestMirrorSourceCompromisedContent(t *testing.T) {
+	content := []byte("executable content")
+	digest := sha256.Sum256(content)
+
+	a := mirrorServer(t, []byte("evil"), digest)
+	b := mirrorServer(t, content, digest)
+
+	source := NewMirrorSource(2, NewHTTPSource(nil, a.URL+"/manifest"), NewHTTPSource(nil, b.URL+"/manifest"))
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+
+	r, _, err := source.Get(v)
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	r.Close()
+	assert.NotNil(t, err)
+}
+
+func TestMirrorSourceConcurrent(t *testing.T) {
+	content := []byte("executable content")
+	digest := sha256.Sum256(content)
+
+	a := mirrorServer(t, content, digest)
+	b := mirrorServer(t, content, digest)
+	source := NewMirrorSource(2, NewHTTPSource(nil, a.URL+"/manifest"), NewHTTPSource(nil, b.URL+"/manifest"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := source.LatestVersion()
+			if !assert.Nil(t, err) {
+				return
+			}
+			r, _, err := source.Get(v)
+			if !assert.Nil(t, err) {
+				return
+			}
+			body, err := io.ReadAll(r)
+			r.Close()
+			assert.Nil(t, err)
+			assert.Equal(t, content, body)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+func moveFileAtReboot(_ string, _ string) error {
+	return ErrNotSupported
+}
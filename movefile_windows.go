@@ -0,0 +1,37 @@
+package selfupdate
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	moveFileReplaceExisting  = 0x1
+	moveFileDelayUntilReboot = 0x4
+)
+
+// moveFileAtReboot schedule the move of src over dst, or its deletion if dst is empty, at the next reboot by
+// recording it in PendingFileRenameOperations
+func moveFileAtReboot(src, dst string) error {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	moveFileEx := kernel32.NewProc("MoveFileExW")
+
+	from, err := syscall.UTF16PtrFromString(src)
+	if err != nil {
+		return err
+	}
+	var to *uint16
+	flags := uintptr(moveFileDelayUntilReboot)
+	if dst != "" {
+		if to, err = syscall.UTF16PtrFromString(dst); err != nil {
+			return err
+		}
+		flags |= moveFileReplaceExisting
+	}
+
+	r1, _, err := moveFileEx.Call(uintptr(unsafe.Pointer(from)), uintptr(unsafe.Pointer(to)), flags)
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
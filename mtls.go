@@ -0,0 +1,32 @@
+package selfupdate
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// NewMTLSClient returns a copy of client, or of http.DefaultClient if nil, that present certs to update servers
+// requiring mutual TLS. Pass it to NewHTTPSource. It can be combined with NewPinnedClient.
+func NewMTLSClient(client *http.Client, certs ...tls.Certificate) (*http.Client, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("at least one client certificate is required")
+	}
+
+	c, transport, err := cloneClient(client)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig.Certificates = append(transport.TLSClientConfig.Certificates, certs...)
+	return c, nil
+}
+
+// NewMTLSClientFromFiles is like NewMTLSClient with a certificate and private key loaded from a pair of PEM files
+func NewMTLSClientFromFiles(client *http.Client, certFile, keyFile string) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client certificate: %s", err)
+	}
+	return NewMTLSClient(client, cert)
+}
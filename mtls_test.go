@@ -0,0 +1,74 @@
+package selfupdate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device-42"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestMTLSClient(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err := server.Client().Get(server.URL)
+	assert.NotNil(t, err)
+
+	certFile, keyFile := writeClientCertificate(t, t.TempDir())
+	client, err := NewMTLSClientFromFiles(server.Client(), certFile, keyFile)
+	assert.Nil(t, err)
+
+	source := NewHTTPSource(client, server.URL)
+	r, _, err := source.Get(&Version{})
+	if assert.Nil(t, err) {
+		defer r.Close()
+		b := make([]byte, 64)
+		n, _ := r.Read(b)
+		assert.Equal(t, "device-42", string(b[:n]))
+	}
+
+	// the original client is left untouched
+	assert.Empty(t, server.Client().Transport.(*http.Transport).TLSClientConfig.Certificates)
+
+	_, err = NewMTLSClient(nil)
+	assert.NotNil(t, err)
+	_, err = NewMTLSClientFromFiles(nil, keyFile, certFile)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,193 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// defaultParallelMinSize is the size under which downloads aren't split when no minimum is given
+const defaultParallelMinSize = 8 << 20
+
+// ParallelDownloads make Get split the download of executables of at least minSize bytes, or 8MiB if zero, in
+// that many ranged requests fetched concurrently, which is much faster from CDNs with a high latency. The executable is still
+// returned as a single stream, the chunks being kept in temporary files until their turn comes. It only applies
+// when the server accepts ranges, and not to downloads that can be resumed with ResumeDownloads.
+func (h *HTTPSource) ParallelDownloads(chunks int, minSize int64) {
+	if minSize <= 0 {
+		minSize = defaultParallelMinSize
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.chunks = chunks
+	h.chunksMinSize = minSize
+}
+
+// getParallel download url in chunks if the response to the first request show it is worth it and possible
+func (h *HTTPSource) getParallel(ctx context.Context, chunks int, minSize int64, url string) (io.ReadCloser, int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		cancel()
+		return nil, 0, fmt.Errorf("error creating request: %s", err)
+	}
+	// ranges must count the bytes of the file, not of a transparently decompressed response
+	request.Header.Set("Accept-Encoding", "identity")
+	response, err := h.client.Do(request)
+	if err != nil {
+		cancel()
+		return nil, 0, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	if err = checkStatus(url, response, http.StatusOK); err != nil {
+		cancel()
+		return nil, 0, err
+	}
+
+	length := response.ContentLength
+	if response.Header.Get("Accept-Ranges") != "bytes" || length < minSize {
+		return withFinalURL(&cancelReadCloser{ReadCloser: response.Body, cancel: cancel}, response), length, nil
+	}
+
+	if int64(chunks) > length {
+		chunks = int(length)
+	}
+	size := length / int64(chunks)
+	r := &chunkedReader{
+		current: io.LimitReader(response.Body, size),
+		first:   response.Body,
+		cancel:  cancel,
+	}
+	for i := 1; i < chunks; i++ {
+		start, end := int64(i)*size, int64(i+1)*size-1
+		if i == chunks-1 {
+			end = length - 1
+		}
+		c := &chunk{done: make(chan struct{})}
+		r.chunks = append(r.chunks, c)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer close(c.done)
+			c.file, c.err = h.getChunk(ctx, url, validator(response), start, end)
+		}()
+	}
+	logDebug("Downloading %s in %d chunks.\n", url, chunks)
+	return withFinalURL(r, response), length, nil
+}
+
+// getChunk download the bytes from start to end of url to a temporary file
+func (h *HTTPSource) getChunk(ctx context.Context, url string, ifRange string, start, end int64) (*os.File, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept-Encoding", "identity")
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if ifRange != "" {
+		request.Header.Set("If-Range", ifRange)
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading chunk at offset %d: %w", start, err)
+	}
+	if err = checkStatus(url, response, http.StatusPartialContent); err != nil {
+		return nil, fmt.Errorf("error downloading chunk at offset %d: %w", start, err)
+	}
+	defer response.Body.Close()
+
+	if got, err := rangeStart(response.Header.Get("Content-Range")); err != nil || got != start {
+		return nil, fmt.Errorf("error downloading chunk at offset %d: unexpected Content-Range %q", start, response.Header.Get("Content-Range"))
+	}
+
+	f, err := os.CreateTemp("", "selfupdate-chunk-*")
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, response.Body)
+	if err == nil && n != end-start+1 {
+		err = fmt.Errorf("received %d bytes instead of %d", n, end-start+1)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("error downloading chunk at offset %d: %w", start, err)
+	}
+	return f, nil
+}
+
+type chunk struct {
+	done chan struct{}
+	file *os.File
+	err  error
+}
+
+// chunkedReader returns the first chunk as it arrives, then every other chunk in order once it is downloaded
+type chunkedReader struct {
+	current io.Reader
+	first   io.Closer
+	chunks  []*chunk
+	next    int
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.current.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		if r.next == 0 {
+			// the first response would go on with the bytes of the other chunks
+			r.first.Close()
+		}
+		if r.next == len(r.chunks) {
+			return 0, io.EOF
+		}
+
+		c := r.chunks[r.next]
+		<-c.done
+		if c.err != nil {
+			return 0, c.err
+		}
+		r.next++
+		r.current = c.file
+	}
+}
+
+// Close will stop the download of the remaining chunks and remove the temporary files
+func (r *chunkedReader) Close() error {
+	r.cancel()
+	err := r.first.Close()
+	r.wg.Wait()
+	for _, c := range r.chunks {
+		if c.file != nil {
+			c.file.Close()
+			os.Remove(c.file.Name())
+		}
+	}
+	return err
+}
+
+// cancelReadCloser release the context of the request once its body is closed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,67 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceParallelDownloads(t *testing.T) {
+	content := make([]byte, 1000003)
+	_, err := rand.Read(content)
+	assert.Nil(t, err)
+
+	var lock sync.Mutex
+	var ranges []string
+	changed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		if changed && r.Header.Get("Range") != "" {
+			w.Header().Set("ETag", `"v2"`)
+		} else {
+			w.Header().Set("ETag", `"v1"`)
+		}
+		lock.Unlock()
+		http.ServeContent(w, r, "app", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	source.ParallelDownloads(4, 1000)
+
+	r, length, err := source.Get(&Version{})
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, int64(len(content)), length)
+	assert.True(t, bytes.Equal(content, b))
+	sort.Strings(ranges)
+	assert.Equal(t, []string{"", "bytes=250000-499999", "bytes=500000-749999", "bytes=750000-1000002"}, ranges)
+
+	// small downloads aren't split
+	ranges = nil
+	source.ParallelDownloads(4, 2000000)
+	b, _, err = readAll(t, source)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(content, b))
+	assert.Equal(t, []string{""}, ranges)
+
+	// a release changing during the download is detected
+	source.ParallelDownloads(4, 1000)
+	changed = true
+	r, _, err = source.Get(&Version{})
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.NotNil(t, err)
+	assert.Nil(t, r.Close())
+}
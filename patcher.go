@@ -1,7 +1,12 @@
 package selfupdate
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/Lamdt03/selfupdate/internal/binarydist"
 )
@@ -23,3 +28,46 @@ func (fn patchFn) Patch(old io.Reader, new io.Writer, patch io.Reader) error {
 func NewBSDiffPatcher() Patcher {
 	return patchFn(binarydist.Patch)
 }
+
+// NewXDeltaPatcher returns a new Patcher that applies VCDIFF patches, as produced by xdelta3, by running the
+// xdelta3 command. See http://xdelta.org/
+func NewXDeltaPatcher() Patcher {
+	return patchFn(func(old io.Reader, new io.Writer, patch io.Reader) error {
+		path, err := exec.LookPath("xdelta3")
+		if err != nil {
+			return fmt.Errorf("xdelta patcher not available: %w", err)
+		}
+
+		// xdelta3 seeks in the source, it has to be a file
+		source, ok := old.(*os.File)
+		if !ok {
+			if source, err = os.CreateTemp("", "selfupdate-source-*"); err != nil {
+				return err
+			}
+			defer os.Remove(source.Name())
+			defer source.Close()
+			if _, err = io.Copy(source, old); err != nil {
+				return err
+			}
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(path, "-d", "-c", "-s", source.Name())
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = patch, new, &stderr
+		if err = cmd.Run(); err != nil {
+			return fmt.Errorf("error applying xdelta patch: %s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	})
+}
+
+// patcherFor returns the Patcher of a patch format announced by a manifest, bsdiff if empty
+func patcherFor(format string) (Patcher, error) {
+	switch strings.ToLower(format) {
+	case "", "bsdiff":
+		return NewBSDiffPatcher(), nil
+	case "xdelta", "xdelta3", "vcdiff":
+		return NewXDeltaPatcher(), nil
+	}
+	return nil, fmt.Errorf("unsupported patch format %q", format)
+}
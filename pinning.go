@@ -0,0 +1,135 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const pinPrefix = "sha256/"
+
+// ErrPinMismatch is returned when the certificate chain of the update server doesn't match any pin
+var ErrPinMismatch = errors.New("update server certificate doesn't match any pin")
+
+// ParsePin decode a pin in the "sha256/<base64>" format used by HPKP and curl --pinnedpubkey
+func ParsePin(pin string) ([]byte, error) {
+	if !strings.HasPrefix(pin, pinPrefix) {
+		return nil, fmt.Errorf("pin %q must start with %s", pin, pinPrefix)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, pinPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pin %q: %s", pin, err)
+	}
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("pin %q must be a SHA-256 digest", pin)
+	}
+	return digest, nil
+}
+
+// Pin returns the pin of the public key of cert, in the format accepted by NewPinnedClient
+func Pin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// NewPinnedClient returns a copy of client, or of http.DefaultClient if nil, that only accept connections to
+// servers whose verified certificate chain contains a public key or a certificate matching one of pins, so that
+// a compromised CA can't be used to serve malicious manifests. Pins are "sha256/<base64>" digests of a
+// SubjectPublicKeyInfo, as returned by Pin, or of a DER certificate. Give a backup pin, for example of a key
+// kept offline, to be able to replace the server key without breaking clients.
+func NewPinnedClient(client *http.Client, pins ...string) (*http.Client, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("at least one pin is required")
+	}
+	var digests [][]byte
+	for _, pin := range pins {
+		digest, err := ParsePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	if len(pins) == 1 {
+		logInfo("Only one TLS pin configured, a backup pin is recommended.\n")
+	}
+
+	pinned, transport, err := cloneClient(client)
+	if err != nil {
+		return nil, err
+	}
+	verify := transport.TLSClientConfig.VerifyConnection
+	transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		return checkPins(cs, digests)
+	}
+	return pinned, nil
+}
+
+func checkPins(cs tls.ConnectionState, digests [][]byte) error {
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		// verification is disabled, pins are then the only thing that authenticate the server
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			der := sha256.Sum256(cert.Raw)
+			for _, digest := range digests {
+				if bytes.Equal(digest, spki[:]) || bytes.Equal(digest, der[:]) {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrPinMismatch
+}
+
+// cloneClient returns a copy of client, or of http.DefaultClient if nil, with its own *http.Transport and
+// tls.Config that can be modified
+func cloneClient(client *http.Client) (*http.Client, *http.Transport, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var transport *http.Transport
+	var wrappers []wrappingTransport
+	wrapped := client.Transport
+	for {
+		w, ok := wrapped.(wrappingTransport)
+		if !ok {
+			break
+		}
+		wrappers = append(wrappers, w)
+		wrapped = w.unwrap()
+	}
+	switch t := wrapped.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, nil, fmt.Errorf("unsupported client transport %T", wrapped)
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	c := *client
+	c.Transport = transport
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		c.Transport = wrappers[i].rewrap(c.Transport)
+	}
+	return &c, transport, nil
+}
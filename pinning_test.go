@@ -0,0 +1,58 @@
+package selfupdate
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(newFile)
+	}))
+	defer server.Close()
+
+	cert := server.Certificate()
+	spkiPin := Pin(cert)
+	certDigest := sha256.Sum256(cert.Raw)
+	certPin := "sha256/" + base64.StdEncoding.EncodeToString(certDigest[:])
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for _, c := range []struct {
+		pins  []string
+		valid bool
+	}{
+		{[]string{spkiPin}, true},
+		{[]string{certPin}, true},
+		{[]string{otherPin, spkiPin}, true},
+		{[]string{otherPin}, false},
+	} {
+		client, err := NewPinnedClient(server.Client(), c.pins...)
+		assert.Nil(t, err)
+
+		resp, err := client.Get(server.URL)
+		if c.valid {
+			assert.Nil(t, err, c.pins)
+			resp.Body.Close()
+		} else {
+			assert.True(t, errors.Is(err, ErrPinMismatch), err)
+		}
+	}
+
+	// the original client is left untouched
+	resp, err := server.Client().Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	_, err = NewPinnedClient(nil)
+	assert.NotNil(t, err)
+	_, err = NewPinnedClient(nil, "md5/abcd")
+	assert.NotNil(t, err)
+	_, err = NewPinnedClient(nil, "sha256/abcd")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,221 @@
+package selfupdate
+
+import (
+	"debug/elf"
+	"io"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/cpu"
+)
+
+// cpuVariant define the CPU feature level of the running CPU, with GOARM on arm and GOAMD64 on amd64. Releases
+// built for the same or a lower level are safe to install.
+type cpuVariant struct {
+	ARMVersion string // GOARM, like "6" or "7", empty on other architectures
+	AMD64Level string // GOAMD64, like "v1" or "v3", empty on other architectures
+}
+
+// runningVariant is the CPU variant of the running executable
+var runningVariant = readCPUVariant()
+
+// translated is true when the running executable is translated by Rosetta, the host can then run arm64 natively
+var translated = underRosetta()
+
+// readCPUVariant returns the highest CPU variant the features of the running CPU support. The running executable
+// works on this CPU, so the level recorded in its build information is kept if the features report a lower one.
+func readCPUVariant() cpuVariant {
+	v := detectCPUVariant()
+	if v.ARMVersion == "" && v.AMD64Level == "" {
+		return v
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "GOARM" && v.ARMVersion != "":
+			if built := strings.SplitN(s.Value, ",", 2)[0]; variantLevel(built) > variantLevel(v.ARMVersion) {
+				v.ARMVersion = built
+			}
+		case s.Key == "GOAMD64" && v.AMD64Level != "":
+			if variantLevel(s.Value) > variantLevel(v.AMD64Level) {
+				v.AMD64Level = s.Value
+			}
+		}
+	}
+	return v
+}
+
+// detectCPUVariant returns the highest GOARM or GOAMD64 level whose required CPU features are all present
+func detectCPUVariant() cpuVariant {
+	var v cpuVariant
+	switch runtime.GOARCH {
+	case "arm":
+		v.ARMVersion = armVersion(cpu.ARM.HasVFP, cpu.ARM.HasVFPv3)
+	case "amd64":
+		v.AMD64Level = amd64Level(cpu.X86.HasCX16 && cpu.X86.HasPOPCNT && cpu.X86.HasSSE3 && cpu.X86.HasSSSE3 && cpu.X86.HasSSE41 && cpu.X86.HasSSE42,
+			cpu.X86.HasAVX && cpu.X86.HasAVX2 && cpu.X86.HasBMI1 && cpu.X86.HasBMI2 && cpu.X86.HasFMA && cpu.X86.HasOSXSAVE,
+			cpu.X86.HasAVX512F && cpu.X86.HasAVX512BW && cpu.X86.HasAVX512CD && cpu.X86.HasAVX512DQ && cpu.X86.HasAVX512VL)
+	}
+	return v
+}
+
+// armVersion returns the GOARM level of a CPU: 6 requires VFP, 7 requires VFPv3, like the Go runtime checks
+func armVersion(vfp, vfpv3 bool) string {
+	switch {
+	case vfp && vfpv3:
+		return "7"
+	case vfp:
+		return "6"
+	}
+	return "5"
+}
+
+// amd64Level returns the GOAMD64 level of a CPU from the support of the features of each microarchitecture level,
+// a level requires all the lower ones
+func amd64Level(v2, v3, v4 bool) string {
+	switch {
+	case v2 && v3 && v4:
+		return "v4"
+	case v2 && v3:
+		return "v3"
+	case v2:
+		return "v2"
+	}
+	return "v1"
+}
+
+var (
+	libcOnce sync.Once
+	libc     string
+)
+
+// runningLibc returns the C library, "musl" or "glibc", the running executable or the host expect on Linux, an
+// empty string on other OS
+func runningLibc() string {
+	libcOnce.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		exe, err := ExecutableRealPath()
+		if err != nil {
+			exe = ""
+		}
+		libc = detectLibc(exe, "/lib")
+	})
+	return libc
+}
+
+// detectLibc returns the C library of the dynamic loader requested by the ELF executable exe. A static executable
+// doesn't request any, it then returns the C library of the host, musl if libDir contains its loader like on Alpine.
+func detectLibc(exe string, libDir string) string {
+	if f, err := elf.Open(exe); err == nil {
+		defer f.Close()
+		for _, p := range f.Progs {
+			if p.Type != elf.PT_INTERP {
+				continue
+			}
+			interp, err := io.ReadAll(p.Open())
+			if err != nil {
+				break
+			}
+			if strings.Contains(string(interp), "musl") {
+				return "musl"
+			}
+			return "glibc"
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(libDir, "ld-musl-*.so.1")); len(matches) > 0 {
+		return "musl"
+	}
+	return "glibc"
+}
+
+// variantLevel returns the numeric level of a GOARM or GOAMD64 value, -1 if it can't be parsed
+func variantLevel(value string) int {
+	level, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(value), "v"))
+	if err != nil {
+		return -1
+	}
+	return level
+}
+
+// supports report if a CPU running variant can run a release built for the level required, an empty requirement
+// is met by every CPU
+func supports(running string, required string) bool {
+	if required == "" {
+		return true
+	}
+	level := variantLevel(required)
+	return level >= 0 && level <= variantLevel(running)
+}
+
+// forPlatform report if the manifest entry a can run on this platform: it must be for the running OS and, if it
+// declares one, for the running architecture. Entries without an arch are assumed to run on every architecture.
+// Entries declaring a goarm or goamd64 level must not require more than the running executable was built for, and
+// those declaring a libc must match the one of the running executable. On macOS, universal entries run on every
+// architecture and arm64 ones also run when the running executable is translated by Rosetta.
+func forPlatform(a *appVersion) bool {
+	if a.OS != runtime.GOOS {
+		return false
+	}
+	arch := a.Arch
+	switch {
+	case arch == "" || a.Universal && runtime.GOOS == "darwin":
+		arch = runtime.GOARCH
+	case arch == "arm64" && translated:
+		return true
+	case arch != runtime.GOARCH:
+		return false
+	}
+	if a.Libc != "" && a.Libc != runningLibc() {
+		return false
+	}
+	switch arch {
+	case "arm":
+		return supports(runningVariant.ARMVersion, a.GOARM)
+	case "amd64":
+		return supports(runningVariant.AMD64Level, a.GOAMD64)
+	}
+	return true
+}
+
+// native report if the manifest entry a runs natively, rather than translated by Rosetta
+func native(a *appVersion) bool {
+	return !translated || a.Universal || a.Arch == "arm64"
+}
+
+// betterBuild report if a is a build of the same version as selected that should be preferred to it, whatever the
+// order of the manifest: under Rosetta, universal and arm64 builds run natively and replace the x86_64 one, then
+// the build for the highest CPU variant wins. Both are expected to run on this platform, see forPlatform.
+func betterBuild(a *appVersion, selected *appVersion) bool {
+	if selected == nil || strings.TrimSpace(a.Version) != strings.TrimSpace(selected.Version) {
+		return false
+	}
+	if native(a) != native(selected) {
+		return native(a)
+	}
+	return variantRank(a) > variantRank(selected)
+}
+
+// variantRank returns the CPU variant level the manifest entry a is built for on the running architecture, -1 for
+// entries that don't declare one
+func variantRank(a *appVersion) int {
+	switch runtime.GOARCH {
+	case "arm":
+		if a.GOARM != "" {
+			return variantLevel(a.GOARM)
+		}
+	case "amd64":
+		if a.GOAMD64 != "" {
+			return variantLevel(a.GOAMD64)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,215 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceArch(t *testing.T) {
+	other := "amd64"
+	if runtime.GOARCH == other {
+		other = "arm64"
+	}
+	manifest := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, manifest)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL)
+	manifest = fmt.Sprintf(`[
+		{"os":%[1]q,"arch":%[2]q,"version":"1.2.0","download_url":"%[4]s/other"},
+		{"os":%[1]q,"arch":%[3]q,"version":"1.2.0","download_url":"%[4]s/native"}
+	]`, runtime.GOOS, other, runtime.GOARCH, server.URL)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+	assert.Equal(t, server.URL+"/native", source.(*HTTPSource).resolve(v))
+
+	manifest = fmt.Sprintf(`[
+		{"os":%[1]q,"arch":%[2]q,"version":"1.3.0"},
+		{"os":%[1]q,"version":"1.2.0"}
+	]`, runtime.GOOS, other)
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+
+	manifest = fmt.Sprintf(`[{"os":%q,"arch":%q,"version":"1.3.0"}]`, runtime.GOOS, other)
+	_, err = source.LatestVersion()
+	assert.NotNil(t, err)
+}
+
+func TestForPlatformVariant(t *testing.T) {
+	defer func(v cpuVariant) { runningVariant = v }(runningVariant)
+
+	for _, c := range []struct {
+		arch     string
+		running  cpuVariant
+		entry    appVersion
+		expected bool
+	}{
+		{"arm", cpuVariant{ARMVersion: "6"}, appVersion{GOARM: "7"}, false},
+		{"arm", cpuVariant{ARMVersion: "7"}, appVersion{GOARM: "6"}, true},
+		{"arm", cpuVariant{ARMVersion: "7"}, appVersion{GOARM: "7"}, true},
+		{"arm", cpuVariant{ARMVersion: "6"}, appVersion{}, true},
+		{"amd64", cpuVariant{AMD64Level: "v1"}, appVersion{GOAMD64: "v3"}, false},
+		{"amd64", cpuVariant{AMD64Level: "v3"}, appVersion{GOAMD64: "v2"}, true},
+		{"amd64", cpuVariant{AMD64Level: "v3"}, appVersion{GOAMD64: "avx2"}, false},
+		{"amd64", cpuVariant{AMD64Level: "v1"}, appVersion{}, true},
+	} {
+		if c.arch != runtime.GOARCH {
+			continue
+		}
+		runningVariant = c.running
+		c.entry.OS = runtime.GOOS
+		assert.Equal(t, c.expected, forPlatform(&c.entry), c.entry)
+	}
+
+	assert.True(t, supports("7", "6"))
+	assert.False(t, supports("6", "7"))
+	assert.True(t, supports("v3", "v3"))
+	assert.False(t, supports("v1", "v2"))
+	assert.False(t, supports("", "v2"))
+}
+
+func TestExpandURLTemplateVariant(t *testing.T) {
+	defer func(v cpuVariant) { runningVariant = v }(runningVariant)
+
+	runningVariant = cpuVariant{ARMVersion: "6", AMD64Level: "v3"}
+	assert.Equal(t, "myapp-6-v3", expandURLTemplate("myapp-{{.ARMVersion}}-{{.AMD64Level}}", nil))
+}
+
+func TestDetectLibc(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "static")
+	assert.Nil(t, os.WriteFile(exe, []byte("not an elf executable"), 0755))
+
+	libDir := filepath.Join(dir, "lib")
+	assert.Nil(t, os.Mkdir(libDir, 0755))
+	assert.Equal(t, "glibc", detectLibc(exe, libDir))
+	assert.Nil(t, os.WriteFile(filepath.Join(libDir, "ld-musl-x86_64.so.1"), nil, 0755))
+	assert.Equal(t, "musl", detectLibc(exe, libDir))
+}
+
+func TestForPlatformLibc(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("libc is only matched on linux")
+	}
+	running := runningLibc()
+	defer func() { libc = running }()
+
+	libc = "musl"
+	assert.True(t, forPlatform(&appVersion{OS: runtime.GOOS, Libc: "musl"}))
+	assert.False(t, forPlatform(&appVersion{OS: runtime.GOOS, Libc: "glibc"}))
+	assert.True(t, forPlatform(&appVersion{OS: runtime.GOOS}))
+	assert.Equal(t, "myapp-musl", expandURLTemplate("myapp-{{.Libc}}", nil))
+}
+
+func TestHTTPSourceRosetta(t *testing.T) {
+	if runtime.GOOS != "darwin" || runtime.GOARCH != "amd64" {
+		t.Skip("Rosetta only translates x86_64 executables on macOS")
+	}
+	defer func(v bool) { translated = v }(translated)
+
+	var base string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":"darwin","arch":"amd64","version":"1.2.0","download_url":"%[1]s/amd64"},
+			{"os":"darwin","arch":"arm64","version":"1.2.0","download_url":"%[1]s/arm64"}
+		]`, base)
+	}))
+	defer server.Close()
+	base = server.URL
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+
+	translated = false
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, base+"/amd64", source.resolve(v))
+
+	translated = true
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, base+"/arm64", source.resolve(v))
+}
+
+func TestBetterBuild(t *testing.T) {
+	defer func(v bool) { translated = v }(translated)
+
+	intel := &appVersion{Version: "1.2.0", Arch: "amd64"}
+	universal := &appVersion{Version: "1.2.0", Universal: true}
+	translated = false
+	assert.False(t, betterBuild(universal, intel))
+	translated = true
+	assert.True(t, betterBuild(universal, intel))
+	assert.True(t, betterBuild(&appVersion{Version: "1.2.0", Arch: "arm64"}, intel))
+	assert.False(t, betterBuild(intel, universal))
+	assert.False(t, betterBuild(&appVersion{Version: "1.1.0", Arch: "arm64"}, intel))
+	assert.False(t, betterBuild(universal, nil))
+
+	// the build for the highest CPU variant wins, whatever the order of the manifest
+	translated = false
+	switch runtime.GOARCH {
+	case "amd64":
+		assert.True(t, betterBuild(&appVersion{Version: "1.2.0", GOAMD64: "v3"}, &appVersion{Version: "1.2.0", GOAMD64: "v2"}))
+		assert.False(t, betterBuild(&appVersion{Version: "1.2.0", GOAMD64: "v2"}, &appVersion{Version: "1.2.0", GOAMD64: "v3"}))
+		assert.True(t, betterBuild(&appVersion{Version: "1.2.0", GOAMD64: "v1"}, intel))
+	case "arm":
+		assert.True(t, betterBuild(&appVersion{Version: "1.2.0", GOARM: "7"}, &appVersion{Version: "1.2.0", GOARM: "6"}))
+		assert.False(t, betterBuild(&appVersion{Version: "1.2.0", GOARM: "6"}, &appVersion{Version: "1.2.0", GOARM: "7"}))
+	}
+}
+
+func TestDetectCPUVariant(t *testing.T) {
+	assert.Equal(t, "5", armVersion(false, false))
+	assert.Equal(t, "6", armVersion(true, false))
+	assert.Equal(t, "7", armVersion(true, true))
+	assert.Equal(t, "v1", amd64Level(false, true, true))
+	assert.Equal(t, "v2", amd64Level(true, false, true))
+	assert.Equal(t, "v3", amd64Level(true, true, false))
+	assert.Equal(t, "v4", amd64Level(true, true, true))
+
+	// the running executable works on this CPU, which supports at least the level it was built for
+	v := readCPUVariant()
+	switch runtime.GOARCH {
+	case "amd64":
+		assert.True(t, variantLevel(v.AMD64Level) >= variantLevel(detectCPUVariant().AMD64Level))
+		assert.True(t, variantLevel(v.AMD64Level) >= 1)
+	case "arm":
+		assert.True(t, variantLevel(v.ARMVersion) >= 5)
+	default:
+		assert.Equal(t, cpuVariant{}, v)
+	}
+}
+
+func TestHTTPSourceHighestVariant(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("GOAMD64 variants only apply to amd64")
+	}
+	defer func(v cpuVariant) { runningVariant = v }(runningVariant)
+	runningVariant = cpuVariant{AMD64Level: "v3"}
+
+	var base string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"arch":"amd64","goamd64":"v2","version":"1.2.0","download_url":"%[2]s/v2"},
+			{"os":%[1]q,"arch":"amd64","goamd64":"v4","version":"1.2.0","download_url":"%[2]s/v4"},
+			{"os":%[1]q,"arch":"amd64","goamd64":"v3","version":"1.2.0","download_url":"%[2]s/v3"},
+			{"os":%[1]q,"arch":"amd64","version":"1.2.0","download_url":"%[2]s/v1"}
+		]`, runtime.GOOS, base)
+	}))
+	defer server.Close()
+	base = server.URL
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, base+"/v3", source.resolve(v))
+}
@@ -0,0 +1,169 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var policyTimeout = 10 * time.Second // maximum time a CommandPolicy can take to decide
+var policyMaxOutput = 64 << 10       // maximum length of the decision written by a CommandPolicy
+
+// PolicyInput is what an UpdatePolicy decide from
+type PolicyInput struct {
+	Current     string            `json:"current"`               // Version currently running
+	Candidate   string            `json:"candidate"`             // Latest version announced by the Source
+	Yanked      bool              `json:"yanked"`                // The current version has been yanked
+	Channel     string            `json:"channel,omitempty"`     // Release channel of the candidate, from the manifest
+	Criticality string            `json:"criticality,omitempty"` // How important installing the candidate is, from the manifest
+	Mandatory   bool              `json:"mandatory,omitempty"`   // The candidate is marked mandatory in the manifest
+	Size        int64             `json:"size,omitempty"`        // Length of the executable of the candidate, if the manifest announce it
+	Released    *time.Time        `json:"released,omitempty"`    // When the candidate was published, if the manifest announce it
+	OS          string            `json:"os"`                    // runtime.GOOS
+	Arch        string            `json:"arch"`                  // runtime.GOARCH
+	Facts       map[string]string `json:"facts"`                 // Local facts from Config.PolicyFacts, like the role or site of the device
+	Now         time.Time         `json:"now"`
+}
+
+// PolicyDecision is the answer of an UpdatePolicy
+type PolicyDecision struct {
+	Allow     bool      `json:"allow"`                // The candidate version can be installed
+	Reason    string    `json:"reason,omitempty"`     // Logged when the update is refused or delayed
+	NotBefore time.Time `json:"not_before,omitempty"` // If set in the future, the update is delayed until a check after that time
+}
+
+// UpdatePolicy define an interface to decide if and when an available update is applied, so operators can
+// implement custom fleet policies without forking the library
+type UpdatePolicy interface {
+	Decide(*PolicyInput) (*PolicyDecision, error)
+}
+
+type policyFn func(*PolicyInput) (*PolicyDecision, error)
+
+// Decide will call the policyFn function to satisfy an UpdatePolicy interface
+func (fn policyFn) Decide(input *PolicyInput) (*PolicyDecision, error) {
+	return fn(input)
+}
+
+// NewPolicy returns an UpdatePolicy calling decide. This is how a policy is evaluated in process: the library
+// doesn't embed a WASM runtime or a starlark interpreter, an application wanting one calls it from decide, so
+// that it alone pays for the dependency.
+func NewPolicy(decide func(*PolicyInput) (*PolicyDecision, error)) UpdatePolicy {
+	return policyFn(decide)
+}
+
+// NewCommandPolicy returns an UpdatePolicy that run the policy module supplied by the operator in the evaluator
+// name, which must decide within 10 seconds. The PolicyInput is written as JSON on its standard input and a
+// PolicyDecision of at most 64 KiB is expected as JSON on its standard output. The evaluator runs with an empty
+// environment, in an empty temporary directory removed once it decided.
+//
+// The sandbox is the evaluator's: a WASI module run with NewCommandPolicy("wasmtime", "run", "policy.wasm") has no
+// access to the filesystem, the network or the environment, as no directory or socket is granted to it, and a
+// starlark script run with NewCommandPolicy("starlark", "policy.star") can only compute. The library doesn't
+// confine the process itself, so name must be an evaluator trusted like the application, never a command taken
+// from the manifest or another untrusted input. To evaluate in process instead, see NewPolicy.
+func NewCommandPolicy(name string, args ...string) UpdatePolicy {
+	return policyFn(func(input *PolicyInput) (*PolicyDecision, error) {
+		in, err := json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), policyTimeout)
+		defer cancel()
+
+		dir, err := os.MkdirTemp("", "selfupdate-policy-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		stdout := &limitedBuffer{limit: policyMaxOutput}
+		stderr := &limitedBuffer{limit: policyMaxOutput}
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		cmd.Env = []string{}
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err = cmd.Run(); err != nil {
+			return nil, fmt.Errorf("error running policy %s: %s %s", name, err, strings.TrimSpace(stderr.String()))
+		}
+		if stdout.truncated {
+			return nil, fmt.Errorf("invalid decision from policy %s: longer than %d bytes", name, policyMaxOutput)
+		}
+
+		var decision PolicyDecision
+		if err = json.Unmarshal(stdout.Bytes(), &decision); err != nil {
+			return nil, fmt.Errorf("invalid decision from policy %s: %s", name, err)
+		}
+		return &decision, nil
+	})
+}
+
+// limitedBuffer keep at most limit bytes written to it, and discard the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:room])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// allowedByPolicy ask the configured policy if candidate can be installed now
+func allowedByPolicy(conf *Config, current string, candidate *Version, yanked bool) (bool, error) {
+	if conf.Policy == nil {
+		return true, nil
+	}
+
+	input := &PolicyInput{
+		Current:     current,
+		Candidate:   candidate.Number,
+		Yanked:      yanked,
+		Channel:     candidate.Channel,
+		Criticality: candidate.Criticality,
+		Mandatory:   candidate.Mandatory,
+		Size:        candidate.Size,
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Facts:       conf.PolicyFacts,
+		Now:         time.Now(),
+	}
+	if released := candidate.Date; !released.IsZero() {
+		input.Released = &released
+	}
+	decision, err := conf.Policy.Decide(input)
+	if err != nil {
+		return false, fmt.Errorf("update policy: %w", err)
+	}
+	if !decision.Allow {
+		logInfo("Update to %s refused by policy: %s\n", candidate.Number, decision.Reason)
+		return false, nil
+	}
+	if decision.NotBefore.After(input.Now) {
+		logInfo("Update to %s delayed by policy until %s: %s\n", candidate.Number, decision.NotBefore, decision.Reason)
+		return false, nil
+	}
+	return true, nil
+}
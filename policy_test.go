@@ -0,0 +1,128 @@
+package selfupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperPolicy is run as the policy module by TestCommandPolicy
+func TestHelperPolicy(t *testing.T) {
+	args := flag.Args()
+	if len(args) == 0 || args[0] != "policy" {
+		return
+	}
+
+	// the policy runs with an empty environment, in an empty directory
+	entries, err := os.ReadDir(".")
+	if len(os.Environ()) != 0 || err != nil || len(entries) != 0 {
+		os.Exit(3)
+	}
+
+	var input PolicyInput
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		os.Exit(2)
+	}
+	if len(args) > 1 && args[1] == "verbose" {
+		os.Stdout.Write(bytes.Repeat([]byte(" "), policyMaxOutput))
+	}
+	decision := PolicyDecision{Allow: input.Facts["ring"] == "canary", Reason: "only canary devices"}
+	json.NewEncoder(os.Stdout).Encode(decision)
+	os.Exit(0)
+}
+
+func TestCommandPolicy(t *testing.T) {
+	policy := NewCommandPolicy(os.Args[0], "-test.run=TestHelperPolicy", "--", "policy")
+
+	decision, err := policy.Decide(&PolicyInput{Current: "1.0.0", Candidate: "1.1.0", Facts: map[string]string{"ring": "canary"}})
+	assert.Nil(t, err)
+	assert.True(t, decision.Allow)
+
+	decision, err = policy.Decide(&PolicyInput{Current: "1.0.0", Candidate: "1.1.0"})
+	assert.Nil(t, err)
+	assert.False(t, decision.Allow)
+	assert.Equal(t, "only canary devices", decision.Reason)
+
+	_, err = NewCommandPolicy(os.Args[0] + "-missing").Decide(&PolicyInput{})
+	assert.NotNil(t, err)
+
+	_, err = NewCommandPolicy(os.Args[0], "-test.run=TestHelperPolicy", "--", "policy", "verbose").Decide(&PolicyInput{})
+	assert.NotNil(t, err)
+}
+
+func TestCheckNowPolicy(t *testing.T) {
+	server := yankServer()
+	defer server.Close()
+
+	var decision *PolicyDecision
+	var input *PolicyInput
+	asked := false
+	u := &Updater{conf: &Config{
+		Current:      &Version{Number: "1.0.0"},
+		Source:       NewHTTPSource(nil, server.URL),
+		VersionStore: &memoryVersionStore{},
+		Policy: NewPolicy(func(i *PolicyInput) (*PolicyDecision, error) {
+			input = i
+			if decision == nil {
+				return nil, errors.New("policy failure")
+			}
+			return decision, nil
+		}),
+		PolicyFacts:            map[string]string{"site": "lab"},
+		UpgradeConfirmCallback: func(string) bool { asked = true; return false },
+	}}
+
+	assert.NotNil(t, u.CheckNow())
+	assert.Equal(t, "1.1.0", input.Candidate)
+	assert.Equal(t, "lab", input.Facts["site"])
+
+	for _, c := range []struct {
+		decision PolicyDecision
+		asked    bool
+	}{
+		{PolicyDecision{Allow: false}, false},
+		{PolicyDecision{Allow: true, NotBefore: time.Now().Add(time.Hour)}, false},
+		{PolicyDecision{Allow: true, NotBefore: time.Now().Add(-time.Hour)}, true},
+		{PolicyDecision{Allow: true}, true},
+	} {
+		asked = false
+		decision = &c.decision
+		assert.Nil(t, u.CheckNow())
+		assert.Equal(t, c.asked, asked, c.decision)
+	}
+}
+
+func TestPolicyInputManifest(t *testing.T) {
+	var input *PolicyInput
+	conf := &Config{Policy: NewPolicy(func(i *PolicyInput) (*PolicyDecision, error) {
+		input = i
+		return &PolicyDecision{Allow: i.Criticality == "security"}, nil
+	})}
+
+	released := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	candidate := &Version{Number: "1.1.0", Channel: "beta", Criticality: "security", Mandatory: true, Size: 1024, Date: released}
+	allowed, err := allowedByPolicy(conf, "1.0.0", candidate, false)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, &PolicyInput{Current: "1.0.0", Candidate: "1.1.0", Channel: "beta", Criticality: "security", Mandatory: true,
+		Size: 1024, Released: &released, OS: input.OS, Arch: input.Arch, Now: input.Now}, input)
+
+	in, err := json.Marshal(input)
+	assert.Nil(t, err)
+	assert.Contains(t, string(in), `"released":"2024-03-01T00:00:00Z"`)
+
+	candidate.Criticality = "low"
+	candidate.Date = time.Time{}
+	allowed, err = allowedByPolicy(conf, "1.0.0", candidate, false)
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+	in, err = json.Marshal(input)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(in), "released")
+}
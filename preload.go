@@ -0,0 +1,149 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// urlResolver is implemented by sources downloading the executable of a version from a URL
+type urlResolver interface {
+	resolve(v *Version) string
+}
+
+// PreloadArtifact copy the executable at path, pushed to the device out of band (rsync, USB, a peer), in the
+// preload directory so the next update to version is applied from it instead of being downloaded. The artifact
+// is verified like a download when the update is applied, with signatures still fetched from the Source, and is
+// discarded after that. If version announces a digest, the artifact is also checked right away.
+func (u *Updater) PreloadArtifact(path string, version *Version) error {
+	conf := u.config()
+	dest, err := preloadPath(conf, version)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".new"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if version.Digest != nil {
+		if !version.DigestHash.Available() {
+			f.Close()
+			os.Remove(tmp)
+			return errors.New("requested hash function not available")
+		}
+		hash := version.DigestHash.New()
+		_, err = io.Copy(io.MultiWriter(f, hash), src)
+		if sum := hash.Sum(nil); err == nil && !bytes.Equal(sum, version.Digest) {
+			err = fmt.Errorf("preloaded file has wrong checksum. Expected: %x, got: %x", version.Digest, sum)
+		}
+	} else {
+		_, err = io.Copy(f, src)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// preloadDir returns the directory preloaded artifacts are kept in, by default a directory named after the
+// executable in the user cache directory
+func preloadDir(conf *Config) (string, error) {
+	if conf.PreloadDir != "" {
+		return conf.PreloadDir, nil
+	}
+	return cacheDir("preload")
+}
+
+// cacheDir returns the directory named after the executable in the kind directory of the user cache directory
+func cacheDir(kind string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	exe, err := ExecutableRealPath()
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(exe), filepath.Ext(exe))
+	return filepath.Join(cache, "selfupdate", kind, name), nil
+}
+
+// preloadPath returns where the artifact preloaded for v is kept
+func preloadPath(conf *Config, v *Version) (string, error) {
+	if v == nil || v.Number == "" || v.Number == "." || v.Number == ".." || strings.ContainsAny(v.Number, `/\`) {
+		return "", fmt.Errorf("a valid version number is required to preload an artifact")
+	}
+	dir, err := preloadDir(conf)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, v.Number), nil
+}
+
+// getArtifact returns the artifact preloaded for v if there is one, or its cached download, or start its download
+// from the Source
+func getArtifact(ctx context.Context, conf *Config, v *Version) (io.ReadCloser, int64, error) {
+	if path, err := preloadPath(conf, v); err == nil {
+		if f, err := os.Open(path); err == nil {
+			info, err := f.Stat()
+			if err == nil {
+				logInfo("Using the preloaded artifact for version %s.\n", v.Number)
+				return newContextReader(ctx, f), info.Size(), nil
+			}
+			f.Close()
+		}
+	}
+	if r, size, ok := getCached(ctx, conf, v); ok {
+		return r, size, nil
+	}
+	ctx, cancel := withTimeout(ctx, conf.DownloadTimeout)
+	r, size, err := getExecutable(ctx, conf.Source, v)
+	if err != nil {
+		cancel()
+		return nil, 0, err
+	}
+	logFinalURL(r, v)
+	if size < 0 && v.Size > 0 {
+		// chunked responses, or those of some CDNs, don't announce their length, the manifest still does
+		size = v.Size
+	}
+	return cacheDownload(conf, v, &struct {
+		io.Reader
+		io.Closer
+	}{r, cancelCloser{r, cancel}}), size, nil
+}
+
+// discardPreloaded remove the artifact preloaded for v once it has been applied, or failed to
+func discardPreloaded(conf *Config, v *Version) {
+	path, err := preloadPath(conf, v)
+	if err != nil {
+		return
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logError("Unable to remove the preloaded artifact for version %s: %v\n", v.Number, err)
+	}
+}
@@ -0,0 +1,118 @@
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreloadArtifact(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	downloads := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"%s/app-{{.Version}}","version":"1.1.0"}]`, runtime.GOOS, server.URL)
+		case "/app-1.1.0":
+			downloads++
+			w.Write(newFile)
+		case "/app-1.1.0.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "pushed")
+	assert.Nil(t, os.WriteFile(artifact, newFile, 0644))
+
+	conf := &Config{
+		Source:       NewHTTPSource(nil, server.URL+"/manifest"),
+		PublicKey:    pub,
+		VersionStore: &memoryVersionStore{},
+		PreloadDir:   filepath.Join(dir, "preload"),
+	}
+	u := &Updater{conf: conf}
+
+	digest := sha256.Sum256(oldFile)
+	err = u.PreloadArtifact(artifact, &Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: digest[:]})
+	assert.NotNil(t, err)
+	assert.NotNil(t, u.PreloadArtifact(artifact, &Version{Number: "../1.1.0"}))
+	_, err = os.Stat(filepath.Join(dir, "preload", "1.1.0"))
+	assert.True(t, os.IsNotExist(err))
+
+	digest = sha256.Sum256(newFile)
+	assert.Nil(t, u.PreloadArtifact(artifact, &Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: digest[:]}))
+
+	// Download use the preloaded artifact too
+	r, size, err := u.Download(&Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(newFile)), size)
+	content, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	r.Close()
+
+	target := filepath.Join(dir, "app")
+	assert.Nil(t, Recover(conf, target))
+	content, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, 0, downloads)
+	_, err = os.Stat(filepath.Join(dir, "preload", "1.1.0"))
+	assert.True(t, os.IsNotExist(err))
+
+	// once applied, the next update is downloaded again
+	assert.Nil(t, Recover(conf, target))
+	assert.Equal(t, 1, downloads)
+}
+
+func TestPreloadArtifactVerified(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0"}]`, runtime.GOOS)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "pushed")
+	assert.Nil(t, os.WriteFile(artifact, oldFile, 0644))
+
+	conf := &Config{
+		Source:       NewChainedSource(NewHTTPSource(nil, server.URL+"/manifest"), NewHTTPSource(nil, server.URL+"/app")),
+		PublicKey:    pub,
+		VersionStore: &memoryVersionStore{},
+		PreloadDir:   filepath.Join(dir, "preload"),
+	}
+	assert.Nil(t, (&Updater{conf: conf}).PreloadArtifact(artifact, &Version{Number: "1.1.0"}))
+
+	// an artifact that isn't signed isn't installed, and is discarded
+	target := filepath.Join(dir, "app")
+	assert.NotNil(t, Recover(conf, target))
+	_, err = os.Stat(filepath.Join(dir, "preload", "1.1.0"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,31 @@
+package selfupdate
+
+import (
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// isPrerelease report if version is a semver prerelease, like 1.2.0-rc.1 or 1.2.0-beta
+func isPrerelease(version string) bool {
+	v, err := semver.NewVersion(strings.TrimSpace(version))
+	return err == nil && v.Prerelease() != ""
+}
+
+// SetAllowPrerelease make LatestVersion select prerelease versions of the stable channel, like 1.2.0-rc.1, they
+// are skipped by default. The versions of a channel subscribed to with SetChannel are selected whatever their
+// tag. Checks made by an Updater use Config.AllowPrerelease instead.
+func (h *HTTPSource) SetAllowPrerelease(allow bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.selector.prerelease = allow
+}
+
+// skipPrerelease report if v is a prerelease the configuration doesn't opt in to. Versions of a channel
+// other than stable are explicitly subscribed to and never skipped.
+func skipPrerelease(conf *Config, v *Version) bool {
+	if conf.AllowPrerelease || !isPrerelease(v.Number) {
+		return false
+	}
+	return v.Channel == "" || v.Channel == StableChannel
+}
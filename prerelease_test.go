@@ -0,0 +1,67 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNowPrerelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"version":"1.3.0-rc.1"},
+			{"os":%[1]q,"version":"1.2.0"}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	conf := &Config{Current: &Version{Number: "1.0.0"}, Source: source}
+	v, err := checkLatestVersion(context.Background(), conf)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+
+	conf.AllowPrerelease = true
+	v, err = checkLatestVersion(context.Background(), conf)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3.0-rc.1", v.Number)
+
+	// the settings of a check aren't left on the source, which other checks can share
+	v, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(allow bool) {
+			defer wg.Done()
+			v, err := checkLatestVersion(context.Background(), &Config{Source: source, AllowPrerelease: allow})
+			assert.Nil(t, err)
+			if allow {
+				assert.Equal(t, "1.3.0-rc.1", v.Number)
+			} else {
+				assert.Equal(t, "1.2.0", v.Number)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+}
+
+func TestSkipPrerelease(t *testing.T) {
+	conf := &Config{}
+	assert.False(t, skipPrerelease(conf, &Version{Number: "1.2.0"}))
+	assert.True(t, skipPrerelease(conf, &Version{Number: "1.2.0-beta"}))
+	assert.True(t, skipPrerelease(conf, &Version{Number: "1.2.0-rc.1", Channel: StableChannel}))
+	assert.False(t, skipPrerelease(conf, &Version{Number: "1.2.0-rc.1", Channel: "beta"}))
+	assert.False(t, skipPrerelease(conf, &Version{Number: "not a version"}))
+
+	conf.AllowPrerelease = true
+	assert.False(t, skipPrerelease(conf, &Version{Number: "1.2.0-beta"}))
+}
@@ -0,0 +1,44 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotPublished is returned by a Source when the executable or the signature of a version announced by
+// the manifest can't be found, usually because the release is still propagating through a CDN
+var ErrNotPublished = errors.New("release not published yet")
+
+var (
+	propagationBackoff    = 5 * time.Second // first delay before fetching an announced version again
+	maxPropagationBackoff = time.Minute     // longest delay between two attempts
+)
+
+// fetch call fetchOnce, retrying with an exponential backoff for up to Config.PropagationTimeout as long as
+// the announced version is not published yet
+func (u *Updater) fetch(ctx context.Context, conf *Config, newVer *Version) (io.ReadCloser, int64, *Options, error) {
+	deadline := time.Now().Add(conf.PropagationTimeout)
+	delay := propagationBackoff
+	for {
+		r, contentLength, opts, err := u.fetchOnce(ctx, conf, newVer)
+		if err == nil || !errors.Is(err, ErrNotPublished) || time.Now().Add(delay).After(deadline) {
+			return r, contentLength, opts, err
+		}
+
+		logInfo("Version %s is announced but not available yet, retrying in %s: %s\n", newVer.Number, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, 0, nil, ctx.Err()
+		}
+
+		delay *= 2
+		if delay > maxPropagationBackoff {
+			delay = maxPropagationBackoff
+		}
+	}
+}
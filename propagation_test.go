@@ -0,0 +1,56 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchWaitForPropagation(t *testing.T) {
+	defer func(backoff time.Duration) { propagationBackoff = backoff }(propagationBackoff)
+	propagationBackoff = time.Millisecond
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	// the CDN only knows about the release after a few requests
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 3 {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/app":
+			w.Write(newFile)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u := &Updater{}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/app"), PublicKey: pub}
+
+	_, _, _, err = u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.ErrorIs(t, err, ErrNotPublished)
+
+	conf.PropagationTimeout = time.Minute
+	r, _, opts, err := u.fetch(context.Background(), conf, &Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, body)
+	assert.Len(t, opts.Signature, ed25519.SignatureSize)
+}
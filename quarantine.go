@@ -0,0 +1,43 @@
+package selfupdate
+
+import (
+	"time"
+)
+
+var (
+	lockedBackoff    = 50 * time.Millisecond // first delay before touching a file locked by an antivirus again
+	maxLockedBackoff = 2 * time.Second       // longest delay between two attempts
+	lockedTimeout    = 15 * time.Second      // how long a file can stay locked before giving up
+)
+
+// retryLocked call f, retrying with an exponential backoff as long as it fails because the file is locked by
+// another process. On Windows, Defender and other antivirus open freshly written executables to scan them,
+// which make renaming or removing them fail for a short while.
+func retryLocked(f func() error) error {
+	deadline := time.Now().Add(lockedTimeout)
+	delay := lockedBackoff
+	for {
+		err := f()
+		if err == nil || !isFileLocked(err) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		logDebug("File locked by another process, retrying in %s: %s\n", delay, err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxLockedBackoff {
+			delay = maxLockedBackoff
+		}
+	}
+}
+
+// markOfTheWeb strip the Zone.Identifier alternate data stream of the staged executable, or replace it by
+// zone if not empty. Once verified, the update must not be blocked by SmartScreen the first time it is launched
+// just because it was downloaded.
+func markOfTheWeb(path string, zone string) error {
+	if zone == "" {
+		return clearZoneIdentifier(path)
+	}
+	return setZoneIdentifier(path, zone)
+}
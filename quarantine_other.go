@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+func clearZoneIdentifier(_ string) error {
+	return nil
+}
+
+func setZoneIdentifier(_ string, _ string) error {
+	return nil
+}
+
+func isFileLocked(_ error) bool {
+	return false
+}
@@ -0,0 +1,37 @@
+package selfupdate
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	errorAccessDenied     = syscall.Errno(5)
+	errorSharingViolation = syscall.Errno(32)
+	errorLockViolation    = syscall.Errno(33)
+)
+
+func zoneIdentifier(path string) string {
+	return path + ":Zone.Identifier"
+}
+
+func clearZoneIdentifier(path string) error {
+	err := os.Remove(zoneIdentifier(path))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func setZoneIdentifier(path string, zone string) error {
+	return os.WriteFile(zoneIdentifier(path), []byte(zone), 0644)
+}
+
+func isFileLocked(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == errorAccessDenied || errno == errorSharingViolation || errno == errorLockViolation
+}
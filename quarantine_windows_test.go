@@ -0,0 +1,54 @@
+package selfupdate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyMarkOfTheWeb(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "TestApplyMarkOfTheWeb.exe")
+	writeOldFile(fName, t)
+
+	err := Apply(bytes.NewReader(newFile), Options{TargetPath: fName})
+	validateUpdate(fName, err, t)
+	_, err = os.Stat(zoneIdentifier(fName))
+	assert.True(t, os.IsNotExist(err))
+
+	zone := "[ZoneTransfer]\r\nZoneId=3\r\n"
+	err = Apply(bytes.NewReader(newFile), Options{TargetPath: fName, MarkOfTheWeb: zone})
+	validateUpdate(fName, err, t)
+	b, err := os.ReadFile(zoneIdentifier(fName))
+	assert.Nil(t, err)
+	assert.Equal(t, zone, string(b))
+}
+
+func TestRetryLocked(t *testing.T) {
+	defer func(backoff time.Duration) { lockedBackoff = backoff }(lockedBackoff)
+	lockedBackoff = time.Millisecond
+
+	calls := 0
+	err := retryLocked(func() error {
+		calls++
+		if calls < 3 {
+			return &os.LinkError{Op: "rename", Err: errorSharingViolation}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryLocked(func() error {
+		calls++
+		return &os.PathError{Op: "remove", Err: syscall.ERROR_FILE_NOT_FOUND}
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+}
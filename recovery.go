@@ -0,0 +1,75 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Recover download the latest release from conf.Source and install it at target whatever the version installed,
+// after the same verification as an update. It is meant for a recovery stub, a tiny separate program run when the
+// executable at target is corrupted beyond rollback, for example by a service manager after it failed to start.
+// target doesn't need to exist.
+func Recover(conf *Config, target string) error {
+	if conf == nil || conf.Source == nil {
+		return errors.New("a Source is required")
+	}
+
+	u := &Updater{conf: conf}
+	ctx, cancel := withTimeout(context.Background(), conf.UpdateTimeout)
+	defer cancel()
+	newVer, err := checkLatestVersion(ctx, conf)
+	if err != nil {
+		return fmt.Errorf("get latest version: %w", err)
+	}
+	logInfo("Recovering %s with version %s.\n", target, newVer.Number)
+
+	r, contentLength, opts, err := u.fetch(ctx, conf, newVer)
+	if err != nil {
+		return err
+	}
+	r, err = u.pipeline(ctx, conf, newVer, r, contentLength)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// reinstall in place, the layout of the installation is what is being repaired
+	opts.TargetPath = target
+	opts.RenameTo, opts.RelocateTo = "", ""
+	// target may have been deleted, it is then created once the update is verified
+	opts.createTarget = true
+	_, err = applyUpdate(r, opts)
+	r.Close()
+	discardPreloaded(conf, newVer)
+	if err != nil {
+		return err
+	}
+
+	recordVersion(conf.VersionStore, conf.VersionComparator, newVer.Number, true)
+	return nil
+}
+
+// InstallRecoveryStub write stub, a recovery program embedded in the application with go:embed, to path if it
+// isn't already there, so it is available when the application itself can't run anymore
+func InstallRecoveryStub(stub []byte, path string) error {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, stub) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.new", filepath.Base(path)))
+	if err := os.WriteFile(tmp, stub, 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,83 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprintf(w, `[{"os":%q,"download_url":"%s/app","version":"1.1.0"}]`, runtime.GOOS, server.URL)
+		case "/app":
+			w.Write(newFile)
+		case "/app.ed25519":
+			w.Write(ed25519.Sign(priv, newFile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	store := &memoryVersionStore{version: "1.2.0"}
+	conf := &Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: pub, VersionStore: store}
+
+	// a missing executable is reinstalled
+	assert.Nil(t, Recover(conf, target))
+	content, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, "1.1.0", store.version)
+
+	// whatever the version, a corrupted executable is replaced
+	assert.Nil(t, os.WriteFile(target, []byte("garbage"), 0755))
+	assert.Nil(t, Recover(conf, target))
+	content, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+
+	// the release must still be verified
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(target, []byte("garbage"), 0755))
+	assert.NotNil(t, Recover(&Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: other}, target))
+	content, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("garbage"), content)
+
+	// nothing is left in place of a missing executable when the release doesn't verify
+	assert.Nil(t, os.Remove(target))
+	assert.NotNil(t, Recover(&Config{Source: NewHTTPSource(nil, server.URL+"/manifest"), PublicKey: other}, target))
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInstallRecoveryStub(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recovery", "myapp-recovery")
+	assert.Nil(t, InstallRecoveryStub(newFile, path))
+	assert.Nil(t, InstallRecoveryStub(newFile, path))
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+}
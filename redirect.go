@@ -0,0 +1,83 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrRedirectRefused is returned when a server redirects a request somewhere its RedirectPolicy doesn't allow
+var ErrRedirectRefused = errors.New("redirect refused")
+
+// RedirectPolicy define which redirects requests to update servers follow. The zero value follow up to 10
+// redirects to any host, like net/http, but never from HTTPS to plain HTTP.
+type RedirectPolicy struct {
+	MaxHops        int  // Maximum number of redirects followed by a request, default to 10, negative to follow none
+	SameHost       bool // if true, only redirects to the host of the original request are followed
+	AllowDowngrade bool // if true, redirects from HTTPS to plain HTTP are followed, if the SecurityPolicy also allow the URL
+}
+
+// Client returns a copy of client, or of http.DefaultClient if nil, following redirects according to p. Every
+// redirect is logged, as is the URL an executable was finally downloaded from.
+func (p *RedirectPolicy) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+	c.CheckRedirect = p.checkRedirect
+	return &c
+}
+
+// checkRedirect is the http.Client CheckRedirect function enforcing p, via are the requests already made
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	hops := p.MaxHops
+	if hops == 0 {
+		hops = 10
+	}
+	from := via[len(via)-1].URL
+	switch {
+	case len(via) > hops:
+		return fmt.Errorf("%w: more than %d redirects from %s", ErrRedirectRefused, hops, via[0].URL)
+	case p.SameHost && !strings.EqualFold(req.URL.Host, via[0].URL.Host):
+		return fmt.Errorf("%w: %s is not on the host of %s", ErrRedirectRefused, req.URL, via[0].URL)
+	case !p.AllowDowngrade && from.Scheme == "https" && req.URL.Scheme != "https":
+		return fmt.Errorf("%w: %s downgrade %s to plain HTTP", ErrRedirectRefused, req.URL, from)
+	}
+	logDebug("Redirected from %s to %s.\n", from, req.URL)
+	return nil
+}
+
+// finalURLReader is implemented by downloads reporting where they came from once redirects were followed
+type finalURLReader interface {
+	FinalURL() string
+}
+
+// download is the body of a download made by HTTPSource
+type download struct {
+	io.ReadCloser
+	finalURL string
+}
+
+// FinalURL returns the URL the executable was downloaded from once redirects were followed, for audit logs
+func (d *download) FinalURL() string {
+	return d.finalURL
+}
+
+// withFinalURL returns r reporting the URL response finally came from
+func withFinalURL(r io.ReadCloser, response *http.Response) io.ReadCloser {
+	if response.Request == nil {
+		return r
+	}
+	return &download{ReadCloser: r, finalURL: response.Request.URL.String()}
+}
+
+// logFinalURL log where the executable of v downloaded by r came from, for audits
+func logFinalURL(r io.Reader, v *Version) {
+	if f, ok := r.(finalURLReader); ok {
+		if url := f.FinalURL(); url != "" {
+			logInfo("Downloading version %s from %s.\n", v.Number, url)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package selfupdate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(newFile)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			http.Redirect(w, r, "/real", http.StatusFound)
+		case "/cdn":
+			http.Redirect(w, r, other.URL+"/app", http.StatusFound)
+		case "/real":
+			w.Write(newFile)
+		}
+	}))
+	defer server.Close()
+
+	get := func(p *RedirectPolicy, url string) (string, error) {
+		source := NewHTTPSource(p.Client(nil), url).(*HTTPSource)
+		r, _, err := source.Get(&Version{})
+		if err != nil {
+			return "", err
+		}
+		body, _ := io.ReadAll(r)
+		r.Close()
+		assert.Equal(t, newFile, body)
+		return r.(finalURLReader).FinalURL(), nil
+	}
+
+	final, err := get(&RedirectPolicy{SameHost: true}, server.URL+"/app")
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/real", final)
+
+	_, err = get(&RedirectPolicy{MaxHops: -1}, server.URL+"/app")
+	assert.ErrorIs(t, err, ErrRedirectRefused)
+	_, err = get(&RedirectPolicy{SameHost: true}, server.URL+"/cdn")
+	assert.ErrorIs(t, err, ErrRedirectRefused)
+	final, err = get(&RedirectPolicy{}, server.URL+"/cdn")
+	assert.Nil(t, err)
+	assert.Equal(t, other.URL+"/app", final)
+}
+
+func TestRedirectPolicyDowngrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(newFile)
+	}))
+	defer plain.Close()
+	tls := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+"/app", http.StatusFound)
+	}))
+	defer tls.Close()
+
+	_, _, err := NewHTTPSource((&RedirectPolicy{}).Client(tls.Client()), tls.URL+"/app").Get(&Version{})
+	assert.ErrorIs(t, err, ErrRedirectRefused)
+
+	r, _, err := NewHTTPSource((&RedirectPolicy{AllowDowngrade: true}).Client(tls.Client()), tls.URL+"/app").Get(&Version{})
+	assert.Nil(t, err)
+	r.Close()
+}
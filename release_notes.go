@@ -0,0 +1,63 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// maxReleaseNotes is the largest release notes document downloaded
+const maxReleaseNotes = 1024 * 1024
+
+// ErrNoReleaseNotes is returned by GetReleaseNotes when a version doesn't have any
+var ErrNoReleaseNotes = errors.New("no release notes")
+
+// ReleaseNotesSource define a Source whose manifest can describe what changed in a version
+type ReleaseNotesSource interface {
+	Source
+	GetReleaseNotes(v *Version) (string, error) // Get the markdown release notes of v, ErrNoReleaseNotes if there are none
+}
+
+var _ ReleaseNotesSource = (*HTTPSource)(nil)
+
+// GetReleaseNotes will return the markdown release notes of v, the "release_notes" of its manifest entry or the
+// document at its "release_notes_url", a template accepting the parameters of NewHTTPSource
+func (h *HTTPSource) GetReleaseNotes(v *Version) (string, error) {
+	if v == nil {
+		return "", ErrNoReleaseNotes
+	}
+	notes, url := v.ReleaseNotes, v.ReleaseNotesURL
+	h.lock.Lock()
+	if a := h.find(v); a != nil && notes == "" && url == "" {
+		notes, url = a.ReleaseNotes, a.ReleaseNotesURL
+	}
+	h.lock.Unlock()
+
+	if notes != "" {
+		return notes, nil
+	}
+	if url == "" {
+		return "", ErrNoReleaseNotes
+	}
+	b, err := h.getLimited(context.Background(), expandURLTemplate(url, v), maxReleaseNotes)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GetReleaseNotes will return the markdown release notes of v, for example the version returned by
+// Source.LatestVersion, so the application can show what's new before asking the user to restart. It can be
+// called from the callbacks of the Config.
+func (u *Updater) GetReleaseNotes(v *Version) (string, error) {
+	if v == nil {
+		return "", ErrNoReleaseNotes
+	}
+	if strings.TrimSpace(v.ReleaseNotes) != "" {
+		return v.ReleaseNotes, nil
+	}
+	if rs, ok := u.config().Source.(ReleaseNotesSource); ok {
+		return rs.GetReleaseNotes(v)
+	}
+	return "", ErrNoReleaseNotes
+}
@@ -0,0 +1,58 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReleaseNotes(t *testing.T) {
+	var base string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/notes-1.2.0.md":
+			fmt.Fprint(w, "## 1.2.0\n\n- Faster startup\n")
+		case "/missing.md":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprintf(w, `[
+				{"os":%[1]q,"version":"1.3.0","release_notes":"## 1.3.0\n\n- Dark mode\n"},
+				{"os":%[1]q,"version":"1.2.0","release_notes_url":"%[2]s/notes-{{.Version}}.md"},
+				{"os":%[1]q,"version":"1.1.0","release_notes_url":"%[2]s/missing.md"},
+				{"os":%[1]q,"version":"1.0.0"}
+			]`, runtime.GOOS, base)
+		}
+	}))
+	defer server.Close()
+	base = server.URL
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	latest, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "## 1.3.0\n\n- Dark mode\n", latest.ReleaseNotes)
+
+	u := &Updater{conf: &Config{Source: source}}
+	notes, err := u.GetReleaseNotes(latest)
+	assert.Nil(t, err)
+	assert.Equal(t, "## 1.3.0\n\n- Dark mode\n", notes)
+
+	notes, err = u.GetReleaseNotes(&Version{Number: "1.2.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, "## 1.2.0\n\n- Faster startup\n", notes)
+
+	_, err = u.GetReleaseNotes(&Version{Number: "1.1.0"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = u.GetReleaseNotes(&Version{Number: "1.0.0"})
+	assert.ErrorIs(t, err, ErrNoReleaseNotes)
+	_, err = u.GetReleaseNotes(nil)
+	assert.ErrorIs(t, err, ErrNoReleaseNotes)
+
+	u.conf.Source = &hungSource{}
+	_, err = u.GetReleaseNotes(&Version{Number: "1.2.0"})
+	assert.ErrorIs(t, err, ErrNoReleaseNotes)
+}
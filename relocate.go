@@ -0,0 +1,100 @@
+package selfupdate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkInstallPath returns an error if p, the path an update is relocated to, isn't a local path which stays in
+// the install root once joined to it: absolute paths, volume names and .. escaping it are refused
+func checkInstallPath(p string) error {
+	clean := filepath.Clean(filepath.FromSlash(p))
+	if p == "" || filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(clean, string(filepath.Separator)) ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid install path %q", p)
+	}
+	return nil
+}
+
+// installRoot returns the directory RelocateTo is relative to
+func (o *Options) installRoot() string {
+	if o.InstallRoot == "" {
+		return filepath.Dir(o.TargetPath)
+	}
+	return o.InstallRoot
+}
+
+// checkRelocation returns an error if RelocateTo would move the updated file outside of the install root
+func (o *Options) checkRelocation() error {
+	if o.RelocateTo == "" {
+		return nil
+	}
+	if err := checkInstallPath(o.RelocateTo); err != nil {
+		return err
+	}
+	root := filepath.Clean(o.installRoot())
+	rel, err := filepath.Rel(root, o.relocation())
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("install path %q is outside of %s", o.RelocateTo, root)
+	}
+	return nil
+}
+
+// relocation return the path the updated file should be moved to, or the empty string
+func (o *Options) relocation() string {
+	if o.RelocateTo != "" {
+		return filepath.Join(o.installRoot(), filepath.FromSlash(o.RelocateTo))
+	}
+	if o.RenameTo != "" {
+		return filepath.Join(filepath.Dir(o.TargetPath), o.RenameTo)
+	}
+	return ""
+}
+
+// relocateInstalled move the updated file to dest and point a symlink at its previous path (or LinkPath) to it,
+// so that shortcuts, launchers and symlinks keep working. The update is already done at that point, so failures
+// are only logged and TargetPath is left unchanged.
+func relocateInstalled(opts *Options, dest string) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		logError("Unable to create %s: %v\n", filepath.Dir(dest), err)
+		return
+	}
+	if err := os.Rename(opts.TargetPath, dest); err != nil {
+		logError("Unable to move %s to %s: %v\n", opts.TargetPath, dest, err)
+		return
+	}
+
+	link := opts.LinkPath
+	if link == "" {
+		link = opts.TargetPath
+	}
+	if err := replaceSymlink(dest, link); err != nil {
+		logInfo("Unable to leave a compatibility symlink at %s: %v\n", link, err)
+	}
+	opts.TargetPath = dest
+}
+
+// replaceSymlink atomically create or replace link with a relative symlink to target
+func replaceSymlink(target, link string) error {
+	if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s exists and isn't a symlink", link)
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		rel = target
+	}
+
+	tmp := filepath.Join(filepath.Dir(link), fmt.Sprintf(".%s.link", filepath.Base(link)))
+	_ = os.Remove(tmp)
+	if err = os.Symlink(rel, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package selfupdate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyRelocateTo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	launcher := filepath.Join(dir, "myapp")
+	writeOldFile(launcher, t)
+
+	opts := Options{TargetPath: launcher, RelocateTo: filepath.Join("versions", "1.1.0", "myapp")}
+	err := apply(bytes.NewReader(newFile), &opts)
+	installed := filepath.Join(dir, "versions", "1.1.0", "myapp")
+	validateUpdate(installed, err, t)
+	assert.Equal(t, installed, opts.TargetPath)
+	validateUpdate(launcher, nil, t)
+
+	// the next update relocate again and repoint the launcher symlink
+	opts = Options{TargetPath: installed, RelocateTo: filepath.Join("versions", "1.2.0", "myapp"), InstallRoot: dir, LinkPath: launcher}
+	err = apply(bytes.NewReader(newFile), &opts)
+	validateUpdate(filepath.Join(dir, "versions", "1.2.0", "myapp"), err, t)
+
+	link, err := os.Readlink(launcher)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("versions", "1.2.0", "myapp"), link)
+}
+
+func TestApplyRelocateToOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app", "myapp")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(target), 0755))
+
+	for _, p := range []string{"/etc/x", "../../x", "versions/../../x", ""} {
+		assert.NotNil(t, checkInstallPath(p), p)
+	}
+	assert.Nil(t, checkInstallPath("versions/1.1.0/myapp"))
+
+	// an install path from the manifest can't move the update out of the install root
+	for _, p := range []string{"/etc/x", "../../x"} {
+		writeOldFile(target, t)
+		err := apply(bytes.NewReader(newFile), &Options{TargetPath: target, RelocateTo: p})
+		assert.NotNil(t, err, p)
+		data, err := os.ReadFile(target)
+		assert.Nil(t, err)
+		assert.Equal(t, oldFile, data)
+	}
+	_, err := os.Stat(filepath.Join(dir, "x"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = entryVersion(&appVersion{Version: "1.1.0", SHA256: strings.Repeat("00", 32), InstallPath: "../../x"})
+	assert.NotNil(t, err)
+}
+
+func TestReplaceSymlinkRefuseFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	writeOldFile(file, t)
+
+	assert.NotNil(t, replaceSymlink(filepath.Join(dir, "target"), file))
+}
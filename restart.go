@@ -1,36 +1,126 @@
 package selfupdate
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/Lamdt03/selfupdate/internal/osext"
 )
 
-func restart(exiter func(error), executable string) error {
-	wd, err := os.Getwd()
-	if err != nil {
-		return err
-	}
+// launch is how the process was started, the updated executable is restarted the same way even if the application
+// changed its working directory or environment since
+var launch = struct {
+	args []string
+	env  []string
+	dir  string
+}{
+	args: append([]string(nil), os.Args...),
+	env:  os.Environ(),
+	dir:  getwd(),
+}
+
+// defaultShutdownTimeout is how long Config.ShutdownHooks can take when Config.ShutdownTimeout is not set
+const defaultShutdownTimeout = 30 * time.Second
 
+func getwd() string {
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// restart start executable, or the running one if empty, with the arguments, environment and working directory the
+// process was launched with. On Unix the process is replaced unless conf.ExitCallback handles exiting, elsewhere the
+// new process is spawned then the application exits.
+func restart(conf *Config, executable string) error {
+	var err error
 	if executable == "" {
 		executable, err = osext.Executable()
 		if err != nil {
 			return err
 		}
 	}
+	dir := launch.dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+
+	if err = beforeExit(conf); err != nil {
+		return err
+	}
+
+	if conf.ExitCallback == nil && runtime.GOOS != "windows" {
+		if err = os.Chdir(dir); err == nil {
+			// only returns if the executable couldn't replace the process
+			err = syscall.Exec(executable, launch.args, launch.env)
+		}
+		logError("Unable to execute %s in place, starting it instead: %v\n", executable, err)
+	}
 
-	_, err = os.StartProcess(executable, os.Args, &os.ProcAttr{
-		Dir:   wd,
-		Env:   os.Environ(),
+	_, err = os.StartProcess(executable, launch.args, &os.ProcAttr{
+		Dir:   dir,
+		Env:   launch.env,
 		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
 		Sys:   &syscall.SysProcAttr{},
 	})
+	return exit(conf, err)
+}
+
+// beforeExit run conf.ShutdownHooks then conf.BeforeRestartCallback, before the process is replaced
+func beforeExit(conf *Config) error {
+	if err := runShutdownHooks(conf); err != nil {
+		return err
+	}
+	if flush := conf.BeforeRestartCallback; flush != nil {
+		if err := flush(); err != nil {
+			return fmt.Errorf("before restart: %w", err)
+		}
+	}
+	return nil
+}
 
-	if exiter != nil {
+// exit leave the application once what replaces it was started, with err the error starting it, through
+// conf.ExitCallback if set. Without it, the process only exits if err is nil.
+func exit(conf *Config, err error) error {
+	if exiter := conf.ExitCallback; exiter != nil {
 		exiter(err)
 	} else if err == nil {
 		os.Exit(0)
 	}
 	return err
 }
+
+// runShutdownHooks run conf.ShutdownHooks one after the other, giving up once conf.ShutdownTimeout elapsed even if
+// a hook ignores its context
+func runShutdownHooks(conf *Config) error {
+	if len(conf.ShutdownHooks) == 0 {
+		return nil
+	}
+	timeout := conf.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i, hook := range conf.ShutdownHooks {
+		done := make(chan error, 1)
+		go func(hook func(context.Context) error) {
+			done <- hook(ctx)
+		}(hook)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("shutdown hook %d: %w", i, err)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("shutdown hook %d: %w", i, ctx.Err())
+		}
+	}
+	return nil
+}
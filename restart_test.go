@@ -0,0 +1,72 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartLaunch(t *testing.T) {
+	assert.Equal(t, os.Args, launch.args)
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Equal(t, wd, launch.dir)
+}
+
+func TestRestartBeforeRestartCallback(t *testing.T) {
+	flushErr := errors.New("flush failed")
+	exited := false
+	conf := &Config{
+		BeforeRestartCallback: func() error { return flushErr },
+		ExitCallback:          func(error) { exited = true },
+	}
+	err := restart(conf, filepath.Join(t.TempDir(), "myapp"))
+	assert.ErrorIs(t, err, flushErr)
+	assert.False(t, exited)
+}
+
+func TestRestartExitCallback(t *testing.T) {
+	flushed := false
+	var exitErr error
+	conf := &Config{
+		BeforeRestartCallback: func() error { flushed = true; return nil },
+		ExitCallback:          func(err error) { exitErr = err },
+	}
+	// the executable doesn't exist, the error is passed to the callback handling the exit
+	err := restart(conf, filepath.Join(t.TempDir(), "myapp"))
+	assert.NotNil(t, err)
+	assert.True(t, flushed)
+	assert.Equal(t, err, exitErr)
+}
+
+func TestRestartShutdownHooks(t *testing.T) {
+	var ran []int
+	hookErr := errors.New("jobs still running")
+	exited := false
+	conf := &Config{
+		ShutdownHooks: []func(context.Context) error{
+			func(context.Context) error { ran = append(ran, 1); return nil },
+			func(context.Context) error { ran = append(ran, 2); return hookErr },
+			func(context.Context) error { ran = append(ran, 3); return nil },
+		},
+		ExitCallback: func(error) { exited = true },
+	}
+	err := restart(conf, filepath.Join(t.TempDir(), "myapp"))
+	assert.ErrorIs(t, err, hookErr)
+	assert.Equal(t, []int{1, 2}, ran)
+	assert.False(t, exited)
+
+	// a hook ignoring its context doesn't hold the restart past the deadline
+	block := make(chan struct{})
+	defer close(block)
+	conf.ShutdownHooks = []func(context.Context) error{func(context.Context) error { <-block; return nil }}
+	conf.ShutdownTimeout = 10 * time.Millisecond
+	err = restart(conf, filepath.Join(t.TempDir(), "myapp"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, exited)
+}
@@ -0,0 +1,312 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// resumeCheckpoint is how many bytes are received between two saves of the state of a partial download
+const resumeCheckpoint = 1 << 20
+
+// partialState describe a partial download persisted next to the partial file
+type partialState struct {
+	URL       string `json:"url"`       // URL being downloaded
+	Validator string `json:"validator"` // ETag or Last-Modified of the response the download started with
+	Length    int64  `json:"length"`    // Length of the complete download, -1 if unknown
+	Offset    int64  `json:"offset"`    // Number of bytes of the partial file covered by Hash
+	Hash      []byte `json:"hash"`      // Marshaled SHA-256 state of the first Offset bytes
+}
+
+// ResumeDownloads make Get persist executables as they are downloaded in dir, or in a directory of the user cache
+// directory if empty, and resume an interrupted download with a Range request instead of starting over. This
+// matters for large executables on unreliable links. Only responses with an ETag or a Last-Modified header can be
+// resumed, so that a partial file is never completed with the bytes of another release.
+func (h *HTTPSource) ResumeDownloads(dir string) error {
+	if dir == "" {
+		var err error
+		if dir, err = cacheDir("partial"); err != nil {
+			return err
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.partialDir = dir
+	return nil
+}
+
+// partialPaths returns where the partial download of url and its state are kept in dir
+func partialPaths(dir string, url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:8])
+	return filepath.Join(dir, name+".part"), filepath.Join(dir, name+".json")
+}
+
+// loadPartial returns the state of the partial download of url after checking the partial file still match
+// it, nil if there is nothing usable to resume
+func loadPartial(part string, statePath string, url string) *partialState {
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	state := &partialState{}
+	if err = json.Unmarshal(b, state); err != nil || state.URL != url || state.Offset <= 0 {
+		return nil
+	}
+
+	f, err := os.Open(part)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.CopyN(h, f, state.Offset); err != nil {
+		return nil
+	}
+	current, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil || !bytes.Equal(current, state.Hash) {
+		logInfo("Partial download of %s is corrupted, starting over.\n", url)
+		return nil
+	}
+	return state
+}
+
+// validator returns what identify the content of response for an If-Range request, weak ETags can't be used
+func validator(response *http.Response) string {
+	if etag := response.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return response.Header.Get("Last-Modified")
+}
+
+// rangeStart returns the first byte of a Content-Range header like "bytes 100-999/1000"
+func rangeStart(contentRange string) (int64, error) {
+	var start, end int64
+	var total string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, fmt.Errorf("invalid Content-Range %q: %s", contentRange, err)
+	}
+	return start, nil
+}
+
+// getResumable download url, resuming the partial download kept in dir if there is one
+func (h *HTTPSource) getResumable(ctx context.Context, dir string, url string) (io.ReadCloser, int64, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, 0, err
+	}
+	part, statePath := partialPaths(dir, url)
+	state := loadPartial(part, statePath, url)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating request: %s", err)
+	}
+	// offsets must count the bytes of the file, not of a transparently decompressed response
+	request.Header.Set("Accept-Encoding", "identity")
+	if state != nil {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", state.Offset))
+		request.Header.Set("If-Range", state.Validator)
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+
+	if response.StatusCode == http.StatusRequestedRangeNotSatisfiable && state != nil {
+		// the partial file doesn't fit the release anymore, start over next time
+		os.Remove(part)
+		os.Remove(statePath)
+	}
+	if err = checkStatus(url, response, http.StatusOK, http.StatusPartialContent); err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case response.StatusCode == http.StatusPartialContent && state != nil:
+		start, err := rangeStart(response.Header.Get("Content-Range"))
+		if err == nil && start != state.Offset {
+			err = fmt.Errorf("expected range starting at %d, got %d", state.Offset, start)
+		}
+		if err != nil {
+			response.Body.Close()
+			os.Remove(statePath)
+			return nil, 0, fmt.Errorf("error resuming download of %s: %s", url, err)
+		}
+		logInfo("Resuming download of %s at offset %d.\n", url, state.Offset)
+	case response.StatusCode == http.StatusOK:
+		if state != nil {
+			logInfo("Download of %s changed on the server, starting over.\n", url)
+		}
+		state = &partialState{URL: url, Validator: validator(response), Length: response.ContentLength}
+		if state.Validator == "" {
+			logDebug("Download of %s can't be resumed, no ETag or Last-Modified header.\n", url)
+			os.Remove(statePath)
+			return withFinalURL(response.Body, response), response.ContentLength, nil
+		}
+	default:
+		// a range answered without a resumable state
+		response.Body.Close()
+		return nil, 0, fmt.Errorf("error downloading %s: unexpected %s", url, response.Status)
+	}
+
+	r, err := newResumableReader(part, statePath, state, response.Body)
+	if err != nil {
+		response.Body.Close()
+		return nil, 0, err
+	}
+	length := state.Length
+	if length < 0 && response.ContentLength >= 0 {
+		length = state.Offset + response.ContentLength
+	}
+	return withFinalURL(r, response), length, nil
+}
+
+// resumableReader returns the bytes of the partial file followed by the rest of the download, which is appended
+// to the partial file with its state saved regularly
+type resumableReader struct {
+	prefix    io.ReadCloser
+	body      io.ReadCloser
+	statePath string
+
+	lock   sync.Mutex
+	file   *os.File
+	hash   hash.Hash
+	state  *partialState
+	saved  int64
+	closed bool
+}
+
+func newResumableReader(part string, statePath string, state *partialState, body io.ReadCloser) (*resumableReader, error) {
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r := &resumableReader{body: body, statePath: statePath, file: file, hash: sha256.New(), state: state, saved: state.Offset}
+
+	if err = file.Truncate(state.Offset); err == nil {
+		_, err = file.Seek(state.Offset, io.SeekStart)
+	}
+	if err == nil && state.Offset > 0 {
+		var prefix *os.File
+		if prefix, err = os.Open(part); err == nil {
+			r.prefix = prefix
+			err = r.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.Hash)
+		}
+	}
+	if err != nil {
+		if r.prefix != nil {
+			r.prefix.Close()
+		}
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	if n, err := r.readPrefix(p); n > 0 || err != nil {
+		return n, err
+	}
+
+	n, err := r.body.Read(p)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return n, err
+	}
+
+	if n > 0 {
+		if _, werr := r.file.Write(p[:n]); werr != nil {
+			// the download can go on, it just won't be resumable
+			logError("Unable to save the partial download: %v\n", werr)
+			r.closed = true
+			r.file.Close()
+			os.Remove(r.statePath)
+			return n, err
+		}
+		r.hash.Write(p[:n])
+		r.state.Offset += int64(n)
+		if r.state.Offset-r.saved >= resumeCheckpoint {
+			r.save()
+		}
+	}
+	if err == io.EOF && (r.state.Length < 0 || r.state.Offset == r.state.Length) {
+		// complete, what's left to do is up to the caller
+		r.closed = true
+		r.file.Close()
+		os.Remove(r.file.Name())
+		os.Remove(r.statePath)
+	} else if err != nil {
+		r.save()
+	}
+	return n, err
+}
+
+// readPrefix read from the partial file until its end, which is where it was truncated
+func (r *resumableReader) readPrefix(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.prefix == nil {
+		return 0, nil
+	}
+	n, err := r.prefix.Read(p)
+	if err == io.EOF {
+		r.prefix.Close()
+		r.prefix = nil
+		err = nil
+	}
+	return n, err
+}
+
+// save persist the state of the download once what it describe is on disk, r.lock must be held
+func (r *resumableReader) save() {
+	b, err := r.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err == nil {
+		r.state.Hash = b
+		err = r.file.Sync()
+	}
+	if err == nil {
+		b, err = json.Marshal(r.state)
+	}
+	if err == nil {
+		err = os.WriteFile(r.statePath, b, 0o644)
+	}
+	if err != nil {
+		logError("Unable to save the state of the partial download: %v\n", err)
+		return
+	}
+	r.saved = r.state.Offset
+}
+
+// Close will keep the partial download to resume it later, unless it is complete
+func (r *resumableReader) Close() error {
+	err := r.body.Close()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.prefix != nil {
+		r.prefix.Close()
+		r.prefix = nil
+	}
+	if !r.closed {
+		r.closed = true
+		r.save()
+		r.file.Close()
+	}
+	return err
+}
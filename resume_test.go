@@ -0,0 +1,125 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type resumeServer struct {
+	content []byte
+	etag    string
+	ranges  []string
+	cut     int // if not zero, the connection is dropped after that many bytes
+}
+
+func (s *resumeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	w.Header().Set("ETag", s.etag)
+	if s.cut == 0 {
+		http.ServeContent(w, r, "app", time.Time{}, bytes.NewReader(s.content))
+		return
+	}
+
+	cut := s.cut
+	s.cut = 0
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nETag: %s\r\nContent-Length: %d\r\n\r\n", s.etag, len(s.content))
+	buf.Write(s.content[:cut])
+	buf.Flush()
+}
+
+func readAll(t *testing.T, source Source) ([]byte, int64, error) {
+	r, length, err := source.Get(&Version{})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	return b, length, err
+}
+
+func TestHTTPSourceResumeDownloads(t *testing.T) {
+	content := make([]byte, 3*resumeCheckpoint+12345)
+	_, err := rand.Read(content)
+	assert.Nil(t, err)
+	s := &resumeServer{content: content, etag: `"v1"`, cut: 2*resumeCheckpoint + 100}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	dir := t.TempDir()
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	assert.Nil(t, source.ResumeDownloads(dir))
+
+	// the connection drops, what was received is kept
+	_, _, err = readAll(t, source)
+	assert.NotNil(t, err)
+
+	// and only the rest is downloaded
+	b, length, err := readAll(t, source)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), length)
+	assert.True(t, bytes.Equal(content, b))
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", 2*resumeCheckpoint+100)}, s.ranges)
+
+	// nothing is left once complete
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	// closing an unfinished download keep it too
+	s.ranges = nil
+	r, _, err := source.Get(&Version{})
+	assert.Nil(t, err)
+	_, err = io.ReadFull(r, make([]byte, 1000))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	b, _, err = readAll(t, source)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(content, b))
+	assert.Equal(t, []string{"", "bytes=1000-"}, s.ranges)
+}
+
+func TestHTTPSourceResumeDownloadsRestart(t *testing.T) {
+	s := &resumeServer{content: bytes.Repeat([]byte("old"), 1000), etag: `"v1"`, cut: 1500}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	dir := t.TempDir()
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	assert.Nil(t, source.ResumeDownloads(dir))
+	_, _, err := readAll(t, source)
+	assert.NotNil(t, err)
+
+	// the release changed on the server, the partial file must not be completed with it
+	s.content = bytes.Repeat([]byte("new"), 1000)
+	s.etag = `"v2"`
+	b, _, err := readAll(t, source)
+	assert.Nil(t, err)
+	assert.Equal(t, string(s.content), string(b))
+
+	// a corrupted partial file is not resumed
+	s.cut = 1500
+	_, _, err = readAll(t, source)
+	assert.NotNil(t, err)
+	part, _ := partialPaths(dir, server.URL)
+	assert.Nil(t, os.WriteFile(part, []byte(strings.Repeat("x", 1500)), 0o644))
+	s.ranges = nil
+	b, _, err = readAll(t, source)
+	assert.Nil(t, err)
+	assert.Equal(t, string(s.content), string(b))
+	assert.Equal(t, []string{""}, s.ranges)
+}
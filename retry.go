@@ -0,0 +1,149 @@
+package selfupdate
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy define how requests to update servers failing with a transient error, like a connection reset or
+// a 502, are retried. The zero value make up to 3 attempts, waiting 500ms then 1s with some jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // Number of attempts including the first one, default to 3
+	Backoff     time.Duration // Delay before the first retry, doubled at each attempt, default to 500ms
+	MaxBackoff  time.Duration // Longest delay between two attempts, default to 30s
+	StatusCodes []int         // HTTP status codes that are retried, default to 408, 429, 500, 502, 503 and 504
+}
+
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+	http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// Client returns a copy of client, or of http.DefaultClient if nil, whose GET requests are retried according to
+// p. Pass it to NewHTTPSource, NewChecksumsFileSource or NewMessageSource so that version checks, downloads and
+// signatures are retried. It can be combined with SecurityPolicy.Client in any order.
+func (p *RetryPolicy) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	c := *client
+	if t, ok := client.Transport.(*policyTransport); ok {
+		// the security policy stay first so that it is found by secureClient
+		c.Transport = t.rewrap(&retryTransport{base: t.base, policy: p})
+	} else {
+		c.Transport = &retryTransport{base: client.Transport, policy: p}
+	}
+	return &c
+}
+
+// retryable returns true if status is a status code retried by p
+func (p *RetryPolicy) retryable(status int) bool {
+	codes := p.StatusCodes
+	if codes == nil {
+		codes = defaultRetryStatusCodes
+	}
+	for _, c := range codes {
+		if c == status {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the attempt following attempt, with a jitter of up to half of it so
+// that clients failing together don't retry together
+func (p *RetryPolicy) delay(attempt int, response *http.Response) time.Duration {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			if d := time.Duration(seconds) * time.Second; d < maxBackoff {
+				return d
+			}
+			return maxBackoff
+		}
+	}
+
+	d := backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// wrappingTransport is a transport adding a behavior to another one
+type wrappingTransport interface {
+	http.RoundTripper
+	unwrap() http.RoundTripper                       // returns the transport being wrapped
+	rewrap(base http.RoundTripper) http.RoundTripper // returns a copy wrapping base instead
+}
+
+type retryTransport struct {
+	base   http.RoundTripper
+	policy *RetryPolicy
+}
+
+var _ wrappingTransport = (*retryTransport)(nil)
+var _ wrappingTransport = (*policyTransport)(nil)
+
+// RoundTrip will retry GET and HEAD requests failing with a transient error
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || req.Body != nil {
+		return base.RoundTrip(req)
+	}
+
+	attempts := t.policy.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := base.RoundTrip(req)
+		if attempt >= attempts || errors.Is(err, ErrInsecureURL) || req.Context().Err() != nil {
+			return response, err
+		}
+		if err == nil && !t.policy.retryable(response.StatusCode) {
+			return response, nil
+		}
+
+		delay := t.policy.delay(attempt, response)
+		if err != nil {
+			logInfo("Request to %s failed, retrying in %s: %s\n", req.URL, delay, err)
+		} else {
+			logInfo("Request to %s failed, retrying in %s: %s\n", req.URL, delay, response.Status)
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (t *retryTransport) unwrap() http.RoundTripper {
+	return t.base
+}
+
+func (t *retryTransport) rewrap(base http.RoundTripper) http.RoundTripper {
+	return &retryTransport{base: base, policy: t.policy}
+}
@@ -0,0 +1,99 @@
+package selfupdate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var requests int32
+	var failures int32
+	drop := true
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if n <= atomic.LoadInt32(&failures) {
+			if n == 1 && drop {
+				// drop the connection
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0"}]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	retry := &RetryPolicy{Backoff: time.Millisecond}
+	source := NewHTTPSource(retry.Client(nil), server.URL)
+
+	// a connection reset and a 502 are retried
+	failures = 2
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+	assert.Equal(t, int32(3), requests)
+
+	// until the attempts are exhausted
+	requests, failures, drop = 0, 10, false
+	_, err = source.LatestVersion()
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), requests)
+
+	// other status codes are not retried
+	requests, status = 0, http.StatusForbidden
+	resp, err := retry.Client(nil).Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, int32(1), requests)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := &RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		d := p.delay(attempt+1, nil)
+		assert.True(t, d >= max/2 && d <= max, attempt, d)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	assert.Equal(t, 3*time.Second, p.delay(1, resp))
+	resp.Header.Set("Retry-After", "60")
+	assert.Equal(t, 5*time.Second, p.delay(1, resp))
+}
+
+func TestRetryPolicyWithOtherClients(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	retry := &RetryPolicy{}
+	insecure := &SecurityPolicy{AllowInsecure: true}
+	for _, client := range []*http.Client{
+		retry.Client(insecure.Client(server.Client())),
+		insecure.Client(retry.Client(server.Client())),
+	} {
+		source := NewHTTPSource(client, server.URL).(*HTTPSource)
+		assert.Equal(t, insecure, securePolicy(source.client))
+
+		// the transport can still be configured for pinning
+		pinned, err := NewPinnedClient(client, Pin(server.Certificate()))
+		assert.Nil(t, err)
+		resp, err := pinned.Get(server.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		_, ok := pinned.Transport.(*policyTransport).base.(*retryTransport)
+		assert.True(t, ok)
+	}
+}
@@ -0,0 +1,197 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoRetainedVersion is returned by Rollback when no previous version is kept on disk
+var ErrNoRetainedVersion = errors.New("no previous version retained")
+
+// retentionDir returns the directory where previous versions are kept
+func retentionDir(conf *Config) (string, error) {
+	if conf.RetentionDir != "" {
+		return conf.RetentionDir, nil
+	}
+	return stateFile(".versions")
+}
+
+// validVersionDir report if version can be used as a directory name
+func validVersionDir(version string) bool {
+	return version != "" && version != "." && version != ".." && !strings.ContainsAny(version, `/\`)
+}
+
+// retainVersion keep a copy of the executable at exe, running version, in the retention directory, then remove the
+// oldest copies beyond conf.KeepVersions. It does nothing unless KeepVersions is set.
+func retainVersion(conf *Config, version string, exe string) {
+	if conf.KeepVersions <= 0 || exe == "" || !validVersionDir(version) {
+		return
+	}
+	dir, err := retentionDir(conf)
+	if err != nil {
+		logDebug("No place to keep previous versions: %v\n", err)
+		return
+	}
+
+	fi, err := os.Stat(exe)
+	if err != nil {
+		logError("Unable to keep version %s: %v\n", version, err)
+		return
+	}
+	vdir := filepath.Join(dir, version)
+	if err = os.MkdirAll(vdir, 0755); err != nil {
+		logError("Unable to keep version %s: %v\n", version, err)
+		return
+	}
+	kept := filepath.Join(vdir, filepath.Base(exe))
+	// a copy rather than a hard link, an executable updated in place would change the version kept as well
+	if err = copyFile(exe, kept, fi.Mode().Perm()); err != nil {
+		_ = os.RemoveAll(vdir)
+		logError("Unable to keep version %s: %v\n", version, err)
+		return
+	}
+	now := time.Now()
+	_ = os.Chtimes(vdir, now, now)
+
+	versions, err := retainedVersions(dir)
+	if err != nil {
+		return
+	}
+	for i, old := range versions {
+		if i >= conf.KeepVersions {
+			logDebug("Removing previous version %s.\n", old)
+			_ = os.RemoveAll(filepath.Join(dir, old))
+		}
+	}
+}
+
+// retainedVersions returns the versions kept in dir, the most recently retained first
+func retainedVersions(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	type retained struct {
+		version string
+		time    time.Time
+	}
+	var found []retained
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, retained{e.Name(), fi.ModTime()})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].time.After(found[j].time) })
+
+	versions := make([]string, 0, len(found))
+	for _, r := range found {
+		versions = append(versions, r.version)
+	}
+	return versions, nil
+}
+
+// RetainedVersions will return the previous versions kept on disk because of Config.KeepVersions, the most recently
+// replaced first
+func (u *Updater) RetainedVersions() ([]string, error) {
+	dir, err := retentionDir(u.config())
+	if err != nil {
+		return nil, err
+	}
+	return retainedVersions(dir)
+}
+
+// Rollback will reinstall the version that ran before the last update, kept on disk because of Config.KeepVersions,
+// without downloading anything. It returns ErrNoRetainedVersion if there is none. The application must be restarted,
+// for example with Restart, to run it.
+func (u *Updater) Rollback() error {
+	conf := u.config()
+	dir, err := retentionDir(conf)
+	if err != nil {
+		return err
+	}
+	versions, err := retainedVersions(dir)
+	if err != nil {
+		return err
+	}
+	current := ""
+	if conf.Current != nil {
+		current = conf.Current.Number
+	}
+	for _, version := range versions {
+		if version != current {
+			return u.RollbackTo(version)
+		}
+	}
+	return ErrNoRetainedVersion
+}
+
+// RollbackTo will reinstall version, one of RetainedVersions, without downloading anything. The application must be
+// restarted, for example with Restart, to run it.
+func (u *Updater) RollbackTo(version string) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	conf := u.config()
+	if !validVersionDir(version) {
+		return fmt.Errorf("%w: %s", ErrNoRetainedVersion, version)
+	}
+	dir, err := retentionDir(conf)
+	if err != nil {
+		return err
+	}
+	exe := u.executable
+	if exe == "" {
+		if exe, err = ExecutableRealPath(); err != nil {
+			return err
+		}
+	}
+	kept, err := retainedExecutable(filepath.Join(dir, version))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrNoRetainedVersion, version)
+	}
+	f, err := os.Open(kept)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	logInfo("Rolling back to version %s.\n", version)
+	if err = Apply(f, Options{TargetPath: exe, TargetMode: fi.Mode().Perm()}); err != nil {
+		return err
+	}
+	u.executable = exe
+	// the version rolled back to is lower than the highest one installed, it must not be refused as a downgrade later
+	recordVersion(versionStore(conf), conf.VersionComparator, version, true)
+	return nil
+}
+
+// retainedExecutable returns the path of the executable kept in the directory of a version
+func retainedExecutable(vdir string) (string, error) {
+	entries, err := os.ReadDir(vdir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			return filepath.Join(vdir, e.Name()), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
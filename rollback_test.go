@@ -0,0 +1,63 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetainVersion(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "myapp")
+	conf := &Config{KeepVersions: 2, RetentionDir: filepath.Join(dir, "versions")}
+
+	for i, version := range []string{"1.0.0", "1.1.0", "1.2.0"} {
+		assert.Nil(t, os.WriteFile(exe, []byte(version), 0755))
+		retainVersion(conf, version, exe)
+		// make the order of retention explicit whatever the resolution of the file system clock
+		at := time.Now().Add(time.Duration(i-10) * time.Minute)
+		assert.Nil(t, os.Chtimes(filepath.Join(conf.RetentionDir, version), at, at))
+	}
+
+	u := &Updater{conf: conf}
+	versions, err := u.RetainedVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.2.0", "1.1.0"}, versions)
+
+	// nothing is kept unless asked to
+	conf = &Config{RetentionDir: filepath.Join(dir, "none")}
+	retainVersion(conf, "1.0.0", exe)
+	_, err = os.Stat(conf.RetentionDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "myapp")
+	store := &memoryVersionStore{version: "1.1.0"}
+	conf := &Config{
+		Current:      &Version{Number: "1.1.0"},
+		KeepVersions: 2,
+		RetentionDir: filepath.Join(dir, "versions"),
+		VersionStore: store,
+	}
+	u := &Updater{conf: conf, executable: exe}
+
+	assert.ErrorIs(t, u.Rollback(), ErrNoRetainedVersion)
+
+	assert.Nil(t, os.WriteFile(exe, oldFile, 0755))
+	retainVersion(conf, "1.0.0", exe)
+	assert.Nil(t, os.WriteFile(exe, newFile, 0755))
+
+	assert.Nil(t, u.Rollback())
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+	assert.Equal(t, "1.0.0", store.version)
+
+	assert.ErrorIs(t, u.RollbackTo("0.9.0"), ErrNoRetainedVersion)
+	assert.ErrorIs(t, u.RollbackTo("../1.0.0"), ErrNoRetainedVersion)
+}
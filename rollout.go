@@ -0,0 +1,65 @@
+package selfupdate
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inRollout report if the installation identified by id is in the cohort receiving version, released to percent
+// of the clients. The cohort only grows as the percentage is dialed up, and differs from one version to the other
+// so that the same clients aren't always the first to get an update.
+func inRollout(id string, version string, percent float64) bool {
+	if percent >= 100 {
+		return true
+	}
+	digest := sha256.Sum256([]byte(id + "\x00" + strings.TrimSpace(version)))
+	bucket := binary.BigEndian.Uint64(digest[:8]) % 10000
+	return float64(bucket) < percent*100
+}
+
+// rolloutID returns the identifier of this installation for staged rollouts, Config.RolloutID or a random one
+// persisted in the user configuration directory
+func rolloutID(conf *Config) string {
+	if conf.RolloutID != "" {
+		return conf.RolloutID
+	}
+	path, err := stateFile(".id")
+	if err != nil {
+		logDebug("No place to record the rollout identifier: %v\n", err)
+		return ""
+	}
+	if b, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b))
+	}
+
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		logError("Unable to generate a rollout identifier: %v\n", err)
+		return ""
+	}
+	id := hex.EncodeToString(random)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		err = os.WriteFile(path, []byte(id+"\n"), 0644)
+	}
+	if err != nil {
+		logError("Unable to record the rollout identifier: %v\n", err)
+	}
+	return id
+}
+
+// rolledOut report if v is released to this installation, either to everyone or to a cohort it belongs to
+func rolledOut(conf *Config, v *Version) bool {
+	if v.Rollout == nil {
+		return true
+	}
+	id := rolloutID(conf)
+	if id == "" {
+		return *v.Rollout >= 100
+	}
+	return inRollout(id, v.Number, *v.Rollout)
+}
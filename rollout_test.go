@@ -0,0 +1,60 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInRollout(t *testing.T) {
+	cohort := func(percent float64) int {
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if inRollout(fmt.Sprint("device-", i), "1.2.0", percent) {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 0, cohort(0))
+	assert.Equal(t, 1000, cohort(100))
+	n := cohort(10)
+	assert.True(t, n > 60 && n < 140, n)
+	n = cohort(50)
+	assert.True(t, n > 420 && n < 580, n)
+
+	// dialing up only adds clients to the cohort
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint("device-", i)
+		if inRollout(id, "1.2.0", 10) {
+			assert.True(t, inRollout(id, "1.2.0", 20), id)
+		}
+	}
+}
+
+func TestCheckNowRollout(t *testing.T) {
+	rollout := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","rollout":%d}]`, runtime.GOOS, rollout)
+	}))
+	defer server.Close()
+
+	asked := false
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           &memoryVersionStore{},
+		RolloutID:              "device-1",
+		UpgradeConfirmCallback: func(string) bool { asked = true; return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.False(t, asked)
+
+	rollout = 100
+	assert.Nil(t, u.CheckNow())
+	assert.True(t, asked)
+}
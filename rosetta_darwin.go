@@ -0,0 +1,9 @@
+package selfupdate
+
+import "syscall"
+
+// underRosetta report if the running process is an x86_64 executable translated by Rosetta on Apple silicon
+func underRosetta() bool {
+	translated, err := syscall.SysctlUint32("sysctl.proc_translated")
+	return err == nil && translated == 1
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+// +build !darwin
+
+package selfupdate
+
+func underRosetta() bool {
+	return false
+}
@@ -0,0 +1,62 @@
+// Package schedule provides what the Updater needs to decide when to check for updates.
+package schedule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckState is what is remembered of the last update check
+type CheckState struct {
+	Time    time.Time `json:"time"`              // When the Source was last asked for the latest version
+	Version string    `json:"version,omitempty"` // Latest version it announced
+}
+
+// CheckStore define where the last update check is persisted, so that a minimum interval between checks holds
+// across launches of the application
+type CheckStore interface {
+	LastCheck() (*CheckState, error)     // Get the last check recorded, or nil if none
+	RecordCheck(state *CheckState) error // Record state as the last check
+}
+
+type fileCheckStore string
+
+// NewFileCheckStore returns a CheckStore keeping the last check as JSON in the file at path
+func NewFileCheckStore(path string) CheckStore {
+	return fileCheckStore(path)
+}
+
+// LastCheck will return the content of the file
+func (f fileCheckStore) LastCheck() (*CheckState, error) {
+	b, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state CheckState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RecordCheck will atomically replace the content of the file with state
+func (f fileCheckStore) RecordCheck(state *CheckState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := string(f)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".new"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,23 @@
+package schedule
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCheckStore(t *testing.T) {
+	store := NewFileCheckStore(filepath.Join(t.TempDir(), "selfupdate", "app.check"))
+	last, err := store.LastCheck()
+	assert.Nil(t, err)
+	assert.Nil(t, last)
+
+	now := time.Date(2024, 6, 1, 16, 0, 0, 0, time.UTC)
+	assert.Nil(t, store.RecordCheck(&CheckState{Time: now, Version: "1.2.0"}))
+	last, err = store.LastCheck()
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(last.Time))
+	assert.Equal(t, "1.2.0", last.Version)
+}
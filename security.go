@@ -0,0 +1,118 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrInsecureURL is returned when a manifest, executable or signature would be fetched over plain HTTP while the
+// SecurityPolicy doesn't allow it
+var ErrInsecureURL = errors.New("refusing to use a plain HTTP URL")
+
+// SecurityPolicy define which transports can be used to reach update servers. The zero value only accept HTTPS,
+// and plain HTTP to loopback addresses for development, which is what is enforced when no policy is chosen.
+type SecurityPolicy struct {
+	AllowInsecure bool     // if true, plain HTTP is accepted for any host, which let anyone on the network path withhold updates
+	InsecureHosts []string // Hosts plain HTTP is accepted for, like a server on a trusted local network
+}
+
+// Client returns a copy of client, or of http.DefaultClient if nil, whose requests, including redirects, are
+// checked against p. Pass it to NewHTTPSource, NewChecksumsFileSource or NewMessageSource to replace the default
+// policy, for example to opt into plain HTTP.
+func (p *SecurityPolicy) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	base := client.Transport
+	if t, ok := base.(*policyTransport); ok {
+		base = t.base
+	}
+
+	c := *client
+	c.Transport = &policyTransport{base: base, policy: p}
+	return &c
+}
+
+// CheckURL returns ErrInsecureURL if raw, which can be a URL template, is a plain HTTP URL not allowed by p
+func (p *SecurityPolicy) CheckURL(raw string) error {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !strings.EqualFold(scheme, "http") || p.AllowInsecure {
+		return nil
+	}
+
+	host := rest
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if strings.EqualFold(host, "localhost") {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	for _, allowed := range p.InsecureHosts {
+		if strings.EqualFold(host, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInsecureURL, raw)
+}
+
+type policyTransport struct {
+	base   http.RoundTripper
+	policy *SecurityPolicy
+}
+
+// RoundTrip will refuse requests not allowed by the policy before handing them to the base transport
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.URL.String()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func (t *policyTransport) unwrap() http.RoundTripper {
+	return t.base
+}
+
+func (t *policyTransport) rewrap(base http.RoundTripper) http.RoundTripper {
+	return &policyTransport{base: base, policy: t.policy}
+}
+
+// securePolicy returns the policy enforced by client
+func securePolicy(client *http.Client) *SecurityPolicy {
+	if t, ok := client.Transport.(*policyTransport); ok {
+		return t.policy
+	}
+	return &SecurityPolicy{}
+}
+
+// secureClient returns client, or http.DefaultClient if nil, enforcing the default policy unless it already
+// enforce one chosen by the caller
+func secureClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, ok := client.Transport.(*policyTransport); ok {
+		return client
+	}
+	return (&SecurityPolicy{}).Client(client)
+}
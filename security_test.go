@@ -0,0 +1,83 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityPolicyCheckURL(t *testing.T) {
+	strict := &SecurityPolicy{}
+	lan := &SecurityPolicy{InsecureHosts: []string{"updates.lan"}}
+	insecure := &SecurityPolicy{AllowInsecure: true}
+
+	for _, c := range []struct {
+		url                   string
+		strict, lan, insecure bool
+	}{
+		{"https://example.com/app", true, true, true},
+		{"https://example.com/app-{{.OS}}", true, true, true},
+		{"http://localhost:8080/app", true, true, true},
+		{"http://127.0.0.1/app", true, true, true},
+		{"http://[::1]:8080/app", true, true, true},
+		{"http://user@updates.lan:8080/app", false, true, true},
+		{"HTTP://example.com/app", false, false, true},
+		{"http://example.com/app-{{.OS}}", false, false, true},
+		{"http://localhost.example.com/app", false, false, true},
+	} {
+		for _, p := range []struct {
+			policy *SecurityPolicy
+			valid  bool
+		}{{strict, c.strict}, {lan, c.lan}, {insecure, c.insecure}} {
+			err := p.policy.CheckURL(c.url)
+			if p.valid {
+				assert.Nil(t, err, c.url)
+			} else {
+				assert.True(t, errors.Is(err, ErrInsecureURL), c.url)
+			}
+		}
+	}
+}
+
+func TestSecurityPolicyHTTPSource(t *testing.T) {
+	var downloadURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0","download_url":%q}]`, runtime.GOOS, downloadURL)
+	}))
+	defer server.Close()
+
+	downloadURL = "http://updates.example.com/app"
+	_, err := NewHTTPSource(nil, server.URL).LatestVersion()
+	assert.True(t, errors.Is(err, ErrInsecureURL))
+
+	insecure := &SecurityPolicy{AllowInsecure: true}
+	v, err := NewHTTPSource(insecure.Client(nil), server.URL).LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+
+	// downloads are checked too, without connecting to the host
+	_, _, err = NewHTTPSource(nil, "http://updates.example.com/app").Get(&Version{})
+	assert.True(t, errors.Is(err, ErrInsecureURL))
+
+	// and so are redirects
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://updates.example.com/app", http.StatusFound)
+	}))
+	defer tlsServer.Close()
+	_, _, err = NewHTTPSource(tlsServer.Client(), tlsServer.URL).Get(&Version{})
+	assert.True(t, errors.Is(err, ErrInsecureURL))
+
+	// the policy survive pinning
+	pinned, err := NewPinnedClient(tlsServer.Client(), Pin(tlsServer.Certificate()))
+	assert.Nil(t, err)
+	_, _, err = NewHTTPSource(pinned, tlsServer.URL).Get(&Version{})
+	assert.True(t, errors.Is(err, ErrInsecureURL))
+	pinned, err = NewPinnedClient(insecure.Client(tlsServer.Client()), Pin(tlsServer.Certificate()))
+	assert.Nil(t, err)
+	assert.Equal(t, insecure, securePolicy(NewHTTPSource(pinned, tlsServer.URL).(*HTTPSource).client))
+}
@@ -0,0 +1,88 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrSmokeTestFailed is returned when the new executable failed its smoke test, it is then not installed
+var ErrSmokeTestFailed = errors.New("smoke test failed")
+
+// defaultSmokeTestTimeout is how long the smoke test can take when SmokeTest.Timeout is not set
+const defaultSmokeTestTimeout = 10 * time.Second
+
+// SmokeTest define a command the new executable is run with before it replaces the running one. It is run from a
+// copy in a temporary directory, which is also its working directory, with SELFUPDATE_SMOKE_TEST=1 in its
+// environment so that it can avoid side effects.
+type SmokeTest struct {
+	Args          []string      // Arguments the new executable is started with, default to --version
+	Timeout       time.Duration // How long the command can take, default to 10 seconds
+	Env           []string      // Environment variables, like KEY=value, added to the ones of the application
+	IgnoreVersion bool          // if true, the output doesn't have to contain the number of the version installed
+}
+
+// run start the staged executable and check it exits successfully reporting version
+func (s *SmokeTest) run(staged string, version string) error {
+	dir, err := os.MkdirTemp("", "selfupdate-smoke")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// the staged file is named .<name>.new, the copy is named like the executable so that it runs on Windows
+	exe := filepath.Join(dir, strings.TrimPrefix(strings.TrimSuffix(filepath.Base(staged), ".new"), "."))
+	if err = copyFile(staged, exe, 0755); err != nil {
+		return err
+	}
+
+	args := s.Args
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSmokeTestTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logInfo("Running smoke test %s %s.\n", filepath.Base(exe), strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "SELFUPDATE_SMOKE_TEST=1"), s.Env...)
+	// the output goes to a file rather than a pipe that a process left behind by the executable could hold open
+	output, err := os.Create(filepath.Join(dir, "output"))
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	cmd.Stdout, cmd.Stderr = output, output
+	err = cmd.Run()
+	out, _ := os.ReadFile(output.Name())
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: no answer after %v", ErrSmokeTestFailed, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v: %s", ErrSmokeTestFailed, err, excerpt(out))
+	}
+	if !s.IgnoreVersion && version != "" && !strings.Contains(string(out), strings.TrimPrefix(version, "v")) {
+		return fmt.Errorf("%w: version %s not reported: %s", ErrSmokeTestFailed, version, excerpt(out))
+	}
+	return nil
+}
+
+// excerpt returns the beginning of the output of a command for an error message
+func excerpt(out []byte) string {
+	const maxExcerpt = 200
+	s := strings.TrimSpace(string(out))
+	if len(s) > maxExcerpt {
+		s = s[:maxExcerpt] + "..."
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stagedScript write script as a staged executable
+func stagedScript(t *testing.T, script string) string {
+	staged := filepath.Join(t.TempDir(), ".myapp.new")
+	assert.Nil(t, os.WriteFile(staged, []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	return staged
+}
+
+func TestSmokeTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the smoke test executables are shell scripts")
+	}
+
+	staged := stagedScript(t, `[ "$1" = --version ] && [ "$SELFUPDATE_SMOKE_TEST" = 1 ] && [ "$(pwd)" != "$HOME" ] && echo "myapp v1.2.0"`)
+	assert.Nil(t, (&SmokeTest{}).run(staged, "v1.2.0"))
+	assert.ErrorIs(t, (&SmokeTest{}).run(staged, "1.3.0"), ErrSmokeTestFailed)
+	assert.Nil(t, (&SmokeTest{IgnoreVersion: true}).run(staged, "1.3.0"))
+	assert.ErrorIs(t, (&SmokeTest{Args: []string{"--help"}}).run(staged, "1.2.0"), ErrSmokeTestFailed)
+
+	staged = stagedScript(t, `echo "$MODE"; [ "$MODE" = ok ]`)
+	assert.ErrorIs(t, (&SmokeTest{IgnoreVersion: true}).run(staged, ""), ErrSmokeTestFailed)
+	assert.Nil(t, (&SmokeTest{Env: []string{"MODE=ok"}}).run(staged, ""))
+
+	staged = stagedScript(t, `sleep 5`)
+	start := time.Now()
+	assert.ErrorIs(t, (&SmokeTest{Timeout: 50 * time.Millisecond}).run(staged, ""), ErrSmokeTestFailed)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
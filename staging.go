@@ -0,0 +1,177 @@
+package selfupdate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// StagingStrategy define where the new executable is written before it is swapped in place of the target.
+// Some home directories (eCryptfs, corporate DLP mounts) have exec or rename semantics that prevent
+// staging next to the executable, in which case another location can be used.
+type StagingStrategy interface {
+	StagingDir(target string) (string, error) // Return the directory where the update for target should be staged
+}
+
+type stagingFn func(string) (string, error)
+
+// StagingDir will call the stagingFn function to satisfy a StagingStrategy interface
+func (fn stagingFn) StagingDir(target string) (string, error) {
+	return fn(target)
+}
+
+// SameDirStaging returns a StagingStrategy that stage the update in the same directory as the target.
+// This is the default behavior and the only one that guarantee an atomic rename.
+func SameDirStaging() StagingStrategy {
+	return stagingFn(func(target string) (string, error) {
+		return filepath.Dir(target), nil
+	})
+}
+
+// CacheDirStaging returns a StagingStrategy that stage the update in a selfupdate directory inside
+// the user cache directory ($XDG_CACHE_HOME on Linux, ~/Library/Caches on darwin, %LocalAppData% on Windows).
+func CacheDirStaging() StagingStrategy {
+	return stagingFn(func(_ string) (string, error) {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir := filepath.Join(cache, "selfupdate")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		return dir, nil
+	})
+}
+
+// CustomDirStaging returns a StagingStrategy that stage the update in the given directory.
+func CustomDirStaging(dir string) StagingStrategy {
+	return stagingFn(func(_ string) (string, error) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		return dir, nil
+	})
+}
+
+// ProbeStaging returns a StagingStrategy that will try each of the candidates in order and use the first one
+// whose directory allow creating an executable file, which isn't on a noexec mount, and renaming it. If no
+// candidates are given, SameDirStaging followed by CacheDirStaging are probed.
+func ProbeStaging(candidates ...StagingStrategy) StagingStrategy {
+	if len(candidates) == 0 {
+		candidates = []StagingStrategy{SameDirStaging(), CacheDirStaging()}
+	}
+
+	return stagingFn(func(target string) (string, error) {
+		var errs []error
+		for _, c := range candidates {
+			dir, err := c.StagingDir(target)
+			if err == nil {
+				err = probeStagingDir(dir)
+			}
+			if err == nil {
+				return dir, nil
+			}
+			logDebug("Staging directory rejected: %v\n", err)
+			errs = append(errs, err)
+		}
+		return "", fmt.Errorf("no usable staging directory: %v", errs)
+	})
+}
+
+// probeScript is written to the probe file, so that it can be run where running it is the only way to know if the
+// directory allows executable files
+var probeScript = []byte("#!/bin/sh\nexit 0\n")
+
+func probeStagingDir(dir string) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	// a new file with a random name, executable by its owner only from its creation, so that a file or link planted
+	// in a shared directory is never written through and other users can't alter the probe before it is run
+	probe := filepath.Join(dir, ".selfupdate.probe."+hex.EncodeToString(id))
+	renamed := probe + ".renamed"
+	fp, err := os.OpenFile(probe, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0700)
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	defer os.Remove(probe)
+	defer os.Remove(renamed)
+
+	_, err = fp.Write(probeScript)
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+
+	if fi, err := os.Stat(probe); err != nil {
+		return err
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm()&0100 == 0 {
+		return fmt.Errorf("%s does not support executable files", dir)
+	}
+	if err = checkExecutable(dir, probe); err != nil {
+		return err
+	}
+
+	if err = os.Rename(probe, renamed); err != nil {
+		return fmt.Errorf("%s does not support rename: %w", dir, err)
+	}
+	return nil
+}
+
+// moveFile renames src to dst, falling back to a copy into dst directory followed by a rename
+// when src was staged on a different filesystem.
+func moveFile(src, dst string, mode os.FileMode) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || filepath.Dir(src) == filepath.Dir(dst) {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.new", filepath.Base(dst)))
+	if err = copyFile(src, tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	preserveAttributes(src, tmp, mode)
+	if err = os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	_ = os.Remove(src)
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := openFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
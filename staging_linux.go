@@ -0,0 +1,21 @@
+package selfupdate
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const stNoexec = 0x8 // ST_NOEXEC, the file system is mounted noexec
+
+// checkExecutable fails if the file system of dir is mounted noexec, where the probe file would keep its
+// executable bit but couldn't be run
+func checkExecutable(dir, _ string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return fmt.Errorf("unable to check the mount options of %s: %w", dir, err)
+	}
+	if int64(st.Flags)&stNoexec != 0 {
+		return fmt.Errorf("%s is on a file system mounted noexec", dir)
+	}
+	return nil
+}
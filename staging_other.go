@@ -0,0 +1,24 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// checkExecutable run the probe script, which fails with a permission error on a file system mounted noexec. Any
+// other failure, like a missing interpreter or an exec format error, means the probe couldn't be run either.
+func checkExecutable(dir, probe string) error {
+	err := exec.Command(probe).Run()
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%s does not allow running executable files: %w", dir, err)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to run an executable file in %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckExecutable(t *testing.T) {
+	dir := t.TempDir()
+	probe := filepath.Join(dir, "probe")
+	assert.Nil(t, os.WriteFile(probe, probeScript, 0700))
+	assert.Nil(t, checkExecutable(dir, probe))
+
+	missing := filepath.Join(dir, "missing")
+	assert.Nil(t, os.WriteFile(missing, []byte("#!/nonexistent/interpreter\n"), 0700))
+	assert.NotNil(t, checkExecutable(dir, missing))
+
+	garbage := filepath.Join(dir, "garbage")
+	assert.Nil(t, os.WriteFile(garbage, []byte{0x7f, 'E', 'L', 'F', 0, 0, 0, 0}, 0700))
+	assert.NotNil(t, checkExecutable(dir, garbage))
+}
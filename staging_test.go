@@ -0,0 +1,92 @@
+package selfupdate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCustomDirStaging(t *testing.T) {
+	fName := "TestApplyCustomDirStaging"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	staging := t.TempDir()
+	err := Apply(bytes.NewReader(newFile), Options{
+		TargetPath: fName,
+		Staging:    CustomDirStaging(staging),
+	})
+	validateUpdate(fName, err, t)
+
+	_, err = os.Stat(filepath.Join(staging, "."+fName+".new"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestProbeStaging(t *testing.T) {
+	good := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(missing, []byte{}, 0644))
+
+	dir, err := ProbeStaging(CustomDirStaging(filepath.Join(missing, "sub")), CustomDirStaging(good)).StagingDir("target")
+	assert.Nil(t, err)
+	assert.Equal(t, good, dir)
+
+	entries, err := os.ReadDir(good)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	_, err = ProbeStaging(CustomDirStaging(filepath.Join(missing, "sub"))).StagingDir("target")
+	assert.NotNil(t, err)
+}
+
+func TestProbeStagingPlantedLink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	dir := t.TempDir()
+	victim := filepath.Join(t.TempDir(), "victim")
+	assert.Nil(t, os.WriteFile(victim, []byte("victim"), 0644))
+	assert.Nil(t, os.Symlink(victim, filepath.Join(dir, ".selfupdate.probe")))
+
+	assert.Nil(t, probeStagingDir(dir))
+	content, err := os.ReadFile(victim)
+	assert.Nil(t, err)
+	assert.Equal(t, "victim", string(content))
+}
+
+func TestProbeStagingNoexec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("mount options are read from /proc/mounts")
+	}
+	mounts, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.Contains(","+fields[3]+",", ",noexec,") || strings.Contains(","+fields[3]+",", ",ro,") {
+			continue
+		}
+		fp, err := os.CreateTemp(fields[1], "selfupdate-test")
+		if err != nil {
+			continue
+		}
+		fp.Close()
+		os.Remove(fp.Name())
+
+		assert.NotNil(t, probeStagingDir(fields[1]))
+		return
+	}
+	t.Skip("no writable noexec mount")
+}
+
+func TestSameDirStaging(t *testing.T) {
+	dir, err := SameDirStaging().StagingDir(filepath.Join("some", "where", "app"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("some", "where"), dir)
+}
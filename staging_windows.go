@@ -0,0 +1,6 @@
+package selfupdate
+
+// checkExecutable does nothing, whether a file can be run doesn't depend on where it is on Windows
+func checkExecutable(_, _ string) error {
+	return nil
+}
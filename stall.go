@@ -0,0 +1,84 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrDownloadStalled is reported to the progress callback when no data was received for Config.StallTimeout.
+// The download is then resumed from the last received byte and the process is not considered done.
+var ErrDownloadStalled = errors.New("download stalled")
+
+// RangeSource define a Source that is able to resume the download of an executable from an offset
+type RangeSource interface {
+	Source
+	GetRange(v *Version, offset int64) (io.ReadCloser, int64, error) // Get the executable starting at offset and the remaining length
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// stallReader abort a read that didn't make progress for timeout and resume the download
+// from the last good offset using reopen.
+type stallReader struct {
+	body    io.ReadCloser
+	reopen  func(offset int64) (io.ReadCloser, error)
+	onStall func(offset int64, err error)
+	timeout time.Duration
+	retries int
+	offset  int64
+}
+
+var _ io.ReadCloser = (*stallReader)(nil)
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	for {
+		result := make(chan readResult, 1)
+		body := sr.body
+		go func() {
+			n, err := body.Read(p)
+			result <- readResult{n, err}
+		}()
+
+		timer := time.NewTimer(sr.timeout)
+		select {
+		case r := <-result:
+			timer.Stop()
+			sr.offset += int64(r.n)
+			return r.n, r.err
+		case <-timer.C:
+		}
+
+		// closing the body unblock the pending read, we must wait for it before reusing p
+		body.Close()
+		r := <-result
+		if r.n > 0 {
+			sr.offset += int64(r.n)
+			return r.n, nil
+		}
+
+		stallErr := fmt.Errorf("no data received for %s at offset %d: %w", sr.timeout, sr.offset, ErrDownloadStalled)
+		if sr.retries <= 0 {
+			return 0, stallErr
+		}
+		sr.retries--
+		if sr.onStall != nil {
+			sr.onStall(sr.offset, stallErr)
+		}
+		logInfo("Download stalled, resuming at offset %d.\n", sr.offset)
+
+		newBody, err := sr.reopen(sr.offset)
+		if err != nil {
+			return 0, fmt.Errorf("resume download at offset %d: %w", sr.offset, err)
+		}
+		sr.body = newBody
+	}
+}
+
+func (sr *stallReader) Close() error {
+	return sr.body.Close()
+}
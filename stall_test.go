@@ -0,0 +1,92 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hangingReader return some data and then block until closed
+type hangingReader struct {
+	data   []byte
+	closed chan struct{}
+}
+
+func (h *hangingReader) Read(p []byte) (int, error) {
+	if len(h.data) > 0 {
+		n := copy(p, h.data)
+		h.data = h.data[n:]
+		return n, nil
+	}
+	<-h.closed
+	return 0, errors.New("closed")
+}
+
+func (h *hangingReader) Close() error {
+	close(h.closed)
+	return nil
+}
+
+func TestStallReaderResume(t *testing.T) {
+	data := []byte("this is some test data that should arrive on the other end of the pipe")
+
+	var stalledAt int64
+	var stallErr error
+	sr := &stallReader{
+		body:    &hangingReader{data: data[:10], closed: make(chan struct{})},
+		timeout: 10 * time.Millisecond,
+		retries: 1,
+		reopen: func(offset int64) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data[offset:])), nil
+		},
+		onStall: func(offset int64, err error) {
+			stalledAt = offset
+			stallErr = err
+		},
+	}
+
+	r, err := io.ReadAll(sr)
+	assert.Nil(t, err)
+	assert.Equal(t, data, r)
+	assert.Equal(t, int64(10), stalledAt)
+	assert.True(t, errors.Is(stallErr, ErrDownloadStalled))
+}
+
+func TestStallReaderGiveUp(t *testing.T) {
+	sr := &stallReader{
+		body:    &hangingReader{closed: make(chan struct{})},
+		timeout: 10 * time.Millisecond,
+		reopen: func(offset int64) (io.ReadCloser, error) {
+			t.Fatal("should not resume")
+			return nil, nil
+		},
+	}
+
+	_, err := io.ReadAll(sr)
+	assert.True(t, errors.Is(err, ErrDownloadStalled))
+}
+
+func TestHTTPSourceGetRange(t *testing.T) {
+	content := "0123456789abcdef"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "app", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	body, length, err := source.GetRange(&Version{}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), length)
+
+	r, err := io.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", string(r))
+}
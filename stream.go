@@ -0,0 +1,71 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Download start the download of v from the configured Source and returns a reader over the executable as it
+// arrives, without buffering it, so it can be copied or teed elsewhere, and its length if known. The digest
+// announced for v, or provided by a HashSource, is checked when the end of the stream is reached and a mismatch
+// is returned by Read. An artifact given to PreloadArtifact is used instead of downloading it. Stalled downloads
+// are resumed and Config.ProgressCallback is called as with CheckNow. The signature of the executable isn't
+// verified, Apply does it.
+func (u *Updater) Download(v *Version) (io.ReadCloser, int64, error) {
+	return u.DownloadContext(context.Background(), v)
+}
+
+// DownloadContext is Download, the returned reader fails with ctx.Err() once ctx is done
+func (u *Updater) DownloadContext(ctx context.Context, v *Version) (io.ReadCloser, int64, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	conf := u.config()
+	r, contentLength, err := getArtifact(ctx, conf, v)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err = u.pipeline(ctx, conf, v, r, contentLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, contentLength, nil
+}
+
+// pipeline wrap the download r of v with stall detection, throttling, size and digest verification and progress reporting. r is
+// closed if an error is returned. Resuming the download and fetching its digest are interrupted once ctx is done.
+func (u *Updater) pipeline(ctx context.Context, conf *Config, v *Version, r io.ReadCloser, contentLength int64) (io.ReadCloser, error) {
+	if conf.StallTimeout > 0 {
+		r = u.stallReader(ctx, v, r, contentLength)
+	}
+	if conf.RateLimit > 0 {
+		r = newThrottledReader(r, conf.RateLimit, conf.RateBurst)
+	}
+	if v.Size > 0 {
+		if contentLength >= 0 && contentLength != v.Size {
+			r.Close()
+			return nil, fmt.Errorf("%w. Expected: %d bytes, announced: %d", ErrSizeMismatch, v.Size, contentLength)
+		}
+		r = &sizeReader{ReadCloser: r, expected: v.Size}
+	}
+
+	checked, err := u.checksumReader(ctx, v, r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if conf.ProgressCallback == nil {
+		return checked, nil
+	}
+	return &progressReadCloser{
+		progressReader: progressReader{Reader: checked, progressCallback: conf.ProgressCallback, contentLength: contentLength},
+		Closer:         checked,
+	}, nil
+}
+
+type progressReadCloser struct {
+	progressReader
+	io.Closer
+}
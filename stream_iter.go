@@ -0,0 +1,87 @@
+//go:build go1.23
+// +build go1.23
+
+package selfupdate
+
+import (
+	"io"
+	"iter"
+)
+
+const defaultChunkSize = 32 * 1024
+
+// Chunk is a piece of an update being streamed
+type Chunk struct {
+	Data   []byte // Only valid until the next iteration, copy it to keep it
+	Offset int64  // Position of Data in the stream
+	Total  int64  // Length of the stream, -1 if unknown
+}
+
+// Progress returns the fraction of the stream received once this chunk is processed, or -1 if the length of
+// the stream is unknown
+func (c Chunk) Progress() float64 {
+	if c.Total <= 0 {
+		return -1
+	}
+	return float64(c.Offset+int64(len(c.Data))) / float64(c.Total)
+}
+
+// Chunks returns an iterator over the content of r in chunks of at most size bytes, or 32 KiB if size isn't
+// positive. total is the length of r reported in each Chunk, -1 if unknown. The iteration stops at the end of r,
+// or after yielding the first read error with an empty Chunk.
+func Chunks(r io.Reader, size int, total int64) iter.Seq2[Chunk, error] {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if total <= 0 {
+		total = -1
+	}
+
+	return func(yield func(Chunk, error) bool) {
+		buf := make([]byte, size)
+		var offset int64
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if !yield(Chunk{Data: buf[:n], Offset: offset, Total: total}, nil) {
+					return
+				}
+				offset += int64(n)
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(Chunk{Offset: offset, Total: total}, err)
+				return
+			}
+		}
+	}
+}
+
+// DownloadChunks is like Download but returns an iterator over the chunks of the executable, in chunks of at
+// most size bytes. An error yielded at the end of the iteration means the download failed or its digest didn't
+// match, and the data received must be discarded. The download is closed when the iteration stops.
+//
+//	for chunk, err := range updater.DownloadChunks(v, 0) {
+//		if err != nil {
+//			return err
+//		}
+//		mirror.Write(chunk.Data)
+//	}
+func (u *Updater) DownloadChunks(v *Version, size int) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		r, total, err := u.Download(v)
+		if err != nil {
+			yield(Chunk{Total: -1}, err)
+			return
+		}
+		defer r.Close()
+
+		for chunk, err := range Chunks(r, size, total) {
+			if !yield(chunk, err) {
+				return
+			}
+		}
+	}
+}
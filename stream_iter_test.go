@@ -0,0 +1,76 @@
+//go:build go1.23
+// +build go1.23
+
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+
+	var received []byte
+	var last Chunk
+	for chunk, err := range Chunks(bytes.NewReader(content), 30, int64(len(content))) {
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(received)), chunk.Offset)
+		received = append(received, chunk.Data...)
+		last = chunk
+	}
+	assert.Equal(t, content, received)
+	assert.Equal(t, float64(1), last.Progress())
+
+	failure := errors.New("connection reset")
+	var errs []error
+	for chunk, err := range Chunks(io.MultiReader(bytes.NewReader(content[:10]), &failingReader{failure}), 0, 0) {
+		assert.Equal(t, float64(-1), chunk.Progress())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	assert.Equal(t, []error{failure}, errs)
+}
+
+type failingReader struct{ err error }
+
+func (f *failingReader) Read([]byte) (int, error) { return 0, f.err }
+
+func TestDownloadChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("executable"), 10000)
+	digest := sha256.Sum256(content)
+	server := streamServer(t, content)
+
+	u := &Updater{conf: &Config{Source: NewHTTPSource(nil, server.URL+"/app")}}
+	v := &Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: digest[:]}
+
+	var received bytes.Buffer
+	for chunk, err := range u.DownloadChunks(v, 4096) {
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, len(chunk.Data), 4096)
+		received.Write(chunk.Data)
+	}
+	assert.Equal(t, content, received.Bytes())
+
+	// stopping early close the download
+	count := 0
+	for range u.DownloadChunks(v, 1024) {
+		count++
+		break
+	}
+	assert.Equal(t, 1, count)
+
+	for _, err := range u.DownloadChunks(&Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: make([]byte, sha256.Size)}, 0) {
+		if err != nil {
+			return
+		}
+	}
+	t.Fatal("digest mismatch not reported")
+}
@@ -0,0 +1,64 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func streamServer(t *testing.T, content []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("executable"), 10000)
+	digest := sha256.Sum256(content)
+	server := streamServer(t, content)
+
+	var progress float64
+	u := &Updater{conf: &Config{
+		Source:           NewHTTPSource(nil, server.URL+"/app"),
+		ProgressCallback: func(p float64, _ error) { progress = p },
+	}}
+
+	r, length, err := u.Download(&Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: digest[:]})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), length)
+
+	var tee bytes.Buffer
+	body, err := io.ReadAll(io.TeeReader(r, &tee))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, content, body)
+	assert.Equal(t, content, tee.Bytes())
+	assert.Equal(t, float64(1), progress)
+
+	// a digest mismatch is reported at the end of the stream, even without progress callback
+	u.conf.ProgressCallback = nil
+	wrong := sha256.Sum256(newFile)
+	r, _, err = u.Download(&Version{Number: "1.1.0", DigestHash: crypto.SHA256, Digest: wrong[:]})
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.NotNil(t, err)
+	r.Close()
+
+	u.conf.RequireChecksum = true
+	_, _, err = u.Download(&Version{Number: "1.1.0"})
+	assert.ErrorIs(t, err, ErrNoChecksum)
+}
@@ -0,0 +1,50 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownTenant is returned when the key directory has no signing keys for the tenant
+var ErrUnknownTenant = errors.New("no signing keys for tenant")
+
+// signedKeyDirectory is the signed envelope of a key directory
+type signedKeyDirectory struct {
+	Directory []byte `json:"directory"` // JSON object of the TrustedKey lists of each tenant
+	Signature []byte `json:"signature"` // Signature of Directory
+}
+
+// TenantKeyRing returns a KeyRing trusting the keys of tenant in directory, after checking with verifier that
+// directory is signed. A white-label build can then ship a single signed directory and select the keys of the
+// brand it runs as at runtime, a binary signed for another customer being refused.
+func TenantKeyRing(directory []byte, verifier Verifier, tenant string) (*KeyRing, error) {
+	var envelope signedKeyDirectory
+	if err := json.Unmarshal(directory, &envelope); err != nil {
+		return nil, fmt.Errorf("error unmarshalling key directory: %s", err)
+	}
+	if err := verifier.VerifySignature(bytes.NewReader(envelope.Directory), envelope.Signature); err != nil {
+		return nil, fmt.Errorf("invalid key directory signature: %w", err)
+	}
+
+	var tenants map[string][]TrustedKey
+	if err := json.Unmarshal(envelope.Directory, &tenants); err != nil {
+		return nil, fmt.Errorf("error unmarshalling key directory: %s", err)
+	}
+	keys := tenants[tenant]
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTenant, tenant)
+	}
+	return NewKeyRing(keys...)
+}
+
+// SignKeyDirectory returns a key directory listing the signing keys of each tenant, signed by privateKey
+func SignKeyDirectory(privateKey ed25519.PrivateKey, tenants map[string][]TrustedKey) ([]byte, error) {
+	directory, err := json.Marshal(tenants)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedKeyDirectory{Directory: directory, Signature: ed25519.Sign(privateKey, directory)})
+}
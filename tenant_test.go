@@ -0,0 +1,37 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantKeyRing(t *testing.T) {
+	directoryPub, directoryPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	acme, globex := newTestKey(t, "acme-2024"), newTestKey(t, "globex-2024")
+
+	directory, err := SignKeyDirectory(directoryPriv, map[string][]TrustedKey{
+		"acme":   {acme.TrustedKey},
+		"globex": {globex.TrustedKey},
+	})
+	assert.Nil(t, err)
+
+	ring, err := TenantKeyRing(directory, NewED25519Verifier(directoryPub), "acme")
+	assert.Nil(t, err)
+	assert.Nil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(acme.private, newFile)))
+	// a binary signed for another customer is refused
+	assert.NotNil(t, ring.VerifySignature(bytes.NewReader(newFile), ed25519.Sign(globex.private, newFile)))
+
+	_, err = TenantKeyRing(directory, NewED25519Verifier(directoryPub), "initech")
+	assert.True(t, errors.Is(err, ErrUnknownTenant))
+
+	// the directory must be signed by the trusted key
+	forged, err := SignKeyDirectory(acme.private, map[string][]TrustedKey{"globex": {acme.TrustedKey}})
+	assert.Nil(t, err)
+	_, err = TenantKeyRing(forged, NewED25519Verifier(directoryPub), "globex")
+	assert.NotNil(t, err)
+}
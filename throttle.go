@@ -0,0 +1,48 @@
+package selfupdate
+
+import (
+	"io"
+	"time"
+)
+
+// throttledReader limit how fast r is read with a token bucket refilled at rate bytes per second and holding up
+// to burst bytes. Reading slower let TCP flow control slow the download down, without any help from the server.
+type throttledReader struct {
+	io.ReadCloser
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	sleep  func(time.Duration)
+}
+
+func newThrottledReader(r io.ReadCloser, rate int64, burst int64) *throttledReader {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &throttledReader{ReadCloser: r, rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now(), sleep: time.Sleep}
+}
+
+// Read will wait until enough tokens are available to fill p, up to burst bytes
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if float64(len(p)) > t.burst {
+		p = p[:int64(t.burst)]
+	}
+	want := float64(len(p))
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	if t.tokens < want {
+		t.sleep(time.Duration((want - t.tokens) / t.rate * float64(time.Second)))
+		t.tokens = want
+		t.last = time.Now()
+	}
+
+	n, err := t.ReadCloser.Read(p)
+	t.tokens -= float64(n)
+	return n, err
+}
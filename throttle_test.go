@@ -0,0 +1,50 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottledReader(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 1000)
+	r := newThrottledReader(io.NopCloser(bytes.NewReader(content)), 1000, 100)
+	var slept time.Duration
+	r.sleep = func(d time.Duration) { slept += d }
+
+	buf := make([]byte, 512)
+	var read []byte
+	for {
+		n, err := r.Read(buf)
+		assert.True(t, n <= 100)
+		read = append(read, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, content, read)
+
+	// the burst is free, the rest come at the rate limit
+	assert.True(t, slept > 850*time.Millisecond && slept <= time.Second, slept)
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("executable"), 10000)
+	server := streamServer(t, content)
+
+	u := &Updater{conf: &Config{Source: NewHTTPSource(nil, server.URL+"/app"), RateLimit: 200000, RateBurst: 50000}}
+	start := time.Now()
+	r, _, err := u.Download(&Version{Number: "1.1.0"})
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, content, b)
+
+	// 50kB of burst, then 50kB at 200kB/s
+	assert.True(t, time.Since(start) >= 200*time.Millisecond, time.Since(start))
+}
@@ -0,0 +1,57 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrUpdateInProgress is returned when another instance of the application is installing an update
+var ErrUpdateInProgress = errors.New("update in progress in another process")
+
+// errLocked is returned by tryLockFile when the file is locked by someone else
+var errLocked = errors.New("file locked")
+
+// lockPath returns the file locked while an update of the executable exe is installed
+func lockPath(conf *Config, exe string) (string, error) {
+	if conf.LockPath != "" {
+		return conf.LockPath, nil
+	}
+	if exe != "" && writableDir(filepath.Dir(exe)) {
+		return filepath.Join(filepath.Dir(exe), fmt.Sprintf(".%s.lock", filepath.Base(exe))), nil
+	}
+	return stateFile(".lock")
+}
+
+// lockUpdate take the advisory lock preventing other processes from installing an update of exe at the same time,
+// or returns ErrUpdateInProgress. The lock is released by calling the function returned. If there is no place for
+// the lock, the update goes on without it.
+func lockUpdate(conf *Config, exe string) (func(), error) {
+	path, err := lockPath(conf, exe)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	}
+	if err != nil {
+		logDebug("No place to lock the update: %v\n", err)
+		return func() {}, nil
+	}
+
+	if err = tryLockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			logInfo("Another instance is installing an update.\n")
+			return nil, ErrUpdateInProgress
+		}
+		logDebug("Unable to lock the update: %v\n", err)
+		return func() {}, nil
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
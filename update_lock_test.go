@@ -0,0 +1,54 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockUpdate(t *testing.T) {
+	conf := &Config{LockPath: filepath.Join(t.TempDir(), "locks", "myapp.lock")}
+	unlock, err := lockUpdate(conf, "")
+	assert.Nil(t, err)
+
+	// the lock is held by another open file, like it would in another process
+	_, err = lockUpdate(conf, "")
+	assert.ErrorIs(t, err, ErrUpdateInProgress)
+
+	unlock()
+	unlock, err = lockUpdate(conf, "")
+	assert.Nil(t, err)
+	unlock()
+}
+
+func TestLockPath(t *testing.T) {
+	dir := t.TempDir()
+	path, err := lockPath(&Config{}, filepath.Join(dir, "myapp"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, ".myapp.lock"), path)
+}
+
+func TestCheckNowUpdateInProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"os":%q,"version":"1.1.0"}]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	conf := &Config{
+		Current:      &Version{Number: "1.0.0"},
+		Source:       NewHTTPSource(nil, server.URL),
+		VersionStore: &memoryVersionStore{},
+		LockPath:     filepath.Join(t.TempDir(), "myapp.lock"),
+	}
+	unlock, err := lockUpdate(conf, "")
+	assert.Nil(t, err)
+	defer unlock()
+
+	u := &Updater{conf: conf}
+	assert.ErrorIs(t, u.CheckNow(), ErrUpdateInProgress)
+}
@@ -0,0 +1,89 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrVersionNotFound is returned by UpdateToVersion when the Source doesn't list the version asked for
+var ErrVersionNotFound = errors.New("version not found")
+
+// UpdateToVersion will install version, chosen by the user for example from ListVersions, instead of the latest
+// one, then restart like CheckNow. Installing an older version than the running one returns ErrDowngrade unless
+// downgrade is true. The Source must be a ListSource.
+func (u *Updater) UpdateToVersion(version string, downgrade bool) error {
+	return u.UpdateToVersionContext(context.Background(), version, downgrade)
+}
+
+// UpdateToVersionContext is UpdateToVersion, giving up once ctx is done
+func (u *Updater) UpdateToVersionContext(ctx context.Context, version string, downgrade bool) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	conf := u.config()
+	ctx, cancel := withTimeout(ctx, conf.UpdateTimeout)
+	defer cancel()
+	v := conf.Current
+
+	newVer, err := findVersion(ctx, conf, version)
+	if err != nil {
+		return err
+	}
+	if same, err := conf.comparator().Compare(v.Number, newVer.Number); err == nil && same == 0 {
+		logInfo("Version %s is already running.\n", v.Number)
+		return nil
+	}
+	older, err := newer(conf.VersionComparator, newVer.Number, v.Number)
+	if err != nil {
+		return fmt.Errorf("compare version: %w", err)
+	}
+	if older && !downgrade {
+		return fmt.Errorf("%w: version %s is older than version %s running", ErrDowngrade, newVer.Number, v.Number)
+	}
+
+	store := versionStore(conf)
+	recordVersion(store, conf.VersionComparator, v.Number, false)
+	if !older && !downgrade && !conf.AllowDowngrade {
+		if err = checkDowngrade(store, conf.VersionComparator, newVer.Number); err != nil {
+			return err
+		}
+	}
+	if older {
+		logInfo("Downgrading from %s to %s.\n", v.Number, newVer.Number)
+	}
+	return u.upgrade(ctx, conf, v, newVer, store, older)
+}
+
+// findVersion returns the version listed by the Source of conf that is the same as version
+func findVersion(ctx context.Context, conf *Config, version string) (*Version, error) {
+	ls, ok := conf.Source.(ListSource)
+	if !ok {
+		return nil, fmt.Errorf("listing versions: %w", ErrNotSupported)
+	}
+	ctx, cancel := withTimeout(withCheckSettings(ctx, conf), conf.CheckTimeout)
+	defer cancel()
+
+	var versions []*Version
+	var err error
+	if cls, ok := ls.(interface {
+		ListVersionsContext(ctx context.Context) ([]*Version, error)
+	}); ok {
+		versions, err = cls.ListVersionsContext(ctx)
+	} else {
+		versions, err = ls.ListVersions()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list versions: %w", err)
+	}
+	for _, v := range versions {
+		if strings.TrimSpace(v.Number) == strings.TrimSpace(version) {
+			return v, nil
+		}
+		if same, err := conf.comparator().Compare(v.Number, version); err == nil && same == 0 {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, version)
+}
@@ -0,0 +1,39 @@
+package selfupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateToVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"os":%[1]q,"version":"1.3.0"},
+			{"os":%[1]q,"version":"1.2.0"},
+			{"os":%[1]q,"version":"1.1.0","consent":{"text":"terms"}}
+		]`, runtime.GOOS)
+	}))
+	defer server.Close()
+
+	store := &memoryVersionStore{}
+	u := &Updater{conf: &Config{
+		Current:      &Version{Number: "1.2.0"},
+		Source:       NewHTTPSource(nil, server.URL),
+		VersionStore: store,
+	}}
+	assert.ErrorIs(t, u.UpdateToVersion("1.4.0", false), ErrVersionNotFound)
+	assert.Nil(t, u.UpdateToVersion("1.2.0", false))
+	assert.ErrorIs(t, u.UpdateToVersion("1.1.0", false), ErrDowngrade)
+
+	// the downgrade goes as far as asking for the consent of 1.1.0
+	assert.ErrorIs(t, u.UpdateToVersion("1.1.0", true), ErrConsentRequired)
+	assert.Equal(t, "1.2.0", store.version)
+
+	u.conf.Source = &hungSource{}
+	assert.ErrorIs(t, u.UpdateToVersion("1.3.0", false), ErrNotSupported)
+}
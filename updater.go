@@ -1,35 +1,113 @@
 package selfupdate
 
 import (
+	"context"
+	"crypto"
 	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
+
+	"github.com/Lamdt03/selfupdate/verify"
 )
 
 // ErrNotSupported is returned by `Manage` when it is not possible to manage the current application.
 var ErrNotSupported = errors.New("operating system not supported")
 
-// Source define an interface that is able to get an update
+// Source define an interface that is able to get an update. Implementations must be safe for concurrent use,
+// so that one Source can back both a Schedule and user triggered checks. The signature and sidecar files
+// match the last executable returned by Get.
 type Source interface {
 	Get(*Version) (io.ReadCloser, int64, error) // Get the executable to be updated to
-	GetSignature() ([64]byte, error)            // Get the signature that match the executable
+	GetSignature() ([]byte, error)              // Get the signature that match the executable
 	LatestVersion() (*Version, error)           // Get the latest version information to determine if we should trigger an update
 }
 
 // Config define extra parameter necessary to manage the updating process
 type Config struct {
-	Current   *Version          // If present will define the current version of the executable that need update
-	Source    Source            // Necessary Source for update
-	Schedule  Schedule          // Define when to trigger an update
-	PublicKey ed25519.PublicKey // The public key that match the private key used to generate the signature of future update
-
-	ProgressCallback       func(float64, error) // if present will call back with 0.0 at the start, rising through to 1.0 at the end if the progress is known. A negative start number will be sent if size is unknown, any error will pass as is and the process is considered done
-	RestartConfirmCallback func() bool          // if present will ask for user acceptance before restarting app
-	UpgradeConfirmCallback func(string) bool    // if present will ask for user acceptance, it can present the message passed
-	ExitCallback           func(error)          // if present will be expected to handle app exit procedure
+	Current              *Version              // If present will define the current version of the executable that need update
+	Source               Source                // Necessary Source for update
+	Schedule             Schedule              // Define when to trigger an update
+	PublicKey            ed25519.PublicKey     // The public key that match the private key used to generate the signature of future update
+	Verifier             Verifier              // If present, used instead of PublicKey to verify the signature of future update, for RSA, ECDSA, HSM-backed keys or a rotating KeyRing
+	SignedDigest         crypto.Hash           // If present, signatures made with PublicKey are over this digest of the update, as made by "selfupdatectl sign --digest", so that large updates are verified in constant memory
+	MaxMessageSize       int64                 // If present, updates larger than this are refused when signatures made with PublicKey are over the whole update, rather than held in memory to be verified
+	GPGVerifier          *GPGVerifier          // If present, the update must also carry a valid OpenPGP signature provided by a GPGSource
+	MinisignVerifier     *MinisignVerifier     // If present, the update must also carry a valid minisign or signify signature provided by a MinisignSource
+	CosignVerifier       *CosignVerifier       // If present, the update must also carry a valid cosign bundle provided by a CosignSource
+	AttestationVerifier  *AttestationVerifier  // If present, the update must carry a SLSA provenance satisfying its policy provided by an AttestationSource
+	AuthenticodeVerifier *AuthenticodeVerifier // If present, on Windows the update must also carry a valid Authenticode signature from the expected publisher
+	CodesignVerifier     *CodesignVerifier     // If present, on macOS the update must also be code signed by the expected team, and notarized if required
+	Staging              StagingStrategy       // If present will define where the update is written before replacing the executable
+	InstallRoot          string                // Directory Version.InstallPath is relative to, default to the directory of the executable
+	LinkPath             string                // Symlink to point at a relocated executable, default to the previous executable path
+	Installer            *Installer            // If present, on Windows the update is an installer run silently once verified, after the application exits
+	ZsyncClient          *http.Client          // If present, an AppImage is rebuilt from the blocks it shares with the update, the others downloaded with this client as described by the zsync file of its embedded update information
+	AppBundle            bool                  // if true, on macOS the whole .app bundle the executable runs from is replaced by the one in the archive of the update, always the case for dmg disk images
+	BurnIn               *BurnIn               // If present, the staged update must pass these self tests before replacing the executable
+	SmokeTest            *SmokeTest            // If present, the staged update is run with this command, like --version, from a temporary directory and must exit successfully reporting its version before replacing the executable
+	Device               string                // If present, updates are firmware images written to this raw device or MTD partition, see Options.Device
+	ArchiveMember        string                // Template, accepting the parameters of NewHTTPSource, of the pattern selecting the executable in archived releases, see Options.ArchiveMember
+
+	StallTimeout time.Duration // if present, a download that doesn't receive any data for that long is aborted and resumed from the last received byte when the Source is a RangeSource
+	StallRetries int           // Maximum number of time a stalled download is resumed, default to 3
+
+	RateLimit int64 // if present, downloads are limited to that many bytes per second so background updates don't saturate the connection
+	RateBurst int64 // Number of bytes that can be read at once above RateLimit, default to RateLimit
+
+	PropagationTimeout time.Duration // if present, when the executable or signature of an announced version is not published yet, the download is retried with backoff for that long instead of failing right away
+
+	CheckTimeout     time.Duration // if present, how long looking for the latest version can take, whatever the http.Client of the Source allows
+	SignatureTimeout time.Duration // if present, how long fetching the signatures of an update can take
+	DownloadTimeout  time.Duration // if present, how long downloading an update can take, from the request to the last byte
+	UpdateTimeout    time.Duration // if present, the deadline of a whole update, from the check to the installation
+
+	MinCheckInterval time.Duration // if present, CheckNow does nothing if the last check recorded in CheckStore is more recent, so frequent launches don't hammer the update server
+	CheckStore       CheckStore    // If present will define where the time of the last check is persisted, default to a file in the user configuration directory
+
+	RequireChecksum      bool                 // if true, refuse an update whose digest is not announced by the Version or a HashSource
+	AllowDowngrade       bool                 // if true, apply an update even if it is older than the highest version ever installed
+	VersionComparator    VersionComparator    // If present, how versions are ordered to find updates, like CalVerComparator or NumericComparator, default to SemVerComparator
+	AllowPrerelease      bool                 // if true, prerelease versions like 1.2.0-rc.1 are installed, they are skipped by default unless they belong to a channel subscribed to
+	VersionStore         VersionStore         // If present will define where the highest version ever installed is persisted, default to a file in the user configuration directory. Moving off a version yanked by a signed manifest lower it and, for a YankedVersionStore, record the yanked version
+	Policy               UpdatePolicy         // If present, decide if and when an available update is applied
+	PolicyFacts          map[string]string    // Local facts passed to the Policy, like the role or site of the device
+	EndOfSupportReporter EndOfSupportReporter // If present, notified once when the running version is past its end of support according to a SupportSource
+	PreloadDir           string               // Directory where artifacts given to Updater.PreloadArtifact are kept, default to a directory in the user cache directory
+	CacheSize            int64                // if present, downloads announcing a digest are kept in CacheDir, up to this many bytes, so that an update not applied yet isn't downloaded again
+	CacheDir             string               // Directory where downloads are cached, default to a directory in the user cache directory
+	KeepVersions         int                  // if present, that many previous versions are kept on disk so Updater.Rollback can revert to them without downloading anything
+	RetentionDir         string               // Directory where previous versions are kept, default to a directory in the user configuration directory
+	HealthWindow         time.Duration        // if present, after an update the new version must call Updater.MarkHealthy within that long once started, or the previous version is restored and restarted
+	HealthStore          HealthStore          // If present will define where the state of the last update is persisted, default to a file in the user configuration directory
+	RolloutID            string               // If present, stable identifier of this installation deciding if it is in the cohort of a staged rollout, default to a random one persisted in the user configuration directory
+	ReceiptStore         ReceiptStore         // If present will define where the consents accepted are recorded, default to a file in the user configuration directory
+	KeyStore             KeyStore             // If present will define where the key bundles applied to a KeyRing created with NewRootKeyRing are persisted, default to a file in the user configuration directory
+	Disabled             bool                 // if true, update checks are skipped, this can be toggled with Updater.Reconfigure
+	Elevate              bool                 // if true, an executable in a directory that is not writable is replaced with elevated privileges, after a UAC prompt on Windows, an administrator prompt on macOS, with pkexec or sudo elsewhere, ErrNeedsElevation is returned otherwise
+	UserInstall          bool                 // if true, when an executable in a directory that is not writable can't be replaced, the update is installed in UserInstallDir for the user only and UserLinkPath pointed at it
+	UserInstallDir       string               // Directory the executable is installed in for the user, default to a directory in the user data directory, like ~/.local/share on Linux or %LocalAppData% on Windows
+	UserLinkPath         string               // Symlink, or batch file if it ends with .cmd or .bat, pointing to the executable installed for the user, default to ~/.local/bin on Unix and none on Windows
+	LockPath             string               // File locked while an update is installed so that instances of the application don't update at the same time, default to a file next to the executable, or in the user configuration directory if it is not writable
+
+	ProgressCallback       func(float64, error)          // if present will call back with 0.0 at the start, rising through to 1.0 at the end if the progress is known. A negative start number will be sent if size is unknown, any error will pass as is and the process is considered done, except ErrDownloadStalled that is reported when a stalled download is resumed
+	RestartConfirmCallback func() bool                   // if present will ask for user acceptance before restarting app
+	UpgradeConfirmCallback func(string) bool             // if present will ask for user acceptance, it can present the message passed
+	ExitCallback           func(error)                   // if present will be expected to handle app exit procedure, the updated executable is then spawned instead of replacing the process on Unix
+	BeforeRestartCallback  func() error                  // if present will be called before restarting the updated executable to flush state, the restart is aborted if it fails
+	ShutdownHooks          []func(context.Context) error // if present will be called in order before restarting, to drain connections, finish jobs or close databases, the restart is aborted if one fails or they don't complete within ShutdownTimeout
+	ShutdownTimeout        time.Duration                 // How long ShutdownHooks can take together, default to 30 seconds
+	ConfigReloadedCallback func(*Config)                 // if present will be called after the configuration was replaced by Updater.Reconfigure
+	RelocateCallback       func(string, string)          // if present will be called with the previous and new executable path after an update relocated it, to migrate state and launchers
+	HopHealthCheck         func(string, *Version) error  // if present will be called with the executable path after each intermediate version of a multi-hop upgrade is installed, for example to run its data migration, the upgrade stops there if it fails
+	ConsentCallback        func(string, *Consent) bool   // if present will present the consent attached to a version and return true if the user accepted it, required to install such versions
 }
 
 // Repeating pattern for scheduling update at a specific time
@@ -54,91 +132,614 @@ type ScheduleAt struct {
 
 // Schedule define when to trigger an update
 type Schedule struct {
-	FetchOnStart bool          // Trigger when the updater is created
-	Interval     time.Duration // Trigger at regular interval
-	At           ScheduleAt    // Trigger at a specific time
+	FetchOnStart bool            // Trigger when the updater is created
+	Interval     time.Duration   // Trigger at regular interval
+	At           ScheduleAt      // Trigger at a specific time
+	Trigger      <-chan struct{} // Trigger every time a value is received, for example from MessageSource.Trigger
+	OnResume     bool            // Trigger as soon as the system resumes from sleep if Interval or At elapsed while asleep, instead of waiting out the schedule. Resumes are noticed by polling the wall clock every 30 seconds
 }
 
 // Version define an executable versionning information
 type Version struct {
 	Number string    // if the app knows its version and supports checking metadata
 	Build  int       // if the app has a build number this could be compared
-	Date   time.Time // last update, could be mtime
+	Date   time.Time // last update, could be mtime, or when the version was published for the versions returned by a Source
+
+	DigestHash  crypto.Hash  // Hash function used to compute Digest, SHA-256 or SHA-512
+	Digest      []byte       // if present, the expected digest of the executable for this version
+	Executable  string       // if present, the file name this version should be installed as, for example MyApp.exe
+	InstallPath string       // if present, the path relative to Config.InstallRoot this version should be installed at
+	Size        int64        // if present, the exact length of the executable for this version
+	Signature   []byte       // if present, the signature of the executable for this version, used instead of the one provided by the Source
+	Consent     *Consent     // if present, the text the user must accept through Config.ConsentCallback before this version is installed
+	Codec       string       // if present, the codec the executable is compressed with, guessed from the extension of the download URL otherwise
+	Archive     string       // if present, the format of the archive, "zip" or "tar", the executable is extracted from, guessed from the extension of the download URL otherwise
+	Member      string       // if present, the pattern selecting the executable in the archive, Config.ArchiveMember otherwise
+	Files       []BundleFile // if present, the other files of the archive installed with the executable, see Options.Files
+	Channel     string       // the release channel of this version, like stable, beta or nightly
+
+	ReleaseNotes    string   // if present, what changed in this version, in markdown, see Updater.GetReleaseNotes
+	ReleaseNotesURL string   // if present, where the markdown release notes of this version can be downloaded
+	MinimumVersion  string   // if present, versions older than this one are no longer supported and must update, see UpdateRequired
+	Mandatory       bool     // if true, every older version must update to this one, see UpdateRequired
+	Criticality     string   // if present, how important installing this version is, like "low", "security" or "critical", to decide how insistently to prompt
+	URL             string   // if present, where the executable of this version is downloaded from
+	Rollout         *float64 // if present, the percentage of clients this version is released to, others keep their version until it is dialed up
 }
 
 // Updater is managing update for your application in the background
 type Updater struct {
 	lock       sync.Mutex
+	confLock   sync.Mutex
 	conf       *Config
 	executable string
+	reschedule chan struct{}
+	resumed    chan struct{}
+
+	scheduleOnce sync.Once // starts the scheduler once Interval or At is configured
+	wakeOnce     sync.Once // starts the wake detection once OnResume is configured
+
+	endOfSupportReported string    // version whose end of support was already reported, u.lock must be held
+	staged               hash.Hash // if not nil, the SHA-256 of the executable staged by install, u.lock must be held
+
+	healthLock  sync.Mutex
+	healthTimer *time.Timer // rolls back the running update unless MarkHealthy is called first
+}
+
+func (u *Updater) config() *Config {
+	u.confLock.Lock()
+	defer u.confLock.Unlock()
+	return u.conf
+}
+
+// Reconfigure replace the configuration of a running Updater. The schedule is recomputed immediately,
+// and an update check already in progress will complete with the previous configuration.
+// Schedule.Trigger can not be changed once the Updater is managed.
+func (u *Updater) Reconfigure(conf *Config) error {
+	if conf == nil || conf.Source == nil {
+		return errors.New("a Source is required")
+	}
+
+	u.confLock.Lock()
+	u.conf = conf
+	u.confLock.Unlock()
+
+	u.startSchedule(conf)
+	select {
+	case u.reschedule <- struct{}{}:
+	default:
+	}
+
+	logInfo("Updater configuration reloaded.\n")
+	if reloaded := conf.ConfigReloadedCallback; reloaded != nil {
+		reloaded(conf)
+	}
+	return nil
 }
 
 // CheckNow will manually trigger a check of an update and if one is present will start the update process
 func (u *Updater) CheckNow() error {
+	return u.CheckNowContext(context.Background())
+}
+
+// CheckNowContext is CheckNow, giving up once ctx is done. A download interrupted by ctx is not applied and the
+// executable is left untouched.
+func (u *Updater) CheckNowContext(ctx context.Context) error {
 	u.lock.Lock()
 	defer u.lock.Unlock()
 
-	v := u.conf.Current
+	conf := u.config()
+	if conf.Disabled {
+		logInfo("Update checks are disabled by configuration.\n")
+		return nil
+	}
 
-	newVer, err := u.conf.Source.LatestVersion()
+	now := time.Now()
+	if checkedRecently(conf, now) {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, conf.UpdateTimeout)
+	defer cancel()
+	v := conf.Current
+
+	newVer, err := checkLatestVersion(ctx, conf)
 	if err != nil {
 		return fmt.Errorf("get latest version: %w", err)
 	}
+	recordCheck(conf, now, newVer.Number)
 
-	isUpdate, err := compare(v.Number, newVer.Number)
+	u.reportEndOfSupport(conf, v.Number, newVer.Number)
+
+	isUpdate, err := newer(conf.VersionComparator, v.Number, newVer.Number)
 	if err != nil {
 		return fmt.Errorf("compare version: %w", err)
 	}
+	prerelease := skipPrerelease(conf, newVer)
+	if isUpdate && prerelease {
+		logInfo("Skipping prerelease version %s.\n", newVer.Number)
+		isUpdate = false
+	}
+	failed := failedUpdate(conf, newVer.Number)
+	if isUpdate && failed {
+		logInfo("Skipping version %s, it was rolled back for not becoming healthy.\n", newVer.Number)
+		isUpdate = false
+	}
+	message := "New version found"
+	required := isUpdate && updateRequired(conf.VersionComparator, v.Number, newVer)
+	if required {
+		message = "Required update found"
+	}
+	yanked := false
+	if !isUpdate && !prerelease && !failed && newVer.Number != v.Number && isYanked(conf.Source, v.Number) {
+		logInfo("Version %s has been yanked, moving to %s.\n", v.Number, newVer.Number)
+		isUpdate, yanked = true, true
+		message = "Current version has been withdrawn"
+	}
+
+	store := versionStore(conf)
+	recordVersion(store, conf.VersionComparator, v.Number, false)
+	// only a signed manifest can move the installation to an older version, anyone serving a manifest could
+	// otherwise roll it back to an old release with known flaws
+	if yanked && !signedYanks(conf.Source) {
+		logInfo("The manifest yanking version %s isn't signed, the move to %s is checked like a downgrade.\n", v.Number, newVer.Number)
+		yanked = false
+	}
+	if yanked {
+		recordYanked(store, v.Number)
+	}
+	if isUpdate && !yanked && !rolledOut(conf, newVer) {
+		logInfo("Version %s is not rolled out to this installation yet.\n", newVer.Number)
+		return nil
+	}
+	if isUpdate && !yanked && !conf.AllowDowngrade {
+		if err = checkDowngrade(store, conf.VersionComparator, newVer.Number); err != nil {
+			return err
+		}
+	}
+	if isUpdate {
+		allowed, err := allowedByPolicy(conf, v.Number, newVer, yanked)
+		if err != nil || !allowed {
+			return err
+		}
+	}
+
 	if isUpdate {
-		if ask := u.conf.UpgradeConfirmCallback; ask != nil {
-			if !ask("New version found") {
+		if ask := conf.UpgradeConfirmCallback; ask != nil {
+			if !ask(message) {
 				logInfo("The user didn't confirm the upgrade.\n")
+				if required {
+					return fmt.Errorf("%w: version %s", ErrUpdateRequired, newVer.Number)
+				}
 				return nil
 			}
 		}
 	} else {
 		return nil
 	}
+	return u.upgrade(ctx, conf, v, newVer, store, yanked)
+}
 
-	r, contentLength, err := u.conf.Source.Get(v)
+// upgrade install newVer over the running version v, through the intermediate versions it requires unless direct
+// is true, then restart. A direct move, like off a yanked version or a downgrade, is recorded as the highest
+// version installed even if it is lower.
+func (u *Updater) upgrade(ctx context.Context, conf *Config, v *Version, newVer *Version, store VersionStore, direct bool) error {
+	var err error
+	hops := []*Version{newVer}
+	if !direct {
+		if hops, err = upgradePath(conf.Source, v.Number, newVer); err != nil {
+			return err
+		}
+	}
+	for _, hop := range hops {
+		if accepted, err := obtainConsent(conf, hop); err != nil || !accepted {
+			return err
+		}
+	}
+
+	previous, _ := ExecutableRealPath()
+	unlock, err := lockUpdate(conf, previous)
 	if err != nil {
 		return err
 	}
-
-	s, err := u.conf.Source.GetSignature()
+	if conf.Installer != nil && runtime.GOOS == "windows" {
+		// the installer replaces the whole installation, intermediate versions are not needed
+		staged, sum, err := u.stageInstaller(ctx, conf, newVer)
+		unlock()
+		if err != nil {
+			return err
+		}
+		if ask := conf.RestartConfirmCallback; ask != nil && !ask() {
+			logInfo("The user didn't confirm restarting the application to run the installer.\n")
+			return os.RemoveAll(filepath.Dir(staged))
+		}
+		recordVersion(store, conf.VersionComparator, newVer.Number, direct)
+		return u.handOff(conf, newVer, staged, sum)
+	}
+	err = u.installHops(ctx, conf, v, hops, store, direct, previous)
+	unlock()
 	if err != nil {
 		return err
 	}
+	recordPendingUpdate(conf, v.Number, previous, newVer.Number, u.executable)
+	if relocated := conf.RelocateCallback; relocated != nil && previous != "" && u.executable != previous {
+		relocated(previous, u.executable)
+	}
 
-	defer r.Close()
+	if ask := conf.RestartConfirmCallback; ask != nil {
+		if !ask() {
+			logInfo("The user didn't confirm restarting the application after upgrade.\n")
+			return nil
+		}
+	}
+	return u.Restart()
+}
+
+// installHops install hops one after the other over the running version v, whose executable is previous
+func (u *Updater) installHops(ctx context.Context, conf *Config, v *Version, hops []*Version, store VersionStore, direct bool, previous string) error {
+	retainVersion(conf, v.Number, previous)
+	target, from := "", v.Number
+	for i, hop := range hops {
+		if err := u.install(ctx, conf, from, hop, target); err != nil {
+			return err
+		}
+		recordVersion(store, conf.VersionComparator, hop.Number, direct)
+		target, from = u.executable, hop.Number
+
+		if check := conf.HopHealthCheck; check != nil && i < len(hops)-1 {
+			if err := check(u.executable, hop); err != nil {
+				return fmt.Errorf("health check of intermediate version %s: %w", hop.Number, err)
+			}
+		}
+	}
+	return nil
+}
+
+// install download, verify and apply newVer over target, or the running executable if empty
+func (u *Updater) install(ctx context.Context, conf *Config, from string, newVer *Version, target string) error {
+	dest := target
+	if dest == "" {
+		dest, _ = ExecutableRealPath()
+	}
+	if dest != "" && conf.Device == "" && !writableDir(filepath.Dir(dest)) {
+		err := fmt.Errorf("%w: %s is not writable", ErrNeedsElevation, filepath.Dir(dest))
+		if conf.Elevate {
+			err = u.installElevated(ctx, conf, from, newVer, dest)
+		}
+		if errors.Is(err, ErrNeedsElevation) && conf.UserInstall {
+			err = u.installForUser(ctx, conf, from, newVer, dest)
+		}
+		return err
+	}
+
+	err := u.installDelta(ctx, conf, from, newVer, target)
+	if err == nil || RollbackError(err) != nil || ctx.Err() != nil {
+		return err
+	}
+	if !errors.Is(err, errNoDelta) {
+		logInfo("Delta update failed, downloading the full executable: %v\n", err)
+	}
+
+	err = u.installZsync(ctx, conf, newVer, target)
+	if err == nil || RollbackError(err) != nil || ctx.Err() != nil {
+		return err
+	}
+	if !errors.Is(err, errNoBlockIndex) {
+		logInfo("zsync update failed, downloading the full AppImage: %v\n", err)
+	}
 
-	pr := &progressReader{Reader: r, progressCallback: u.conf.ProgressCallback, contentLength: contentLength}
+	r, contentLength, opts, err := u.fetchBlocks(ctx, conf, newVer, target)
+	if err != nil {
+		if RollbackError(err) != nil || ctx.Err() != nil {
+			return err
+		}
+		if !errors.Is(err, errNoBlockIndex) {
+			logInfo("Block update failed, downloading the full executable: %v\n", err)
+		}
+		if r, contentLength, opts, err = u.fetch(ctx, conf, newVer); err != nil {
+			return err
+		}
+	}
 
-	u.executable, err = applyUpdate(pr, u.conf.PublicKey, s)
+	r, err = u.pipeline(ctx, conf, newVer, r, contentLength)
 	if err != nil {
 		return err
 	}
+	defer r.Close()
 
-	if ask := u.conf.RestartConfirmCallback; ask != nil {
-		if !ask() {
-			logInfo("The user didn't confirm restarting the application after upgrade.\n")
+	opts.TargetPath = target
+	if runtime.GOOS == "darwin" && (conf.AppBundle || opts.Archive == "dmg") {
+		opts.AppBundle = appBundleOf(dest)
+	}
+	opts.staged = u.staged
+	u.executable, err = applyUpdate(r, opts)
+	r.Close()
+	discardPreloaded(conf, newVer)
+	return err
+}
+
+// fetchOnce start the download of newVer and fetch everything needed to verify it
+func (u *Updater) fetchOnce(ctx context.Context, conf *Config, newVer *Version) (io.ReadCloser, int64, *Options, error) {
+	r, contentLength, err := getArtifact(ctx, conf, newVer)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	opts, err := u.options(ctx, conf, newVer)
+	if err != nil {
+		// don't leak the download if the signatures can't be fetched
+		r.Close()
+		return nil, 0, nil, err
+	}
+	return r, contentLength, opts, nil
+}
+
+// options returns the options newVer is applied with, fetching everything needed to verify it
+func (u *Updater) options(ctx context.Context, conf *Config, newVer *Version) (*Options, error) {
+	ctx, cancel := withTimeout(ctx, conf.SignatureTimeout)
+	defer cancel()
+	var err error
+	codec, archive, member := payloadFormat(conf, newVer)
+	opts := &Options{
+		Staging:     conf.Staging,
+		RenameTo:    newVer.Executable,
+		RelocateTo:  newVer.InstallPath,
+		InstallRoot: conf.InstallRoot,
+		LinkPath:    conf.LinkPath,
+		Device:      conf.Device,
+
+		Codec:         codec,
+		Archive:       archive,
+		ArchiveMember: member,
+		Files:         newVer.Files,
+
+		AuthenticodeVerifier: conf.AuthenticodeVerifier,
+		CodesignVerifier:     conf.CodesignVerifier,
+	}
+	if burnIn := conf.BurnIn; burnIn != nil {
+		reporter := burnIn.Reporter
+		if reporter == nil {
+			reporter, _ = conf.Source.(BurnInReporter)
+		}
+		opts.BurnIn = func(staged string) error {
+			return burnIn.run(staged, newVer, reporter)
+		}
+	}
+	if smoke := conf.SmokeTest; smoke != nil {
+		burnIn := opts.BurnIn
+		opts.BurnIn = func(staged string) error {
+			if err := smoke.run(staged, newVer.Number); err != nil {
+				return err
+			}
+			if burnIn != nil {
+				return burnIn(staged)
+			}
 			return nil
 		}
 	}
-	return u.Restart()
+	if requireSignature(conf) {
+		s := newVer.Signature
+		if s == nil {
+			if s, err = getSignature(ctx, conf.Source, newVer); err != nil {
+				return nil, err
+			}
+		}
+		opts.Signature = s
+		opts.Verifier = conf.Verifier
+		if ring, ok := opts.Verifier.(*KeyRing); ok {
+			updateRootKeys(ctx, ring, conf, newVer)
+			updateKeyRing(ctx, ring, conf.Source, newVer)
+		}
+		if opts.Verifier == nil && conf.SignedDigest != 0 {
+			opts.Verifier = verify.NewED25519Digest(conf.PublicKey, conf.SignedDigest)
+		} else if opts.Verifier == nil {
+			opts.Verifier = verify.NewED25519Limit(conf.PublicKey, conf.MaxMessageSize)
+		}
+	}
+	if conf.GPGVerifier != nil {
+		if err = gpgSignature(ctx, opts, conf, newVer); err != nil {
+			return nil, err
+		}
+	}
+	if conf.MinisignVerifier != nil {
+		if err = minisignSignature(ctx, opts, conf, newVer); err != nil {
+			return nil, err
+		}
+	}
+	if conf.CosignVerifier != nil {
+		if err = cosignBundle(ctx, opts, conf, newVer); err != nil {
+			return nil, err
+		}
+	}
+	if conf.AttestationVerifier != nil {
+		if err = attestation(ctx, opts, conf, newVer); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// payloadFormat returns the codec the download of v is compressed with and the format of the archive it is, as
+// announced by the manifest or guessed from the extension of its URL, and the pattern selecting the executable
+// in the archive
+func payloadFormat(conf *Config, v *Version) (string, string, string) {
+	codec, archive := v.Codec, v.Archive
+	if r, ok := conf.Source.(urlResolver); ok && (codec == "" || archive == "") {
+		url := r.resolve(v)
+		if codec == "" {
+			codec = codecFromURL(url)
+		}
+		if archive == "" {
+			archive = archiveFromURL(url)
+		}
+	}
+
+	member := v.Member
+	if member == "" {
+		member = conf.ArchiveMember
+	}
+	if member != "" {
+		member = expandURLTemplate(member, v)
+	}
+	return codec, archive, member
+}
+
+// requireSignature report if updates must carry a signature for conf.PublicKey or conf.Verifier, which is the
+// case unless only other signature formats are configured
+func requireSignature(conf *Config) bool {
+	return conf.PublicKey != nil || conf.Verifier != nil || (conf.GPGVerifier == nil && conf.MinisignVerifier == nil && conf.CosignVerifier == nil)
+}
+
+func gpgSignature(ctx context.Context, opts *Options, conf *Config, v *Version) error {
+	gs, ok := conf.Source.(GPGSource)
+	if !ok {
+		return errors.New("source doesn't provide OpenPGP signature")
+	}
+	var signature []byte
+	var err error
+	if cs, ok := gs.(GPGContextSource); ok {
+		signature, err = cs.GetGPGSignatureContext(ctx, v)
+	} else {
+		signature, err = getBytes(ctx, gs.GetGPGSignature)
+	}
+	if err != nil {
+		return err
+	}
+	opts.GPGSignature = signature
+	opts.GPGVerifier = conf.GPGVerifier
+	return nil
+}
+
+func minisignSignature(ctx context.Context, opts *Options, conf *Config, v *Version) error {
+	ms, ok := conf.Source.(MinisignSource)
+	if !ok {
+		return errors.New("source doesn't provide minisign signature")
+	}
+	var signature []byte
+	var err error
+	if cs, ok := ms.(MinisignContextSource); ok {
+		signature, err = cs.GetMinisignSignatureContext(ctx, v)
+	} else {
+		signature, err = getBytes(ctx, ms.GetMinisignSignature)
+	}
+	if err != nil {
+		return err
+	}
+	opts.MinisignSignature = signature
+	opts.MinisignVerifier = conf.MinisignVerifier
+	return nil
 }
 
-// Restart once an update is done can trigger a restart of the binary. This is useful to implement a restart later policy.
+func cosignBundle(ctx context.Context, opts *Options, conf *Config, v *Version) error {
+	cs, ok := conf.Source.(CosignSource)
+	if !ok {
+		return errors.New("source doesn't provide cosign bundle")
+	}
+	var bundle []byte
+	var err error
+	if ccs, ok := cs.(CosignContextSource); ok {
+		bundle, err = ccs.GetCosignBundleContext(ctx, v)
+	} else {
+		bundle, err = getBytes(ctx, cs.GetCosignBundle)
+	}
+	if err != nil {
+		return err
+	}
+	opts.CosignBundle = bundle
+	opts.CosignVerifier = conf.CosignVerifier
+	return nil
+}
+
+func attestation(ctx context.Context, opts *Options, conf *Config, v *Version) error {
+	as, ok := conf.Source.(AttestationSource)
+	if !ok {
+		return errors.New("source doesn't provide attestation")
+	}
+	var a []byte
+	var err error
+	if cs, ok := as.(AttestationContextSource); ok {
+		a, err = cs.GetAttestationContext(ctx, v)
+	} else {
+		a, err = getBytes(ctx, as.GetAttestation)
+	}
+	if err != nil {
+		return err
+	}
+	opts.Attestation = a
+	opts.AttestationVerifier = conf.AttestationVerifier
+	return nil
+}
+
+// checksumReader wrap r to verify the digest announced by the version or the source, if any
+func (u *Updater) checksumReader(ctx context.Context, v *Version, r io.ReadCloser) (io.ReadCloser, error) {
+	h, digest := v.DigestHash, v.Digest
+	if digest == nil {
+		if hs, ok := u.config().Source.(HashSource); ok {
+			var err error
+			h, digest, err = getHash(ctx, hs, v)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				logDebug("No checksum available: %v\n", err)
+				digest = nil
+			}
+		}
+	}
+
+	if digest == nil {
+		if u.config().RequireChecksum {
+			return nil, ErrNoChecksum
+		}
+		return r, nil
+	}
+	return newHashReader(r, h, digest)
+}
+
+func (u *Updater) stallReader(ctx context.Context, v *Version, r io.ReadCloser, contentLength int64) io.ReadCloser {
+	conf := u.config()
+	retries := conf.StallRetries
+	if retries == 0 {
+		retries = 3
+	}
+
+	return &stallReader{
+		body:    r,
+		timeout: conf.StallTimeout,
+		retries: retries,
+		reopen: func(offset int64) (io.ReadCloser, error) {
+			rs, ok := conf.Source.(RangeSource)
+			if !ok {
+				return nil, fmt.Errorf("source doesn't support resuming download")
+			}
+			body, _, err := resumeDownload(ctx, rs, v, offset)
+			return body, err
+		},
+		onStall: func(offset int64, err error) {
+			if conf.ProgressCallback == nil {
+				return
+			}
+			if contentLength > 0 {
+				conf.ProgressCallback(float64(offset)/float64(contentLength), err)
+			} else {
+				conf.ProgressCallback(float64(contentLength), err)
+			}
+		},
+	}
+}
+
+// Restart once an update is done can trigger a restart of the binary with the arguments, environment and working
+// directory the application was launched with. This is useful to implement a restart later policy.
 func (u *Updater) Restart() error {
-	return restart(u.conf.ExitCallback, u.executable)
+	return restart(u.config(), u.executable)
 }
 
 // Manage sets up an Updater and runs it to manage the current executable.
 func Manage(conf *Config) (*Updater, error) {
-	updater := &Updater{conf: conf}
+	updater := &Updater{conf: conf, reschedule: make(chan struct{}, 1), resumed: make(chan struct{}, 1)}
+	updater.guardUpdate()
 
 	go func() {
-		if updater.conf.Schedule.FetchOnStart {
+		if updater.config().Schedule.FetchOnStart {
 			logInfo("Doing an initial upgrade check.\n")
 			err := updater.CheckNow()
 			if err != nil {
@@ -146,9 +747,11 @@ func Manage(conf *Config) (*Updater, error) {
 			}
 		}
 
-		if updater.conf.Schedule.Interval != 0 || updater.conf.Schedule.At.Repeating != None {
+		updater.startSchedule(updater.config())
+
+		if updater.config().Schedule.Trigger != nil {
 			go func() {
-				triggerSchedule(updater)
+				triggerOnNotification(updater)
 			}()
 		}
 	}()
@@ -159,26 +762,28 @@ func Manage(conf *Config) (*Updater, error) {
 
 // ManualUpdate applies a specific update manually instead of managing the update of this app automatically.
 func ManualUpdate(s Source, publicKey ed25519.PublicKey) error {
+	return ManualUpdateContext(context.Background(), s, publicKey)
+}
+
+// ManualUpdateContext is ManualUpdate, giving up once ctx is done without touching the executable
+func ManualUpdateContext(ctx context.Context, s Source, publicKey ed25519.PublicKey) error {
 	v := &Version{}
-	r, _, err := s.Get(v)
+	r, _, err := getExecutable(ctx, s, v)
 	if err != nil {
 		return err
 	}
+	defer r.Close()
 
-	signature, err := s.GetSignature()
+	signature, err := getSignature(ctx, s, v)
 	if err != nil {
 		return err
 	}
 
-	_, err = applyUpdate(r, publicKey, signature)
+	_, err = applyUpdate(r, &Options{Signature: signature, Verifier: NewED25519Verifier(publicKey)})
 	return err
 }
 
-func applyUpdate(r io.Reader, publicKey ed25519.PublicKey, signature [64]byte) (string, error) {
-	opts := &Options{}
-	opts.Signature = signature[:]
-	opts.PublicKey = publicKey
-
+func applyUpdate(r io.Reader, opts *Options) (string, error) {
 	err := apply(r, opts)
 	if err != nil {
 		return "", err
@@ -186,21 +791,49 @@ func applyUpdate(r io.Reader, publicKey ed25519.PublicKey, signature [64]byte) (
 	return opts.TargetPath, nil
 }
 
+// startSchedule start the scheduler and the wake detection of a managed Updater once conf needs them, they keep
+// running if a later configuration doesn't
+func (u *Updater) startSchedule(conf *Config) {
+	if u.reschedule == nil {
+		return
+	}
+	if conf.Schedule.Interval != 0 || conf.Schedule.At.Repeating != None {
+		u.scheduleOnce.Do(func() {
+			go triggerSchedule(u)
+		})
+	}
+	if conf.Schedule.OnResume {
+		u.wakeOnce.Do(func() {
+			go watchWake(u)
+		})
+	}
+}
+
 func triggerSchedule(updater *Updater) {
 	for {
 		var delay time.Duration
 
-		if updater.conf.Schedule.Interval != 0 {
-			delay = updater.conf.Schedule.Interval
+		schedule := updater.config().Schedule
+		if schedule.Interval != 0 {
+			delay = schedule.Interval
 		}
-		if updater.conf.Schedule.At.Repeating != None {
-			at := delayUntilNextTriggerAt(updater.conf.Schedule.At.Repeating, updater.conf.Schedule.At.Time)
+		if schedule.At.Repeating != None {
+			at := delayUntilNextTriggerAt(schedule.At.Repeating, schedule.At.Time)
 			if delay == 0 || at < delay {
 				delay = at
 			}
 		}
 
-		time.Sleep(delay)
+		if delay == 0 {
+			<-updater.reschedule
+			continue
+		}
+
+		if !waitSchedule(updater, delay) {
+			logDebug("Schedule changed, recomputing next upgrade check.\n")
+			continue
+		}
+
 		logInfo("Scheduled upgrade check after %s.\n", delay)
 		err := updater.CheckNow()
 		if err != nil {
@@ -209,6 +842,45 @@ func triggerSchedule(updater *Updater) {
 	}
 }
 
+// waitSchedule wait for delay to elapse on the wall clock, returning false if the schedule changed meanwhile.
+// The timer doesn't account for the time the system spent asleep, so it is adjusted every time it resumes, and
+// a check that became due while asleep runs right away.
+func waitSchedule(updater *Updater, delay time.Duration) bool {
+	deadline := time.Now().Round(0).Add(delay)
+	timer := time.NewTimer(delay)
+	defer func() { timer.Stop() }()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-updater.reschedule:
+			return false
+		case <-updater.resumed:
+			if !updater.config().Schedule.OnResume {
+				continue
+			}
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				logInfo("Upgrade check missed while asleep, checking now.\n")
+				return true
+			}
+			timer.Stop()
+			timer = time.NewTimer(remaining)
+		}
+	}
+}
+
+func triggerOnNotification(updater *Updater) {
+	for range updater.config().Schedule.Trigger {
+		logInfo("Notified upgrade check.\n")
+		err := updater.CheckNow()
+		if err != nil {
+			logError("Upgrade error: %v\n", err)
+		}
+	}
+}
+
 func delayUntilNextTriggerAt(repeating Repeating, offset time.Time) time.Duration {
 	now := time.Now().In(offset.Location())
 	month, day, hour := now.Month(), now.Day(), now.Hour()
@@ -40,3 +40,22 @@ func Test_DelayUntilNextTriggerAtDifferentLocatrion(t *testing.T) {
 	assert.Greater(t, hourlyTime.UnixNano(), now.UnixNano())
 	assert.Less(t, hourlyTime.UnixNano(), maxHour.UnixNano())
 }
+
+func TestReconfigure(t *testing.T) {
+	reloaded := make(chan *Config, 1)
+	u := &Updater{conf: &Config{}, reschedule: make(chan struct{}, 1)}
+
+	assert.NotNil(t, u.Reconfigure(&Config{}))
+
+	conf := &Config{
+		Source:                 &ChainedSource{},
+		Disabled:               true,
+		ConfigReloadedCallback: func(c *Config) { reloaded <- c },
+	}
+	assert.Nil(t, u.Reconfigure(conf))
+	assert.Equal(t, conf, <-reloaded)
+	assert.Equal(t, conf, u.config())
+	assert.Len(t, u.reschedule, 1)
+
+	assert.Nil(t, u.CheckNow())
+}
@@ -0,0 +1,68 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UpgradePathSource define a Source whose manifest can require a version to be installed before another, for
+// example when a data migration done by 2.0 must have run before 3.0 is started
+type UpgradePathSource interface {
+	Source
+	UpgradePath(current string, target *Version) ([]*Version, error) // Versions to install in order to go from current to target, ending with target
+}
+
+// upgradePath returns the versions to install in order to update from current to target according to source
+func upgradePath(source Source, current string, target *Version) ([]*Version, error) {
+	ups, ok := source.(UpgradePathSource)
+	if !ok {
+		return []*Version{target}, nil
+	}
+	hops, err := ups.UpgradePath(current, target)
+	if err != nil {
+		return nil, fmt.Errorf("plan upgrade path: %w", err)
+	}
+	if len(hops) > 1 {
+		numbers := make([]string, len(hops))
+		for i, hop := range hops {
+			numbers[i] = hop.Number
+		}
+		logInfo("Upgrading from %s through %s.\n", current, strings.Join(numbers, ", "))
+	}
+	return hops, nil
+}
+
+// planUpgradePath returns the entries of the manifest to install in order to update from current to target. As
+// long as target requires a newer version than the one installed, the highest version whose own requirement is
+// met is installed first. Versions are ordered by c, semver if nil.
+func planUpgradePath(c VersionComparator, appVersions []appVersion, current string, target *appVersion) ([]*appVersion, error) {
+	var path []*appVersion
+	installed := current
+	for olderThan(c, installed, target.Requires) {
+		var next *appVersion
+		for i := range appVersions {
+			a := &appVersions[i]
+			if !forPlatform(a) || a.Yanked || !olderThan(c, installed, a.Version) || !olderThan(c, a.Version, target.Version) {
+				continue
+			}
+			if a.Requires != "" && olderThan(c, installed, a.Requires) {
+				continue
+			}
+			if next == nil || olderThan(c, next.Version, a.Version) {
+				next = a
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("no upgrade path from version %s to version %s which requires version %s", current, target.Version, target.Requires)
+		}
+		path = append(path, next)
+		installed = next.Version
+	}
+	return append(path, target), nil
+}
+
+// olderThan report if version a is older than version b according to c, invalid versions are never older
+func olderThan(c VersionComparator, a, b string) bool {
+	older, err := newer(c, a, b)
+	return err == nil && older
+}
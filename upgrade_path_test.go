@@ -0,0 +1,111 @@
+package selfupdate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upgradePathServer() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/manifest" {
+			fmt.Fprint(w, r.URL.Path)
+			return
+		}
+		fmt.Fprintf(w, `[{"os":%[1]q,"version":"3.1.0","download_url":"%[2]s/3.1.0","requires":"2.0.0"},`+
+			`{"os":%[1]q,"version":"3.0.0","download_url":"%[2]s/3.0.0","requires":"2.0.0"},`+
+			`{"os":%[1]q,"version":"2.2.0","download_url":"%[2]s/2.2.0","yanked":true},`+
+			`{"os":%[1]q,"version":"2.1.0","download_url":"%[2]s/2.1.0","requires":"1.5.0",`+
+			`"consent":{"text":"New data format."}},`+
+			`{"os":%[1]q,"version":"2.0.0","download_url":"%[2]s/2.0.0"},`+
+			`{"os":%[1]q,"version":"1.5.0","download_url":"%[2]s/1.5.0"},`+
+			`{"os":"other","version":"2.5.0","download_url":"%[2]s/other"}]`, runtime.GOOS, server.URL)
+	}))
+	return server
+}
+
+func TestHTTPSourceUpgradePath(t *testing.T) {
+	server := upgradePathServer()
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL+"/manifest").(*HTTPSource)
+	latest, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.1.0", latest.Number)
+
+	for _, c := range []struct {
+		current string
+		hops    []string
+	}{
+		{"3.0.0", []string{"3.1.0"}},
+		{"2.0.0", []string{"3.1.0"}},
+		{"1.5.0", []string{"2.1.0", "3.1.0"}},
+		{"1.4.0", []string{"2.0.0", "3.1.0"}},
+		{"1.0.0", []string{"2.0.0", "3.1.0"}},
+	} {
+		hops, err := upgradePath(source, c.current, latest)
+		assert.Nil(t, err, c.current)
+		var numbers []string
+		for _, hop := range hops {
+			numbers = append(numbers, hop.Number)
+		}
+		assert.Equal(t, c.hops, numbers, c.current)
+		assert.True(t, latest == hops[len(hops)-1])
+	}
+
+	// intermediate versions are downloaded from their own URL
+	hops, err := source.UpgradePath("1.0.0", latest)
+	assert.Nil(t, err)
+	for _, hop := range hops {
+		r, _, err := source.Get(hop)
+		assert.Nil(t, err)
+		path, err := io.ReadAll(r)
+		r.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "/"+hop.Number, string(path))
+	}
+
+	_, err = planUpgradePath(nil, nil, "1.0.0", &appVersion{OS: runtime.GOOS, Version: "3.0.0", Requires: "2.0.0"})
+	assert.NotNil(t, err)
+
+	// versions are ordered by the configured comparator, not as semver
+	numeric := []appVersion{
+		{OS: runtime.GOOS, Version: "20"},
+		{OS: runtime.GOOS, Version: "30", Requires: "20"},
+		{OS: runtime.GOOS, Version: "100", Requires: "30"},
+	}
+	path, err := planUpgradePath(NumericComparator, numeric, "10", &numeric[2])
+	assert.Nil(t, err)
+	if assert.Len(t, path, 3) {
+		assert.Equal(t, "20", path[0].Version)
+		assert.Equal(t, "30", path[1].Version)
+	}
+}
+
+func TestCheckNowUpgradePathConsent(t *testing.T) {
+	server := upgradePathServer()
+	defer server.Close()
+
+	var asked []string
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.5.0"},
+		Source:                 NewHTTPSource(nil, server.URL+"/manifest"),
+		VersionStore:           &memoryVersionStore{},
+		ReceiptStore:           &memoryReceiptStore{},
+		UpgradeConfirmCallback: func(string) bool { return true },
+		ConsentCallback: func(version string, consent *Consent) bool {
+			asked = append(asked, version)
+			return false
+		},
+	}}
+
+	// the consent of an intermediate version is required before anything is installed
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []string{"2.1.0"}, asked)
+}
@@ -0,0 +1,109 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// userInstallDir returns the per-user directory the executable exe is installed in when its own directory is not
+// writable: Config.UserInstallDir, or a directory named after it in the user data directory
+func userInstallDir(conf *Config, exe string) (string, error) {
+	if conf.UserInstallDir != "" {
+		return conf.UserInstallDir, nil
+	}
+	var base string
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		// %LocalAppData%, the roaming profile is no place for executables
+		base, err = os.UserCacheDir()
+	case "darwin", "ios":
+		// ~/Library/Application Support
+		base, err = os.UserConfigDir()
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			var home string
+			home, err = os.UserHomeDir()
+			base = filepath.Join(home, ".local", "share")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, strings.TrimSuffix(filepath.Base(exe), filepath.Ext(exe))), nil
+}
+
+// userLinkPath returns where the link to the executable installed for the user is put: Config.UserLinkPath, or
+// ~/.local/bin on Unix. There is none by default on Windows.
+func userLinkPath(conf *Config, exe string) string {
+	if conf.UserLinkPath != "" {
+		return conf.UserLinkPath
+	}
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "bin", filepath.Base(exe))
+}
+
+// installForUser install newVer for the user only, as exe is in a directory that is not writable: it is applied on a
+// copy of exe in the user install directory, then the user link is pointed at it
+func (u *Updater) installForUser(ctx context.Context, conf *Config, from string, newVer *Version, exe string) error {
+	dir, err := userInstallDir(conf, exe)
+	if err != nil {
+		return fmt.Errorf("%w: no user directory to install to: %v", ErrNeedsElevation, err)
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, filepath.Base(exe))
+	if err = copyFile(exe, dest, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	logInfo("%s is not writable, installing the update in %s.\n", filepath.Dir(exe), dir)
+	if err = u.install(ctx, conf, from, newVer, dest); err != nil {
+		return err
+	}
+
+	if link := userLinkPath(conf, exe); link != "" {
+		if err = replaceShim(u.executable, link); err != nil {
+			logError("Unable to point %s at %s: %v\n", link, u.executable, err)
+		}
+	}
+	return nil
+}
+
+// replaceShim point link at target, with a batch file forwarding the arguments if link is a .cmd or .bat file,
+// a symlink otherwise
+func replaceShim(target, link string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(link)) {
+	case ".cmd", ".bat":
+		tmp := filepath.Join(filepath.Dir(link), fmt.Sprintf(".%s.new", filepath.Base(link)))
+		if err := os.WriteFile(tmp, []byte(fmt.Sprintf("@\"%s\" %%*\r\n", target)), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, link); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	default:
+		return replaceSymlink(target, link)
+	}
+}
@@ -0,0 +1,101 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticSource is a Source serving newFile signed with key
+type staticSource struct {
+	key  ed25519.PrivateKey
+	gets int // number of downloads
+}
+
+func (s *staticSource) Get(*Version) (io.ReadCloser, int64, error) {
+	s.gets++
+	return io.NopCloser(bytes.NewReader(newFile)), int64(len(newFile)), nil
+}
+
+func (s *staticSource) GetSignature() ([]byte, error) {
+	return ed25519.Sign(s.key, newFile), nil
+}
+
+func (s *staticSource) LatestVersion() (*Version, error) {
+	return &Version{Number: "1.1.0"}, nil
+}
+
+func TestUserInstallDir(t *testing.T) {
+	dir, err := userInstallDir(&Config{UserInstallDir: "/opt/mine"}, "/usr/bin/myapp")
+	assert.Nil(t, err)
+	assert.Equal(t, "/opt/mine", dir)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	t.Setenv("XDG_DATA_HOME", "/home/me/data")
+	dir, err = userInstallDir(&Config{}, "/usr/bin/myapp")
+	assert.Nil(t, err)
+	assert.Equal(t, "/home/me/data/myapp", dir)
+}
+
+func TestReplaceShim(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app", "myapp.exe")
+
+	shim := filepath.Join(dir, "bin", "myapp.cmd")
+	assert.Nil(t, replaceShim(target, shim))
+	b, err := os.ReadFile(shim)
+	assert.Nil(t, err)
+	assert.Equal(t, "@\""+target+"\" %*\r\n", string(b))
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	link := filepath.Join(dir, "bin", "myapp")
+	assert.Nil(t, replaceShim(target, link))
+	resolved, err := filepath.EvalSymlinks(filepath.Dir(link))
+	assert.Nil(t, err)
+	dest, err := os.Readlink(link)
+	assert.Nil(t, err)
+	assert.Equal(t, target, filepath.Join(resolved, dest))
+}
+
+func TestInstallForUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "system", "myapp")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(exe), 0755))
+	writeOldFile(exe, t)
+
+	conf := &Config{
+		Source:         &staticSource{key: priv},
+		PublicKey:      pub,
+		UserInstall:    true,
+		UserInstallDir: filepath.Join(dir, "user", "myapp"),
+		UserLinkPath:   filepath.Join(dir, "user", "bin", "myapp"),
+	}
+	u := &Updater{conf: conf}
+	err = u.installForUser(context.Background(), conf, "1.0.0", &Version{Number: "1.1.0"}, exe)
+	assert.Nil(t, err)
+
+	// the system executable is left alone, the link leads to the update
+	b, err := os.ReadFile(exe)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, b)
+	assert.Equal(t, filepath.Join(conf.UserInstallDir, "myapp"), u.executable)
+	validateUpdate(u.executable, nil, t)
+	validateUpdate(conf.UserLinkPath, nil, t)
+}
@@ -3,53 +3,95 @@ package selfupdate
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
-	"encoding/asn1"
 	"errors"
-	"math/big"
+	"fmt"
+	"io"
+
+	"github.com/Lamdt03/selfupdate/verify"
 )
 
-// Verifier defines an interface for verfiying an update's signature with a public key.
-type Verifier interface {
-	VerifySignature(checksum, signature []byte, h crypto.Hash, publicKey crypto.PublicKey) error
+// Verifier defines an interface for verifying an update's signature.
+//
+// Deprecated: use verify.Verifier.
+type Verifier = verify.Verifier
+
+// verifyFn adapt a function to the Verifier interface
+type verifyFn = verify.Func
+
+// NewVerifier returns a Verifier for publicKey, which can be an ed25519.PublicKey, a *rsa.PublicKey or
+// a *ecdsa.PublicKey. h is the hash function used by RSA and ECDSA signatures.
+//
+// Deprecated: use verify.New.
+func NewVerifier(publicKey crypto.PublicKey, h crypto.Hash) (Verifier, error) {
+	return verify.New(publicKey, h)
+}
+
+// NewED25519Verifier returns a Verifier that uses the ed25519 algorithm to verify updates.
+//
+// Deprecated: use verify.NewED25519.
+func NewED25519Verifier(publicKey ed25519.PublicKey) Verifier {
+	return verify.NewED25519(publicKey)
+}
+
+// NewThresholdVerifier returns a Verifier that require valid ed25519 signatures from at least threshold of
+// publicKeys.
+//
+// Deprecated: use verify.NewThreshold.
+func NewThresholdVerifier(threshold int, publicKeys ...ed25519.PublicKey) (Verifier, error) {
+	return verify.NewThreshold(threshold, publicKeys...)
 }
 
-type verifyFn func([]byte, []byte, crypto.Hash, crypto.PublicKey) error
+// keyVerifier is a Verifier verifying with the public key and hash function set in Options, as the Verifiers
+// returned by NewRSAVerifier and NewECDSAVerifier did before Verifiers held their key
+type keyVerifier struct {
+	algorithm string
+	bind      func(publicKey crypto.PublicKey, h crypto.Hash) (Verifier, error)
+}
 
-func (fn verifyFn) VerifySignature(checksum []byte, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
-	return fn(checksum, signature, hash, publicKey)
+// VerifySignature fail, as the key is only known once bound to the public key of Options
+func (v *keyVerifier) VerifySignature(payload io.Reader, signature []byte) error {
+	return fmt.Errorf("no %s public key to verify signature with", v.algorithm)
 }
 
-// NewRSAVerifier returns a Verifier that uses the RSA algorithm to verify updates.
+// NewRSAVerifier returns a Verifier that uses the RSA algorithm to verify updates with Options.PublicKey.
+//
+// Deprecated: use verify.NewRSA, which holds the public key, or verify.New.
 func NewRSAVerifier() Verifier {
-	return verifyFn(func(checksum, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
+	return &keyVerifier{algorithm: "RSA", bind: func(publicKey crypto.PublicKey, h crypto.Hash) (Verifier, error) {
 		key, ok := publicKey.(*rsa.PublicKey)
 		if !ok {
-			return errors.New("not a valid RSA public key")
+			return nil, errors.New("not a valid RSA public key")
 		}
-		return rsa.VerifyPKCS1v15(key, hash, checksum, signature)
-	})
+		return verify.NewRSA(key, h), nil
+	}}
 }
 
-type rsDER struct {
-	R *big.Int
-	S *big.Int
-}
-
-// NewECDSAVerifier returns a Verifier that uses the ECDSA algorithm to verify updates.
+// NewECDSAVerifier returns a Verifier that uses the ECDSA algorithm to verify updates with Options.PublicKey.
+//
+// Deprecated: use verify.NewECDSA, which holds the public key, or verify.New.
 func NewECDSAVerifier() Verifier {
-	return verifyFn(func(checksum, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
+	return &keyVerifier{algorithm: "ECDSA", bind: func(publicKey crypto.PublicKey, h crypto.Hash) (Verifier, error) {
 		key, ok := publicKey.(*ecdsa.PublicKey)
 		if !ok {
-			return errors.New("not a valid ECDSA public key")
-		}
-		var rs rsDER
-		if _, err := asn1.Unmarshal(signature, &rs); err != nil {
-			return err
-		}
-		if !ecdsa.Verify(key, checksum, rs.R, rs.S) {
-			return errors.New("failed to verify ecsda signature")
+			return nil, errors.New("not a valid ECDSA public key")
 		}
-		return nil
-	})
+		return verify.NewECDSA(key, h), nil
+	}}
+}
+
+// NewRSAKeyVerifier returns a Verifier that uses the RSA PKCS #1 v1.5 algorithm over the h digest to verify
+// updates.
+//
+// Deprecated: use verify.NewRSA.
+func NewRSAKeyVerifier(publicKey *rsa.PublicKey, h crypto.Hash) Verifier {
+	return verify.NewRSA(publicKey, h)
+}
+
+// NewECDSAKeyVerifier returns a Verifier that uses the ECDSA algorithm over the h digest to verify updates.
+//
+// Deprecated: use verify.NewECDSA.
+func NewECDSAKeyVerifier(publicKey *ecdsa.PublicKey, h crypto.Hash) Verifier {
+	return verify.NewECDSA(publicKey, h)
 }
@@ -0,0 +1,191 @@
+// Package verify provides the Verifiers checking the signature of an update before it is applied.
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Verifier defines an interface for verifying an update's signature. The Verifier holds the key material, so
+// ed25519, RSA, ECDSA or custom HSM-backed verifiers can be swapped without changing the Source.
+type Verifier interface {
+	VerifySignature(payload io.Reader, signature []byte) error
+}
+
+// Func is an adapter to use an ordinary function as a Verifier
+type Func func(payload io.Reader, signature []byte) error
+
+// VerifySignature will call fn to satisfy a Verifier interface
+func (fn Func) VerifySignature(payload io.Reader, signature []byte) error {
+	return fn(payload, signature)
+}
+
+// New returns a Verifier for publicKey, which can be an ed25519.PublicKey, a *rsa.PublicKey or
+// a *ecdsa.PublicKey. h is the hash function used by RSA and ECDSA signatures.
+func New(publicKey crypto.PublicKey, h crypto.Hash) (Verifier, error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return NewED25519(key), nil
+	case *rsa.PublicKey:
+		return NewRSA(key, h), nil
+	case *ecdsa.PublicKey:
+		return NewECDSA(key, h), nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// ReadMessage returns the whole payload, failing if limit is positive and the payload is larger. The ed25519
+// verifiers signing the whole update have to hold it in memory, as ed25519 can't verify a stream.
+func ReadMessage(payload io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(payload)
+	}
+	message, err := io.ReadAll(io.LimitReader(payload, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(message)) > limit {
+		return nil, fmt.Errorf("update larger than %d bytes can't be verified with an ed25519 signature of the whole update, sign its digest instead", limit)
+	}
+	return message, nil
+}
+
+// NewED25519 returns a Verifier that uses the ed25519 algorithm to verify updates. The update is held in memory,
+// as the signature is over the whole update. Use NewED25519Limit to bound the memory used, or NewED25519Digest to
+// verify updates in constant memory.
+func NewED25519(publicKey ed25519.PublicKey) Verifier {
+	return NewED25519Limit(publicKey, 0)
+}
+
+// NewED25519Limit is NewED25519, refusing updates larger than limit bytes rather than holding them in memory. The
+// size isn't limited if limit is 0.
+func NewED25519Limit(publicKey ed25519.PublicKey, limit int64) Verifier {
+	return Func(func(payload io.Reader, signature []byte) error {
+		if len(publicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("ed25519 public key must be %v bytes long and was %v", ed25519.PublicKeySize, len(publicKey))
+		}
+		if len(signature) != ed25519.SignatureSize {
+			return fmt.Errorf("ed25519 signature must be %v bytes long and was %v", ed25519.SignatureSize, len(signature))
+		}
+		message, err := ReadMessage(payload, limit)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(publicKey, message, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	})
+}
+
+// NewED25519Digest returns a Verifier that uses the ed25519 algorithm over the h digest of updates, as signed by
+// "selfupdatectl sign --digest". The update is hashed as it is read, so it is verified in constant memory.
+func NewED25519Digest(publicKey ed25519.PublicKey, h crypto.Hash) Verifier {
+	return Func(func(payload io.Reader, signature []byte) error {
+		if len(publicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("ed25519 public key must be %v bytes long and was %v", ed25519.PublicKeySize, len(publicKey))
+		}
+		if len(signature) != ed25519.SignatureSize {
+			return fmt.Errorf("ed25519 signature must be %v bytes long and was %v", ed25519.SignatureSize, len(signature))
+		}
+		checksum, err := digest(h, payload)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(publicKey, checksum, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	})
+}
+
+// NewThreshold returns a Verifier that require valid ed25519 signatures from at least threshold of
+// publicKeys, so that a single compromised release key can't sign an update on its own. The signature is the
+// concatenation of the 64 bytes signatures of each signer, in any order. As with NewED25519, the update is held in
+// memory.
+func NewThreshold(threshold int, publicKeys ...ed25519.PublicKey) (Verifier, error) {
+	if threshold < 1 || threshold > len(publicKeys) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d and was %d", len(publicKeys), threshold)
+	}
+	// a key listed twice would count twice toward the threshold
+	seen := make(map[string]bool, len(publicKeys))
+	for _, key := range publicKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 public key must be %v bytes long and was %v", ed25519.PublicKeySize, len(key))
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("duplicate ed25519 public key %x", []byte(key))
+		}
+		seen[string(key)] = true
+	}
+
+	return Func(func(payload io.Reader, signature []byte) error {
+		if len(signature) == 0 || len(signature)%ed25519.SignatureSize != 0 {
+			return fmt.Errorf("ed25519 signatures must be a multiple of %v bytes long and was %v", ed25519.SignatureSize, len(signature))
+		}
+		message, err := ReadMessage(payload, 0)
+		if err != nil {
+			return err
+		}
+
+		// every key count only once, whatever the number of signatures it made
+		signed := make([]bool, len(publicKeys))
+		valid := 0
+		for ; len(signature) > 0; signature = signature[ed25519.SignatureSize:] {
+			for i, key := range publicKeys {
+				if !signed[i] && ed25519.Verify(key, message, signature[:ed25519.SignatureSize]) {
+					signed[i] = true
+					valid++
+					break
+				}
+			}
+		}
+		if valid < threshold {
+			return fmt.Errorf("only %d valid ed25519 signatures, %d required", valid, threshold)
+		}
+		return nil
+	}), nil
+}
+
+// NewRSA returns a Verifier that uses the RSA PKCS #1 v1.5 algorithm over the h digest to verify updates.
+func NewRSA(publicKey *rsa.PublicKey, h crypto.Hash) Verifier {
+	return Func(func(payload io.Reader, signature []byte) error {
+		checksum, err := digest(h, payload)
+		if err != nil {
+			return err
+		}
+		return rsa.VerifyPKCS1v15(publicKey, h, checksum, signature)
+	})
+}
+
+// NewECDSA returns a Verifier that uses the ECDSA algorithm over the h digest to verify updates.
+// The signature is expected to be ASN.1 DER encoded.
+func NewECDSA(publicKey *ecdsa.PublicKey, h crypto.Hash) Verifier {
+	return Func(func(payload io.Reader, signature []byte) error {
+		checksum, err := digest(h, payload)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(publicKey, checksum, signature) {
+			return errors.New("failed to verify ecsda signature")
+		}
+		return nil
+	})
+}
+
+// digest returns the h digest of payload
+func digest(h crypto.Hash, payload io.Reader) ([]byte, error) {
+	if !h.Available() {
+		return nil, errors.New("requested hash function not available")
+	}
+	hash := h.New()
+	if _, err := io.Copy(hash, payload); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	oldFile = []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	newFile = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+)
+
+func TestThreshold(t *testing.T) {
+	var pubs []ed25519.PublicKey
+	var privs []ed25519.PrivateKey
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		assert.Nil(t, err)
+		pubs = append(pubs, pub)
+		privs = append(privs, priv)
+	}
+	_, rogue, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	v, err := NewThreshold(2, pubs...)
+	assert.Nil(t, err)
+
+	sign := func(keys ...ed25519.PrivateKey) []byte {
+		var signature []byte
+		for _, key := range keys {
+			signature = append(signature, ed25519.Sign(key, newFile)...)
+		}
+		return signature
+	}
+
+	assert.Nil(t, v.VerifySignature(bytes.NewReader(newFile), sign(privs[0], privs[2])))
+	assert.Nil(t, v.VerifySignature(bytes.NewReader(newFile), sign(rogue, privs[2], privs[1])))
+	assert.NotNil(t, v.VerifySignature(bytes.NewReader(newFile), sign(privs[1])))
+	assert.NotNil(t, v.VerifySignature(bytes.NewReader(newFile), sign(privs[1], privs[1])))
+	assert.NotNil(t, v.VerifySignature(bytes.NewReader(newFile), sign(privs[1], rogue)))
+	assert.NotNil(t, v.VerifySignature(bytes.NewReader(oldFile), sign(privs[0], privs[1])))
+	assert.NotNil(t, v.VerifySignature(bytes.NewReader(newFile), sign(privs[0], privs[1])[1:]))
+
+	_, err = NewThreshold(4, pubs...)
+	assert.NotNil(t, err)
+	_, err = NewThreshold(0, pubs...)
+	assert.NotNil(t, err)
+	_, err = NewThreshold(1, pubs[0][:16])
+	assert.NotNil(t, err)
+
+	// the same key listed twice must not be able to meet the threshold alone
+	_, err = NewThreshold(2, pubs[0], pubs[1], append(ed25519.PublicKey(nil), pubs[0]...))
+	assert.NotNil(t, err)
+}
+
+// zeroReader is an endless stream of zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestED25519DigestConstantMemory(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	const size = 64 << 20
+	h := sha256.New()
+	_, err = io.Copy(h, io.LimitReader(zeroReader{}, size))
+	assert.Nil(t, err)
+	signature := ed25519.Sign(priv, h.Sum(nil))
+
+	v := NewED25519Digest(pub, crypto.SHA256)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	assert.Nil(t, v.VerifySignature(io.LimitReader(zeroReader{}, size), signature))
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	assert.NotNil(t, v.VerifySignature(io.LimitReader(zeroReader{}, size-1), signature))
+	assert.NotNil(t, NewED25519(pub).VerifySignature(io.LimitReader(zeroReader{}, size), signature))
+}
+
+func TestReadMessageLimit(t *testing.T) {
+	limit := int64(len(newFile))
+	message, err := ReadMessage(bytes.NewReader(newFile), limit)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, message)
+
+	_, err = ReadMessage(bytes.NewReader(append(newFile, 0)), limit)
+	assert.NotNil(t, err)
+
+	message, err = ReadMessage(bytes.NewReader(append(newFile, 0)), 0)
+	assert.Nil(t, err)
+	assert.Len(t, message, len(newFile)+1)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	big := append(newFile, newFile...)
+	assert.NotNil(t, NewED25519Limit(pub, limit).VerifySignature(bytes.NewReader(big), ed25519.Sign(priv, big)))
+	assert.Nil(t, NewED25519(pub).VerifySignature(bytes.NewReader(big), ed25519.Sign(priv, big)))
+}
@@ -0,0 +1,36 @@
+package selfupdate
+
+import "time"
+
+var (
+	// wakePeriod is how often the wall clock is sampled to detect the system resuming from sleep
+	wakePeriod = 30 * time.Second
+	// wakeSlack is how late a sample can be before it is considered the system was asleep
+	wakeSlack = 30 * time.Second
+)
+
+// watchWake notify the scheduler of updater every time the system resumes from sleep. There is no portable
+// notification of a resume, so the wall clock is polled every wakePeriod.
+func watchWake(updater *Updater) {
+	ticker := time.NewTicker(wakePeriod)
+	defer ticker.Stop()
+	detectWake(ticker.C, time.Now, wakePeriod+wakeSlack, updater.resumed)
+}
+
+// detectWake send to wake every time the wall clock moved forward by more than late between two ticks. Timers
+// don't fire while the system sleeps and, depending on the OS, the monotonic clock doesn't even advance, so a
+// jump of the wall clock is how a process see that the system was suspended, whatever the OS.
+func detectWake(ticks <-chan time.Time, now func() time.Time, late time.Duration, wake chan<- struct{}) {
+	last := now().Round(0) // only the wall clock keeps counting while asleep
+	for range ticks {
+		current := now().Round(0)
+		if current.Sub(last) > late {
+			logInfo("System resumed after %s asleep.\n", current.Sub(last).Round(time.Second))
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+		last = current
+	}
+}
@@ -0,0 +1,73 @@
+package selfupdate
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectWake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// read by the detector goroutine while the test advances it
+	var now atomic.Int64
+	now.Store(start.UnixNano())
+	ticks := make(chan time.Time)
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		detectWake(ticks, func() time.Time { return time.Unix(0, now.Load()).UTC() }, time.Minute, wake)
+		close(done)
+	}()
+
+	tick := func(elapsed time.Duration) bool {
+		at := time.Unix(0, now.Add(int64(elapsed))).UTC()
+		ticks <- at
+		ticks <- at // the second tick is only received once the first one is processed
+		select {
+		case <-wake:
+			return true
+		default:
+			return false
+		}
+	}
+
+	assert.False(t, tick(30*time.Second))
+	assert.False(t, tick(50*time.Second))
+	assert.True(t, tick(8*time.Hour))
+	assert.False(t, tick(30*time.Second))
+
+	close(ticks)
+	<-done
+}
+
+func TestWaitScheduleResumed(t *testing.T) {
+	u := &Updater{
+		conf:       &Config{Schedule: Schedule{Interval: time.Hour, OnResume: true}},
+		reschedule: make(chan struct{}, 1),
+		resumed:    make(chan struct{}, 1),
+	}
+
+	// the interval elapsed while asleep
+	result := make(chan bool)
+	go func() { result <- waitSchedule(u, -time.Second) }()
+	u.resumed <- struct{}{}
+	select {
+	case r := <-result:
+		assert.True(t, r)
+	case <-time.After(5 * time.Second):
+		t.Fatal("check not triggered after resume")
+	}
+
+	// the remaining of the interval is waited out
+	go func() { result <- waitSchedule(u, time.Hour) }()
+	u.resumed <- struct{}{}
+	select {
+	case <-result:
+		t.Fatal("check triggered before the end of the interval")
+	case <-time.After(50 * time.Millisecond):
+	}
+	u.reschedule <- struct{}{}
+	assert.False(t, <-result)
+}
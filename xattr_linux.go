@@ -0,0 +1,23 @@
+package selfupdate
+
+import (
+	"errors"
+	"syscall"
+)
+
+// copyXattrs set the extended attributes of src on dst, including its SELinux context and file capabilities
+func copyXattrs(src, dst string) error {
+	x := &xattrCopier{
+		list: syscall.Listxattr,
+		get:  syscall.Getxattr,
+		set: func(path, name string, value []byte) error {
+			return syscall.Setxattr(path, name, value, 0)
+		},
+	}
+	err := x.copy(src, dst)
+	if errors.Is(err, syscall.ENOTSUP) {
+		// the file system doesn't support extended attributes
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package selfupdate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPreservesOwnerAndXattrs(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "myapp")
+	writeOldFile(target, t)
+	if err := syscall.Setxattr(target, "user.selfupdate", []byte("kept"), 0); err != nil {
+		t.Skipf("extended attributes not supported: %v", err)
+	}
+	owned := os.Geteuid() == 0
+	if owned {
+		assert.Nil(t, os.Chown(target, 1234, 5678))
+	}
+
+	err := Apply(bytes.NewReader(newFile), Options{TargetPath: target})
+	validateUpdate(target, err, t)
+
+	value := make([]byte, 16)
+	n, err := syscall.Getxattr(target, "user.selfupdate", value)
+	assert.Nil(t, err)
+	assert.Equal(t, "kept", string(value[:n]))
+	if owned {
+		fi, err := os.Stat(target)
+		assert.Nil(t, err)
+		st := fi.Sys().(*syscall.Stat_t)
+		assert.Equal(t, uint32(1234), st.Uid)
+		assert.Equal(t, uint32(5678), st.Gid)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package selfupdate
+
+// copyXattrs does nothing, extended attributes are not carried over on these systems
+func copyXattrs(_, _ string) error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// YankSource define a Source whose manifest can mark a version as yanked. A yanked version is never offered as
+// an update and a client running it is moved to the latest version, even if that version isn't newer. This is
+// the kill switch of a bad release. Moving to an older version is only allowed when the manifest is signed, as
+// with NewSignedHTTPSource or a MessageSource, otherwise the yanked version is left like any downgrade would be.
+type YankSource interface {
+	Source
+	IsYanked(version string) bool // Report if version was marked as yanked by the last manifest fetched
+}
+
+// signedYankSource define a YankSource telling if the manifest marking versions as yanked had its signature verified
+type signedYankSource interface {
+	yanksSigned() bool
+}
+
+// signedYanks report if the versions yanked by source were announced by a verified manifest
+func signedYanks(source Source) bool {
+	ss, ok := source.(signedYankSource)
+	return ok && ss.yanksSigned()
+}
+
+// yankList is the set of versions pulled by a manifest, given exactly or as semver ranges like "1.4.x" or
+// ">=1.3.0, <1.3.2"
+type yankList struct {
+	versions map[string]bool
+	ranges   []*semver.Constraints
+}
+
+// add pull version, an exact version or a range
+func (y *yankList) add(version string) {
+	version = strings.TrimSpace(version)
+	if y.versions == nil {
+		y.versions = map[string]bool{}
+	}
+	if _, err := semver.NewVersion(version); err != nil {
+		if c, err := semver.NewConstraint(version); err == nil {
+			y.ranges = append(y.ranges, c)
+			return
+		}
+	}
+	y.versions[version] = true
+}
+
+// contains report if version was pulled
+func (y *yankList) contains(version string) bool {
+	if y == nil {
+		return false
+	}
+	version = strings.TrimSpace(version)
+	if y.versions[version] {
+		return true
+	}
+	if len(y.ranges) == 0 {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, c := range y.ranges {
+		if c.Check(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestAppVersion returns the entry of the manifest for the running platform that isn't yanked and is preferred by
+// sel, the first one if sel is nil, and the versions yanked for the running platform. Yanked entries without "os"
+// apply to every platform, so a bad release can be pulled everywhere at once. The entries whose version is
+// pulled by a yanked range are marked yanked too.
+func latestAppVersion(appVersions []appVersion, sel *selector) (*appVersion, *yankList, error) {
+	yanked := &yankList{}
+	for i := range appVersions {
+		a := &appVersions[i]
+		if a.Yanked && (a.OS == "" || forPlatform(a)) {
+			yanked.add(a.Version)
+		}
+	}
+
+	var latest *appVersion
+	for i := range appVersions {
+		a := &appVersions[i]
+		if !forPlatform(a) {
+			continue
+		}
+		if yanked.contains(a.Version) {
+			a.Yanked = true
+		} else if sel.match(a) && (sel.prefer(a, latest) || betterBuild(a, latest)) {
+			latest = a
+		}
+	}
+	if latest == nil {
+		return nil, yanked, fmt.Errorf("no version found")
+	}
+	return latest, yanked, nil
+}
+
+// isYanked report if version was yanked according to source
+func isYanked(source Source, version string) bool {
+	ys, ok := source.(YankSource)
+	return ok && ys.IsYanked(strings.TrimSpace(version))
+}
@@ -0,0 +1,152 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func yankServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, yankManifest())
+	}))
+}
+
+func yankManifest() string {
+	return fmt.Sprintf(`[{"os":"other","version":"9.0.0","download_url":"http://localhost/other"},`+
+		`{"os":%q,"version":"1.2.0","download_url":"http://localhost/1.2.0","yanked":true},`+
+		`{"os":%q,"version":"1.1.0","download_url":"http://localhost/1.1.0"}]`, runtime.GOOS, runtime.GOOS)
+}
+
+// signedManifestServer serves manifest at /manifest with its ed25519 signature, for NewSignedHTTPSource
+func signedManifestServer(t *testing.T, manifest string) (*httptest.Server, Verifier) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest":
+			fmt.Fprint(w, manifest)
+		case "/manifest.ed25519":
+			w.Write(ed25519.Sign(priv, []byte(manifest)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, NewED25519Verifier(pub)
+}
+
+func TestHTTPSourceYanked(t *testing.T) {
+	server := yankServer()
+	defer server.Close()
+
+	source := NewHTTPSource(nil, server.URL).(*HTTPSource)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+	assert.True(t, source.IsYanked("1.2.0"))
+	assert.False(t, source.IsYanked("1.1.0"))
+
+	_, _, err = latestAppVersion([]appVersion{{OS: runtime.GOOS, Version: "1.0.0", Yanked: true}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCheckNowYanked(t *testing.T) {
+	for _, c := range []struct {
+		current string
+		message string
+	}{
+		{"1.0.0", "New version found"},
+		{"1.2.0", "Current version has been withdrawn"},
+		{"1.1.0", ""},
+	} {
+		server, verifier := signedManifestServer(t, yankManifest())
+
+		var asked string
+		u := &Updater{conf: &Config{
+			Current:      &Version{Number: c.current},
+			Source:       NewSignedHTTPSource(nil, server.URL+"/manifest", verifier),
+			VersionStore: &memoryVersionStore{},
+			UpgradeConfirmCallback: func(message string) bool {
+				asked = message
+				return false
+			},
+		}}
+		assert.Nil(t, u.CheckNow())
+		assert.Equal(t, c.message, asked, c.current)
+	}
+
+	// an unsigned manifest can't force a rollback to an older version
+	server := yankServer()
+	defer server.Close()
+	asked := false
+	store := &memoryVersionStore{}
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.2.0"},
+		Source:                 NewHTTPSource(nil, server.URL),
+		VersionStore:           store,
+		UpgradeConfirmCallback: func(string) bool { asked = true; return false },
+	}}
+	assert.ErrorIs(t, u.CheckNow(), ErrDowngrade)
+	assert.False(t, asked)
+	assert.Equal(t, "1.2.0", store.version)
+
+	u.conf.AllowDowngrade = true
+	assert.Nil(t, u.CheckNow())
+	assert.True(t, asked)
+}
+
+func TestCheckNowYankedRecorded(t *testing.T) {
+	server, verifier := signedManifestServer(t, yankManifest())
+	store := NewFileVersionStore(filepath.Join(t.TempDir(), "myapp.version")).(YankedVersionStore)
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.2.0"},
+		Source:                 NewSignedHTTPSource(nil, server.URL+"/manifest", verifier),
+		VersionStore:           store,
+		UpgradeConfirmCallback: func(string) bool { return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	yanked, err := store.YankedVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.2.0"}, yanked)
+
+	// a stale mirror still offering the yanked version can't bring it back
+	assert.ErrorIs(t, checkDowngrade(store, SemVerComparator, "1.2.0"), ErrDowngrade)
+	assert.Nil(t, checkDowngrade(store, SemVerComparator, "1.3.0"))
+}
+
+func TestHTTPSourceKillSwitch(t *testing.T) {
+	server, verifier := signedManifestServer(t, fmt.Sprintf(`[
+			{"version":">=1.3.0, <1.3.2","yanked":true},
+			{"version":"1.2.1","yanked":true},
+			{"os":%[1]q,"version":"1.3.1"},
+			{"os":%[1]q,"version":"1.3.0"},
+			{"os":%[1]q,"version":"1.2.1"},
+			{"os":%[1]q,"version":"1.2.0"}
+		]`, runtime.GOOS))
+
+	source := NewSignedHTTPSource(nil, server.URL+"/manifest", verifier).(*HTTPSource)
+	v, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", v.Number)
+	for version, yanked := range map[string]bool{"1.3.1": true, "1.3.0": true, "1.2.1": true, "1.2.0": false, "1.3.2": false} {
+		assert.Equal(t, yanked, source.IsYanked(version), version)
+	}
+
+	// a client running a pulled version moves back to 1.2.0
+	asked := ""
+	u := &Updater{conf: &Config{
+		Current:                &Version{Number: "1.3.0"},
+		Source:                 source,
+		VersionStore:           &memoryVersionStore{},
+		UpgradeConfirmCallback: func(message string) bool { asked = message; return false },
+	}}
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, "Current version has been withdrawn", asked)
+}